@@ -1,10 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
 	"verification-api/internal/api"
 	"verification-api/internal/config"
 	"verification-api/internal/database"
+	"verification-api/internal/services"
 	"verification-api/pkg/logging"
 
 	"github.com/gin-gonic/gin"
@@ -18,6 +25,18 @@ func main() {
 
 	// Initialize logging
 	logging.InitLogging()
+	logging.SetLevel(config.AppConfig.LogLevel)
+
+	// Log effective configuration (secrets redacted)
+	logging.Infof("Effective configuration:")
+	for _, line := range config.AppConfig.Summary() {
+		logging.Infof("  %s", line)
+	}
+
+	// Load trusted Apple root certificates (built-in + APPLE_ROOT_CERT_PATH / APPLE_ROOT_CERT_PEM)
+	if err := services.LoadAppleRootCertificates(); err != nil {
+		log.Fatal("Failed to load Apple root certificates:", err)
+	}
 
 	// Initialize database
 	logging.Infof("Initializing database connection...")
@@ -26,6 +45,10 @@ func main() {
 		log.Fatal("Failed to initialize database:", err)
 	}
 
+	// Subscription transition events for analytics (no-op unless SUBSCRIPTION_EVENT_SINK is set)
+	services.InitSubscriptionEventSink()
+	services.InitSupersededSubscriptionNotifications()
+
 	// Set Gin mode
 	gin.SetMode(config.AppConfig.Mode)
 	logging.Infof("Gin mode set to: %s", config.AppConfig.Mode)
@@ -40,6 +63,20 @@ func main() {
 	api.SetupRoutes(r)
 	logging.Infof("Routes setup completed")
 
+	// Start scheduled jobs (one instance runs each job via Redis lease)
+	var scheduler *services.Scheduler
+	if config.AppConfig.SchedulerEnabled {
+		redisService, err := services.NewRedisService()
+		if err != nil {
+			logging.Errorf("Scheduler disabled, Redis unavailable: %v", err)
+		} else {
+			services.InitStoreAPILimiters()
+			scheduler = services.NewScheduler(redisService)
+			scheduler.Register(services.NewBindingRetryJob(time.Duration(config.AppConfig.BindingRetryIntervalSeconds) * time.Second))
+			scheduler.Start()
+		}
+	}
+
 	// Start server
 	port := config.AppConfig.Port
 	if port == "" {
@@ -51,8 +88,29 @@ func main() {
 	addr := "0.0.0.0:" + port
 	logging.Infof("Binding to address: %s", addr)
 
-	if err := r.Run(addr); err != nil {
-		logging.Errorf("Failed to start server: %v", err)
-		log.Fatal("Failed to start server:", err)
+	server := &http.Server{Addr: addr, Handler: r}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Errorf("Failed to start server: %v", err)
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	// Graceful shutdown: stop accepting requests, then wait for in-flight requests and jobs
+	<-ctx.Done()
+	logging.Infof("Shutting down...")
+	timeout := time.Duration(config.AppConfig.ShutdownTimeoutSeconds) * time.Second
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logging.Errorf("Server shutdown error: %v", err)
+	}
+	if scheduler != nil {
+		scheduler.Stop(timeout)
 	}
+	api.Shutdown(timeout)
+	logging.Infof("Server stopped")
 }
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+	"time"
+	"verification-api/internal/config"
+	"verification-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDiagnostics returns operational state useful when troubleshooting
+// GET /api/admin/diagnostics
+func GetDiagnostics(c *gin.Context) {
+	redisService, err := services.NewRedisService()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Service unavailable",
+		})
+		return
+	}
+
+	// Brevo daily quota consumption (counted per UTC day across all instances)
+	date := services.EmailQuotaDate(time.Now())
+	sentToday, err := redisService.GetDailyEmailCount(date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get email quota: " + err.Error(),
+		})
+		return
+	}
+
+	brevo := gin.H{
+		"date":       date,
+		"sent_today": sentToday,
+		"daily_cap":  config.AppConfig.BrevoDailyCap,
+	}
+	if dailyCap := int64(config.AppConfig.BrevoDailyCap); dailyCap > 0 {
+		brevo["remaining"] = max(dailyCap-sentToday, 0)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"brevo": brevo,
+		},
+	})
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"verification-api/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReprocessAppStoreNotification re-runs an App Store notification that was already received
+// POST /api/admin/notifications/apple/reprocess?environment=production
+// The body is the original notification body ({"signedPayload": "..."}), the signature is still verified
+// Replay protection is skipped so a recorded notification can be processed again (backfill / reprocess)
+func ReprocessAppStoreNotification(c *gin.Context) {
+	environment := c.DefaultQuery("environment", "production")
+	if environment != "production" && environment != "sandbox" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "environment must be production or sandbox",
+		})
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Failed to read request body",
+		})
+		return
+	}
+
+	logging.Infof("Reprocessing App Store notification - environment: %s, body length: %d", environment, len(body))
+	processAppStoreNotification(environment, c, body, "", notificationProcessOptions{skipReplayCheck: true, inline: true})
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net/http"
+	"verification-api/internal/models"
+	"verification-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateProjectGroupRequest represents create project group request
+type CreateProjectGroupRequest struct {
+	GroupID     string `json:"group_id" binding:"required"`
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+// CreateProjectGroup creates a project group
+// POST /api/admin/project-groups
+// Projects join the group through the group_id field of create/update project
+func CreateProjectGroup(c *gin.Context) {
+	var req CreateProjectGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	group := &models.ProjectGroup{
+		GroupID:     req.GroupID,
+		Name:        req.Name,
+		Description: req.Description,
+	}
+
+	projectService := services.NewProjectService()
+	if err := projectService.CreateProjectGroup(group); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Failed to create project group: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Project group created successfully",
+		"data":    group,
+	})
+}
+
+// GetProjectGroups lists project groups with their member projects
+// GET /api/admin/project-groups
+func GetProjectGroups(c *gin.Context) {
+	projectService := services.NewProjectService()
+	groups, err := projectService.ListProjectGroups()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get project groups: " + err.Error(),
+		})
+		return
+	}
+
+	data := make([]gin.H, 0, len(groups))
+	for _, group := range groups {
+		projectIDs, err := projectService.GetGroupProjects(group.GroupID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to get project groups: " + err.Error(),
+			})
+			return
+		}
+		data = append(data, gin.H{
+			"group_id":    group.GroupID,
+			"name":        group.Name,
+			"description": group.Description,
+			"projects":    projectIDs,
+			"created_at":  group.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    data,
+	})
+}
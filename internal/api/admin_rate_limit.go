@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"verification-api/internal/middleware"
+	"verification-api/internal/services"
+	"verification-api/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClearVerificationRateLimit lets a rate-limited email request a new verification code immediately
+// DELETE /api/admin/rate-limit?project_id=xxx&email=xxx
+// The authenticated operator (ADMIN_API_KEYS entry name) and client IP are logged for auditing
+func ClearVerificationRateLimit(c *gin.Context) {
+	projectID := c.Query("project_id")
+	email := c.Query("email")
+	if projectID == "" || email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "project_id and email are required",
+		})
+		return
+	}
+
+	redisService, err := services.NewRedisService()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Service unavailable",
+		})
+		return
+	}
+
+	cleared, err := redisService.ClearRateLimit(projectID, email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to clear rate limit: " + err.Error(),
+		})
+		return
+	}
+
+	// Never trust a client-supplied identity; AdminAuthMiddleware sets the operator of the matching key
+	operator := c.GetString(middleware.AdminUserKey)
+	if operator == "" {
+		operator = "unknown"
+	}
+	logging.Infof("Verification rate limit cleared - project: %s, email: %s, cleared: %v, by: %s (ip: %s)",
+		projectID, email, cleared, operator, c.ClientIP())
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"cleared": cleared,
+	})
+}
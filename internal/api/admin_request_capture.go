@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"verification-api/internal/database"
+	"verification-api/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListRequestCaptures lists the sampled request/response captures of a project, newest first
+// GET /api/admin/projects/:id/captures?limit=50&offset=0
+// Captures are only recorded for projects with debug_capture enabled and expire after REQUEST_CAPTURE_TTL_SECONDS
+func ListRequestCaptures(c *gin.Context) {
+	projectID := c.Param("id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Project ID is required",
+		})
+		return
+	}
+
+	limit, offset := response.ParsePagination(c)
+
+	captures, total, err := database.ListRequestCaptures(projectID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to list request captures: " + err.Error(),
+		})
+		return
+	}
+
+	response.PaginatedJSON(c, captures, limit, offset, total)
+}
+
+// GetRequestCapture returns one request/response capture of a project
+// GET /api/admin/projects/:id/captures/:capture_id
+func GetRequestCapture(c *gin.Context) {
+	projectID := c.Param("id")
+	captureID := c.Param("capture_id")
+
+	capture, err := database.GetRequestCapture(projectID, captureID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get request capture: " + err.Error(),
+		})
+		return
+	}
+	if capture == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Request capture not found or expired",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    capture,
+	})
+}
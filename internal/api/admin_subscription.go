@@ -0,0 +1,192 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"verification-api/internal/database"
+	"verification-api/internal/models"
+	"verification-api/internal/response"
+	"verification-api/internal/services"
+	"verification-api/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// DeduplicateSubscriptions merges duplicate subscriptions (same project_id + original_transaction_id)
+// POST /api/admin/subscriptions/deduplicate?dry_run=false
+// Defaults to dry-run mode, which only reports what would be merged
+func DeduplicateSubscriptions(c *gin.Context) {
+	dryRun := c.DefaultQuery("dry_run", "true") != "false"
+
+	results, err := database.DeduplicateSubscriptions(dryRun)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to deduplicate subscriptions: " + err.Error(),
+			"data":    results,
+		})
+		return
+	}
+
+	removed := 0
+	for _, result := range results {
+		removed += len(result.RemovedIDs)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"dry_run": dryRun,
+		"groups":  len(results),
+		"removed": removed,
+		"data":    results,
+	})
+}
+
+// ListProjectSubscriptions lists subscriptions of a project by product and status
+// GET /api/admin/projects/:id/subscriptions?product_id=xxx&status=active&limit=50&offset=0
+func ListProjectSubscriptions(c *gin.Context) {
+	projectID := c.Param("id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Project ID is required",
+		})
+		return
+	}
+
+	limit, offset := response.ParsePagination(c)
+
+	subscriptions, total, err := database.ListProjectSubscriptions(projectID, c.Query("product_id"), c.Query("status"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to list subscriptions: " + err.Error(),
+		})
+		return
+	}
+
+	response.PaginatedJSON(c, toSubscriptionHistoryItems(subscriptions), limit, offset, total)
+}
+
+// DeleteSubscription deletes a subscription and its related transactions
+// DELETE /api/admin/subscriptions/:id?hard=true
+// Soft-deletes by default; hard=true permanently erases the rows (GDPR erasure)
+func DeleteSubscription(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid subscription ID",
+		})
+		return
+	}
+
+	hardDelete := c.Query("hard") == "true"
+
+	result, err := database.DeleteSubscription(uint(id), hardDelete)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "Subscription not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to delete subscription: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Subscription deleted successfully",
+		"data":    result,
+	})
+}
+
+// ListFlaggedUsers lists users flagged as suspected fraud for a project (newest first)
+// GET /api/admin/projects/:id/flagged-users?limit=50&offset=0
+// Users are flagged when their distinct subscriptions exceed FRAUD_MAX_SUBSCRIPTIONS_PER_USER
+func ListFlaggedUsers(c *gin.Context) {
+	projectID := c.Param("id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Project ID is required",
+		})
+		return
+	}
+
+	limit, offset := response.ParsePagination(c)
+
+	users, total, err := database.ListFlaggedUsers(projectID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to list flagged users: " + err.Error(),
+		})
+		return
+	}
+
+	response.PaginatedJSON(c, users, limit, offset, total)
+}
+
+// RefreshSubscription force-refreshes a single subscription from the store (e.g. after a dispute)
+// POST /api/admin/subscriptions/:id/refresh
+// Uses the stored original_transaction_id (iOS) or purchase token (Android) and returns the refreshed record
+func RefreshSubscription(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid subscription ID",
+		})
+		return
+	}
+
+	stored, err := database.GetSubscriptionByID(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "Subscription not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get subscription: " + err.Error(),
+		})
+		return
+	}
+
+	verificationService := services.NewSubscriptionVerificationService()
+	subscription, err := verificationService.RefreshSubscription(stored)
+	if err != nil {
+		logging.Errorf("Failed to refresh subscription - id: %d, project: %s, error: %v", id, stored.ProjectID, err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"success": false,
+			"message": "Failed to refresh subscription: " + err.Error(),
+		})
+		return
+	}
+
+	// Notify App Backend like a client-initiated sync
+	if subscription.StateChanged {
+		if project, err := services.NewProjectService().GetProjectForAdmin(subscription.ProjectID); err == nil && project.HasWebhook() {
+			webhookNotifier := services.NewWebhookNotifier()
+			webhookNotifier.NotifyAppBackendAsync(services.WebhookEndpointFromProject(project), subscription)
+		}
+	}
+
+	// subscription is the stored record after the merge (CreateOrUpdateSubscription)
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"state_changed": subscription.StateChanged,
+		"data":          toSubscriptionHistoryItems([]models.Subscription{*subscription})[0],
+	})
+}
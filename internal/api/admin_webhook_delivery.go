@@ -0,0 +1,102 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"verification-api/internal/database"
+	"verification-api/internal/response"
+	"verification-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ListWebhookDeliveries lists the stored webhook delivery outcomes of a project, newest first
+// GET /api/admin/projects/:id/webhooks/deliveries?succeeded=false&limit=50&offset=0
+// succeeded=false lists the deliveries that failed after all retries
+func ListWebhookDeliveries(c *gin.Context) {
+	projectID := c.Param("id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Project ID is required",
+		})
+		return
+	}
+
+	var succeeded *bool
+	if value := c.Query("succeeded"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "succeeded must be true or false",
+			})
+			return
+		}
+		succeeded = &parsed
+	}
+
+	limit, offset := response.ParsePagination(c)
+
+	deliveries, total, err := database.ListWebhookDeliveries(projectID, succeeded, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to list webhook deliveries: " + err.Error(),
+		})
+		return
+	}
+
+	response.PaginatedJSON(c, deliveries, limit, offset, total)
+}
+
+// RedeliverWebhook sends the stored payload of a webhook delivery again
+// POST /api/admin/webhooks/:id/redeliver
+// One synchronous attempt with the project's current webhook config; the outcome is stored as a new delivery
+func RedeliverWebhook(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid webhook delivery ID",
+		})
+		return
+	}
+
+	delivery, err := database.GetWebhookDeliveryByID(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "Webhook delivery not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get webhook delivery: " + err.Error(),
+		})
+		return
+	}
+
+	redelivery, err := services.NewWebhookNotifier().RedeliverWebhook(delivery)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Failed to redeliver webhook: " + err.Error(),
+		})
+		return
+	}
+
+	message := "Webhook redelivered successfully"
+	if !redelivery.Succeeded {
+		message = "Webhook redelivery failed"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": redelivery.Succeeded,
+		"message": message,
+		"data":    redelivery,
+	})
+}
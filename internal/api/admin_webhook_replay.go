@@ -0,0 +1,122 @@
+package api
+
+import (
+	"net/http"
+	"time"
+	"verification-api/internal/database"
+	"verification-api/internal/services"
+	"verification-api/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxWebhookReplayDeliveries caps the failed deliveries replayed by one request
+const maxWebhookReplayDeliveries = 10000
+
+// ReplayProjectWebhooks re-delivers the webhooks that failed in a time window (e.g. after an App Backend outage)
+// POST /api/admin/projects/:id/webhooks/replay?from=2025-01-01T10:00:00Z&to=2025-01-01T12:00:00Z&dry_run=false
+// Every event whose delivery failed in [from, to) and never succeeded since is sent again with its stored payload,
+// once per event_id and in the original order; to defaults to now; with dry_run=true the events are listed without sending
+func ReplayProjectWebhooks(c *gin.Context) {
+	projectID := c.Param("id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Project ID is required",
+		})
+		return
+	}
+
+	from, err := time.Parse(time.RFC3339, c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "from is required (RFC 3339, e.g. 2025-01-01T10:00:00Z)",
+		})
+		return
+	}
+	to := time.Now()
+	if value := c.Query("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "to must be RFC 3339, e.g. 2025-01-01T12:00:00Z",
+			})
+			return
+		}
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "from must be before to",
+		})
+		return
+	}
+	dryRun := c.Query("dry_run") == "true"
+
+	projectService := services.NewProjectService()
+	project, err := projectService.GetProjectForAdmin(projectID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Failed to get project: " + err.Error(),
+		})
+		return
+	}
+	if !project.HasWebhook() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Webhook callback URL is not configured for this project",
+		})
+		return
+	}
+
+	// Fetch one more than the cap to detect windows that are too large
+	deliveries, err := database.GetUndeliveredWebhookDeliveries(projectID, from, to, maxWebhookReplayDeliveries+1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get webhook deliveries: " + err.Error(),
+		})
+		return
+	}
+	if len(deliveries) > maxWebhookReplayDeliveries {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Too many failed deliveries in the window, please use a smaller time range",
+		})
+		return
+	}
+	deliveries = services.DedupeReplayDeliveries(deliveries)
+
+	eventIDs := make([]string, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		eventIDs = append(eventIDs, delivery.EventID)
+	}
+	data := gin.H{
+		"from":      from.Format(time.RFC3339),
+		"to":        to.Format(time.RFC3339),
+		"count":     len(deliveries),
+		"event_ids": eventIDs,
+		"dry_run":   dryRun,
+	}
+
+	if dryRun || len(deliveries) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    data,
+		})
+		return
+	}
+
+	logging.Infof("Replaying webhooks - project: %s, from: %s, to: %s, events: %d",
+		projectID, from.Format(time.RFC3339), to.Format(time.RFC3339), len(deliveries))
+	webhookNotifier := services.NewWebhookNotifier()
+	webhookNotifier.ReplayWebhooksAsync(services.WebhookEndpointFromProject(project), deliveries)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": "Webhook replay started",
+		"data":    data,
+	})
+}
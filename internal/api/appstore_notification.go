@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strings"
 	"time"
+	"verification-api/internal/config"
 	"verification-api/internal/database"
 	"verification-api/internal/models"
 	"verification-api/internal/services"
@@ -18,25 +19,30 @@ import (
 var (
 	// Global signature verifier instance
 	signatureVerifier = services.NewSignatureVerifier()
-	// Global replay protection instance
-	replayProtection = services.NewReplayProtection()
+	// Global replay protection instance (initialized in SetupRoutes)
+	replayProtection *services.ReplayProtection
 )
 
+// notificationProcessOptions controls how a notification is processed
+type notificationProcessOptions struct {
+	// skipReplayCheck disables replay protection, only set by admin reprocess / backfill paths
+	// Public webhook handlers always use the zero value, so the bypass cannot be triggered by callers
+	skipReplayCheck bool
+	// inline processes the notification before responding instead of queueing it
+	// Set by admin reprocess so the caller gets the processing result
+	inline bool
+}
+
 // processAppStoreNotification processes App Store notification
 // If body is nil, it will be read from the context
-func processAppStoreNotification(environment string, c *gin.Context, body []byte, signatureHeader string) {
+func processAppStoreNotification(environment string, c *gin.Context, body []byte, signatureHeader string, opts notificationProcessOptions) {
 	startTime := time.Now()
 
 	// Read raw body if not provided
 	var err error
 	if body == nil {
-		body, err = c.GetRawData()
-		if err != nil {
-			logging.Errorf("Failed to read request body: %v", err)
-			c.JSON(http.StatusBadRequest, gin.H{
-				"success": false,
-				"message": "Failed to read request body",
-			})
+		var ok bool
+		if body, ok = readWebhookBody(c); !ok {
 			return
 		}
 	}
@@ -51,19 +57,9 @@ func processAppStoreNotification(environment string, c *gin.Context, body []byte
 		return
 	}
 
-	// Verify signature if present
+	// V2 notifications are signed in-band (signedPayload JWS), the header is not used by Apple
 	if signatureHeader != "" {
-		if err := signatureVerifier.VerifyNotification(body, signatureHeader); err != nil {
-			logging.Errorf("Signature verification failed: %v", err)
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"success": false,
-				"message": "Signature verification failed",
-			})
-			return
-		}
-		logging.Infof("Signature verification passed")
-	} else {
-		logging.Infof("No signature header present, skipping verification")
+		logging.Infof("X-Apple-Notification-Signature header is deprecated for V2 notifications and will be ignored, verifying signedPayload JWS instead")
 	}
 
 	// Parse the wrapper to get signedPayload
@@ -78,6 +74,17 @@ func processAppStoreNotification(environment string, c *gin.Context, body []byte
 	}
 
 	if wrapper.SignedPayload == "" {
+		// Detect legacy V1 notifications (flat JSON with notification_type / unified_receipt)
+		var v1 models.AppStoreNotificationV1
+		if err := json.Unmarshal(body, &v1); err == nil && v1.IsV1() {
+			logging.Errorf("Received App Store Server Notification V1 (notification_type: %s), only V2 is supported", v1.NotificationType)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "App Store Server Notifications V1 is not supported, please switch to Version 2 in App Store Connect",
+			})
+			return
+		}
+
 		logging.Errorf("signedPayload is empty in notification")
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -86,22 +93,39 @@ func processAppStoreNotification(environment string, c *gin.Context, body []byte
 		return
 	}
 
-	// Parse JWT manually to skip signature verification
-	// JWT format: header.payload.signature
-	parts := strings.Split(wrapper.SignedPayload, ".")
-	if len(parts) != 3 {
-		logging.Errorf("Invalid JWT format: expected 3 parts, got %d", len(parts))
-		c.JSON(http.StatusBadRequest, gin.H{
+	// Verify the signedPayload JWS (x5c chain up to Apple Root CA, ES256 signature)
+	claims, err := signatureVerifier.VerifyJWS(wrapper.SignedPayload)
+	unverified := false
+	if err != nil && environment == "sandbox" && config.AppConfig.AppStoreSandboxSkipSignature {
+		// Sandbox testing fallback: decode without verification (never used for production)
+		unverified = true
+		recordUnverifiedNotification("ios", "unknown", environment, "invalid", false)
+		logging.Warnf("Signature verification failed, decoding sandbox notification anyway (APPSTORE_SANDBOX_SKIP_SIGNATURE enabled): %v", err)
+		claims, err = services.DecodeUnverifiedJWS(wrapper.SignedPayload)
+		if err != nil {
+			logging.Errorf("Failed to decode signedPayload: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Failed to decode JWT payload",
+			})
+			return
+		}
+	} else if err != nil {
+		// The project is unknown until the payload is trusted
+		recordUnverifiedNotification("ios", "unknown", environment, "invalid", true)
+		logging.Errorf("Signature verification failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{
 			"success": false,
-			"message": "Invalid JWT format",
+			"message": "Signature verification failed",
 		})
 		return
+	} else {
+		logging.Infof("Signature verification passed")
 	}
 
-	// Decode payload (second part)
-	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	payload, err := json.Marshal(claims)
 	if err != nil {
-		logging.Errorf("Failed to decode JWT payload: %v", err)
+		logging.Errorf("Failed to encode JWT claims: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "Failed to decode JWT payload",
@@ -124,10 +148,35 @@ func processAppStoreNotification(environment string, c *gin.Context, body []byte
 		return
 	}
 
+	// An unverified payload may only touch sandbox subscriptions: the handlers look subscriptions up
+	// by the notification's environment, so a forged payload claiming Production must not get that far
+	if unverified && notification.Data.Environment != "Sandbox" {
+		recordUnverifiedNotification("ios", "unknown", environment, "invalid", true)
+		logging.Errorf("Unverified notification claims environment %q, only Sandbox is accepted without signature verification", notification.Data.Environment)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Signature verification failed",
+		})
+		return
+	}
+
 	// Log parsed notification details
 	logging.Infof("Parsed notification - type: %s, bundle_id: %s, environment: %s, data_version: %s, uuid: %s",
 		notification.NotificationType, notification.Data.BundleID, notification.Data.Environment, notification.DataVersion, notification.NotificationUUID)
 
+	// Validate data version to detect schema drift
+	if !isSupportedDataVersion(notification.DataVersion) {
+		if config.AppConfig.AppStoreStrictDataVersion {
+			logging.Errorf("Unsupported notification data_version: %s (supported: %v), rejecting", notification.DataVersion, config.AppConfig.AppStoreSupportedDataVersions)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Unsupported notification data version: " + notification.DataVersion,
+			})
+			return
+		}
+		logging.Warnf("Unexpected notification data_version: %s (supported: %v), processing anyway", notification.DataVersion, config.AppConfig.AppStoreSupportedDataVersions)
+	}
+
 	// Handle heartbeat
 	if notification.NotificationType == "" {
 		logging.Infof("AppStore heartbeat - environment: %s", environment)
@@ -138,8 +187,10 @@ func processAppStoreNotification(environment string, c *gin.Context, body []byte
 		return
 	}
 
-	// Check for replay attacks
-	if replayProtection.IsReplay(notification.NotificationUUID, notification.SignedDate) {
+	// Check for replay attacks (skipped only for admin reprocessing)
+	if opts.skipReplayCheck {
+		logging.Infof("Replay check skipped for reprocessing - notification_uuid: %s", notification.NotificationUUID)
+	} else if replayProtection.IsReplay(notification.NotificationUUID, notification.SignedDate) {
 		logging.Errorf("Replay attack detected - notification_uuid: %s, signed_date: %d", notification.NotificationUUID, notification.SignedDate)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -148,83 +199,141 @@ func processAppStoreNotification(environment string, c *gin.Context, body []byte
 		return
 	}
 
+	// Respond as soon as the notification is verified, the queue worker does the rest
+	if !opts.inline && notificationQueue != nil {
+		err := enqueueAppStoreNotification(environment, body, payload, &notification)
+		if err == nil {
+			logging.Infof("AppStore notification queued - type: %s, uuid: %s, time: %v",
+				notification.NotificationType, notification.NotificationUUID, time.Since(startTime))
+			c.JSON(http.StatusOK, gin.H{
+				"success": true,
+				"message": "Notification accepted",
+			})
+			return
+		}
+		logging.Errorf("Failed to queue notification, processing inline - uuid: %s, error: %v", notification.NotificationUUID, err)
+	}
+
+	status, response := handleVerifiedAppStoreNotification(environment, &notification, startTime)
+	if status >= http.StatusInternalServerError && !opts.skipReplayCheck {
+		// Apple retries on 5xx; the retry must not be rejected as a replay of this failed attempt
+		replayProtection.Release(notification.NotificationUUID, notification.SignedDate)
+	}
+	c.JSON(status, response)
+}
+
+// handleVerifiedAppStoreNotification processes a notification whose signedPayload was verified and deduplicated
+// Returns the HTTP status and body for Apple; called inline by the webhook or by the notification queue worker
+func handleVerifiedAppStoreNotification(environment string, notification *models.AppStoreNotification, startTime time.Time) (int, gin.H) {
 	// Get project by bundle_id
 	projectService := services.NewProjectService()
 	project, err := projectService.GetProjectByBundleID(notification.Data.BundleID)
 	if err != nil {
 		logging.Errorf("Project not found for bundle_id: %s, error: %v", notification.Data.BundleID, err)
-		c.JSON(http.StatusBadRequest, gin.H{
+		return http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "Project not found for bundle_id: " + notification.Data.BundleID,
-		})
-		return
+		}
 	}
 
 	logging.Infof("Found project: %s (project_id: %s)", project.ProjectName, project.ProjectID)
 
+	// Verify signedTransactionInfo JWS (strict projects reject unverified transactions)
+	if _, err := signatureVerifier.VerifyJWS(notification.Data.SignedTransactionInfo); err != nil {
+		reason := "invalid"
+		if notification.Data.SignedTransactionInfo == "" {
+			reason = "missing"
+		}
+		recordUnverifiedNotification("ios", project.ProjectID, environment, reason, project.RequireWebhookSignature)
+		if project.RequireWebhookSignature {
+			logging.Errorf("signedTransactionInfo verification failed, rejecting (require_webhook_signature enabled): %v", err)
+			return http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "Transaction signature verification failed",
+			}
+		}
+		logging.Warnf("signedTransactionInfo verification failed, processing anyway (require_webhook_signature disabled) - project: %s, environment: %s: %v", project.ProjectID, environment, err)
+	}
+
 	// Parse transaction info from JWT
 	transactionInfo, err := parseTransactionInfo(notification.Data.SignedTransactionInfo)
 	if err != nil {
 		logging.Errorf("Failed to parse transaction info: %v, signed_transaction_info length: %d", err, len(notification.Data.SignedTransactionInfo))
-		c.JSON(http.StatusBadRequest, gin.H{
+		return http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "Failed to parse transaction info",
-		})
-		return
+		}
 	}
 
 	logging.Infof("Parsed transaction info - transaction_id: %s, original_transaction_id: %s, product_id: %s, app_account_token: %s",
 		transactionInfo.TransactionID, transactionInfo.OriginalTransactionID, transactionInfo.ProductID, transactionInfo.AppAccountToken)
 
+	// Parse renewal info (authoritative auto-renew status and expiration intent), optional
+	if notification.Data.SignedRenewalInfo != "" {
+		renewalInfo, err := parseRenewalInfo(notification.Data.SignedRenewalInfo)
+		if err != nil {
+			logging.Warnf("Failed to parse renewal info, using transaction info only: %v", err)
+		} else {
+			transactionInfo.RenewalInfo = renewalInfo
+			logging.Infof("Parsed renewal info - auto_renew_status: %d, expiration_intent: %d, billing_retry: %v",
+				renewalInfo.AutoRenewStatus, renewalInfo.ExpirationIntent, renewalInfo.IsInBillingRetryPeriod)
+		}
+	}
+
 	// Note: appAccountToken is a UUID set by the client during purchase (applicationUserName parameter)
 	// We need to query App Backend to get the actual device_id (user_id) from appAccountToken
 	// If appAccountToken is empty, we cannot determine user_id (should not happen in normal flow)
 
-	// Query device_id from App Backend using appAccountToken
-	if transactionInfo.AppAccountToken != "" && project.WebhookCallbackURL != "" {
-		// Extract base URL from webhook callback URL (e.g., https://api.example.com/webhooks/unionhub -> https://api.example.com)
-		baseURL := extractBaseURL(project.WebhookCallbackURL)
-		if baseURL != "" {
-			deviceID, err := queryDeviceIDFromAppBackend(baseURL, transactionInfo.AppAccountToken)
-			if err != nil {
-				logging.Infof("Failed to query device_id from App Backend: %v, will use appAccountToken (UUID) as user_id", err)
-				// Fallback: use appAccountToken as user_id (UUID format)
-				// This is acceptable as appAccountToken is already a UUID
-			} else if deviceID != "" {
-				logging.Infof("Resolved device_id from appAccountToken - AppAccountToken: %s, DeviceID: %s", transactionInfo.AppAccountToken, deviceID)
-				// Replace appAccountToken with actual device_id
-				transactionInfo.AppAccountToken = deviceID
-			}
+	// Query device_id from App Backend using appAccountToken (token_resolution_policy applies on failure)
+	userID, resolved, err := services.ResolveAppAccountToken(project, transactionInfo.AppAccountToken)
+	if err != nil {
+		// reject policy: acknowledge so Apple doesn't retry, but don't store anything
+		logging.Warnf("AppStore notification dropped, appAccountToken unresolved - project: %s, type: %s, transaction: %s",
+			project.ProjectID, notification.NotificationType, transactionInfo.TransactionID)
+		return http.StatusOK, gin.H{
+			"success": true,
+			"message": "Notification dropped: appAccountToken could not be resolved",
 		}
 	}
+	transactionInfo.AppAccountToken = userID
+	transactionInfo.Unresolved = !resolved
+
+	// Stored state before the notification, for the transition event (only loaded when a sink is configured)
+	var before *models.Subscription
+	if services.SubscriptionEventsEnabled() {
+		before, _ = database.GetSubscriptionByOriginalTransactionID(project.ProjectID, transactionInfo.OriginalTransactionID, notification.Data.Environment)
+	}
 
 	// Handle notification by type
-	subscription, err := handleNotificationByType(notification.NotificationType, transactionInfo, project.ProjectID, notification.Data.Environment)
+	subscription, err := handleNotificationByType(notification.NotificationType, notification.Subtype, transactionInfo, project.ProjectID, notification.Data.Environment)
 	if err != nil {
 		logging.Errorf("Failed to handle notification: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
+		return http.StatusInternalServerError, gin.H{
 			"success": false,
 			"message": "Failed to process notification",
-		})
-		return
+		}
 	}
+	services.PublishSubscriptionTransitionAsync(before, subscription, services.SubscriptionTrigger{
+		Source:           services.TransitionSourceAppleNotification,
+		NotificationType: notification.NotificationType,
+		Subtype:          notification.Subtype,
+	})
 
 	// Notify App Backend via webhook if configured
-	if subscription != nil && project.WebhookCallbackURL != "" {
-		go func() {
-			webhookNotifier := services.NewWebhookNotifier()
-			webhookNotifier.NotifyAppBackend(project.WebhookCallbackURL, project.WebhookSecret, subscription)
-		}()
+	if subscription != nil && project.HasWebhook() {
+		webhookNotifier := services.NewWebhookNotifier()
+		webhookNotifier.NotifyAppBackendAsync(services.WebhookEndpointFromProject(project), subscription)
 	}
+	services.CheckSubscriptionFraudAsync(project, subscription)
 
 	processingTime := time.Since(startTime)
 	logging.Infof("AppStore notification processed - type: %s, transaction: %s, time: %v",
 		notification.NotificationType, transactionInfo.TransactionID, processingTime)
 
-	c.JSON(http.StatusOK, gin.H{
+	return http.StatusOK, gin.H{
 		"success": true,
 		"message": "Notification processed successfully",
-	})
+	}
 }
 
 // AppStoreProductionWebhookHandler handles production environment webhook
@@ -237,18 +346,13 @@ func AppStoreProductionWebhookHandler(c *gin.Context) {
 	}
 
 	// Read raw body
-	body, err := c.GetRawData()
-	if err != nil {
-		logging.Errorf("Failed to read request body: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"message": "Failed to read request body",
-		})
+	body, ok := readWebhookBody(c)
+	if !ok {
 		return
 	}
 
 	// Process notification with production environment
-	processAppStoreNotification("production", c, body, signature)
+	processAppStoreNotification("production", c, body, signature, notificationProcessOptions{})
 }
 
 // AppStoreSandboxWebhookHandler handles sandbox environment webhook
@@ -261,18 +365,23 @@ func AppStoreSandboxWebhookHandler(c *gin.Context) {
 	}
 
 	// Read raw body
-	body, err := c.GetRawData()
-	if err != nil {
-		logging.Errorf("Failed to read request body: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"message": "Failed to read request body",
-		})
+	body, ok := readWebhookBody(c)
+	if !ok {
 		return
 	}
 
 	// Process notification with sandbox environment
-	processAppStoreNotification("sandbox", c, body, signature)
+	processAppStoreNotification("sandbox", c, body, signature, notificationProcessOptions{})
+}
+
+// isSupportedDataVersion checks if the notification data version is in the configured list
+func isSupportedDataVersion(dataVersion string) bool {
+	for _, v := range config.AppConfig.AppStoreSupportedDataVersions {
+		if v == dataVersion {
+			return true
+		}
+	}
+	return false
 }
 
 // min returns the minimum of two integers
@@ -296,6 +405,9 @@ func parseTransactionInfo(signedTransactionInfo string) (*models.TransactionInfo
 	if len(parts) != 3 {
 		return nil, fmt.Errorf("invalid JWT format: expected 3 parts, got %d", len(parts))
 	}
+	if err := services.EnforceJWSAlgorithm(signedTransactionInfo); err != nil {
+		return nil, err
+	}
 
 	// Decode payload (second part)
 	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
@@ -371,6 +483,24 @@ func parseTransactionInfo(signedTransactionInfo string) (*models.TransactionInfo
 		transactionInfo.Environment = env
 	}
 
+	if t, ok := claims["type"].(string); ok {
+		transactionInfo.Type = t
+	}
+
+	if group, ok := claims["subscriptionGroupIdentifier"].(string); ok {
+		transactionInfo.SubscriptionGroupID = group
+	}
+
+	// Billing period: Apple doesn't report it, so infer it from this transaction's dates
+	// Skipped while an offer or free trial applies (its duration differs from the regular period);
+	// the stored billing period is kept in that case
+	offerType, _ := claims["offerType"].(float64)
+	isTrialPeriod, _ := claims["isTrialPeriod"].(bool)
+	if services.IsAutoRenewableType(transactionInfo.Type) && offerType == 0 && !isTrialPeriod {
+		transactionInfo.BillingPeriod = services.BillingPeriodFromDates(
+			services.TimeFromMillis(transactionInfo.PurchaseDateMS), services.TimeFromMillis(transactionInfo.ExpiresDateMS))
+	}
+
 	// Extract appAccountToken (user_id passed from client during purchase)
 	// Apple stores this as a UUID string in the JWT claims
 	// Try different possible field names
@@ -401,25 +531,90 @@ func parseTransactionInfo(signedTransactionInfo string) (*models.TransactionInfo
 		return nil, fmt.Errorf("original_transaction_id is missing in JWT claims")
 	}
 
+	// expiresDate is required for auto-renewable subscriptions, otherwise it would be stored as 1970-01-01
+	if transactionInfo.ExpiresDateMS <= 0 && services.IsAutoRenewableType(transactionInfo.Type) {
+		return nil, fmt.Errorf("expires_date is missing in JWT claims (type: %q)", transactionInfo.Type)
+	}
+
 	return transactionInfo, nil
 }
 
+// parseRenewalInfo decodes signedRenewalInfo
+// The signature is not checked again: the whole data payload is covered by the verified signedPayload
+func parseRenewalInfo(signedRenewalInfo string) (*models.RenewalInfo, error) {
+	claims, err := services.DecodeUnverifiedJWS(signedRenewalInfo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode signedRenewalInfo: %w", err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode renewal info claims: %w", err)
+	}
+	var renewalInfo models.RenewalInfo
+	if err := json.Unmarshal(payload, &renewalInfo); err != nil {
+		return nil, fmt.Errorf("failed to parse renewal info: %w", err)
+	}
+	return &renewalInfo, nil
+}
+
+// applyRenewalInfo updates the subscription from the notification's renewal info, when present
+// autoRenewStatus is more current than the transaction's; expirationIntent tells why a subscription ended
+func applyRenewalInfo(subscription *models.Subscription, transactionInfo *models.TransactionInfo) {
+	renewalInfo := transactionInfo.RenewalInfo
+	if renewalInfo == nil {
+		return
+	}
+	subscription.AutoRenewStatus = renewalInfo.AutoRenewStatus == 1
+	subscription.ExpirationIntent = renewalInfo.ExpirationIntent
+	subscription.GracePeriodExpiresDate = nil
+	if renewalInfo.GracePeriodExpiresDate > 0 {
+		gracePeriodExpiresDate := services.TimeFromMillis(renewalInfo.GracePeriodExpiresDate)
+		subscription.GracePeriodExpiresDate = &gracePeriodExpiresDate
+	}
+}
+
+// bindAppAccountToken binds the transaction's user_id to a subscription without one,
+// or replaces an unresolved binding (store_unresolved policy) once the token has been resolved
+func bindAppAccountToken(subscription *models.Subscription, transactionInfo *models.TransactionInfo) {
+	if transactionInfo.AppAccountToken == "" {
+		return
+	}
+	switch {
+	case subscription.AppAccountToken == "":
+		logging.Infof("Binding appAccountToken - original_transaction: %s, app_account_token: %s",
+			transactionInfo.OriginalTransactionID, transactionInfo.AppAccountToken)
+	case !subscription.IsBindingResolved() && !transactionInfo.Unresolved:
+		logging.Infof("Resolved pending appAccountToken binding - original_transaction: %s, app_account_token: %s -> %s",
+			transactionInfo.OriginalTransactionID, subscription.AppAccountToken, transactionInfo.AppAccountToken)
+	default:
+		return
+	}
+	subscription.AppAccountToken = transactionInfo.AppAccountToken
+	subscription.SetResolved(!transactionInfo.Unresolved)
+}
+
 // handleNotificationByType handles notification by type
+// subtype (e.g. UPGRADE, AUTO_RENEW_DISABLED, VOLUNTARY, BILLING_RETRY) is stored as the subscription's last_subtype
 // Returns the updated subscription and error
-func handleNotificationByType(notificationType string, transactionInfo *models.TransactionInfo, projectID, environment string) (*models.Subscription, error) {
+func handleNotificationByType(notificationType, subtype string, transactionInfo *models.TransactionInfo, projectID, environment string) (*models.Subscription, error) {
 	switch notificationType {
 	case "INITIAL_BUY", "SUBSCRIBED":
-		return handleInitialBuy(transactionInfo, projectID, environment)
-	case "DID_RENEW", "RENEWAL_EXTENDED":
-		return handleDidRenew(transactionInfo, projectID)
+		return handleInitialBuy(transactionInfo, projectID, environment, subtype)
+	case "DID_RENEW":
+		return handleDidRenew(transactionInfo, projectID, environment, subtype, true)
+	case "RENEWAL_EXTENDED":
+		// Apple extended the renewal date, not a paid renewal
+		return handleDidRenew(transactionInfo, projectID, environment, subtype, false)
 	case "DID_FAIL_TO_RENEW":
-		return handleDidFailToRenew(transactionInfo, projectID)
+		return handleDidFailToRenew(transactionInfo, projectID, environment, subtype)
 	case "DID_CANCEL":
-		return handleDidCancel(transactionInfo, projectID)
+		return handleDidCancel(transactionInfo, projectID, environment, subtype)
+	case "DID_CHANGE_RENEWAL_STATUS", "DID_CHANGE_RENEWAL_PREF":
+		return handleDidChangeRenewal(transactionInfo, projectID, environment, notificationType, subtype)
 	case "DID_REFUND", "REVOKE":
-		return handleDidRefund(transactionInfo, projectID)
+		return handleDidRefund(transactionInfo, projectID, environment, subtype)
 	case "EXPIRED", "GRACE_PERIOD_EXPIRED":
-		return handleExpired(transactionInfo, projectID)
+		return handleExpired(transactionInfo, projectID, environment, subtype)
 	default:
 		logging.Infof("Unknown notification type: %s", notificationType)
 		return nil, nil
@@ -427,7 +622,7 @@ func handleNotificationByType(notificationType string, transactionInfo *models.T
 }
 
 // handleInitialBuy handles initial purchase
-func handleInitialBuy(transactionInfo *models.TransactionInfo, projectID, environment string) (*models.Subscription, error) {
+func handleInitialBuy(transactionInfo *models.TransactionInfo, projectID, environment, subtype string) (*models.Subscription, error) {
 	logging.Infof("Handling INITIAL_BUY - transaction: %s, original_transaction: %s, product: %s, app_account_token: %s",
 		transactionInfo.TransactionID, transactionInfo.OriginalTransactionID, transactionInfo.ProductID, transactionInfo.AppAccountToken)
 
@@ -438,7 +633,7 @@ func handleInitialBuy(transactionInfo *models.TransactionInfo, projectID, enviro
 	}
 
 	// Find existing subscription by original transaction ID
-	subscription, err := database.GetSubscriptionByOriginalTransactionID(projectID, transactionInfo.OriginalTransactionID)
+	subscription, err := database.GetSubscriptionByOriginalTransactionID(projectID, transactionInfo.OriginalTransactionID, environment)
 	if err != nil {
 		// Create new subscription
 		subscription = &models.Subscription{
@@ -446,16 +641,23 @@ func handleInitialBuy(transactionInfo *models.TransactionInfo, projectID, enviro
 			AppAccountToken:       userID, // Use appAccountToken if available
 			Platform:              "ios",
 			Status:                "active",
-			StartDate:             time.Unix(transactionInfo.PurchaseDateMS/1000, 0),
-			EndDate:               time.Unix(transactionInfo.ExpiresDateMS/1000, 0),
+			StartDate:             services.TimeFromMillis(transactionInfo.PurchaseDateMS),
+			EndDate:               services.TimeFromMillis(transactionInfo.ExpiresDateMS),
 			ProductID:             transactionInfo.ProductID,
 			TransactionID:         transactionInfo.TransactionID,
 			OriginalTransactionID: transactionInfo.OriginalTransactionID,
 			Environment:           environment,
-			PurchaseDate:          time.Unix(transactionInfo.PurchaseDateMS/1000, 0),
-			ExpiresDate:           time.Unix(transactionInfo.ExpiresDateMS/1000, 0),
+			PurchaseDate:          services.TimeFromMillis(transactionInfo.PurchaseDateMS),
+			ExpiresDate:           services.TimeFromMillis(transactionInfo.ExpiresDateMS),
 			AutoRenewStatus:       transactionInfo.AutoRenewStatus == 1,
+			BillingPeriod:         transactionInfo.BillingPeriod,
+			SubscriptionGroupID:   transactionInfo.SubscriptionGroupID,
+			LastSubtype:           subtype,
 		}
+		if transactionInfo.Unresolved {
+			subscription.SetResolved(false)
+		}
+		applyRenewalInfo(subscription, transactionInfo)
 
 		if err := database.CreateSubscription(subscription); err != nil {
 			logging.Errorf("Failed to create subscription: %v", err)
@@ -473,19 +675,26 @@ func handleInitialBuy(transactionInfo *models.TransactionInfo, projectID, enviro
 	}
 
 	// Update existing subscription
-	// If subscription has no appAccountToken but we have one, bind it
-	if subscription.AppAccountToken == "" && userID != "" {
-		subscription.AppAccountToken = userID
-		logging.Infof("Binding appAccountToken to existing subscription - original_transaction: %s, app_account_token: %s",
-			transactionInfo.OriginalTransactionID, userID)
-	}
+	// If subscription has no appAccountToken (or an unresolved one) but we have one, bind it
+	bindAppAccountToken(subscription, transactionInfo)
+
+	// A new transaction on an existing original transaction is a resubscribe
+	services.RecordResubscribe(subscription, transactionInfo.TransactionID)
 
 	// Update ProductID if it changed (e.g., upgrade from monthly to yearly)
 	subscription.ProductID = transactionInfo.ProductID
 	subscription.TransactionID = transactionInfo.TransactionID
 	subscription.Status = "active"
-	subscription.ExpiresDate = time.Unix(transactionInfo.ExpiresDateMS/1000, 0)
+	subscription.ExpiresDate = services.TimeFromMillis(transactionInfo.ExpiresDateMS)
 	subscription.AutoRenewStatus = transactionInfo.AutoRenewStatus == 1
+	if transactionInfo.BillingPeriod != "" {
+		subscription.BillingPeriod = transactionInfo.BillingPeriod
+	}
+	if transactionInfo.SubscriptionGroupID != "" {
+		subscription.SubscriptionGroupID = transactionInfo.SubscriptionGroupID
+	}
+	subscription.LastSubtype = subtype
+	applyRenewalInfo(subscription, transactionInfo)
 
 	if err := database.UpdateSubscription(subscription); err != nil {
 		logging.Errorf("Failed to update subscription: %v", err)
@@ -498,20 +707,17 @@ func handleInitialBuy(transactionInfo *models.TransactionInfo, projectID, enviro
 }
 
 // handleDidRenew handles renewal
-func handleDidRenew(transactionInfo *models.TransactionInfo, projectID string) (*models.Subscription, error) {
+// countRenewal is false for RENEWAL_EXTENDED, which moves the expiry without a new paid period
+func handleDidRenew(transactionInfo *models.TransactionInfo, projectID, environment, subtype string, countRenewal bool) (*models.Subscription, error) {
 	logging.Infof("Handling DID_RENEW - transaction: %s, app_account_token: %s", transactionInfo.TransactionID, transactionInfo.AppAccountToken)
 
-	subscription, err := database.GetSubscriptionByOriginalTransactionID(projectID, transactionInfo.OriginalTransactionID)
+	subscription, err := database.GetSubscriptionByOriginalTransactionID(projectID, transactionInfo.OriginalTransactionID, environment)
 	if err != nil {
 		return nil, fmt.Errorf("subscription not found: %w", err)
 	}
 
-	// If subscription has no appAccountToken but we have one, bind it
-	if subscription.AppAccountToken == "" && transactionInfo.AppAccountToken != "" {
-		subscription.AppAccountToken = transactionInfo.AppAccountToken
-		logging.Infof("Binding appAccountToken during renewal - original_transaction: %s, app_account_token: %s",
-			transactionInfo.OriginalTransactionID, transactionInfo.AppAccountToken)
-	}
+	// If subscription has no appAccountToken (or an unresolved one) but we have one, bind it
+	bindAppAccountToken(subscription, transactionInfo)
 
 	// Update ProductID if it changed (e.g., upgrade from monthly to yearly)
 	// This is important for subscription upgrades, as Apple may send DID_RENEW
@@ -522,11 +728,23 @@ func handleDidRenew(transactionInfo *models.TransactionInfo, projectID string) (
 		subscription.ProductID = transactionInfo.ProductID
 	}
 
+	if countRenewal {
+		services.RecordRenewal(subscription, transactionInfo.TransactionID)
+	}
+
 	// Update TransactionID to the latest transaction
 	subscription.TransactionID = transactionInfo.TransactionID
 	subscription.Status = "active"
-	subscription.ExpiresDate = time.Unix(transactionInfo.ExpiresDateMS/1000, 0)
+	subscription.ExpiresDate = services.TimeFromMillis(transactionInfo.ExpiresDateMS)
 	subscription.AutoRenewStatus = transactionInfo.AutoRenewStatus == 1
+	if transactionInfo.BillingPeriod != "" {
+		subscription.BillingPeriod = transactionInfo.BillingPeriod
+	}
+	if transactionInfo.SubscriptionGroupID != "" {
+		subscription.SubscriptionGroupID = transactionInfo.SubscriptionGroupID
+	}
+	subscription.LastSubtype = subtype
+	applyRenewalInfo(subscription, transactionInfo)
 	if err := database.UpdateSubscription(subscription); err != nil {
 		return nil, err
 	}
@@ -534,23 +752,21 @@ func handleDidRenew(transactionInfo *models.TransactionInfo, projectID string) (
 }
 
 // handleDidFailToRenew handles failed renewal
-func handleDidFailToRenew(transactionInfo *models.TransactionInfo, projectID string) (*models.Subscription, error) {
+func handleDidFailToRenew(transactionInfo *models.TransactionInfo, projectID, environment, subtype string) (*models.Subscription, error) {
 	logging.Infof("Handling DID_FAIL_TO_RENEW - transaction: %s", transactionInfo.TransactionID)
 
-	subscription, err := database.GetSubscriptionByOriginalTransactionID(projectID, transactionInfo.OriginalTransactionID)
+	subscription, err := database.GetSubscriptionByOriginalTransactionID(projectID, transactionInfo.OriginalTransactionID, environment)
 	if err != nil {
 		return nil, fmt.Errorf("subscription not found: %w", err)
 	}
 
-	// If subscription has no appAccountToken but we have one, bind it
-	if subscription.AppAccountToken == "" && transactionInfo.AppAccountToken != "" {
-		subscription.AppAccountToken = transactionInfo.AppAccountToken
-		logging.Infof("Binding appAccountToken - original_transaction: %s, app_account_token: %s",
-			transactionInfo.OriginalTransactionID, transactionInfo.AppAccountToken)
-	}
+	// If subscription has no appAccountToken (or an unresolved one) but we have one, bind it
+	bindAppAccountToken(subscription, transactionInfo)
 
 	subscription.Status = "failed"
 	subscription.AutoRenewStatus = false
+	subscription.LastSubtype = subtype
+	applyRenewalInfo(subscription, transactionInfo) // auto-renew stays on while Apple retries billing
 	if err := database.UpdateSubscription(subscription); err != nil {
 		return nil, err
 	}
@@ -558,136 +774,126 @@ func handleDidFailToRenew(transactionInfo *models.TransactionInfo, projectID str
 }
 
 // handleDidCancel handles cancellation
-func handleDidCancel(transactionInfo *models.TransactionInfo, projectID string) (*models.Subscription, error) {
+func handleDidCancel(transactionInfo *models.TransactionInfo, projectID, environment, subtype string) (*models.Subscription, error) {
 	logging.Infof("Handling DID_CANCEL - transaction: %s", transactionInfo.TransactionID)
 
-	subscription, err := database.GetSubscriptionByOriginalTransactionID(projectID, transactionInfo.OriginalTransactionID)
+	subscription, err := database.GetSubscriptionByOriginalTransactionID(projectID, transactionInfo.OriginalTransactionID, environment)
 	if err != nil {
 		return nil, fmt.Errorf("subscription not found: %w", err)
 	}
 
-	// If subscription has no appAccountToken but we have one, bind it
-	if subscription.AppAccountToken == "" && transactionInfo.AppAccountToken != "" {
-		subscription.AppAccountToken = transactionInfo.AppAccountToken
-		logging.Infof("Binding appAccountToken - original_transaction: %s, app_account_token: %s",
-			transactionInfo.OriginalTransactionID, transactionInfo.AppAccountToken)
-	}
+	// If subscription has no appAccountToken (or an unresolved one) but we have one, bind it
+	bindAppAccountToken(subscription, transactionInfo)
 
 	subscription.Status = "cancelled"
 	subscription.AutoRenewStatus = false
+	subscription.LastSubtype = subtype
+	applyRenewalInfo(subscription, transactionInfo)
 	if err := database.UpdateSubscription(subscription); err != nil {
 		return nil, err
 	}
 	return subscription, nil
 }
 
-// handleDidRefund handles refund
-func handleDidRefund(transactionInfo *models.TransactionInfo, projectID string) (*models.Subscription, error) {
-	logging.Infof("Handling DID_REFUND - transaction: %s", transactionInfo.TransactionID)
+// handleDidChangeRenewal handles DID_CHANGE_RENEWAL_STATUS (subtype AUTO_RENEW_ENABLED / AUTO_RENEW_DISABLED)
+// and DID_CHANGE_RENEWAL_PREF (subtype UPGRADE / DOWNGRADE, empty when the change was reverted)
+// The subscription stays in its current status; only auto-renew and the subtype change,
+// except for UPGRADE, which takes effect immediately (see applyUpgrade)
+func handleDidChangeRenewal(transactionInfo *models.TransactionInfo, projectID, environment, notificationType, subtype string) (*models.Subscription, error) {
+	logging.Infof("Handling %s - transaction: %s, subtype: %s", notificationType, transactionInfo.TransactionID, subtype)
 
-	subscription, err := database.GetSubscriptionByOriginalTransactionID(projectID, transactionInfo.OriginalTransactionID)
+	subscription, err := database.GetSubscriptionByOriginalTransactionID(projectID, transactionInfo.OriginalTransactionID, environment)
 	if err != nil {
 		return nil, fmt.Errorf("subscription not found: %w", err)
 	}
 
-	// If subscription has no appAccountToken but we have one, bind it
-	if subscription.AppAccountToken == "" && transactionInfo.AppAccountToken != "" {
-		subscription.AppAccountToken = transactionInfo.AppAccountToken
-		logging.Infof("Binding appAccountToken - original_transaction: %s, app_account_token: %s",
-			transactionInfo.OriginalTransactionID, transactionInfo.AppAccountToken)
-	}
+	// If subscription has no appAccountToken (or an unresolved one) but we have one, bind it
+	bindAppAccountToken(subscription, transactionInfo)
 
-	subscription.Status = "refunded"
-	subscription.AutoRenewStatus = false
+	switch subtype {
+	case "AUTO_RENEW_ENABLED":
+		subscription.AutoRenewStatus = true
+	case "AUTO_RENEW_DISABLED":
+		subscription.AutoRenewStatus = false
+	case "UPGRADE":
+		applyUpgrade(subscription, transactionInfo)
+	case "DOWNGRADE":
+		// Downgrades apply at the next renewal (DID_RENEW with the new product), the current tier stays until then
+		logging.Infof("Downgrade scheduled for next renewal - original_transaction: %s, current product: %s",
+			transactionInfo.OriginalTransactionID, subscription.ProductID)
+	}
+	subscription.LastSubtype = subtype
+	applyRenewalInfo(subscription, transactionInfo)
 	if err := database.UpdateSubscription(subscription); err != nil {
 		return nil, err
 	}
 	return subscription, nil
 }
 
-// handleExpired handles expiration
-func handleExpired(transactionInfo *models.TransactionInfo, projectID string) (*models.Subscription, error) {
-	logging.Infof("Handling EXPIRED - transaction: %s", transactionInfo.TransactionID)
+// applyUpgrade switches the subscription to the upgraded product
+// Apple upgrades immediately: the notification carries the new transaction of the higher tier,
+// so the product, transaction and expiry are taken from it and the subscription becomes active again
+// Other active subscriptions of the same group are superseded when it is saved (see database.UpdateSubscription)
+func applyUpgrade(subscription *models.Subscription, transactionInfo *models.TransactionInfo) {
+	if transactionInfo.ProductID == "" || transactionInfo.TransactionID == subscription.TransactionID {
+		return
+	}
+	logging.Infof("Subscription upgraded - original_transaction: %s, product: %s -> %s",
+		transactionInfo.OriginalTransactionID, subscription.ProductID, transactionInfo.ProductID)
+
+	subscription.ProductID = transactionInfo.ProductID
+	subscription.TransactionID = transactionInfo.TransactionID
+	subscription.Status = "active"
+	if transactionInfo.ExpiresDateMS > 0 {
+		subscription.ExpiresDate = services.TimeFromMillis(transactionInfo.ExpiresDateMS)
+	}
+	if transactionInfo.BillingPeriod != "" {
+		subscription.BillingPeriod = transactionInfo.BillingPeriod
+	}
+	if transactionInfo.SubscriptionGroupID != "" {
+		subscription.SubscriptionGroupID = transactionInfo.SubscriptionGroupID
+	}
+}
+
+// handleDidRefund handles refund
+func handleDidRefund(transactionInfo *models.TransactionInfo, projectID, environment, subtype string) (*models.Subscription, error) {
+	logging.Infof("Handling DID_REFUND - transaction: %s", transactionInfo.TransactionID)
 
-	subscription, err := database.GetSubscriptionByOriginalTransactionID(projectID, transactionInfo.OriginalTransactionID)
+	subscription, err := database.GetSubscriptionByOriginalTransactionID(projectID, transactionInfo.OriginalTransactionID, environment)
 	if err != nil {
 		return nil, fmt.Errorf("subscription not found: %w", err)
 	}
 
-	// If subscription has no appAccountToken but we have one, bind it
-	if subscription.AppAccountToken == "" && transactionInfo.AppAccountToken != "" {
-		subscription.AppAccountToken = transactionInfo.AppAccountToken
-		logging.Infof("Binding appAccountToken - original_transaction: %s, app_account_token: %s",
-			transactionInfo.OriginalTransactionID, transactionInfo.AppAccountToken)
-	}
+	// If subscription has no appAccountToken (or an unresolved one) but we have one, bind it
+	bindAppAccountToken(subscription, transactionInfo)
 
-	subscription.Status = "expired"
+	subscription.Status = "refunded"
 	subscription.AutoRenewStatus = false
+	subscription.LastSubtype = subtype
 	if err := database.UpdateSubscription(subscription); err != nil {
 		return nil, err
 	}
 	return subscription, nil
 }
 
-// extractBaseURL extracts base URL from webhook callback URL
-// e.g., https://api.example.com/webhooks/unionhub -> https://api.example.com
-func extractBaseURL(webhookURL string) string {
-	// Simple extraction: remove /webhooks/unionhub or similar paths
-	if strings.Contains(webhookURL, "/webhooks/") {
-		parts := strings.Split(webhookURL, "/webhooks/")
-		if len(parts) > 0 {
-			return parts[0]
-		}
-	}
-	// If no /webhooks/ found, try to extract base URL by removing last path segment
-	lastSlash := strings.LastIndex(webhookURL, "/")
-	if lastSlash > 0 {
-		// Find the protocol part (http:// or https://)
-		protocolEnd := strings.Index(webhookURL, "://")
-		if protocolEnd > 0 {
-			// Find the next slash after protocol
-			pathStart := strings.Index(webhookURL[protocolEnd+3:], "/")
-			if pathStart > 0 {
-				return webhookURL[:protocolEnd+3+pathStart]
-			}
-		}
-		return webhookURL[:lastSlash]
-	}
-	return webhookURL
-}
-
-// queryDeviceIDFromAppBackend queries App Backend to get device_id from app_account_token
-func queryDeviceIDFromAppBackend(baseURL, appAccountToken string) (string, error) {
-	url := fmt.Sprintf("%s/api/app-account-token/device-id?app_account_token=%s", baseURL, appAccountToken)
-
-	client := &http.Client{
-		Timeout: 5 * time.Second,
-	}
+// handleExpired handles expiration
+func handleExpired(transactionInfo *models.TransactionInfo, projectID, environment, subtype string) (*models.Subscription, error) {
+	logging.Infof("Handling EXPIRED - transaction: %s", transactionInfo.TransactionID)
 
-	resp, err := client.Get(url)
+	subscription, err := database.GetSubscriptionByOriginalTransactionID(projectID, transactionInfo.OriginalTransactionID, environment)
 	if err != nil {
-		return "", fmt.Errorf("failed to query app backend: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("app backend returned status %d", resp.StatusCode)
-	}
-
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+		return nil, fmt.Errorf("subscription not found: %w", err)
 	}
 
-	if success, ok := result["success"].(bool); !ok || !success {
-		return "", fmt.Errorf("App Backend query failed")
-	}
+	// If subscription has no appAccountToken (or an unresolved one) but we have one, bind it
+	bindAppAccountToken(subscription, transactionInfo)
 
-	if data, ok := result["data"].(map[string]interface{}); ok {
-		if deviceID, ok := data["device_id"].(string); ok {
-			return deviceID, nil
-		}
+	subscription.Status = "expired"
+	subscription.AutoRenewStatus = false
+	subscription.LastSubtype = subtype
+	applyRenewalInfo(subscription, transactionInfo)
+	if err := database.UpdateSubscription(subscription); err != nil {
+		return nil, err
 	}
-
-	return "", fmt.Errorf("device_id not found in response")
+	return subscription, nil
 }
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+	"verification-api/internal/models"
+	"verification-api/internal/services"
+)
+
+// notificationQueue processes verified App Store notifications after the webhook responded
+// nil when APPSTORE_NOTIFICATION_QUEUE_ENABLED is false, notifications are then processed inline
+var notificationQueue *services.NotificationQueue
+
+// enqueueAppStoreNotification persists a verified notification for the queue worker
+// body is the raw webhook body, payload the verified signedPayload claims (JSON)
+func enqueueAppStoreNotification(environment string, body, payload []byte, notification *models.AppStoreNotification) error {
+	return notificationQueue.Enqueue(&models.QueuedNotification{
+		Environment:      environment,
+		NotificationUUID: notification.NotificationUUID,
+		NotificationType: notification.NotificationType,
+		Subtype:          notification.Subtype,
+		BundleID:         notification.Data.BundleID,
+		Body:             string(body),
+		Payload:          string(payload),
+	})
+}
+
+// processQueuedAppStoreNotification is the queue worker handler
+// The notification runs through the same processing as inline; server errors (5xx) are retried,
+// any other non-200 outcome (unknown bundle_id, rejected transaction) fails immediately
+func processQueuedAppStoreNotification(queued *models.QueuedNotification) (bool, error) {
+	var notification models.AppStoreNotification
+	if err := json.Unmarshal([]byte(queued.Payload), &notification); err != nil {
+		return false, fmt.Errorf("failed to parse queued notification payload: %w", err)
+	}
+
+	status, response := handleVerifiedAppStoreNotification(queued.Environment, &notification, time.Now())
+	if status == http.StatusOK {
+		return false, nil
+	}
+	return status >= http.StatusInternalServerError, fmt.Errorf("%d: %v", status, response["message"])
+}
@@ -0,0 +1,278 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"verification-api/internal/config"
+	"verification-api/internal/database"
+	"verification-api/internal/models"
+	"verification-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unsignedJWS encodes claims as an ES256 JWS without a valid signature or x5c chain
+func unsignedJWS(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("marshal claims: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(payload) + ".c2lnbmF0dXJl"
+}
+
+// postAppStoreNotification sends an unsigned V2 notification to the webhook handler of the environment
+func postAppStoreNotification(t *testing.T, handler gin.HandlerFunc, notification map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"signedPayload": unsignedJWS(t, notification)})
+
+	router := gin.New()
+	router.POST("/webhook/apple", handler)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/webhook/apple", bytes.NewReader(body)))
+	return recorder
+}
+
+// createAppStoreSubscription stores an active production iOS subscription of the given product in group "group-1"
+func createAppStoreSubscription(t *testing.T, productID, transactionID string, expiresDate time.Time) *models.Subscription {
+	t.Helper()
+	subscription := &models.Subscription{
+		ProjectID:             "app-a",
+		AppAccountToken:       "user-a",
+		Platform:              "ios",
+		Status:                "active",
+		ProductID:             productID,
+		TransactionID:         transactionID,
+		OriginalTransactionID: "1000000001",
+		Environment:           "Production",
+		SubscriptionGroupID:   "group-1",
+		AutoRenewStatus:       true,
+		PurchaseDate:          time.Now().AddDate(0, 0, -25),
+		ExpiresDate:           expiresDate,
+	}
+	if err := database.CreateSubscription(subscription); err != nil {
+		t.Fatalf("create subscription: %v", err)
+	}
+	return subscription
+}
+
+// UPGRADE takes effect immediately: the new product, transaction and expiry replace the current ones
+func TestHandleDidChangeRenewalUpgrade(t *testing.T) {
+	setupTestDB(t)
+	createTestProject(t, models.Project{ProjectID: "app-a", ProjectName: "App A"})
+	createAppStoreSubscription(t, "com.example.basic.monthly", "1000000001", time.Now().AddDate(0, 0, 5))
+
+	newExpiry := time.Now().AddDate(0, 1, 0).Truncate(time.Millisecond)
+	transactionInfo := &models.TransactionInfo{
+		TransactionID:         "1000000002",
+		OriginalTransactionID: "1000000001",
+		ProductID:             "com.example.premium.monthly",
+		ExpiresDateMS:         newExpiry.UnixMilli(),
+		BillingPeriod:         "P1M",
+		SubscriptionGroupID:   "group-1",
+		RenewalInfo:           &models.RenewalInfo{AutoRenewProductID: "com.example.premium.monthly", AutoRenewStatus: 1},
+	}
+	if _, err := handleNotificationByType("DID_CHANGE_RENEWAL_PREF", "UPGRADE", transactionInfo, "app-a", "Production"); err != nil {
+		t.Fatalf("handle UPGRADE: %v", err)
+	}
+
+	got, err := database.GetSubscriptionByOriginalTransactionID("app-a", "1000000001", "Production")
+	if err != nil {
+		t.Fatalf("load subscription: %v", err)
+	}
+	if got.ProductID != "com.example.premium.monthly" || got.TransactionID != "1000000002" {
+		t.Errorf("product/transaction = %s/%s, want the upgraded ones", got.ProductID, got.TransactionID)
+	}
+	if !got.ExpiresDate.Equal(newExpiry) {
+		t.Errorf("ExpiresDate = %v, want %v", got.ExpiresDate, newExpiry)
+	}
+	if got.Status != "active" || !got.AutoRenewStatus || got.BillingPeriod != "P1M" || got.LastSubtype != "UPGRADE" {
+		t.Errorf("status = %s, auto_renew = %v, billing_period = %s, last_subtype = %s",
+			got.Status, got.AutoRenewStatus, got.BillingPeriod, got.LastSubtype)
+	}
+
+	// A repeated UPGRADE carrying the already applied transaction changes nothing but the subtype
+	if _, err := handleNotificationByType("DID_CHANGE_RENEWAL_PREF", "UPGRADE", transactionInfo, "app-a", "Production"); err != nil {
+		t.Fatalf("handle repeated UPGRADE: %v", err)
+	}
+	again, _ := database.GetSubscriptionByOriginalTransactionID("app-a", "1000000001", "Production")
+	if again.TransactionID != "1000000002" || !again.ExpiresDate.Equal(newExpiry) {
+		t.Errorf("repeated UPGRADE changed the subscription: %s, %v", again.TransactionID, again.ExpiresDate)
+	}
+}
+
+// DOWNGRADE keeps the current tier until the next renewal, which then switches the product
+func TestHandleDidChangeRenewalDowngrade(t *testing.T) {
+	setupTestDB(t)
+	createTestProject(t, models.Project{ProjectID: "app-a", ProjectName: "App A"})
+	currentExpiry := time.Now().AddDate(0, 0, 5).Truncate(time.Millisecond)
+	createAppStoreSubscription(t, "com.example.premium.monthly", "1000000002", currentExpiry)
+
+	// Apple sends the current (premium) transaction, the lower tier is only in the renewal info
+	downgrade := &models.TransactionInfo{
+		TransactionID:         "1000000002",
+		OriginalTransactionID: "1000000001",
+		ProductID:             "com.example.premium.monthly",
+		ExpiresDateMS:         currentExpiry.UnixMilli(),
+		RenewalInfo:           &models.RenewalInfo{AutoRenewProductID: "com.example.basic.monthly", AutoRenewStatus: 1},
+	}
+	if _, err := handleNotificationByType("DID_CHANGE_RENEWAL_PREF", "DOWNGRADE", downgrade, "app-a", "Production"); err != nil {
+		t.Fatalf("handle DOWNGRADE: %v", err)
+	}
+
+	got, err := database.GetSubscriptionByOriginalTransactionID("app-a", "1000000001", "Production")
+	if err != nil {
+		t.Fatalf("load subscription: %v", err)
+	}
+	if got.ProductID != "com.example.premium.monthly" || got.TransactionID != "1000000002" {
+		t.Errorf("product/transaction = %s/%s, want the current tier kept", got.ProductID, got.TransactionID)
+	}
+	if !got.ExpiresDate.Equal(currentExpiry) || got.Status != "active" || got.LastSubtype != "DOWNGRADE" {
+		t.Errorf("expires = %v, status = %s, last_subtype = %s", got.ExpiresDate, got.Status, got.LastSubtype)
+	}
+
+	// The next renewal is billed at the lower tier
+	renewedExpiry := currentExpiry.AddDate(0, 1, 0)
+	renewal := &models.TransactionInfo{
+		TransactionID:         "1000000003",
+		OriginalTransactionID: "1000000001",
+		ProductID:             "com.example.basic.monthly",
+		ExpiresDateMS:         renewedExpiry.UnixMilli(),
+		AutoRenewStatus:       1,
+	}
+	if _, err := handleNotificationByType("DID_RENEW", "", renewal, "app-a", "Production"); err != nil {
+		t.Fatalf("handle DID_RENEW: %v", err)
+	}
+
+	renewed, _ := database.GetSubscriptionByOriginalTransactionID("app-a", "1000000001", "Production")
+	if renewed.ProductID != "com.example.basic.monthly" || renewed.TransactionID != "1000000003" {
+		t.Errorf("product/transaction after renewal = %s/%s, want the lower tier", renewed.ProductID, renewed.TransactionID)
+	}
+	if !renewed.ExpiresDate.Equal(renewedExpiry) {
+		t.Errorf("ExpiresDate after renewal = %v, want %v", renewed.ExpiresDate, renewedExpiry)
+	}
+}
+
+// With APPSTORE_SANDBOX_SKIP_SIGNATURE a forged notification on the sandbox URL must never reach a production subscription
+func TestSandboxSkipSignatureCannotTouchProductionSubscriptions(t *testing.T) {
+	tests := []struct {
+		name           string
+		environment    string // data.environment claimed by the forged notification
+		sandboxSibling bool   // a sandbox subscription reuses the production original_transaction_id
+		wantStatus     int
+		wantSandbox    string // status of the sandbox subscription afterwards
+	}{
+		{name: "claims production", environment: "Production", wantStatus: http.StatusUnauthorized},
+		{name: "claims sandbox without sandbox subscription", environment: "Sandbox", wantStatus: http.StatusInternalServerError},
+		{name: "claims sandbox with sandbox subscription", environment: "Sandbox", sandboxSibling: true, wantStatus: http.StatusOK, wantSandbox: "refunded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			config.AppConfig.AppStoreSandboxSkipSignature = true
+			config.AppConfig.AppStoreSupportedDataVersions = []string{"2.0"}
+			previous := replayProtection
+			replayProtection = services.NewReplayProtection(nil)
+			t.Cleanup(func() {
+				replayProtection.Stop(time.Second)
+				replayProtection = previous
+			})
+
+			createTestProject(t, models.Project{ProjectID: "app-a", ProjectName: "App A", BundleID: "com.example.a"})
+			production := createAppStoreSubscription(t, "com.example.pro.monthly", "1000000001", time.Now().AddDate(0, 0, 20))
+			var sandbox *models.Subscription
+			if tt.sandboxSibling {
+				sandbox = &models.Subscription{
+					ProjectID: "app-a", AppAccountToken: "tester", Platform: "ios", Status: "active", ProductID: "com.example.pro.monthly",
+					TransactionID: "1000000001", OriginalTransactionID: "1000000001", Environment: "Sandbox",
+					PurchaseDate: time.Now(), ExpiresDate: time.Now().Add(5 * time.Minute),
+				}
+				if err := database.CreateSubscription(sandbox); err != nil {
+					t.Fatalf("create sandbox subscription: %v", err)
+				}
+			}
+
+			recorder := postAppStoreNotification(t, AppStoreSandboxWebhookHandler, map[string]interface{}{
+				"notificationType": "REVOKE",
+				"notificationUUID": "forged-" + tt.name,
+				"version":          "2.0",
+				"signedDate":       time.Now().UnixMilli(),
+				"data": map[string]interface{}{
+					"bundleId":    "com.example.a",
+					"environment": tt.environment,
+					"signedTransactionInfo": unsignedJWS(t, map[string]interface{}{
+						"transactionId":         "1000000001",
+						"originalTransactionId": "1000000001",
+						"productId":             "com.example.pro.monthly",
+						"type":                  "Auto-Renewable Subscription",
+						"purchaseDate":          time.Now().UnixMilli(),
+						"expiresDate":           time.Now().Add(5 * time.Minute).UnixMilli(),
+					}),
+				},
+			})
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+
+			var stored models.Subscription
+			if err := database.DB.First(&stored, production.ID).Error; err != nil {
+				t.Fatalf("load production subscription: %v", err)
+			}
+			if stored.Status != "active" || stored.Environment != "Production" || stored.TransactionID != "1000000001" {
+				t.Errorf("production subscription changed: status %q, environment %q, transaction %q",
+					stored.Status, stored.Environment, stored.TransactionID)
+			}
+			if sandbox != nil {
+				var storedSandbox models.Subscription
+				database.DB.First(&storedSandbox, sandbox.ID)
+				if storedSandbox.Status != tt.wantSandbox {
+					t.Errorf("sandbox subscription status = %q, want %q", storedSandbox.Status, tt.wantSandbox)
+				}
+			}
+		})
+	}
+}
+
+// The data format version is read from the decoded payload's "version" field, as Apple sends it
+func TestAppStoreNotificationDataVersionStrictMode(t *testing.T) {
+	tests := []struct {
+		name       string
+		version    interface{} // nil omits the field
+		wantStatus int
+	}{
+		{name: "supported version", version: "2.0", wantStatus: http.StatusOK},
+		{name: "unsupported version", version: "1.0", wantStatus: http.StatusBadRequest},
+		{name: "missing version", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			config.AppConfig.AppStoreSandboxSkipSignature = true
+			config.AppConfig.AppStoreSupportedDataVersions = []string{"2.0"}
+			config.AppConfig.AppStoreStrictDataVersion = true
+
+			// Shaped like a decoded V2 heartbeat payload (no notificationType)
+			notification := map[string]interface{}{
+				"notificationUUID": "heartbeat-" + tt.name,
+				"signedDate":       time.Now().UnixMilli(),
+				"data":             map[string]interface{}{"bundleId": "com.example.a", "environment": "Sandbox"},
+			}
+			if tt.version != nil {
+				notification["version"] = tt.version
+			}
+
+			recorder := postAppStoreNotification(t, AppStoreSandboxWebhookHandler, notification)
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+		})
+	}
+}
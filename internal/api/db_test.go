@@ -0,0 +1,60 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"verification-api/internal/config"
+	"verification-api/internal/database"
+	"verification-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupTestDB points the database package at a fresh in-memory SQLite database
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.Config{
+		DuplicateTransactionIDPolicy: database.DuplicateTransactionIDUpsert,
+		ExpiryDriftToleranceSeconds:  60,
+		CodeExpireMinutes:            5,
+	}
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:api_%s?mode=memory&cache=shared", name)), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Project{}, &models.ProjectGroup{}, &models.Subscription{}, models.Subscription{}, &models.Transaction{}, &models.WebhookDelivery{}); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	database.DB = db
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+// createTestProject stores an active project without webhooks
+// Unique columns left empty are derived from the project ID
+func createTestProject(t *testing.T, project models.Project) *models.Project {
+	t.Helper()
+	project.IsActive = true
+	if project.APIKey == "" {
+		project.APIKey = "key-" + project.ProjectID
+	}
+	if project.BundleID == "" {
+		project.BundleID = "com.example.ios." + project.ProjectID
+	}
+	if err := database.DB.Create(&project).Error; err != nil {
+		t.Fatalf("create project %s: %v", project.ProjectID, err)
+	}
+	return &project
+}
@@ -1,27 +1,85 @@
 package api
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 	"verification-api/internal/database"
 	"verification-api/internal/models"
 	"verification-api/internal/services"
 	"verification-api/pkg/logging"
+	"verification-api/pkg/metrics"
 
 	"github.com/gin-gonic/gin"
 )
 
-// GooglePlayNotification represents Google Play Real-Time Developer Notification
-type GooglePlayNotification struct {
+// Global Pub/Sub push verifier instance (initialized in SetupRoutes)
+var pubSubPushVerifier = services.NewPubSubPushVerifier("")
+
+// GooglePlayPubSubMessage represents the Pub/Sub push envelope Google Play RTDN are delivered in
+type GooglePlayPubSubMessage struct {
 	Message struct {
-		Data string `json:"data"` // Base64 encoded protobuf message
+		Data      string `json:"data"`      // Base64 encoded JSON GooglePlayNotification
+		MessageID string `json:"messageId"` // Pub/Sub message ID
 	} `json:"message"`
-	SubscriptionNotification struct {
+	Subscription string `json:"subscription"` // Pub/Sub subscription name
+}
+
+// GooglePlayNotification represents Google Play Real-Time Developer Notification (DeveloperNotification)
+// Exactly one of the notification objects is set
+type GooglePlayNotification struct {
+	Version         string `json:"version"`
+	PackageName     string `json:"packageName"`
+	EventTimeMillis string `json:"eventTimeMillis"`
+
+	SubscriptionNotification *struct {
 		NotificationType int    `json:"notificationType"` // 1=SUBSCRIPTION_RECOVERED, 2=SUBSCRIPTION_RENEWED, etc.
 		PurchaseToken    string `json:"purchaseToken"`
 		SubscriptionID   string `json:"subscriptionId"`
-	} `json:"subscriptionNotification"`
+	} `json:"subscriptionNotification,omitempty"`
+	OneTimeProductNotification *struct {
+		NotificationType int    `json:"notificationType"` // 1=ONE_TIME_PRODUCT_PURCHASED, 2=ONE_TIME_PRODUCT_CANCELED
+		PurchaseToken    string `json:"purchaseToken"`
+		SKU              string `json:"sku"` // Product ID
+	} `json:"oneTimeProductNotification,omitempty"`
+	VoidedPurchaseNotification *struct {
+		PurchaseToken string `json:"purchaseToken"`
+		OrderID       string `json:"orderId"`
+		ProductType   int    `json:"productType"` // 1=PRODUCT_TYPE_SUBSCRIPTION, 2=PRODUCT_TYPE_ONE_TIME
+		RefundType    int    `json:"refundType"`  // 1=REFUND_TYPE_FULL_REFUND, 2=REFUND_TYPE_QUANTITY_BASED_PARTIAL_REFUND
+	} `json:"voidedPurchaseNotification,omitempty"`
+	TestNotification *struct {
+		Version string `json:"version"`
+	} `json:"testNotification,omitempty"`
+}
+
+// decodeGooglePlayNotification decodes the Pub/Sub envelope and the base64 JSON notification in message.data
+func decodeGooglePlayNotification(body []byte) (*GooglePlayNotification, error) {
+	var envelope GooglePlayPubSubMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("invalid Pub/Sub message: %w", err)
+	}
+	if envelope.Message.Data == "" {
+		return nil, fmt.Errorf("message.data is empty")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(envelope.Message.Data)
+	if err != nil {
+		// Some publishers omit the padding or use the URL alphabet
+		if data, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(envelope.Message.Data, "=")); err != nil {
+			return nil, fmt.Errorf("message.data is not valid base64: %w", err)
+		}
+	}
+
+	var notification GooglePlayNotification
+	if err := json.Unmarshal(data, &notification); err != nil {
+		return nil, fmt.Errorf("message.data is not a valid developer notification: %w", err)
+	}
+	return &notification, nil
 }
 
 // GooglePlayWebhookHandler handles Google Play Real-Time Developer Notifications
@@ -30,19 +88,14 @@ func GooglePlayWebhookHandler(c *gin.Context) {
 	startTime := time.Now()
 
 	// Read raw body
-	body, err := c.GetRawData()
-	if err != nil {
-		logging.Errorf("Failed to read request body: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"message": "Failed to read request body",
-		})
+	body, ok := readWebhookBody(c)
+	if !ok {
 		return
 	}
 
-	// Parse notification
-	var notification GooglePlayNotification
-	if err := json.Unmarshal(body, &notification); err != nil {
+	// Parse notification (Pub/Sub envelope with base64 JSON in message.data)
+	notification, err := decodeGooglePlayNotification(body)
+	if err != nil {
 		logging.Errorf("Failed to parse Google Play notification: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -50,43 +103,85 @@ func GooglePlayWebhookHandler(c *gin.Context) {
 		})
 		return
 	}
-
-	// Extract purchase token and subscription ID
-	purchaseToken := notification.SubscriptionNotification.PurchaseToken
-	subscriptionID := notification.SubscriptionNotification.SubscriptionID
-	notificationType := notification.SubscriptionNotification.NotificationType
-
-	if purchaseToken == "" || subscriptionID == "" {
-		logging.Errorf("Missing purchase_token or subscription_id in notification")
+	if notification.PackageName == "" {
+		logging.Errorf("Missing packageName in Google Play notification")
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"message": "Missing required fields: purchase_token or subscription_id",
+			"message": "Missing required field: packageName",
 		})
 		return
 	}
 
-	// TODO: Get project by package_name (need to extract from purchase token or use default)
-	// For now, we'll need to query all projects or use a default
+	// Get project by package_name (never another project's, even with several registered)
+	// Unknown packages are acknowledged with 200 so Pub/Sub stops redelivering them
 	projectService := services.NewProjectService()
-	projects, err := projectService.GetAllProjects()
+	project, err := projectService.GetProjectByPackageName(notification.PackageName)
 	if err != nil {
-		logging.Errorf("Failed to get projects: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
+		logging.Errorf("Project not found for package_name: %s, error: %v", notification.PackageName, err)
+		metrics.IncCounter("google_play_unknown_package_total", nil)
+		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "Failed to get projects",
+			"message": "Project not found for package_name: " + notification.PackageName,
 		})
 		return
 	}
 
-	// Find project by matching package_name (would need to query Google API to get package name)
-	// For now, use first active project as fallback
-	var project *models.Project
-	if len(projects) > 0 {
-		project = projects[0]
-	} else {
+	// Verify Pub/Sub push authentication (OIDC token in Authorization header)
+	if err := pubSubPushVerifier.VerifyAuthorizationHeader(c.GetHeader("Authorization")); err != nil {
+		reason := "invalid"
+		if c.GetHeader("Authorization") == "" {
+			reason = "missing"
+		}
+		recordUnverifiedNotification("android", project.ProjectID, "production", reason, project.RequireWebhookSignature)
+		if project.RequireWebhookSignature {
+			logging.Errorf("Google Play notification verification failed, rejecting (require_webhook_signature enabled): %v", err)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "Notification verification failed",
+			})
+			return
+		}
+		logging.Warnf("Google Play notification not verified, processing anyway (require_webhook_signature disabled) - project: %s: %v", project.ProjectID, err)
+	}
+
+	// Route by the notification object present
+	switch {
+	case notification.OneTimeProductNotification != nil:
+		// One-time product (non-consumable) notification
+		handleGooglePlayOneTimeProduct(c, project, notification.OneTimeProductNotification.NotificationType,
+			notification.OneTimeProductNotification.PurchaseToken, notification.OneTimeProductNotification.SKU)
+		return
+	case notification.VoidedPurchaseNotification != nil:
+		// Refund or chargeback
+		voided := notification.VoidedPurchaseNotification
+		handleGooglePlayVoidedPurchase(c, project, voided.PurchaseToken, voided.OrderID, voided.ProductType)
+		return
+	case notification.TestNotification != nil:
+		logging.Infof("Google Play test notification received - project: %s, package: %s", project.ProjectID, notification.PackageName)
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "Test notification received",
+		})
+		return
+	case notification.SubscriptionNotification == nil:
+		logging.Errorf("Google Play notification contains no known notification object - package: %s", notification.PackageName)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"message": "No active projects found",
+			"message": "Unsupported notification",
+		})
+		return
+	}
+
+	// Extract purchase token and subscription ID
+	purchaseToken := notification.SubscriptionNotification.PurchaseToken
+	subscriptionID := notification.SubscriptionNotification.SubscriptionID
+	notificationType := notification.SubscriptionNotification.NotificationType
+
+	if purchaseToken == "" || subscriptionID == "" {
+		logging.Errorf("Missing purchase_token or subscription_id in notification")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Missing required fields: purchase_token or subscription_id",
 		})
 		return
 	}
@@ -111,6 +206,7 @@ func GooglePlayWebhookHandler(c *gin.Context) {
 	}
 
 	// Update subscription based on notification type
+	verified := *subscription
 	switch notificationType {
 	case 1: // SUBSCRIPTION_RECOVERED
 		subscription.Status = "active"
@@ -149,14 +245,17 @@ func GooglePlayWebhookHandler(c *gin.Context) {
 		})
 		return
 	}
+	services.PublishSubscriptionTransitionAsync(&verified, subscription, services.SubscriptionTrigger{
+		Source:           services.TransitionSourceGoogleNotification,
+		NotificationType: strconv.Itoa(notificationType),
+	})
 
 	// Notify App Backend via webhook if configured
-	if project.WebhookCallbackURL != "" {
-		go func() {
-			webhookNotifier := services.NewWebhookNotifier()
-			webhookNotifier.NotifyAppBackend(project.WebhookCallbackURL, project.WebhookSecret, subscription)
-		}()
+	if project.HasWebhook() {
+		webhookNotifier := services.NewWebhookNotifier()
+		webhookNotifier.NotifyAppBackendAsync(services.WebhookEndpointFromProject(project), subscription)
 	}
+	services.CheckSubscriptionFraudAsync(project, subscription)
 
 	processingTime := time.Since(startTime)
 	logging.Infof("Google Play notification processed - type: %d, subscription: %s, time: %v",
@@ -167,3 +266,104 @@ func GooglePlayWebhookHandler(c *gin.Context) {
 		"message": "Notification processed successfully",
 	})
 }
+
+// handleGooglePlayVoidedPurchase handles Google Play voided purchase notifications (refunds and chargebacks)
+// Subscriptions are marked refunded so the user loses the entitlement; one-time products are removed
+func handleGooglePlayVoidedPurchase(c *gin.Context, project *models.Project, purchaseToken, orderID string, productType int) {
+	if purchaseToken == "" {
+		logging.Errorf("Missing purchaseToken in voided purchase notification - order: %s", orderID)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Missing required field: purchase_token",
+		})
+		return
+	}
+
+	switch productType {
+	case 2: // PRODUCT_TYPE_ONE_TIME
+		deleted, err := database.DeleteTransactionByPurchaseToken(project.ProjectID, purchaseToken)
+		if err != nil {
+			logging.Errorf("Failed to remove voided product purchase: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to update transaction",
+			})
+			return
+		}
+		logging.Infof("Google Play one-time product voided - order: %s, removed: %d", orderID, deleted)
+	default: // PRODUCT_TYPE_SUBSCRIPTION
+		subscription, err := database.FindSubscriptionByPurchaseToken(purchaseToken)
+		if err != nil || subscription.ProjectID != project.ProjectID {
+			// Nothing stored for this purchase (yet), nothing to revoke
+			logging.Warnf("Subscription not found for voided purchase - project: %s, order: %s", project.ProjectID, orderID)
+			break
+		}
+
+		before := *subscription
+		subscription.Status = "refunded"
+		subscription.AutoRenewStatus = false
+		if err := database.UpdateSubscription(subscription); err != nil {
+			logging.Errorf("Failed to update voided subscription: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to update subscription",
+			})
+			return
+		}
+		services.PublishSubscriptionTransitionAsync(&before, subscription, services.SubscriptionTrigger{
+			Source:           services.TransitionSourceGoogleNotification,
+			NotificationType: "voided_purchase",
+		})
+
+		// Notify App Backend via webhook if configured
+		if project.HasWebhook() {
+			webhookNotifier := services.NewWebhookNotifier()
+			webhookNotifier.NotifyAppBackendAsync(services.WebhookEndpointFromProject(project), subscription)
+		}
+		logging.Infof("Google Play subscription voided - project: %s, order: %s, subscription: %s",
+			project.ProjectID, orderID, subscription.OriginalTransactionID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Notification processed successfully",
+	})
+}
+
+// handleGooglePlayOneTimeProduct handles Google Play one-time product notifications
+func handleGooglePlayOneTimeProduct(c *gin.Context, project *models.Project, notificationType int, purchaseToken, productID string) {
+	switch notificationType {
+	case 1: // ONE_TIME_PRODUCT_PURCHASED
+		verificationService := services.NewSubscriptionVerificationService()
+		// The user comes from obfuscatedExternalAccountId, or stays the one bound earlier via bind_account
+		transaction, err := verificationService.VerifyGooglePlayProduct(project.ProjectID, purchaseToken, productID, "")
+		if err != nil {
+			logging.Errorf("Failed to verify Google Play product purchase: %v", err)
+			// Still return success to Google (we'll retry later)
+			c.JSON(http.StatusOK, gin.H{
+				"success": true,
+				"message": "Notification received, verification will be retried",
+			})
+			return
+		}
+		logging.Infof("Google Play one-time product purchased - product: %s, order: %s", productID, transaction.TransactionID)
+	case 2: // ONE_TIME_PRODUCT_CANCELED
+		deleted, err := database.DeleteTransactionByPurchaseToken(project.ProjectID, purchaseToken)
+		if err != nil {
+			logging.Errorf("Failed to remove canceled product purchase: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to update transaction",
+			})
+			return
+		}
+		logging.Infof("Google Play one-time product canceled - product: %s, removed: %d", productID, deleted)
+	default:
+		logging.Infof("Unknown one-time product notification type: %d", notificationType)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Notification processed successfully",
+	})
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"verification-api/internal/database"
+	"verification-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// postGooglePlayNotification sends an RTDN wrapped in a Pub/Sub push envelope to the handler
+func postGooglePlayNotification(t *testing.T, notification map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	data, err := json.Marshal(notification)
+	if err != nil {
+		t.Fatalf("marshal notification: %v", err)
+	}
+	envelope, _ := json.Marshal(map[string]interface{}{
+		"message": map[string]string{"data": base64.StdEncoding.EncodeToString(data), "messageId": "1"},
+	})
+
+	router := gin.New()
+	router.POST("/webhook/google", GooglePlayWebhookHandler)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/webhook/google", bytes.NewReader(envelope)))
+	return recorder
+}
+
+// With several projects registered, a notification only touches the project owning its packageName
+func TestGooglePlayWebhookResolvesProjectByPackageName(t *testing.T) {
+	setupTestDB(t)
+	createTestProject(t, models.Project{ProjectID: "app-a", ProjectName: "App A", PackageName: "com.example.a"})
+	createTestProject(t, models.Project{ProjectID: "app-b", ProjectName: "App B", PackageName: "com.example.b"})
+
+	now := time.Now()
+	for _, subscription := range []*models.Subscription{
+		{ProjectID: "app-a", AppAccountToken: "user-a", Platform: "android", Status: "active", ProductID: "pro",
+			TransactionID: "GPA.1111", OriginalTransactionID: "GPA.1111", LatestReceipt: "token-a", PurchaseDate: now, ExpiresDate: now.AddDate(0, 1, 0)},
+		{ProjectID: "app-b", AppAccountToken: "user-b", Platform: "android", Status: "active", ProductID: "pro",
+			TransactionID: "GPA.2222", OriginalTransactionID: "GPA.2222", LatestReceipt: "token-b", PurchaseDate: now, ExpiresDate: now.AddDate(0, 1, 0)},
+	} {
+		if err := database.CreateSubscription(subscription); err != nil {
+			t.Fatalf("create subscription: %v", err)
+		}
+	}
+
+	voided := func(packageName, purchaseToken string) map[string]interface{} {
+		return map[string]interface{}{
+			"version":     "1.0",
+			"packageName": packageName,
+			"voidedPurchaseNotification": map[string]interface{}{
+				"purchaseToken": purchaseToken, "orderId": "GPA.order", "productType": 1, "refundType": 1,
+			},
+		}
+	}
+	statusOf := func(projectID string) string {
+		t.Helper()
+		var subscription models.Subscription
+		if err := database.DB.Where("project_id = ?", projectID).First(&subscription).Error; err != nil {
+			t.Fatalf("load subscription of %s: %v", projectID, err)
+		}
+		return subscription.Status
+	}
+
+	// App A's package must not refund app B's purchase
+	if recorder := postGooglePlayNotification(t, voided("com.example.a", "token-b")); recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", recorder.Code)
+	}
+	if got := statusOf("app-b"); got != "active" {
+		t.Fatalf("app-b status after app-a notification = %q, want active", got)
+	}
+
+	if recorder := postGooglePlayNotification(t, voided("com.example.b", "token-b")); recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", recorder.Code)
+	}
+	if got := statusOf("app-b"); got != "refunded" {
+		t.Errorf("app-b status = %q, want refunded", got)
+	}
+	if got := statusOf("app-a"); got != "active" {
+		t.Errorf("app-a status = %q, want active", got)
+	}
+
+	// Unknown packages are acknowledged so Pub/Sub stops redelivering them
+	recorder := postGooglePlayNotification(t, voided("com.example.unknown", "token-a"))
+	if recorder.Code != http.StatusOK || !bytes.Contains(recorder.Body.Bytes(), []byte(`"success":false`)) {
+		t.Errorf("unknown package response = %d %s, want 200 with success false", recorder.Code, recorder.Body.String())
+	}
+}
+
+// bind_account with a purchase token binds a one-time product stored without a user
+func TestBindAccountBindsOneTimeProduct(t *testing.T) {
+	setupTestDB(t)
+	createTestProject(t, models.Project{ProjectID: "app-a", ProjectName: "App A", PackageName: "com.example.a"})
+	if err := database.CreateOrUpdateTransaction(&models.Transaction{
+		ProjectID: "app-a", TransactionID: "GPA.1111", OriginalTransactionID: "GPA.1111", ProductID: "lifetime",
+		Type: "non_consumable", Environment: "production", PurchasedAt: time.Now(), PurchaseToken: "token-a",
+	}); err != nil {
+		t.Fatalf("create transaction: %v", err)
+	}
+
+	router := gin.New()
+	router.POST("/bind_account", BindAccount)
+	bind := func(purchaseToken string) int {
+		body, _ := json.Marshal(map[string]string{"user_id": "user-a", "purchase_token": purchaseToken})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/bind_account", bytes.NewReader(body)))
+		return recorder.Code
+	}
+
+	if code := bind("unknown-token"); code != http.StatusNotFound {
+		t.Errorf("unknown token status = %d, want 404", code)
+	}
+	if code := bind("token-a"); code != http.StatusOK {
+		t.Fatalf("bind status = %d, want 200", code)
+	}
+	if products := getNonConsumableProductIDs("app-a", "user-a"); len(products) != 1 || products[0] != "lifetime" {
+		t.Errorf("non_consumables = %v, want [lifetime]", products)
+	}
+}
@@ -0,0 +1,21 @@
+package api
+
+import (
+	"verification-api/pkg/metrics"
+)
+
+// recordUnverifiedNotification counts an Apple/Google notification without a valid signature
+// reason is "missing" or "invalid"; action is "rejected" (strict project) or "processed"
+func recordUnverifiedNotification(platform, projectID, environment, reason string, rejected bool) {
+	action := "processed"
+	if rejected {
+		action = "rejected"
+	}
+	metrics.IncCounter("webhook_unverified_notifications_total", map[string]string{
+		"platform":    platform,
+		"project_id":  projectID,
+		"environment": environment,
+		"reason":      reason,
+		"action":      action,
+	})
+}
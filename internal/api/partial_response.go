@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondWithFields writes a JSON response filtered by the "fields" query parameter
+// GET ...?fields=is_active,expires_date returns only those top-level keys (plus "success")
+// Without "fields" the full object is returned; unknown fields are ignored
+// Only used for successful responses, errors are always returned in full
+// Timestamps are converted by the "time_format" query parameter first (see formatTimes)
+func respondWithFields(c *gin.Context, code int, obj interface{}) {
+	c.JSON(code, filterFields(c, formatTimes(c, obj)))
+}
+
+// filterFields returns obj reduced to the keys requested by the "fields" query parameter
+func filterFields(c *gin.Context, obj interface{}) interface{} {
+	fields := parseFields(c.Query("fields"))
+	if len(fields) == 0 {
+		return obj
+	}
+
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return obj
+	}
+	var full map[string]json.RawMessage
+	if err := json.Unmarshal(body, &full); err != nil {
+		// Not a JSON object, nothing to filter
+		return obj
+	}
+
+	filtered := make(map[string]json.RawMessage, len(fields)+1)
+	if success, ok := full["success"]; ok {
+		filtered["success"] = success
+	}
+	for _, field := range fields {
+		if value, ok := full[field]; ok {
+			filtered[field] = value
+		}
+	}
+	return filtered
+}
+
+// parseFields parses a comma-separated field list, ignoring empty entries
+func parseFields(value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,16 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"verification-api/internal/services"
+)
+
+// projectLookupError describes a failed app_id project lookup for the client
+// A deactivated project gets 403 PROJECT_INACTIVE, an unknown app 400 PROJECT_NOT_FOUND
+func projectLookupError(err error) (status int, code, message string) {
+	if errors.Is(err, services.ErrProjectInactive) {
+		return http.StatusForbidden, services.ProjectInactiveCode, "App is inactive: " + err.Error()
+	}
+	return http.StatusBadRequest, services.ProjectNotFoundCode, "App not found: " + err.Error()
+}
@@ -1,10 +1,19 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"verification-api/internal/config"
+	"verification-api/internal/database"
 	"verification-api/internal/middleware"
 	"verification-api/internal/models"
+	"verification-api/internal/response"
 	"verification-api/internal/services"
+	"verification-api/pkg/logging"
+	"verification-api/pkg/metrics"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,8 +23,39 @@ func SetupRoutes(r *gin.Engine) {
 	// Initialize project manager
 	middleware.InitProjectManager()
 
+	// Apply App Store signature verifier configuration
+	signatureVerifier.SetCertCacheTTL(time.Duration(config.AppConfig.AppleCertCacheTTLMinutes) * time.Minute)
+	pubSubPushVerifier = services.NewPubSubPushVerifier(config.AppConfig.GooglePubSubAudience)
+
+	// Replay protection shared across instances via Redis, in memory when Redis is unavailable
+	if redisService, err := services.NewRedisService(); err == nil {
+		replayProtection = services.NewReplayProtection(redisService)
+	} else {
+		logging.Warnf("Replay protection using in-memory store, Redis unavailable: %v", err)
+		replayProtection = services.NewReplayProtection(nil)
+	}
+	// Verified App Store notifications are processed by a worker after the webhook responds
+	if config.AppConfig.AppStoreNotificationQueueEnabled {
+		notificationQueue = services.NewNotificationQueue(processQueuedAppStoreNotification,
+			config.AppConfig.AppStoreNotificationQueueWorkers, config.AppConfig.AppStoreNotificationMaxAttempts)
+		notificationQueue.Start()
+	}
+	if config.AppConfig.AppleCertWarmup {
+		go func() {
+			if err := signatureVerifier.Warmup(); err != nil {
+				logging.Errorf("Apple certificate cache warmup failed (ready after first verified notification): %v", err)
+				return
+			}
+			logging.Infof("Apple certificate cache warmed up")
+		}()
+	}
+
+	// Base route group (BASE_PATH prefix, empty by default)
+	base := r.Group(config.AppConfig.BasePath)
+	base.Use(middleware.RequestCaptureMiddleware())
+
 	// API route group
-	api := r.Group("/api")
+	api := base.Group("/api")
 	{
 		// Verification code routes (require project authentication)
 		verification := api.Group("/verification")
@@ -25,14 +65,33 @@ func SetupRoutes(r *gin.Engine) {
 			verification.POST("/verify-code", VerifyCode)
 		}
 
-		// Project management routes (for admin use)
+		// Project management routes (for admin use, require ADMIN_API_KEYS)
+		// Includes destructive and secret-revealing endpoints (hard deletes, replays, captures, include_secrets)
 		admin := api.Group("/admin")
+		admin.Use(middleware.AdminAuthMiddleware())
 		{
 			admin.GET("/projects", GetProjects)
 			admin.POST("/projects", CreateProject)
+			admin.GET("/projects/:id", GetProject)
 			admin.PUT("/projects/:id", UpdateProject)
 			admin.DELETE("/projects/:id", DeleteProject)
 			admin.GET("/projects/:id/stats", GetProjectStats)
+			admin.POST("/projects/:id/webhooks/test", TestProjectWebhook)
+			admin.POST("/projects/:id/webhooks/replay", ReplayProjectWebhooks)
+			admin.GET("/projects/:id/webhooks/deliveries", ListWebhookDeliveries)
+			admin.POST("/webhooks/:id/redeliver", RedeliverWebhook)
+			admin.GET("/projects/:id/captures", ListRequestCaptures)
+			admin.GET("/projects/:id/captures/:capture_id", GetRequestCapture)
+			admin.GET("/projects/:id/subscriptions", ListProjectSubscriptions)
+			admin.GET("/projects/:id/flagged-users", ListFlaggedUsers)
+			admin.POST("/subscriptions/deduplicate", DeduplicateSubscriptions)
+			admin.DELETE("/subscriptions/:id", DeleteSubscription)
+			admin.POST("/subscriptions/:id/refresh", RefreshSubscription)
+			admin.POST("/notifications/apple/reprocess", ReprocessAppStoreNotification) // Skips replay protection
+			admin.DELETE("/rate-limit", ClearVerificationRateLimit)
+			admin.GET("/project-groups", GetProjectGroups)
+			admin.POST("/project-groups", CreateProjectGroup)
+			admin.GET("/diagnostics", GetDiagnostics)
 		}
 
 		// Statistics and monitoring routes
@@ -45,19 +104,31 @@ func SetupRoutes(r *gin.Engine) {
 		// Subscription routes
 		// Note: /status endpoint supports both authenticated (backend) and unauthenticated (client) requests
 		subscription := api.Group("/subscription")
+		subscription.Use(middleware.IdempotencyMiddleware(database.RedisIdempotencyStore{}))
 		{
 			subscription.POST("/verify", VerifySubscription)
 			subscription.GET("/status", GetSubscriptionStatus) // Supports both client and backend calls
 			subscription.POST("/restore", RestoreSubscription)
 			subscription.POST("/bind_account", BindAccount)      // Bind user_id to subscription
 			subscription.GET("/history", GetSubscriptionHistory) // Get subscription history
+			subscription.GET("/entitled", CheckEntitlement)      // Lightweight entitlement check
+		}
+
+		// Subscription sync, offer signing and transaction lookup (require project authentication)
+		subscriptionSync := api.Group("/subscription")
+		subscriptionSync.Use(middleware.ProjectAuthMiddleware(), middleware.IdempotencyMiddleware(database.RedisIdempotencyStore{}))
+		{
+			subscriptionSync.POST("/sync", SyncSubscriptions)
+			subscriptionSync.POST("/offer-signature", GenerateOfferSignature) // App Store promotional offer signature
+			subscriptionSync.GET("/by-transaction", GetSubscriptionByTransaction)
 		}
 
 		// Verify routes (已移除，完全依赖 Server Notifications)
 		// 不再需要主动验证接口，Apple 会通过 Server Notifications 自动通知
 
 		// Webhook routes (no authentication, called by Apple/Google)
-		webhook := r.Group("/webhook")
+		webhook := base.Group("/webhook")
+		webhook.Use(middleware.MaxBodySizeMiddleware(int64(config.AppConfig.WebhookMaxBodyBytes)))
 		{
 			// Apple webhook routes (separate endpoints for production and sandbox)
 			webhook.POST("/apple/production", AppStoreProductionWebhookHandler) // Production environment
@@ -66,19 +137,78 @@ func SetupRoutes(r *gin.Engine) {
 		}
 	}
 
+	// Metrics (Prometheus text format)
+	base.GET("/metrics", func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain; version=0.0.4")
+		metrics.WritePrometheus(c.Writer)
+	})
+
 	// Health check
-	r.GET("/health", func(c *gin.Context) {
+	base.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"status":  "ok",
 			"service": "unionhub",
 		})
 	})
+
+	// Readiness check (not ready until the Apple cert cache is warmed up, when APPLE_CERT_WARMUP is enabled)
+	base.GET("/health/ready", func(c *gin.Context) {
+		if config.AppConfig.AppleCertWarmup && !signatureVerifier.IsWarmedUp() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"status":  "not_ready",
+				"service": "unionhub",
+				"message": "Apple certificate cache warming up",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "ready",
+			"service": "unionhub",
+		})
+	})
+}
+
+// Shutdown stops the background routines of the API handlers (replay protection cleanup, notification queue workers)
+// Safe to call more than once
+func Shutdown(timeout time.Duration) {
+	if notificationQueue != nil {
+		notificationQueue.Stop(timeout)
+	}
+	if replayProtection != nil {
+		replayProtection.Stop(timeout)
+	}
 }
 
-// GetProjects gets all projects
+// GetProjects gets projects with optional filters
+// GET /api/admin/projects?q=xxx&bundle_id=xxx&package_name=xxx&is_active=true&limit=50&offset=0&include_secrets=true
+// is_active defaults to true; pass is_active=all to include inactive projects
+// Secrets (api_key, webhook_secret) are masked unless include_secrets=true, as in GetProject
 func GetProjects(c *gin.Context) {
+	filter := services.ProjectFilter{
+		Query:       c.Query("q"),
+		BundleID:    c.Query("bundle_id"),
+		PackageName: c.Query("package_name"),
+	}
+
+	switch isActive := c.DefaultQuery("is_active", "true"); isActive {
+	case "all":
+		// No filter
+	default:
+		active, err := strconv.ParseBool(isActive)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "is_active must be true, false or all",
+			})
+			return
+		}
+		filter.IsActive = &active
+	}
+
+	limit, offset := response.ParsePagination(c)
+
 	projectService := services.NewProjectService()
-	projects, err := projectService.GetAllProjects()
+	projects, total, err := projectService.ListProjects(filter, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -87,26 +217,98 @@ func GetProjects(c *gin.Context) {
 		return
 	}
 
+	if c.Query("include_secrets") != "true" {
+		for _, project := range projects {
+			project.APIKey = maskSecret(project.APIKey)
+			project.WebhookSecret = maskSecret(project.WebhookSecret)
+		}
+	}
+
+	response.PaginatedJSON(c, projects, limit, offset, total)
+}
+
+// GetProject gets a single project's full configuration
+// GET /api/admin/projects/:id?include_secrets=true
+// Secrets (api_key, webhook_secret) are masked unless include_secrets=true
+func GetProject(c *gin.Context) {
+	projectID := c.Param("id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Project ID is required",
+		})
+		return
+	}
+
+	projectService := services.NewProjectService()
+	project, err := projectService.GetProjectForAdmin(projectID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Failed to get project: " + err.Error(),
+		})
+		return
+	}
+
+	if c.Query("include_secrets") != "true" {
+		project.APIKey = maskSecret(project.APIKey)
+		project.WebhookSecret = maskSecret(project.WebhookSecret)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data":    projects,
+		"data":    project,
 	})
 }
 
+// maskSecret masks a secret value, keeping only the last 4 characters
+func maskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return "****" + secret[len(secret)-4:]
+}
+
 // CreateProjectRequest represents create project request
 type CreateProjectRequest struct {
-	ProjectID          string `json:"project_id" binding:"required"`
-	ProjectName        string `json:"project_name" binding:"required"`
-	APIKey             string `json:"api_key" binding:"required"`
-	FromName           string `json:"from_name" binding:"required"`
-	TemplateID         string `json:"template_id"`
-	Description        string `json:"description"`
-	ContactEmail       string `json:"contact_email"`
-	MaxRequests        int    `json:"max_requests"`
-	BundleID           string `json:"bundle_id"`            // iOS bundle ID (for subscription center)
-	PackageName        string `json:"package_name"`         // Android package name (for subscription center)
-	WebhookCallbackURL string `json:"webhook_callback_url"` // App Backend webhook URL (optional)
-	WebhookSecret      string `json:"webhook_secret"`       // Webhook signature secret (optional)
+	ProjectID                 string `json:"project_id" binding:"required"`
+	ProjectName               string `json:"project_name" binding:"required"`
+	APIKey                    string `json:"api_key" binding:"required"`
+	FromName                  string `json:"from_name" binding:"required"`
+	FromEmail                 string `json:"from_email"` // Optional, must be a verified Brevo sender; defaults to BREVO_FROM_EMAIL
+	TemplateID                string `json:"template_id"`
+	Description               string `json:"description"`
+	ContactEmail              string `json:"contact_email"`
+	MaxRequests               int    `json:"max_requests"`
+	BundleID                  string `json:"bundle_id"`                   // iOS bundle ID (for subscription center)
+	PackageName               string `json:"package_name"`                // Android package name (for subscription center)
+	WebhookCallbackURL        string `json:"webhook_callback_url"`        // App Backend webhook URL (optional)
+	WebhookSecret             string `json:"webhook_secret"`              // Webhook signature secret (optional)
+	WebhookSandboxURL         string `json:"webhook_sandbox_url"`         // Webhook URL for sandbox subscriptions (optional, falls back to webhook_callback_url)
+	WebhookProductionURL      string `json:"webhook_production_url"`      // Webhook URL for production subscriptions (optional, falls back to webhook_callback_url)
+	WebhookContentType        string `json:"webhook_content_type"`        // Webhook encoding: json (default) or form
+	WebhookSignatureAlgorithm string `json:"webhook_signature_algorithm"` // Webhook HMAC algorithm: sha256 (default) or sha512
+	WebhookSignatureFormat    string `json:"webhook_signature_format"`    // Signature header format: hex (default) or prefixed (sha256=<hex>)
+	PlanStrategy              string `json:"plan_strategy"`               // Plan resolution: suffix (default), map, regex or passthrough
+	PlanMapping               string `json:"plan_mapping"`                // map strategy: JSON object of product_id -> plan
+	PlanPattern               string `json:"plan_pattern"`                // regex strategy: first capture group is the plan
+	EntitlementMapping        string `json:"entitlement_mapping"`         // JSON object of product_id -> entitlement names (optional)
+	AllowedEnvironments       string `json:"allowed_environments"`        // Allowed App Store environments, e.g. "sandbox,production" (empty = all)
+	RequireWebhookSignature   bool   `json:"require_webhook_signature"`   // Reject Apple/Google notifications that lack or fail verification (401)
+	DebugCapture              bool   `json:"debug_capture"`               // Capture sampled requests/responses (REQUEST_CAPTURE_SAMPLE_RATE) for debugging
+	CodeDeliveryMode          string `json:"code_delivery_mode"`          // Verification code delivery: email (default) or webhook
+	CodeDeliveryURL           string `json:"code_delivery_url"`           // webhook mode: URL that receives the signed code payload
+	CodeLength                int    `json:"code_length"`                 // Verification code length, 4-12 (0 = default of 6)
+	CodeType                  string `json:"code_type"`                   // Verification code type: numeric (default) or alphanumeric
+	CodeExpireMinutes         int    `json:"code_expire_minutes"`         // Verification code validity in minutes (0 = CODE_EXPIRE_MINUTES)
+	GroupID                   string `json:"group_id"`                    // Project group sharing verification codes (optional, must exist)
+	TokenResolutionPolicy     string `json:"token_resolution_policy"`     // appAccountToken lookup failure: fallback_to_token (default), store_unresolved or reject
+	MaxTransactionAgeDays     int    `json:"max_transaction_age_days"`    // Reject verify requests for transactions purchased more than N days ago (0 = disabled)
+	WebhookMaxRetries         int    `json:"webhook_max_retries"`         // Webhook retries after the first attempt (0 = default of 2, -1 = no retries)
+	WebhookBackoffBaseMs      int    `json:"webhook_backoff_base_ms"`     // Webhook exponential backoff base in ms (0 = default 1s, 5s schedule)
 }
 
 // CreateProject creates a new project
@@ -120,28 +322,208 @@ func CreateProject(c *gin.Context) {
 		return
 	}
 
+	// Validate webhook callback URL
+	if req.WebhookCallbackURL != "" {
+		if err := services.ValidateWebhookURL(req.WebhookCallbackURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid webhook_callback_url: " + err.Error(),
+			})
+			return
+		}
+	}
+	if err := validateEnvironmentWebhookURLs(req.WebhookSandboxURL, req.WebhookProductionURL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := validateAllowedEnvironments(req.AllowedEnvironments); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if !services.IsValidWebhookContentType(req.WebhookContentType) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid webhook_content_type (must be json or form)",
+		})
+		return
+	}
+
+	if err := services.ValidateWebhookSignatureConfig(req.WebhookSignatureAlgorithm, req.WebhookSignatureFormat); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := validateCodeDelivery(req.CodeDeliveryMode, req.CodeDeliveryURL, req.CodeDeliveryMode == services.CodeDeliveryWebhook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if !services.IsValidTokenResolutionPolicy(req.TokenResolutionPolicy) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid token_resolution_policy (must be fallback_to_token, store_unresolved or reject)",
+		})
+		return
+	}
+
+	if err := validateProjectGroup(req.GroupID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if req.FromEmail != "" {
+		if err := validateProjectFromEmail(req.FromEmail); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
+	if err := services.ValidatePlanConfig(req.PlanStrategy, req.PlanMapping, req.PlanPattern); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid plan configuration: " + err.Error(),
+		})
+		return
+	}
+
+	if err := services.ValidateEntitlementMapping(req.EntitlementMapping); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if req.MaxTransactionAgeDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "max_transaction_age_days must not be negative (0 = disabled)",
+		})
+		return
+	}
+
+	if req.TemplateID != "" {
+		if _, err := services.ParseBrevoTemplateID(req.TemplateID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
+	if err := services.ValidateCodeSettings(req.CodeLength, req.CodeType); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := services.ValidateCodeExpireMinutes(req.CodeExpireMinutes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := services.ValidateWebhookRetryPolicy(req.WebhookMaxRetries, req.WebhookBackoffBaseMs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
 	// Set defaults
 	if req.MaxRequests == 0 {
-		req.MaxRequests = 1000 // 1000 requests per day
+		req.MaxRequests = config.AppConfig.DefaultMaxRequests // requests per day
 	}
 
 	project := &models.Project{
-		ProjectID:          req.ProjectID,
-		ProjectName:        req.ProjectName,
-		APIKey:             req.APIKey,
-		FromName:           req.FromName,
-		TemplateID:         req.TemplateID,
-		Description:        req.Description,
-		ContactEmail:       req.ContactEmail,
-		MaxRequests:        req.MaxRequests,
-		BundleID:           req.BundleID,
-		PackageName:        req.PackageName,
-		WebhookCallbackURL: req.WebhookCallbackURL,
-		WebhookSecret:      req.WebhookSecret,
-		IsActive:           true,
+		ProjectID:                 req.ProjectID,
+		ProjectName:               req.ProjectName,
+		APIKey:                    req.APIKey,
+		FromName:                  req.FromName,
+		FromEmail:                 req.FromEmail,
+		TemplateID:                req.TemplateID,
+		Description:               req.Description,
+		ContactEmail:              req.ContactEmail,
+		MaxRequests:               req.MaxRequests,
+		BundleID:                  req.BundleID,
+		PackageName:               req.PackageName,
+		WebhookCallbackURL:        req.WebhookCallbackURL,
+		WebhookSecret:             req.WebhookSecret,
+		WebhookSandboxURL:         req.WebhookSandboxURL,
+		WebhookProductionURL:      req.WebhookProductionURL,
+		WebhookContentType:        req.WebhookContentType,
+		WebhookSignatureAlgorithm: req.WebhookSignatureAlgorithm,
+		WebhookSignatureFormat:    req.WebhookSignatureFormat,
+		PlanStrategy:              req.PlanStrategy,
+		PlanMapping:               req.PlanMapping,
+		PlanPattern:               req.PlanPattern,
+		EntitlementMapping:        req.EntitlementMapping,
+		AllowedEnvironments:       req.AllowedEnvironments,
+		RequireWebhookSignature:   req.RequireWebhookSignature,
+		DebugCapture:              req.DebugCapture,
+		CodeDeliveryMode:          req.CodeDeliveryMode,
+		CodeDeliveryURL:           req.CodeDeliveryURL,
+		CodeLength:                req.CodeLength,
+		CodeType:                  req.CodeType,
+		CodeExpireMinutes:         req.CodeExpireMinutes,
+		GroupID:                   req.GroupID,
+		TokenResolutionPolicy:     req.TokenResolutionPolicy,
+		MaxTransactionAgeDays:     req.MaxTransactionAgeDays,
+		WebhookMaxRetries:         req.WebhookMaxRetries,
+		WebhookBackoffBaseMs:      req.WebhookBackoffBaseMs,
+		IsActive:                  true,
 	}
 
+	// Grouped projects share codes, so their code settings must match
 	projectService := services.NewProjectService()
+	if err := projectService.ValidateGroupCodeSettings(project); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// Optionally ping the webhook before saving (validate_webhook=true)
+	var webhookValidation []*services.WebhookTestResult
+	if c.Query("validate_webhook") == "true" && project.HasWebhook() {
+		var ok bool
+		if webhookValidation, ok = validateProjectWebhooks(project); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success":            false,
+				"message":            "Webhook validation failed, project not created",
+				"webhook_validation": webhookValidation,
+			})
+			return
+		}
+	}
+
 	if err := projectService.CreateProject(project); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -150,26 +532,53 @@ func CreateProject(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
+	response := gin.H{
 		"success": true,
 		"message": "Project created successfully",
 		"data":    project,
-	})
+	}
+	if webhookValidation != nil {
+		response["webhook_validation"] = webhookValidation
+	}
+	c.JSON(http.StatusCreated, response)
 }
 
 // UpdateProjectRequest represents update project request
 type UpdateProjectRequest struct {
-	ProjectName        string `json:"project_name"`
-	FromName           string `json:"from_name"`
-	TemplateID         string `json:"template_id"`
-	Description        string `json:"description"`
-	ContactEmail       string `json:"contact_email"`
-	MaxRequests        int    `json:"max_requests"`
-	IsActive           *bool  `json:"is_active"`
-	BundleID           string `json:"bundle_id"`            // iOS bundle ID
-	PackageName        string `json:"package_name"`         // Android package name
-	WebhookCallbackURL string `json:"webhook_callback_url"` // App Backend webhook URL (optional)
-	WebhookSecret      string `json:"webhook_secret"`       // Webhook signature secret (optional)
+	ProjectName               string  `json:"project_name"`
+	FromName                  string  `json:"from_name"`
+	FromEmail                 *string `json:"from_email"`  // Must be a verified Brevo sender
+	TemplateID                *string `json:"template_id"` // Brevo template ID (empty string = built-in email text)
+	Description               string  `json:"description"`
+	ContactEmail              string  `json:"contact_email"`
+	MaxRequests               int     `json:"max_requests"`
+	IsActive                  *bool   `json:"is_active"`
+	BundleID                  string  `json:"bundle_id"`                   // iOS bundle ID
+	PackageName               string  `json:"package_name"`                // Android package name
+	WebhookCallbackURL        string  `json:"webhook_callback_url"`        // App Backend webhook URL (optional)
+	WebhookSecret             string  `json:"webhook_secret"`              // Webhook signature secret (optional)
+	WebhookSandboxURL         *string `json:"webhook_sandbox_url"`         // Webhook URL for sandbox subscriptions (empty string = use webhook_callback_url)
+	WebhookProductionURL      *string `json:"webhook_production_url"`      // Webhook URL for production subscriptions (empty string = use webhook_callback_url)
+	WebhookContentType        *string `json:"webhook_content_type"`        // Webhook encoding: json (default) or form
+	WebhookSignatureAlgorithm *string `json:"webhook_signature_algorithm"` // Webhook HMAC algorithm: sha256 (default) or sha512
+	WebhookSignatureFormat    *string `json:"webhook_signature_format"`    // Signature header format: hex (default) or prefixed (sha256=<hex>)
+	PlanStrategy              *string `json:"plan_strategy"`               // Plan resolution: suffix (default), map, regex or passthrough
+	PlanMapping               *string `json:"plan_mapping"`                // map strategy: JSON object of product_id -> plan
+	PlanPattern               *string `json:"plan_pattern"`                // regex strategy: first capture group is the plan
+	EntitlementMapping        *string `json:"entitlement_mapping"`         // JSON object of product_id -> entitlement names (empty string = none)
+	AllowedEnvironments       *string `json:"allowed_environments"`        // Allowed App Store environments (empty string = all)
+	RequireWebhookSignature   *bool   `json:"require_webhook_signature"`   // Reject Apple/Google notifications that lack or fail verification (401)
+	DebugCapture              *bool   `json:"debug_capture"`               // Capture sampled requests/responses (REQUEST_CAPTURE_SAMPLE_RATE) for debugging
+	CodeDeliveryMode          *string `json:"code_delivery_mode"`          // Verification code delivery: email (default) or webhook
+	CodeDeliveryURL           *string `json:"code_delivery_url"`           // webhook mode: URL that receives the signed code payload
+	CodeLength                *int    `json:"code_length"`                 // Verification code length, 4-12 (0 = default of 6)
+	CodeType                  *string `json:"code_type"`                   // Verification code type: numeric (default) or alphanumeric
+	CodeExpireMinutes         *int    `json:"code_expire_minutes"`         // Verification code validity in minutes (0 = CODE_EXPIRE_MINUTES)
+	GroupID                   *string `json:"group_id"`                    // Project group sharing verification codes (empty string = leave group)
+	TokenResolutionPolicy     *string `json:"token_resolution_policy"`     // appAccountToken lookup failure: fallback_to_token (default), store_unresolved or reject
+	MaxTransactionAgeDays     *int    `json:"max_transaction_age_days"`    // Reject verify requests for transactions purchased more than N days ago (0 = disabled)
+	WebhookMaxRetries         *int    `json:"webhook_max_retries"`         // Webhook retries after the first attempt (0 = default of 2, -1 = no retries)
+	WebhookBackoffBaseMs      *int    `json:"webhook_backoff_base_ms"`     // Webhook exponential backoff base in ms (0 = default 1s, 5s schedule)
 }
 
 // UpdateProject updates an existing project
@@ -192,6 +601,109 @@ func UpdateProject(c *gin.Context) {
 		return
 	}
 
+	// Validate webhook callback URL
+	if req.WebhookCallbackURL != "" {
+		if err := services.ValidateWebhookURL(req.WebhookCallbackURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid webhook_callback_url: " + err.Error(),
+			})
+			return
+		}
+	}
+	var sandboxURL, productionURL string
+	if req.WebhookSandboxURL != nil {
+		sandboxURL = *req.WebhookSandboxURL
+	}
+	if req.WebhookProductionURL != nil {
+		productionURL = *req.WebhookProductionURL
+	}
+	if err := validateEnvironmentWebhookURLs(sandboxURL, productionURL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if req.AllowedEnvironments != nil {
+		if err := validateAllowedEnvironments(*req.AllowedEnvironments); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	if req.WebhookContentType != nil && !services.IsValidWebhookContentType(*req.WebhookContentType) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid webhook_content_type (must be json or form)",
+		})
+		return
+	}
+	if req.WebhookSignatureAlgorithm != nil {
+		if err := services.ValidateWebhookSignatureConfig(*req.WebhookSignatureAlgorithm, ""); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	if req.WebhookSignatureFormat != nil {
+		if err := services.ValidateWebhookSignatureConfig("", *req.WebhookSignatureFormat); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	if req.CodeDeliveryMode != nil || req.CodeDeliveryURL != nil {
+		mode, deliveryURL := "", ""
+		if req.CodeDeliveryMode != nil {
+			mode = *req.CodeDeliveryMode
+		}
+		if req.CodeDeliveryURL != nil {
+			deliveryURL = *req.CodeDeliveryURL
+		}
+		// An omitted code_delivery_url keeps the stored one, an empty one can't be combined with webhook mode
+		if err := validateCodeDelivery(mode, deliveryURL, mode == services.CodeDeliveryWebhook && req.CodeDeliveryURL != nil); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
+	if req.TokenResolutionPolicy != nil && !services.IsValidTokenResolutionPolicy(*req.TokenResolutionPolicy) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid token_resolution_policy (must be fallback_to_token, store_unresolved or reject)",
+		})
+		return
+	}
+	if req.GroupID != nil {
+		if err := validateProjectGroup(*req.GroupID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	if req.FromEmail != nil {
+		if err := validateProjectFromEmail(*req.FromEmail); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
 	// Build update map
 	updates := make(map[string]interface{})
 	if req.ProjectName != "" {
@@ -200,8 +712,20 @@ func UpdateProject(c *gin.Context) {
 	if req.FromName != "" {
 		updates["from_name"] = req.FromName
 	}
-	if req.TemplateID != "" {
-		updates["template_id"] = req.TemplateID
+	if req.FromEmail != nil {
+		updates["from_email"] = *req.FromEmail
+	}
+	if req.TemplateID != nil {
+		if *req.TemplateID != "" {
+			if _, err := services.ParseBrevoTemplateID(*req.TemplateID); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"success": false,
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+		updates["template_id"] = *req.TemplateID
 	}
 	if req.Description != "" {
 		updates["description"] = req.Description
@@ -228,8 +752,171 @@ func UpdateProject(c *gin.Context) {
 	if req.WebhookSecret != "" || c.Query("remove_webhook") == "true" {
 		updates["webhook_secret"] = req.WebhookSecret
 	}
+	if req.WebhookSandboxURL != nil {
+		updates["webhook_sandbox_url"] = *req.WebhookSandboxURL
+	}
+	if req.WebhookProductionURL != nil {
+		updates["webhook_production_url"] = *req.WebhookProductionURL
+	}
+	if req.AllowedEnvironments != nil {
+		updates["allowed_environments"] = *req.AllowedEnvironments
+	}
+	if req.RequireWebhookSignature != nil {
+		updates["require_webhook_signature"] = *req.RequireWebhookSignature
+	}
+	if req.DebugCapture != nil {
+		updates["debug_capture"] = *req.DebugCapture
+	}
+	if req.CodeDeliveryMode != nil {
+		updates["code_delivery_mode"] = *req.CodeDeliveryMode
+	}
+	if req.CodeDeliveryURL != nil {
+		updates["code_delivery_url"] = *req.CodeDeliveryURL
+	}
+	if req.CodeLength != nil {
+		if err := services.ValidateCodeSettings(*req.CodeLength, ""); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		updates["code_length"] = *req.CodeLength
+	}
+	if req.CodeType != nil {
+		if err := services.ValidateCodeSettings(0, *req.CodeType); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		updates["code_type"] = *req.CodeType
+	}
+	if req.CodeExpireMinutes != nil {
+		if err := services.ValidateCodeExpireMinutes(*req.CodeExpireMinutes); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		updates["code_expire_minutes"] = *req.CodeExpireMinutes
+	}
+	if req.GroupID != nil {
+		updates["group_id"] = *req.GroupID
+	}
+	if req.TokenResolutionPolicy != nil {
+		updates["token_resolution_policy"] = *req.TokenResolutionPolicy
+	}
+	if req.MaxTransactionAgeDays != nil {
+		if *req.MaxTransactionAgeDays < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "max_transaction_age_days must not be negative (0 = disabled)",
+			})
+			return
+		}
+		updates["max_transaction_age_days"] = *req.MaxTransactionAgeDays
+	}
+	if req.WebhookMaxRetries != nil {
+		if err := services.ValidateWebhookRetryPolicy(*req.WebhookMaxRetries, 0); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		updates["webhook_max_retries"] = *req.WebhookMaxRetries
+	}
+	if req.WebhookBackoffBaseMs != nil {
+		if err := services.ValidateWebhookRetryPolicy(0, *req.WebhookBackoffBaseMs); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		updates["webhook_backoff_base_ms"] = *req.WebhookBackoffBaseMs
+	}
+	if req.WebhookContentType != nil {
+		updates["webhook_content_type"] = *req.WebhookContentType
+	}
+	if req.WebhookSignatureAlgorithm != nil {
+		updates["webhook_signature_algorithm"] = *req.WebhookSignatureAlgorithm
+	}
+	if req.WebhookSignatureFormat != nil {
+		updates["webhook_signature_format"] = *req.WebhookSignatureFormat
+	}
+	if req.PlanStrategy != nil {
+		updates["plan_strategy"] = *req.PlanStrategy
+	}
+	if req.PlanMapping != nil {
+		updates["plan_mapping"] = *req.PlanMapping
+	}
+	if req.PlanPattern != nil {
+		updates["plan_pattern"] = *req.PlanPattern
+	}
+	if err := validatePlanUpdates(projectID, updates); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid plan configuration: " + err.Error(),
+		})
+		return
+	}
+	if req.EntitlementMapping != nil {
+		if err := services.ValidateEntitlementMapping(*req.EntitlementMapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		updates["entitlement_mapping"] = *req.EntitlementMapping
+	}
+
+	// Optionally ping the resulting webhook configuration before saving (validate_webhook=true)
+	var webhookValidation []*services.WebhookTestResult
+	if c.Query("validate_webhook") == "true" {
+		updated, err := projectWithWebhookUpdates(projectID, updates)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "Failed to get project: " + err.Error(),
+			})
+			return
+		}
+		if updated.HasWebhook() {
+			var ok bool
+			if webhookValidation, ok = validateProjectWebhooks(updated); !ok {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"success":            false,
+					"message":            "Webhook validation failed, project not updated",
+					"webhook_validation": webhookValidation,
+				})
+				return
+			}
+		}
+	}
 
 	projectService := services.NewProjectService()
+	if updatesCodeSettings(updates) {
+		updated, err := projectWithCodeUpdates(projectID, updates)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "Failed to get project: " + err.Error(),
+			})
+			return
+		}
+		if err := projectService.ValidateGroupCodeSettings(updated); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
 	if err := projectService.UpdateProject(projectID, updates); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -238,10 +925,145 @@ func UpdateProject(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"success": true,
 		"message": "Project updated successfully",
-	})
+	}
+	if webhookValidation != nil {
+		response["webhook_validation"] = webhookValidation
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// validatePlanUpdates validates the resulting plan configuration of a project update
+// Fields not being updated keep their stored values
+func validatePlanUpdates(projectID string, updates map[string]interface{}) error {
+	_, hasStrategy := updates["plan_strategy"]
+	_, hasMapping := updates["plan_mapping"]
+	_, hasPattern := updates["plan_pattern"]
+	if !hasStrategy && !hasMapping && !hasPattern {
+		return nil
+	}
+
+	var strategy, mapping, pattern string
+	if project, err := services.NewProjectService().GetProjectForAdmin(projectID); err == nil {
+		strategy, mapping, pattern = project.PlanStrategy, project.PlanMapping, project.PlanPattern
+	}
+	if v, ok := updates["plan_strategy"].(string); ok {
+		strategy = v
+	}
+	if v, ok := updates["plan_mapping"].(string); ok {
+		mapping = v
+	}
+	if v, ok := updates["plan_pattern"].(string); ok {
+		pattern = v
+	}
+	return services.ValidatePlanConfig(strategy, mapping, pattern)
+}
+
+// validateEnvironmentWebhookURLs validates the optional per-environment webhook URLs (empty = not set)
+func validateEnvironmentWebhookURLs(sandboxURL, productionURL string) error {
+	if sandboxURL != "" {
+		if err := services.ValidateWebhookURL(sandboxURL); err != nil {
+			return fmt.Errorf("invalid webhook_sandbox_url: %w", err)
+		}
+	}
+	if productionURL != "" {
+		if err := services.ValidateWebhookURL(productionURL); err != nil {
+			return fmt.Errorf("invalid webhook_production_url: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateCodeDelivery checks the verification code delivery mode and URL
+func validateCodeDelivery(mode, deliveryURL string, requireURL bool) error {
+	if !services.IsValidCodeDeliveryMode(mode) {
+		return fmt.Errorf("invalid code_delivery_mode %q (must be email or webhook)", mode)
+	}
+	if deliveryURL == "" {
+		if requireURL {
+			return fmt.Errorf("code_delivery_url is required for webhook code delivery")
+		}
+		return nil
+	}
+	if err := services.ValidateWebhookURL(deliveryURL); err != nil {
+		return fmt.Errorf("invalid code_delivery_url: %w", err)
+	}
+	return nil
+}
+
+// validateProjectGroup checks that a non-empty group_id refers to an existing project group
+func validateProjectGroup(groupID string) error {
+	if groupID == "" {
+		return nil
+	}
+	projectService := services.NewProjectService()
+	if _, err := projectService.GetProjectGroup(groupID); err != nil {
+		return fmt.Errorf("Invalid group_id: %v", err)
+	}
+	return nil
+}
+
+// codeSettingsColumns are the project columns that must match within a project group
+var codeSettingsColumns = []string{"code_length", "code_type", "code_expire_minutes", "group_id"}
+
+// updatesCodeSettings reports whether a project update changes a column checked by ValidateGroupCodeSettings
+func updatesCodeSettings(updates map[string]interface{}) bool {
+	for _, column := range codeSettingsColumns {
+		if _, ok := updates[column]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// projectWithCodeUpdates loads a project and applies the pending code settings and group updates (not saved)
+func projectWithCodeUpdates(projectID string, updates map[string]interface{}) (*models.Project, error) {
+	project, err := services.NewProjectService().GetProjectForAdmin(projectID)
+	if err != nil {
+		return nil, err
+	}
+	if value, ok := updates["code_length"].(int); ok {
+		project.CodeLength = value
+	}
+	if value, ok := updates["code_type"].(string); ok {
+		project.CodeType = value
+	}
+	if value, ok := updates["code_expire_minutes"].(int); ok {
+		project.CodeExpireMinutes = value
+	}
+	if value, ok := updates["group_id"].(string); ok {
+		project.GroupID = value
+	}
+	return project, nil
+}
+
+// validateProjectFromEmail checks a project from_email: a valid address that is a verified sender of the Brevo account
+// The Brevo check is skipped when BREVO_API_KEY is not configured (no email is sent through Brevo then)
+func validateProjectFromEmail(email string) error {
+	if err := services.ValidateFromEmail(email); err != nil {
+		return err
+	}
+	if config.AppConfig.BrevoAPIKey == "" {
+		return nil
+	}
+	return services.NewBrevoService().VerifySender(email)
+}
+
+// validateAllowedEnvironments checks a comma-separated allowed_environments value
+func validateAllowedEnvironments(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	for _, env := range strings.Split(value, ",") {
+		switch strings.ToLower(strings.TrimSpace(env)) {
+		case "sandbox", "production":
+		default:
+			return fmt.Errorf("Invalid allowed_environments: %q (must be sandbox or production)", env)
+		}
+	}
+	return nil
 }
 
 // DeleteProject deletes a project
@@ -301,3 +1123,44 @@ func GetProjectStats(c *gin.Context) {
 		"data":    stats,
 	})
 }
+
+// TestProjectWebhook sends a synthetic webhook event to the project's callback URL
+// POST /api/admin/projects/:id/webhooks/test?environment=sandbox
+// Returns the delivery result (HTTP status, latency, error) synchronously
+func TestProjectWebhook(c *gin.Context) {
+	projectID := c.Param("id")
+	if projectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Project ID is required",
+		})
+		return
+	}
+
+	projectService := services.NewProjectService()
+	project, err := projectService.GetProjectForAdmin(projectID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Failed to get project: " + err.Error(),
+		})
+		return
+	}
+
+	endpoint := services.WebhookEndpointFromProject(project).ForEnvironment(c.Query("environment"))
+	if endpoint.URL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Webhook callback URL is not configured for this project",
+		})
+		return
+	}
+
+	webhookNotifier := services.NewWebhookNotifier()
+	result := webhookNotifier.SendTestWebhook(endpoint)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": result.Error == "",
+		"data":    result,
+	})
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"verification-api/internal/database"
+	"verification-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// putProject sends an update request for a project to the handler
+func putProject(t *testing.T, projectID, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	router := gin.New()
+	router.PUT("/admin/projects/:id", UpdateProject)
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPut, "/admin/projects/"+projectID, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestUpdateProjectTemplateID(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		want       string
+	}{
+		{name: "omitted keeps the template", body: `{"description": "updated"}`, wantStatus: http.StatusOK, want: "12"},
+		{name: "set to another template", body: `{"template_id": "34"}`, wantStatus: http.StatusOK, want: "34"},
+		{name: "empty string clears the template", body: `{"template_id": ""}`, wantStatus: http.StatusOK, want: ""},
+		{name: "non-numeric is rejected", body: `{"template_id": "welcome"}`, wantStatus: http.StatusBadRequest, want: "12"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			createTestProject(t, models.Project{ProjectID: "app-a", ProjectName: "App A", TemplateID: "12"})
+
+			recorder := putProject(t, "app-a", tt.body)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+
+			var project models.Project
+			if err := database.DB.Where("project_id = ?", "app-a").First(&project).Error; err != nil {
+				t.Fatalf("load project: %v", err)
+			}
+			if project.TemplateID != tt.want {
+				t.Errorf("template_id = %q, want %q", project.TemplateID, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetProjectsMasksSecrets(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "masked by default", query: "", want: "****7890"},
+		{name: "include_secrets reveals", query: "?include_secrets=true", want: "key-app-a-1234567890"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			createTestProject(t, models.Project{ProjectID: "app-a", ProjectName: "App A", APIKey: "key-app-a-1234567890", WebhookSecret: "hook-app-a-1234567890"})
+
+			router := gin.New()
+			router.GET("/admin/projects", GetProjects)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/projects"+tt.query, nil))
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", recorder.Code, recorder.Body.String())
+			}
+
+			var body struct {
+				Data []models.Project `json:"data"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if len(body.Data) != 1 {
+				t.Fatalf("got %d projects, want 1", len(body.Data))
+			}
+			if body.Data[0].APIKey != tt.want {
+				t.Errorf("api_key = %q, want %q", body.Data[0].APIKey, tt.want)
+			}
+			if tt.query == "" && body.Data[0].WebhookSecret == "hook-app-a-1234567890" {
+				t.Errorf("webhook_secret is not masked")
+			}
+		})
+	}
+}
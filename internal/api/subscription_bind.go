@@ -4,27 +4,16 @@ import (
 	"net/http"
 	"verification-api/internal/database"
 	"verification-api/internal/models"
+	"verification-api/pkg/client"
 	"verification-api/pkg/logging"
 
 	"github.com/gin-gonic/gin"
 )
 
-// BindAccountRequest represents bind account request
-type BindAccountRequest struct {
-	UserID string `json:"user_id" binding:"required"` // User ID to bind
-
-	// iOS specific
-	OriginalTransactionID string `json:"original_transaction_id,omitempty"` // iOS original transaction ID
-
-	// Android specific
-	PurchaseToken string `json:"purchase_token,omitempty"` // Android purchase token
-}
-
-// BindAccountResponse represents bind account response
-type BindAccountResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-}
+type (
+	BindAccountRequest  = client.BindAccountRequest
+	BindAccountResponse = client.BindAccountResponse
+)
 
 // BindAccount binds user_id to a subscription
 // POST /api/subscription/bind_account
@@ -60,6 +49,26 @@ func BindAccount(c *gin.Context) {
 	} else {
 		// Android: Find by purchase_token
 		subscription, err = database.FindSubscriptionByPurchaseToken(req.PurchaseToken)
+		if err != nil {
+			// Android one-time products are stored as transactions; bind them when the purchase
+			// carried no obfuscatedExternalAccountId, otherwise they never show up in non_consumables
+			bound, bindErr := database.BindTransactionsByPurchaseToken(req.PurchaseToken, req.UserID)
+			if bindErr != nil {
+				logging.Errorf("Failed to bind product purchase: %v", bindErr)
+				c.JSON(http.StatusInternalServerError, BindAccountResponse{
+					Success: false,
+					Message: "Failed to bind account",
+				})
+				return
+			}
+			if bound > 0 {
+				c.JSON(http.StatusOK, BindAccountResponse{
+					Success: true,
+					Message: "Account bound successfully",
+				})
+				return
+			}
+		}
 	}
 
 	if err != nil {
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"time"
+	"verification-api/internal/database"
+	"verification-api/internal/models"
+	"verification-api/internal/services"
+	"verification-api/pkg/client"
+
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	EntitlementCheckResponse = client.EntitlementCheckResponse
+)
+
+// CheckEntitlement reports whether a user is entitled right now
+// GET /api/subscription/entitled?user_id=xxx&app_id=yyy&product_id=zzz&platform=ios
+// Minimal answer for high-frequency feature gating; product_id is optional (any product when empty)
+// Can be called by both client and app backend, like /status
+func CheckEntitlement(c *gin.Context) {
+	userID := c.Query("user_id")
+	appID := c.Query("app_id")
+	productID := c.Query("product_id")
+	platform := c.DefaultQuery("platform", "ios") // Default to ios
+
+	if userID == "" || appID == "" {
+		c.JSON(http.StatusBadRequest, EntitlementCheckResponse{
+			Success: false,
+			Message: "user_id and app_id are required",
+		})
+		return
+	}
+
+	projectService := services.NewProjectService()
+	var project *models.Project
+	var err error
+	if platform == "ios" {
+		project, err = projectService.GetProjectByBundleID(appID)
+	} else {
+		project, err = projectService.GetProjectByPackageName(appID)
+	}
+	if err != nil {
+		status, code, message := projectLookupError(err)
+		c.JSON(status, EntitlementCheckResponse{
+			Success: false,
+			Message: message,
+			Code:    code,
+		})
+		return
+	}
+
+	check, cached := database.GetCachedEntitlement(project.ProjectID, userID, productID)
+	if !cached {
+		entitled, expiresDate, err := database.CheckUserHasActiveSubscription(project.ProjectID, userID, productID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, EntitlementCheckResponse{
+				Success: false,
+				Message: "Failed to check entitlement: " + err.Error(),
+			})
+			return
+		}
+		check = database.EntitlementCheck{Entitled: entitled, ExpiresDate: expiresDate}
+		database.SetCachedEntitlement(project.ProjectID, userID, productID, check)
+	}
+
+	response := EntitlementCheckResponse{
+		Success:  true,
+		Entitled: check.Entitled,
+	}
+	if check.Entitled {
+		response.ExpiresDate = check.ExpiresDate.Format(time.RFC3339)
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -2,36 +2,18 @@ package api
 
 import (
 	"net/http"
-	"time"
 	"verification-api/internal/database"
 	"verification-api/internal/models"
 	"verification-api/internal/services"
+	"verification-api/pkg/client"
 
 	"github.com/gin-gonic/gin"
 )
 
-// SubscriptionHistoryItem represents a subscription history item
-type SubscriptionHistoryItem struct {
-	ID                  uint      `json:"id"`
-	AppAccountToken     string    `json:"app_account_token"`
-	Platform            string    `json:"platform"`
-	Status              string    `json:"status"`
-	ProductID           string    `json:"product_id"`
-	TransactionID       string    `json:"transaction_id"`
-	OriginalTransactionID string  `json:"original_transaction_id"`
-	PurchaseDate        time.Time `json:"purchase_date"`
-	ExpiresDate         time.Time `json:"expires_date"`
-	AutoRenew           bool      `json:"auto_renew"`
-	CreatedAt           time.Time `json:"created_at"`
-	UpdatedAt           time.Time `json:"updated_at"`
-}
-
-// SubscriptionHistoryResponse represents subscription history response
-type SubscriptionHistoryResponse struct {
-	Success      bool                     `json:"success"`
-	Message      string                   `json:"message,omitempty"`
-	Subscriptions []SubscriptionHistoryItem `json:"subscriptions,omitempty"`
-}
+type (
+	SubscriptionHistoryItem     = client.SubscriptionHistoryItem
+	SubscriptionHistoryResponse = client.SubscriptionHistoryResponse
+)
 
 // GetSubscriptionHistory gets subscription history for a user
 // GET /api/subscription/history?user_id=xxx&app_id=yyy&platform=ios
@@ -61,9 +43,11 @@ func GetSubscriptionHistory(c *gin.Context) {
 		}
 
 		if err != nil {
-			c.JSON(http.StatusBadRequest, SubscriptionHistoryResponse{
+			status, code, message := projectLookupError(err)
+			c.JSON(status, SubscriptionHistoryResponse{
 				Success: false,
-				Message: "App not found: " + err.Error(),
+				Message: message,
+				Code:    code,
 			})
 			return
 		}
@@ -87,27 +71,37 @@ func GetSubscriptionHistory(c *gin.Context) {
 	}
 
 	// Convert to response format
+	historyItems := toSubscriptionHistoryItems(subscriptions)
+
+	respondWithFields(c, http.StatusOK, SubscriptionHistoryResponse{
+		Success:      true,
+		Subscriptions: historyItems,
+	})
+}
+
+// toSubscriptionHistoryItems converts subscriptions to history item format
+func toSubscriptionHistoryItems(subscriptions []models.Subscription) []SubscriptionHistoryItem {
 	historyItems := make([]SubscriptionHistoryItem, len(subscriptions))
+	planResolver := services.NewPlanResolver()
 	for i, sub := range subscriptions {
 		historyItems[i] = SubscriptionHistoryItem{
-			ID:                  sub.ID,
-			AppAccountToken:     sub.AppAccountToken,
-			Platform:            sub.Platform,
-			Status:              sub.Status,
-			ProductID:           sub.ProductID,
-			TransactionID:       sub.TransactionID,
+			ID:                    sub.ID,
+			AppAccountToken:       sub.AppAccountToken,
+			Platform:              sub.Platform,
+			Status:                sub.Status,
+			Plan:                  planResolver.Resolve(&sub),
+			BillingPeriod:         sub.BillingPeriod,
+			ProductID:             sub.ProductID,
+			SubscriptionGroupID:   sub.SubscriptionGroupID,
+			TransactionID:         sub.TransactionID,
 			OriginalTransactionID: sub.OriginalTransactionID,
-			PurchaseDate:        sub.PurchaseDate,
-			ExpiresDate:         sub.ExpiresDate,
-			AutoRenew:           sub.AutoRenewStatus,
-			CreatedAt:           sub.CreatedAt,
-			UpdatedAt:           sub.UpdatedAt,
+			PurchaseDate:          sub.PurchaseDate,
+			ExpiresDate:           sub.ExpiresDate,
+			AutoRenew:             sub.AutoRenewStatus,
+			RenewalCount:          sub.RenewalCount,
+			CreatedAt:             sub.CreatedAt,
+			UpdatedAt:             sub.UpdatedAt,
 		}
 	}
-
-	c.JSON(http.StatusOK, SubscriptionHistoryResponse{
-		Success:      true,
-		Subscriptions: historyItems,
-	})
+	return historyItems
 }
-
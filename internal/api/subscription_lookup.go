@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+	"verification-api/internal/database"
+	"verification-api/internal/models"
+	"verification-api/internal/services"
+	"verification-api/pkg/client"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type (
+	SubscriptionByTransactionResponse = client.SubscriptionByTransactionResponse
+)
+
+// GetSubscriptionByTransaction looks up a subscription by transaction_id
+// GET /api/subscription/by-transaction?transaction_id=xxx&app_id=yyy&platform=ios (requires project authentication)
+// For App Backends that only kept a transaction_id (not the original one)
+func GetSubscriptionByTransaction(c *gin.Context) {
+	transactionID := c.Query("transaction_id")
+	appID := c.Query("app_id")
+	platform := c.DefaultQuery("platform", "ios") // Default to ios
+
+	if transactionID == "" || appID == "" {
+		c.JSON(http.StatusBadRequest, SubscriptionByTransactionResponse{
+			Success: false,
+			Message: "transaction_id and app_id are required",
+		})
+		return
+	}
+
+	projectService := services.NewProjectService()
+	var project *models.Project
+	var err error
+	if platform == "ios" {
+		project, err = projectService.GetProjectByBundleID(appID)
+	} else {
+		project, err = projectService.GetProjectByPackageName(appID)
+	}
+	if err != nil {
+		status, code, message := projectLookupError(err)
+		c.JSON(status, SubscriptionByTransactionResponse{
+			Success: false,
+			Message: message,
+			Code:    code,
+		})
+		return
+	}
+
+	// The app must belong to the authenticated project
+	if projectID, exists := c.Get("project_id"); !exists || projectID.(string) != project.ProjectID {
+		c.JSON(http.StatusForbidden, SubscriptionByTransactionResponse{
+			Success: false,
+			Message: "App does not belong to the authenticated project",
+		})
+		return
+	}
+
+	subscription, err := database.GetSubscriptionByTransactionID(project.ProjectID, transactionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, SubscriptionByTransactionResponse{
+				Success: false,
+				Message: "Subscription not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, SubscriptionByTransactionResponse{
+			Success: false,
+			Message: "Failed to get subscription: " + err.Error(),
+		})
+		return
+	}
+
+	item := toSubscriptionHistoryItems([]models.Subscription{*subscription})[0]
+	respondWithFields(c, http.StatusOK, SubscriptionByTransactionResponse{
+		Success:      true,
+		IsActive:     subscription.IsEntitled(time.Now()),
+		Subscription: &item,
+	})
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+	"verification-api/internal/services"
+	"verification-api/pkg/client"
+	"verification-api/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	OfferSignatureRequest  = client.OfferSignatureRequest
+	OfferSignatureResponse = client.OfferSignatureResponse
+)
+
+// GenerateOfferSignature signs an App Store promotional offer for the authenticated project's app
+// POST /api/subscription/offer-signature (requires project authentication)
+func GenerateOfferSignature(c *gin.Context) {
+	var req OfferSignatureRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, OfferSignatureResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	projectID := c.GetString("project_id")
+	projectService := services.NewProjectService()
+	project, err := projectService.GetProjectByID(projectID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, OfferSignatureResponse{
+			Success: false,
+			Message: "Project not found",
+		})
+		return
+	}
+	if project.BundleID == "" {
+		c.JSON(http.StatusBadRequest, OfferSignatureResponse{
+			Success: false,
+			Message: "bundle_id is not configured for this project",
+		})
+		return
+	}
+
+	signature, err := services.GeneratePromotionalOfferSignature(project.BundleID, req.ProductID, req.OfferID, req.AppAccountToken)
+	if err != nil {
+		logging.Errorf("Failed to generate offer signature - project: %s, product: %s, offer: %s: %v",
+			projectID, req.ProductID, req.OfferID, err)
+		c.JSON(http.StatusInternalServerError, OfferSignatureResponse{
+			Success: false,
+			Message: "Failed to generate offer signature",
+		})
+		return
+	}
+
+	logging.Infof("Generated offer signature - project: %s, product: %s, offer: %s", projectID, req.ProductID, req.OfferID)
+	c.JSON(http.StatusOK, OfferSignatureResponse{
+		Success:   true,
+		KeyID:     signature.KeyID,
+		Nonce:     signature.Nonce,
+		Timestamp: signature.Timestamp,
+		Signature: signature.Signature,
+	})
+}
@@ -3,51 +3,22 @@ package api
 import (
 	"net/http"
 	"time"
+	"verification-api/internal/config"
 	"verification-api/internal/database"
 	"verification-api/internal/models"
 	"verification-api/internal/services"
+	"verification-api/pkg/client"
 	"verification-api/pkg/logging"
 
 	"github.com/gin-gonic/gin"
 )
 
-// TransactionInfo represents a transaction to restore
-type TransactionInfo struct {
-	SignedTransaction string `json:"signed_transaction,omitempty"` // JWT signed transaction (iOS)
-	TransactionID     string `json:"transaction_id,omitempty"`     // Transaction ID (iOS)
-	ProductID         string `json:"product_id,omitempty"`          // Product ID
-}
-
-// RestoreSubscriptionRequest represents restore subscription request
-// Supports two modes:
-// 1. Active restore: Client provides transaction list, UnionHub verifies each one
-// 2. Passive restore: Client only provides user_id, UnionHub looks up from database
-type RestoreSubscriptionRequest struct {
-	UserID      string           `json:"user_id" binding:"required"`      // User ID from the app
-	AppID       string           `json:"app_id,omitempty"`                // Bundle ID (iOS) or Package Name (Android) - optional if transactions provided
-	Platform    string           `json:"platform" binding:"required,oneof=ios android"` // ios or android
-	Transactions []TransactionInfo `json:"transactions,omitempty"`        // List of transactions to verify (for active restore)
-}
-
-// SubscriptionInfo represents a subscription in restore response
-type SubscriptionInfo struct {
-	IsActive    bool   `json:"is_active"`
-	Status      string `json:"status"`
-	ExpiresDate string `json:"expires_date,omitempty"`
-	ProductID   string `json:"product_id,omitempty"`
-	AutoRenew   bool   `json:"auto_renew,omitempty"`
-}
-
-// RestoreSubscriptionResponse represents restore subscription response
-type RestoreSubscriptionResponse struct {
-	Success      bool              `json:"success"`
-	Message      string            `json:"message"`
-	Subscriptions []SubscriptionInfo `json:"subscriptions,omitempty"` // List of all active subscriptions
-	// Legacy fields (for backward compatibility)
-	IsActive  bool   `json:"is_active,omitempty"`
-	ExpiresAt string `json:"expires_at,omitempty"`
-	ProductID string `json:"product_id,omitempty"`
-}
+type (
+	TransactionInfo             = client.RestoreTransaction
+	RestoreSubscriptionRequest  = client.RestoreSubscriptionRequest
+	SubscriptionInfo            = client.SubscriptionInfo
+	RestoreSubscriptionResponse = client.RestoreSubscriptionResponse
+)
 
 // RestoreSubscription restores subscription by verifying transactions
 // POST /api/subscription/restore
@@ -76,9 +47,11 @@ func RestoreSubscription(c *gin.Context) {
 			project, err = projectService.GetProjectByPackageName(req.AppID)
 		}
 		if err != nil {
-			c.JSON(http.StatusBadRequest, RestoreSubscriptionResponse{
+			status, code, message := projectLookupError(err)
+			c.JSON(status, RestoreSubscriptionResponse{
 				Success: false,
-				Message: "App not found: " + err.Error(),
+				Message: message,
+				Code:    code,
 			})
 			return
 		}
@@ -114,6 +87,7 @@ func RestoreSubscription(c *gin.Context) {
 					tx.TransactionID,
 					tx.ProductID,
 					req.UserID,
+					"", // auto-detect environment
 				)
 				
 				if err != nil {
@@ -122,14 +96,16 @@ func RestoreSubscription(c *gin.Context) {
 				}
 				
 				// Check if subscription is active
-				isActive := subscription.Status == "active" && subscription.ExpiresDate.After(time.Now())
+				isActive := subscription.IsEntitled(time.Now())
 				
 				activeSubscriptions = append(activeSubscriptions, SubscriptionInfo{
-					IsActive:    isActive,
-					Status:      subscription.Status,
-					ExpiresDate: subscription.ExpiresDate.Format(time.RFC3339),
-					ProductID:   subscription.ProductID,
-					AutoRenew:   subscription.AutoRenewStatus,
+					IsActive:      isActive,
+					Status:        subscription.Status,
+					ExpiresDate:   subscription.ExpiresDate.Format(time.RFC3339),
+					ProductID:     subscription.ProductID,
+					AutoRenew:     subscription.AutoRenewStatus,
+					Plan:          services.ResolveSubscriptionPlan(project, subscription),
+					BillingPeriod: subscription.BillingPeriod,
 				})
 			} else {
 				// Android restore - TODO: implement when Google Play restore is needed
@@ -144,7 +120,8 @@ func RestoreSubscription(c *gin.Context) {
 		// Mode 2: Passive restore - look up from database
 		logging.Infof("Passive restore: looking up subscriptions for user %s", req.UserID)
 		
-		subscriptions, err := database.GetUserSubscriptions(project.ProjectID, req.UserID)
+		lookback := time.Duration(config.AppConfig.RestoreLookbackMonths) * 30 * 24 * time.Hour
+		subscriptions, err := database.GetRestorableSubscriptions(project.ProjectID, req.UserID, lookback, config.AppConfig.RestoreIncludeExpired)
 		if err != nil {
 			c.JSON(http.StatusNotFound, RestoreSubscriptionResponse{
 				Success: false,
@@ -155,14 +132,16 @@ func RestoreSubscription(c *gin.Context) {
 		
 		// Filter active subscriptions and convert to response format
 		for _, sub := range subscriptions {
-			isActive := sub.Status == "active" && sub.ExpiresDate.After(time.Now())
+			isActive := sub.IsEntitled(time.Now())
 			
 			activeSubscriptions = append(activeSubscriptions, SubscriptionInfo{
-				IsActive:    isActive,
-				Status:      sub.Status,
-				ExpiresDate: sub.ExpiresDate.Format(time.RFC3339),
-				ProductID:   sub.ProductID,
-				AutoRenew:   sub.AutoRenewStatus,
+				IsActive:      isActive,
+				Status:        sub.Status,
+				ExpiresDate:   sub.ExpiresDate.Format(time.RFC3339),
+				ProductID:     sub.ProductID,
+				AutoRenew:     sub.AutoRenewStatus,
+				Plan:          services.ResolveSubscriptionPlan(project, &sub),
+				BillingPeriod: sub.BillingPeriod,
 			})
 		}
 	}
@@ -3,27 +3,19 @@ package api
 import (
 	"net/http"
 	"time"
+	"verification-api/internal/config"
 	"verification-api/internal/database"
 	"verification-api/internal/models"
 	"verification-api/internal/services"
+	"verification-api/pkg/client"
+	"verification-api/pkg/logging"
 
 	"github.com/gin-gonic/gin"
 )
 
-// GetSubscriptionStatusResponse represents subscription status response
-type GetSubscriptionStatusResponse struct {
-	Success     bool   `json:"success"`
-	Message     string `json:"message,omitempty"`
-	IsActive    bool   `json:"is_active"`
-	Platform    string `json:"platform,omitempty"`     // Platform: ios or android
-	Status      string `json:"status,omitempty"`        // Subscription status
-	ExpiresDate string `json:"expires_date,omitempty"` // ISO 8601 format
-	ProductID   string `json:"product_id,omitempty"`
-	AutoRenew   bool   `json:"auto_renew,omitempty"`
-
-	// Legacy support (deprecated)
-	ExpiresAt string `json:"expires_at,omitempty"` // Deprecated: use expires_date
-}
+type (
+	GetSubscriptionStatusResponse = client.GetSubscriptionStatusResponse
+)
 
 // GetSubscriptionStatus gets subscription status
 // GET /api/subscription/status?user_id=xxx&app_id=yyy
@@ -53,37 +45,109 @@ func GetSubscriptionStatus(c *gin.Context) {
 	}
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, GetSubscriptionStatusResponse{
+		status, code, message := projectLookupError(err)
+		c.JSON(status, GetSubscriptionStatusResponse{
 			Success: false,
-			Message: "App not found: " + err.Error(),
+			Message: message,
+			Code:    code,
 		})
 		return
 	}
 
+	// Serve from cache (invalidated whenever the user's subscription or transactions change)
+	var cached GetSubscriptionStatusResponse
+	if database.GetCachedSubscriptionStatus(project.ProjectID, userID, &cached) {
+		respondWithETag(c, cached)
+		return
+	}
+
+	response := buildSubscriptionStatus(project, userID)
+	// Don't cache an active status that would outlive the subscription itself
+	if expiresDate, err := time.Parse(time.RFC3339, response.ExpiresDate); !response.IsActive || err != nil ||
+		time.Until(expiresDate) > time.Duration(config.AppConfig.SubscriptionStatusCacheTTLSeconds)*time.Second {
+		database.SetCachedSubscriptionStatus(project.ProjectID, userID, response)
+	}
+
+	respondWithETag(c, response)
+}
+
+// applyLapsedStatus distinguishes a lapsed subscriber from a user who never subscribed (e.g. for win-back offers)
+// expired: the latest subscription with its expiry; none: no subscription at all
+func applyLapsedStatus(response *GetSubscriptionStatusResponse, project *models.Project, userID string) {
+	latest, err := database.GetLatestSubscriptionByUser(project.ProjectID, userID)
+	if err != nil {
+		response.Status = "none"
+		return
+	}
+	response.Status = "expired"
+	response.Platform = latest.Platform
+	response.ExpiresDate = latest.ExpiresDate.Format(time.RFC3339)
+	response.ExpiresAt = latest.ExpiresDate.Format(time.RFC3339) // Legacy support
+	response.ProductID = latest.ProductID
+	response.Plan = services.ResolveSubscriptionPlan(project, latest)
+	response.BillingPeriod = latest.BillingPeriod
+}
+
+// buildSubscriptionStatus computes the subscription status of a user from the database
+func buildSubscriptionStatus(project *models.Project, userID string) GetSubscriptionStatusResponse {
+	// Get owned one-time products
+	nonConsumables := getNonConsumableProductIDs(project.ProjectID, userID)
+
 	// Get active subscription
 	subscription, err := database.GetActiveSubscription(project.ProjectID, userID)
 	if err != nil {
 		// No active subscription found
-		c.JSON(http.StatusOK, GetSubscriptionStatusResponse{
-			Success: true,
-			IsActive: false,
-			Status:   "inactive",
-		})
-		return
+		response := GetSubscriptionStatusResponse{
+			Success:        true,
+			IsActive:       false,
+			Status:         "inactive",
+			NonConsumables: nonConsumables,
+			Entitlements:   services.ResolveEntitlements(project, nonConsumables),
+		}
+		if config.AppConfig.SubscriptionStatusLapsedDetail {
+			applyLapsedStatus(&response, project, userID)
+		}
+		return response
 	}
 
 	// Check if subscription is still active
-	isActive := subscription.Status == "active" && subscription.ExpiresDate.After(time.Now())
-
-	c.JSON(http.StatusOK, GetSubscriptionStatusResponse{
-		Success:     true,
-		IsActive:    isActive,
-		Platform:    subscription.Platform,
-		Status:      subscription.Status,
-		ExpiresDate: subscription.ExpiresDate.Format(time.RFC3339),
-		ExpiresAt:   subscription.ExpiresDate.Format(time.RFC3339), // Legacy support
-		ProductID:   subscription.ProductID,
-		AutoRenew:   subscription.AutoRenewStatus,
-	})
+	isActive := subscription.IsEntitled(time.Now())
+
+	ownedProductIDs := nonConsumables
+	if isActive {
+		ownedProductIDs = append([]string{subscription.ProductID}, nonConsumables...)
+	}
+
+	return GetSubscriptionStatusResponse{
+		Success:       true,
+		IsActive:      isActive,
+		Platform:      subscription.Platform,
+		Status:        subscription.Status,
+		ExpiresDate:   subscription.ExpiresDate.Format(time.RFC3339),
+		ExpiresAt:     subscription.ExpiresDate.Format(time.RFC3339), // Legacy support
+		ProductID:     subscription.ProductID,
+		AutoRenew:     subscription.AutoRenewStatus,
+		Plan:          services.ResolveSubscriptionPlan(project, subscription),
+		BillingPeriod: subscription.BillingPeriod,
+		RenewalCount:  subscription.RenewalCount,
+
+		NonConsumables: nonConsumables,
+		Entitlements:   services.ResolveEntitlements(project, ownedProductIDs),
+	}
+}
+
+// getNonConsumableProductIDs returns product IDs of one-time products owned by the user
+func getNonConsumableProductIDs(projectID, userID string) []string {
+	transactions, err := database.GetUserTransactionsByType(projectID, userID, "non_consumable")
+	if err != nil {
+		logging.Errorf("Failed to get non-consumable transactions: %v", err)
+		return nil
+	}
+
+	productIDs := make([]string, 0, len(transactions))
+	for _, tx := range transactions {
+		productIDs = append(productIDs, tx.ProductID)
+	}
+	return productIDs
 }
 
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"net/http"
+	"time"
+	"verification-api/internal/config"
+	"verification-api/internal/database"
+	"verification-api/internal/models"
+	"verification-api/internal/services"
+	"verification-api/pkg/client"
+	"verification-api/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	SyncSubscriptionRequest  = client.SyncSubscriptionRequest
+	SyncSubscriptionResponse = client.SyncSubscriptionResponse
+)
+
+// SyncSubscriptions refreshes the user's subscriptions from Apple / Google
+// POST /api/subscription/sync (requires project authentication)
+// Uses the stored original_transaction_id / purchase_token, so the client doesn't need to re-send receipts
+// iOS refreshes from the latest transaction of the chain, so renewals since the last verification are picked up
+func SyncSubscriptions(c *gin.Context) {
+	var req SyncSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, SyncSubscriptionResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+	if req.Platform == "" {
+		req.Platform = "ios"
+	}
+
+	projectService := services.NewProjectService()
+	var project *models.Project
+	var err error
+	if req.Platform == "ios" {
+		project, err = projectService.GetProjectByBundleID(req.AppID)
+	} else {
+		project, err = projectService.GetProjectByPackageName(req.AppID)
+	}
+	if err != nil {
+		status, code, message := projectLookupError(err)
+		c.JSON(status, SyncSubscriptionResponse{
+			Success: false,
+			Message: message,
+			Code:    code,
+		})
+		return
+	}
+
+	// The app must belong to the authenticated project
+	if projectID, exists := c.Get("project_id"); !exists || projectID.(string) != project.ProjectID {
+		c.JSON(http.StatusForbidden, SyncSubscriptionResponse{
+			Success: false,
+			Message: "App does not belong to the authenticated project",
+		})
+		return
+	}
+
+	// Rate limit per user to respect store API limits
+	redisService, err := services.NewRedisService()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, SyncSubscriptionResponse{
+			Success: false,
+			Message: "Service unavailable",
+		})
+		return
+	}
+	interval := time.Duration(config.AppConfig.SubscriptionSyncIntervalSeconds) * time.Second
+	acquired, err := redisService.AcquireSyncSlot(project.ProjectID, req.UserID, interval)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, SyncSubscriptionResponse{
+			Success: false,
+			Message: "Service error",
+		})
+		return
+	}
+	if !acquired {
+		c.JSON(http.StatusTooManyRequests, SyncSubscriptionResponse{
+			Success: false,
+			Message: "Please wait before syncing subscriptions again",
+		})
+		return
+	}
+
+	subscriptions, err := database.GetUserSubscriptions(project.ProjectID, req.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, SyncSubscriptionResponse{
+			Success: false,
+			Message: "Failed to get subscriptions: " + err.Error(),
+		})
+		return
+	}
+
+	verificationService := services.NewSubscriptionVerificationService()
+	webhookNotifier := services.NewWebhookNotifier()
+	var refreshed []SubscriptionInfo
+	failed := 0
+	seen := make(map[string]bool)
+
+	for _, stored := range subscriptions {
+		// One refresh per subscription chain
+		key := stored.OriginalTransactionID
+		if key == "" {
+			key = stored.TransactionID
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		subscription, err := verificationService.RefreshSubscription(&stored)
+		if err != nil {
+			logging.Errorf("Failed to sync subscription - project_id: %s, transaction_id: %s, error: %v",
+				project.ProjectID, stored.TransactionID, err)
+			failed++
+			continue
+		}
+
+		if project.HasWebhook() && subscription.StateChanged {
+			webhookNotifier.NotifyAppBackendAsync(services.WebhookEndpointFromProject(project), subscription)
+		}
+
+		refreshed = append(refreshed, SubscriptionInfo{
+			IsActive:      subscription.IsEntitled(time.Now()),
+			Status:        subscription.Status,
+			ExpiresDate:   subscription.ExpiresDate.Format(time.RFC3339),
+			ProductID:     subscription.ProductID,
+			AutoRenew:     subscription.AutoRenewStatus,
+			Plan:          services.ResolveSubscriptionPlan(project, subscription),
+			BillingPeriod: subscription.BillingPeriod,
+		})
+	}
+
+	c.JSON(http.StatusOK, SyncSubscriptionResponse{
+		Success:       true,
+		Message:       "Subscriptions synced",
+		Subscriptions: refreshed,
+		Failed:        failed,
+	})
+}
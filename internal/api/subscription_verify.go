@@ -3,11 +3,13 @@ package api
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 	"verification-api/internal/models"
 	"verification-api/internal/services"
+	"verification-api/pkg/client"
 	"verification-api/pkg/logging"
 
 	"github.com/gin-gonic/gin"
@@ -20,6 +22,9 @@ func extractBundleIDFromJWT(signedTransaction string) (string, error) {
 	if len(parts) != 3 {
 		return "", nil
 	}
+	if err := services.EnforceJWSAlgorithm(signedTransaction); err != nil {
+		return "", err
+	}
 
 	// Decode payload (second part)
 	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
@@ -41,38 +46,35 @@ func extractBundleIDFromJWT(signedTransaction string) (string, error) {
 	return "", nil
 }
 
-// VerifySubscriptionRequest represents verify subscription request
-// Supports platform-specific fields as per industry standards
-type VerifySubscriptionRequest struct {
-	Platform  string `json:"platform" binding:"required,oneof=ios android"` // ios or android
-	UserID    string `json:"user_id" binding:"required"`                    // User ID from the app
-	ProductID string `json:"product_id" binding:"required"`                 // Product ID (required for both platforms)
-
-	// iOS specific fields
-	SignedTransaction string `json:"signed_transaction,omitempty"` // JWT signed transaction (iOS)
-	TransactionID     string `json:"transaction_id,omitempty"`     // Transaction ID (iOS)
-
-	// Android specific fields
-	PurchaseToken string `json:"purchase_token,omitempty"` // Purchase token (Android)
-
-	// Legacy support (deprecated, use platform-specific fields)
-	ReceiptData string `json:"receipt_data,omitempty"` // Legacy: Base64 receipt (iOS) or purchase token (Android)
-	AppID       string `json:"app_id,omitempty"`       // Legacy: Bundle ID (iOS) or Package Name (Android)
+// validatePlatformIdentifiers checks that the identifiers sent match the platform
+// iOS requires signed_transaction or transaction_id (or legacy receipt_data) and must not carry purchase_token
+// Android requires purchase_token (or legacy receipt_data) and must not carry signed_transaction / transaction_id
+func validatePlatformIdentifiers(req *VerifySubscriptionRequest) error {
+	switch req.Platform {
+	case "ios":
+		if req.PurchaseToken != "" {
+			return errors.New("purchase_token is an Android field, iOS requires signed_transaction or transaction_id")
+		}
+		if req.SignedTransaction == "" && req.TransactionID == "" && req.ReceiptData == "" {
+			return errors.New("iOS requires signed_transaction or transaction_id")
+		}
+	case "android":
+		if req.SignedTransaction != "" || req.TransactionID != "" {
+			return errors.New("signed_transaction and transaction_id are iOS fields, Android requires purchase_token")
+		}
+		if req.PurchaseToken == "" && req.ReceiptData == "" {
+			return errors.New("Android requires purchase_token")
+		}
+	default:
+		return errors.New("platform must be ios or android")
+	}
+	return nil
 }
 
-// VerifySubscriptionResponse represents verify subscription response
-type VerifySubscriptionResponse struct {
-	Success     bool   `json:"success"`
-	Message     string `json:"message"`
-	IsActive    bool   `json:"is_active"`
-	Platform    string `json:"platform,omitempty"`     // Platform: ios or android
-	ExpiresDate string `json:"expires_date,omitempty"` // ISO 8601 format
-	ProductID   string `json:"product_id,omitempty"`
-	AutoRenew   bool   `json:"auto_renew,omitempty"`
-
-	// Legacy support (deprecated)
-	ExpiresAt string `json:"expires_at,omitempty"` // Deprecated: use expires_date
-}
+type (
+	VerifySubscriptionRequest  = client.VerifySubscriptionRequest
+	VerifySubscriptionResponse = client.VerifySubscriptionResponse
+)
 
 // VerifySubscription verifies subscription receipt/token
 // POST /api/subscription/verify
@@ -87,25 +89,13 @@ func VerifySubscription(c *gin.Context) {
 		return
 	}
 
-	// Validate platform-specific fields
-	if req.Platform == "ios" {
-		// iOS requires signed_transaction or transaction_id (or legacy receipt_data)
-		if req.SignedTransaction == "" && req.TransactionID == "" && req.ReceiptData == "" {
-			c.JSON(http.StatusBadRequest, VerifySubscriptionResponse{
-				Success: false,
-				Message: "iOS requires signed_transaction or transaction_id",
-			})
-			return
-		}
-	} else if req.Platform == "android" {
-		// Android requires purchase_token (or legacy receipt_data)
-		if req.PurchaseToken == "" && req.ReceiptData == "" {
-			c.JSON(http.StatusBadRequest, VerifySubscriptionResponse{
-				Success: false,
-				Message: "Android requires purchase_token",
-			})
-			return
-		}
+	// Validate platform-specific fields before any store call
+	if err := validatePlatformIdentifiers(&req); err != nil {
+		c.JSON(http.StatusBadRequest, VerifySubscriptionResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
 	}
 
 	// Get project - try to get from bundle_id/package_name if available
@@ -125,9 +115,11 @@ func VerifySubscription(c *gin.Context) {
 			project, err = projectService.GetProjectByPackageName(req.AppID)
 		}
 		if err != nil {
-			c.JSON(http.StatusBadRequest, VerifySubscriptionResponse{
+			status, code, message := projectLookupError(err)
+			c.JSON(status, VerifySubscriptionResponse{
 				Success: false,
-				Message: "App not found: " + err.Error(),
+				Message: message,
+				Code:    code,
 			})
 			return
 		}
@@ -143,9 +135,11 @@ func VerifySubscription(c *gin.Context) {
 		}
 		project, err = projectService.GetProjectByBundleID(bundleID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, VerifySubscriptionResponse{
+			status, code, message := projectLookupError(err)
+			c.JSON(status, VerifySubscriptionResponse{
 				Success: false,
-				Message: "App not found for bundle_id: " + bundleID,
+				Message: message,
+				Code:    code,
 			})
 			return
 		}
@@ -157,12 +151,22 @@ func VerifySubscription(c *gin.Context) {
 		return
 	}
 
-	// 添加详细日志：项目信息
-	logging.Infof("验证订阅请求 - ProjectID: %s, ProjectName: %s, BundleID: %s, UserID: %s, TransactionID: %s, ProductID: %s, Platform: %s",
+	// Validate forced environment against the project's allowed environments
+	if req.Environment != "" && !project.AllowsEnvironment(req.Environment) {
+		c.JSON(http.StatusBadRequest, VerifySubscriptionResponse{
+			Success: false,
+			Message: "Environment " + req.Environment + " is not allowed for this app",
+		})
+		return
+	}
+
+	// 详细日志：项目信息（仅 Debug 级别）
+	logging.Debugf("验证订阅请求 - ProjectID: %s, ProjectName: %s, BundleID: %s, UserID: %s, TransactionID: %s, ProductID: %s, Platform: %s",
 		project.ProjectID, project.ProjectName, project.BundleID, req.UserID, req.TransactionID, req.ProductID, req.Platform)
 
 	// Verify receipt/token
-	verificationService := services.NewSubscriptionVerificationService()
+	verificationService := services.NewSubscriptionVerificationService().
+		WithMaxTransactionAge(services.MaxTransactionAge(project))
 	var subscription *models.Subscription
 
 	if req.Platform == "ios" {
@@ -174,10 +178,11 @@ func VerifySubscription(c *gin.Context) {
 				req.TransactionID,
 				req.ProductID,
 				req.UserID,
+				req.Environment,
 			)
 		} else {
 			// Legacy format
-			subscription, err = verificationService.VerifyAppleReceipt(project.ProjectID, req.ReceiptData, req.UserID)
+			subscription, err = verificationService.VerifyAppleReceipt(project.ProjectID, req.ReceiptData, req.UserID, req.Environment)
 		}
 	} else {
 		// Android
@@ -194,37 +199,45 @@ func VerifySubscription(c *gin.Context) {
 	}
 
 	if err != nil {
-		// 添加详细日志：验证失败
-		logging.Errorf("订阅验证失败 - ProjectID: %s, ProjectName: %s, BundleID: %s, UserID: %s, TransactionID: %s, Error: %v",
-			project.ProjectID, project.ProjectName, project.BundleID, req.UserID, req.TransactionID, err)
-		c.JSON(http.StatusBadRequest, VerifySubscriptionResponse{
+		// 验证失败：记录完整信息
+		logging.Errorf("订阅验证失败 - ProjectID: %s, ProjectName: %s, BundleID: %s, UserID: %s, TransactionID: %s, ProductID: %s, Platform: %s, Error: %v",
+			project.ProjectID, project.ProjectName, project.BundleID, req.UserID, req.TransactionID, req.ProductID, req.Platform, err)
+		response := VerifySubscriptionResponse{
 			Success: false,
 			Message: "Verification failed: " + err.Error(),
-		})
+		}
+		if errors.Is(err, services.ErrTransactionTooOld) {
+			response.Code = services.TransactionTooOldCode
+		}
+		c.JSON(http.StatusBadRequest, response)
 		return
 	}
 
-	// 添加详细日志：验证成功
-	isActive := subscription.Status == "active" && subscription.ExpiresDate.After(time.Now())
-	logging.Infof("订阅验证成功 - ProjectID: %s, UserID: %s, TransactionID: %s, Status: %s, IsActive: %v, ExpiresDate: %s",
+	// 验证成功：Info 级别只记录简要信息，详细信息仅 Debug 级别
+	isActive := subscription.IsEntitled(time.Now())
+	logging.Infof("Subscription verified - project: %s, transaction: %s, status: %s",
+		project.ProjectID, subscription.TransactionID, subscription.Status)
+	logging.Debugf("订阅验证成功 - ProjectID: %s, UserID: %s, TransactionID: %s, Status: %s, IsActive: %v, ExpiresDate: %s",
 		project.ProjectID, req.UserID, subscription.TransactionID, subscription.Status, isActive, subscription.ExpiresDate.Format(time.RFC3339))
 
 	// Notify App Backend via webhook if configured (optional, for pre-order flow)
-	if project.WebhookCallbackURL != "" {
-		go func() {
-			webhookNotifier := services.NewWebhookNotifier()
-			webhookNotifier.NotifyAppBackend(project.WebhookCallbackURL, project.WebhookSecret, subscription)
-		}()
+	// Skipped when reconciliation found no material change (status / expiry within tolerance)
+	if project.HasWebhook() && subscription.StateChanged {
+		webhookNotifier := services.NewWebhookNotifier()
+		webhookNotifier.NotifyAppBackendAsync(services.WebhookEndpointFromProject(project), subscription)
 	}
-
-	c.JSON(http.StatusOK, VerifySubscriptionResponse{
-		Success:     true,
-		Message:     "Subscription verified successfully",
-		IsActive:    isActive,
-		Platform:    subscription.Platform,
-		ExpiresDate: subscription.ExpiresDate.Format(time.RFC3339),
-		ExpiresAt:   subscription.ExpiresDate.Format(time.RFC3339), // Legacy support
-		ProductID:   subscription.ProductID,
-		AutoRenew:   subscription.AutoRenewStatus,
+	services.CheckSubscriptionFraudAsync(project, subscription)
+
+	respondWithFields(c, http.StatusOK, VerifySubscriptionResponse{
+		Success:       true,
+		Message:       "Subscription verified successfully",
+		IsActive:      isActive,
+		Platform:      subscription.Platform,
+		ExpiresDate:   subscription.ExpiresDate.Format(time.RFC3339),
+		ExpiresAt:     subscription.ExpiresDate.Format(time.RFC3339), // Legacy support
+		ProductID:     subscription.ProductID,
+		AutoRenew:     subscription.AutoRenewStatus,
+		Plan:          services.ResolveSubscriptionPlan(project, subscription),
+		BillingPeriod: subscription.BillingPeriod,
 	})
 }
@@ -0,0 +1,32 @@
+package api
+
+import "testing"
+
+func TestValidatePlatformIdentifiers(t *testing.T) {
+	tests := []struct {
+		name  string
+		req   VerifySubscriptionRequest
+		valid bool
+	}{
+		{"ios signed transaction", VerifySubscriptionRequest{Platform: "ios", SignedTransaction: "jws"}, true},
+		{"ios transaction id", VerifySubscriptionRequest{Platform: "ios", TransactionID: "1000000001"}, true},
+		{"ios legacy receipt", VerifySubscriptionRequest{Platform: "ios", ReceiptData: "base64"}, true},
+		{"ios without identifier", VerifySubscriptionRequest{Platform: "ios"}, false},
+		{"ios with purchase token", VerifySubscriptionRequest{Platform: "ios", PurchaseToken: "token"}, false},
+		{"ios transaction id and purchase token", VerifySubscriptionRequest{Platform: "ios", TransactionID: "1000000001", PurchaseToken: "token"}, false},
+		{"android purchase token", VerifySubscriptionRequest{Platform: "android", PurchaseToken: "token"}, true},
+		{"android legacy receipt", VerifySubscriptionRequest{Platform: "android", ReceiptData: "token"}, true},
+		{"android without identifier", VerifySubscriptionRequest{Platform: "android"}, false},
+		{"android with signed transaction", VerifySubscriptionRequest{Platform: "android", PurchaseToken: "token", SignedTransaction: "jws"}, false},
+		{"android with transaction id", VerifySubscriptionRequest{Platform: "android", TransactionID: "1000000001"}, false},
+		{"unknown platform", VerifySubscriptionRequest{Platform: "web", PurchaseToken: "token"}, false},
+		{"empty platform", VerifySubscriptionRequest{TransactionID: "1000000001"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validatePlatformIdentifiers(&tt.req); (err == nil) != tt.valid {
+				t.Errorf("validatePlatformIdentifiers() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
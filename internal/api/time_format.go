@@ -0,0 +1,70 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Supported values of the "time_format" query parameter
+const (
+	TimeFormatRFC3339 = "rfc3339" // default, e.g. 2025-12-31T23:59:59Z
+	TimeFormatUnixMS  = "unix_ms" // epoch milliseconds (as used by Apple)
+	TimeFormatUnix    = "unix"    // epoch seconds
+)
+
+// timeFormatFields are the timestamp keys converted by the "time_format" query parameter (at any depth)
+var timeFormatFields = map[string]bool{
+	"expires_date":  true,
+	"expires_at":    true,
+	"purchase_date": true,
+}
+
+// formatTimes returns obj with its expires_date / purchase_date values converted to the requested time format
+// GET ...?time_format=unix_ms returns {"expires_date": 1767225599000, ...}
+// Without time_format (or rfc3339, or an unknown value) the object is returned unchanged
+func formatTimes(c *gin.Context, obj interface{}) interface{} {
+	format := c.Query("time_format")
+	if format != TimeFormatUnixMS && format != TimeFormatUnix {
+		return obj
+	}
+
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return obj
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return obj
+	}
+	return convertTimeFields(value, format)
+}
+
+// convertTimeFields walks a decoded JSON value and converts the timestamp fields in place
+func convertTimeFields(value interface{}, format string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if s, ok := field.(string); ok && timeFormatFields[key] {
+				if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+					if format == TimeFormatUnix {
+						v[key] = t.Unix()
+					} else {
+						v[key] = t.UnixMilli()
+					}
+				}
+				continue
+			}
+			v[key] = convertTimeFields(field, format)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = convertTimeFields(item, format)
+		}
+	}
+	return value
+}
@@ -1,16 +1,22 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
+	"time"
 	"verification-api/internal/config"
 	"verification-api/internal/services"
+	"verification-api/pkg/logging"
+	"verification-api/pkg/metrics"
 
 	"github.com/gin-gonic/gin"
 )
 
 // SendCodeRequest represents send verification code request
 type SendCodeRequest struct {
-	Email     string `json:"email" binding:"required,email"`
+	Email     string `json:"email" binding:"omitempty,email"` // Required for the email channel
+	Phone     string `json:"phone,omitempty"`                 // E.164 phone number, required for the sms channel
+	Channel   string `json:"channel,omitempty"`               // email (default) or sms
 	ProjectID string `json:"project_id" binding:"required"`
 	Language  string `json:"language,omitempty"`
 }
@@ -19,12 +25,24 @@ type SendCodeRequest struct {
 type SendCodeResponse struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
+	Error   string `json:"error,omitempty"` // Machine-readable error code (e.g. EMAIL_QUOTA_EXCEEDED)
 }
 
+// ErrEmailQuotaExceeded is returned when the daily email cap (BREVO_DAILY_CAP) has been reached
+const ErrEmailQuotaExceeded = "EMAIL_QUOTA_EXCEEDED"
+
+// ErrDailySendLimitExceeded is returned when an email has received CODE_DAILY_SEND_LIMIT codes today
+const ErrDailySendLimitExceeded = "DAILY_SEND_LIMIT_EXCEEDED"
+
+// ErrProjectQuotaExceeded is returned when the project has sent max_requests codes today
+const ErrProjectQuotaExceeded = "PROJECT_QUOTA_EXCEEDED"
+
 // VerifyCodeRequest represents verify verification code request
 type VerifyCodeRequest struct {
-	Email     string `json:"email" binding:"required,email"`
-	Code      string `json:"code" binding:"required,len=6"`
+	Email     string `json:"email" binding:"omitempty,email"` // Required for the email channel
+	Phone     string `json:"phone,omitempty"`                 // E.164 phone number, required for the sms channel
+	Channel   string `json:"channel,omitempty"`               // email (default) or sms, as used for send-code
+	Code      string `json:"code" binding:"required"`         // Format is checked against the project's code format
 	ProjectID string `json:"project_id" binding:"required"`
 }
 
@@ -32,8 +50,39 @@ type VerifyCodeRequest struct {
 type VerifyCodeResponse struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
+	Error   string `json:"error,omitempty"` // Machine-readable error code (e.g. INVALID_CODE_FORMAT)
+}
+
+// ErrInvalidCodeFormat is returned when the submitted code doesn't match the project's code format
+const ErrInvalidCodeFormat = "INVALID_CODE_FORMAT"
+
+// ErrInvalidRecipient is returned when the channel is unknown or its email / phone is missing or malformed
+const ErrInvalidRecipient = "INVALID_RECIPIENT"
+
+// ErrChannelUnavailable is returned when the requested channel is not configured (e.g. sms without TWILIO_*)
+const ErrChannelUnavailable = "CHANNEL_UNAVAILABLE"
+
+// codeRecipient returns the address a code is sent to / verified for: the email or the E.164 phone number
+func codeRecipient(channel, email, phone string) (string, error) {
+	switch channel {
+	case "", services.CodeChannelEmail:
+		if email == "" {
+			return "", fmt.Errorf("email is required")
+		}
+		return email, nil
+	case services.CodeChannelSMS:
+		if err := services.ValidateE164(phone); err != nil {
+			return "", err
+		}
+		return phone, nil
+	default:
+		return "", fmt.Errorf("channel must be %s or %s", services.CodeChannelEmail, services.CodeChannelSMS)
+	}
 }
 
+// ErrTooManyAttempts is returned when CODE_MAX_VERIFY_ATTEMPTS wrong codes were submitted and the code was discarded
+const ErrTooManyAttempts = "TOO_MANY_ATTEMPTS"
+
 // SendVerificationCode sends verification code
 func SendVerificationCode(c *gin.Context) {
 	var req SendCodeRequest
@@ -45,6 +94,26 @@ func SendVerificationCode(c *gin.Context) {
 		return
 	}
 
+	recipient, err := codeRecipient(req.Channel, req.Email, req.Phone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, SendCodeResponse{
+			Success: false,
+			Message: "Invalid request: " + err.Error(),
+			Error:   ErrInvalidRecipient,
+		})
+		return
+	}
+	sender, err := services.NewCodeSender(req.Channel)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, SendCodeResponse{
+			Success: false,
+			Message: err.Error(),
+			Error:   ErrChannelUnavailable,
+		})
+		return
+	}
+	sms := req.Channel == services.CodeChannelSMS
+
 	// Get project ID from context (set by middleware)
 	projectID, exists := c.Get("project_id")
 	if !exists {
@@ -62,7 +131,7 @@ func SendVerificationCode(c *gin.Context) {
 	}
 
 	// Check rate limit using Redis
-	rateLimited, err := redisService.CheckRateLimit(projectID.(string), req.Email)
+	rateLimited, err := redisService.CheckRateLimit(projectID.(string), recipient)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, SendCodeResponse{
 			Success: false,
@@ -79,8 +148,103 @@ func SendVerificationCode(c *gin.Context) {
 		return
 	}
 
-	// Generate verification code
-	code, err := redisService.GenerateCode()
+	// Quota reservations taken below are given back unless the code is delivered
+	// All of them count against the UTC day of quotaTime, also when released after midnight
+	quotaTime := time.Now()
+	var rollback []func()
+	defer func() {
+		for _, release := range rollback {
+			release()
+		}
+	}()
+
+	// Daily cap per project + email, against slow-drip abuse that stays under the cooldown
+	allowed, err := redisService.ReserveDailyCodeSend(projectID.(string), recipient, config.AppConfig.CodeDailySendLimit, quotaTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, SendCodeResponse{
+			Success: false,
+			Message: "Service error",
+		})
+		return
+	}
+	if !allowed {
+		logging.Warnf("Daily verification code limit reached (%d) - project: %s", config.AppConfig.CodeDailySendLimit, projectID.(string))
+		metrics.IncCounter("verification_code_daily_limit_rejections_total", nil)
+		c.JSON(http.StatusTooManyRequests, SendCodeResponse{
+			Success: false,
+			Message: "Daily verification code limit reached for this email, please try again tomorrow",
+			Error:   ErrDailySendLimitExceeded,
+		})
+		return
+	}
+	rollback = append(rollback, func() { redisService.ReleaseDailyCodeSend(projectID.(string), recipient, quotaTime) })
+
+	// Projects in a group share the code namespace (rate limits stay per project)
+	projectService := services.NewProjectService()
+	project, projectErr := projectService.GetProjectByID(projectID.(string))
+	codeNamespace := projectID.(string)
+	if projectErr == nil {
+		codeNamespace = services.CodeNamespace(project)
+	}
+	// webhook delivery mode only applies to the email channel, SMS always goes through the SMS sender
+	deliverByWebhook := !sms && projectErr == nil && project.CodeDeliveryMode == services.CodeDeliveryWebhook
+	sendEmail := !sms && !deliverByWebhook
+
+	// Per-project daily quota (max_requests), reserved atomically and given back if the code is not delivered
+	if projectErr == nil {
+		_, allowed, err := redisService.ReserveDailyQuota(project.ProjectID, project.MaxRequests, quotaTime)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, SendCodeResponse{
+				Success: false,
+				Message: "Service error",
+			})
+			return
+		}
+		if !allowed {
+			logging.Warnf("Project daily quota reached (%d) - project: %s", project.MaxRequests, project.ProjectID)
+			metrics.IncCounter("project_quota_rejections_total", nil)
+			c.JSON(http.StatusTooManyRequests, SendCodeResponse{
+				Success: false,
+				Message: fmt.Sprintf("Daily request quota of %d verification codes exceeded for this project, please try again tomorrow", project.MaxRequests),
+				Error:   ErrProjectQuotaExceeded,
+			})
+			return
+		}
+		rollback = append(rollback, func() { redisService.ReleaseDailyQuota(project.ProjectID, quotaTime) })
+	}
+
+	// Count the email against today's Brevo quota before anything is stored
+	if sendEmail {
+		_, allowed, err := redisService.ReserveDailyEmailQuota(config.AppConfig.BrevoDailyCap, quotaTime)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, SendCodeResponse{
+				Success: false,
+				Message: "Service error",
+			})
+			return
+		}
+		if !allowed {
+			logging.Warnf("Daily email cap reached (%d), refusing to send verification code - project: %s", config.AppConfig.BrevoDailyCap, projectID.(string))
+			c.JSON(http.StatusServiceUnavailable, SendCodeResponse{
+				Success: false,
+				Message: "Daily email quota exceeded, please try again later",
+				Error:   ErrEmailQuotaExceeded,
+			})
+			return
+		}
+		rollback = append(rollback, func() { redisService.ReleaseDailyEmailQuota(quotaTime) })
+	}
+
+	// Generate verification code in the project's code format (default 6 digits)
+	codeFormat := services.DefaultCodeFormat
+	if projectErr == nil {
+		codeFormat = services.CodeFormatForProject(project)
+	}
+	expireMinutes := config.AppConfig.CodeExpireMinutes
+	if projectErr == nil {
+		expireMinutes = services.CodeExpireMinutesForProject(project)
+	}
+	code, err := redisService.GenerateCode(codeFormat.Length, codeFormat.Alphanumeric())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, SendCodeResponse{
 			Success: false,
@@ -89,8 +253,8 @@ func SendVerificationCode(c *gin.Context) {
 		return
 	}
 
-	// Store verification code in Redis (with TTL, auto-expire)
-	if err := redisService.StoreCode(projectID.(string), req.Email, code, config.AppConfig.CodeExpireMinutes); err != nil {
+	// Store verification code in Redis (with TTL, auto-expire), the message shows the same validity
+	if err := redisService.StoreCode(codeNamespace, recipient, code, expireMinutes); err != nil {
 		c.JSON(http.StatusInternalServerError, SendCodeResponse{
 			Success: false,
 			Message: "Failed to store verification code",
@@ -99,19 +263,52 @@ func SendVerificationCode(c *gin.Context) {
 	}
 
 	// Set rate limit in Redis
-	if err := redisService.SetRateLimit(projectID.(string), req.Email, config.AppConfig.RateLimitMinutes); err != nil {
+	if err := redisService.SetRateLimit(projectID.(string), recipient, config.AppConfig.RateLimitMinutes); err != nil {
 		// Log error but don't affect main flow
 	}
 
-	// Send email
-	brevoService := services.NewBrevoService()
-	if err := brevoService.SendVerificationCodeEmail(projectID.(string), req.Email, code, req.Language); err != nil {
+	// Deliver the code: webhook mode hands it to the integrator, otherwise send email
+	if deliverByWebhook {
+		webhookNotifier := services.NewWebhookNotifier()
+		endpoint := services.CodeDeliveryEndpointFromProject(project)
+		if err := webhookNotifier.DeliverVerificationCode(endpoint, project.ProjectID, recipient, code, req.Language, expireMinutes); err != nil {
+			c.JSON(http.StatusBadGateway, SendCodeResponse{
+				Success: false,
+				Message: "Failed to deliver verification code",
+			})
+			return
+		}
+		rollback = nil
+
+		c.JSON(http.StatusOK, SendCodeResponse{
+			Success: true,
+			Message: "Verification code delivered successfully",
+		})
+		return
+	}
+
+	// Send email / SMS
+	if err := sender.Send(projectID.(string), recipient, code, req.Language, expireMinutes); err != nil {
+		if sms {
+			logging.Errorf("Failed to send verification SMS - project: %s, error: %v", projectID.(string), err)
+			c.JSON(http.StatusInternalServerError, SendCodeResponse{
+				Success: false,
+				Message: "Failed to send verification SMS",
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, SendCodeResponse{
 			Success: false,
 			Message: "Failed to send verification email",
 		})
 		return
 	}
+	rollback = nil
+	if sms {
+		metrics.IncCounter("sms_sent_total", nil)
+	} else {
+		metrics.IncCounter("brevo_emails_sent_total", nil)
+	}
 
 	c.JSON(http.StatusOK, SendCodeResponse{
 		Success: true,
@@ -129,6 +326,15 @@ func VerifyCode(c *gin.Context) {
 		})
 		return
 	}
+	recipient, err := codeRecipient(req.Channel, req.Email, req.Phone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, VerifyCodeResponse{
+			Success: false,
+			Message: "Invalid request: " + err.Error(),
+			Error:   ErrInvalidRecipient,
+		})
+		return
+	}
 
 	// Get project ID from context (set by middleware)
 	projectID, exists := c.Get("project_id")
@@ -136,6 +342,26 @@ func VerifyCode(c *gin.Context) {
 		projectID = req.ProjectID // If middleware didn't set it, use project ID from request
 	}
 
+	// Codes of grouped projects are looked up in the group namespace
+	projectService := services.NewProjectService()
+	project, _ := projectService.GetProjectByID(projectID.(string)) // nil if not found
+	codeNamespace := projectID.(string)
+	if project != nil {
+		codeNamespace = services.CodeNamespace(project)
+	}
+
+	// Reject malformed codes before they consume a Redis lookup
+	codeFormat := services.CodeFormatForProject(project)
+	req.Code = codeFormat.Normalize(req.Code)
+	if err := codeFormat.Validate(req.Code); err != nil {
+		c.JSON(http.StatusBadRequest, VerifyCodeResponse{
+			Success: false,
+			Message: "Invalid verification code format: " + err.Error(),
+			Error:   ErrInvalidCodeFormat,
+		})
+		return
+	}
+
 	// Initialize services
 	redisService, err := services.NewRedisService()
 	if err != nil {
@@ -146,8 +372,28 @@ func VerifyCode(c *gin.Context) {
 		return
 	}
 
-	// Get verification code from Redis
-	storedCode, err := redisService.GetCode(projectID.(string), req.Email)
+	// Concurrent guesses may pass the limit before the lockout below deletes the code
+	maxAttempts := int64(config.AppConfig.CodeMaxVerifyAttempts)
+	if maxAttempts > 0 {
+		attempts, err := redisService.GetFailedAttempts(codeNamespace, recipient)
+		if err != nil {
+			// Fail closed: without the counter the attempt limit can't be enforced
+			logging.Errorf("Failed to read failed verification attempts - project: %s, error: %v", projectID.(string), err)
+			c.JSON(http.StatusServiceUnavailable, VerifyCodeResponse{
+				Success: false,
+				Message: "Service unavailable",
+			})
+			return
+		}
+		if attempts >= maxAttempts {
+			lockOutVerification(c, redisService, codeNamespace, recipient)
+			return
+		}
+	}
+
+	// Check verification code in Redis (according to CODE_POLICY)
+	expireMinutes := services.CodeExpireMinutesForProject(project)
+	valid, err := redisService.CheckCode(codeNamespace, recipient, req.Code, expireMinutes)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, VerifyCodeResponse{
 			Success: false,
@@ -157,7 +403,25 @@ func VerifyCode(c *gin.Context) {
 	}
 
 	// Compare verification codes
-	if storedCode != req.Code {
+	if !valid {
+		if maxAttempts > 0 {
+			expire := time.Duration(expireMinutes) * time.Minute
+			attempts, err := redisService.IncrFailedAttempt(codeNamespace, recipient, expire)
+			if err != nil {
+				// Fail closed: an uncounted guess would let brute force bypass the limit, so the code is discarded
+				logging.Errorf("Failed to count failed verification attempt - project: %s, error: %v", projectID.(string), err)
+				redisService.DeleteCode(codeNamespace, recipient)
+				c.JSON(http.StatusServiceUnavailable, VerifyCodeResponse{
+					Success: false,
+					Message: "Service unavailable, please request a new verification code",
+				})
+				return
+			}
+			if attempts >= maxAttempts {
+				lockOutVerification(c, redisService, codeNamespace, recipient)
+				return
+			}
+		}
 		c.JSON(http.StatusBadRequest, VerifyCodeResponse{
 			Success: false,
 			Message: "Invalid verification code",
@@ -166,10 +430,26 @@ func VerifyCode(c *gin.Context) {
 	}
 
 	// Delete verification code from Redis (mark as used)
-	redisService.DeleteCode(projectID.(string), req.Email)
+	redisService.DeleteCode(codeNamespace, recipient)
+	redisService.ResetFailedAttempts(codeNamespace, recipient)
 
 	c.JSON(http.StatusOK, VerifyCodeResponse{
 		Success: true,
 		Message: "Verification code verified successfully",
 	})
 }
+
+// lockOutVerification discards the outstanding codes of the email after too many failed attempts
+// The counter is reset too, so the next code sent gets a fresh set of attempts
+func lockOutVerification(c *gin.Context, redisService *services.RedisService, codeNamespace, email string) {
+	redisService.DeleteCode(codeNamespace, email)
+	redisService.ResetFailedAttempts(codeNamespace, email)
+	logging.Warnf("Verification code discarded after %d failed attempts - namespace: %s", config.AppConfig.CodeMaxVerifyAttempts, codeNamespace)
+	metrics.IncCounter("verification_code_lockouts_total", nil)
+
+	c.JSON(http.StatusTooManyRequests, VerifyCodeResponse{
+		Success: false,
+		Message: "Too many failed attempts, please request a new verification code",
+		Error:   ErrTooManyAttempts,
+	})
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"verification-api/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readWebhookBody reads the raw body of an Apple/Google notification
+// Bodies over WEBHOOK_MAX_BODY_BYTES are rejected with 413, other read errors with 400
+func readWebhookBody(c *gin.Context) ([]byte, bool) {
+	body, err := c.GetRawData()
+	if err == nil {
+		return body, true
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		logging.Errorf("Webhook request body exceeds %d bytes from %s", maxBytesErr.Limit, c.ClientIP())
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"success": false,
+			"message": "Request body too large",
+		})
+		return nil, false
+	}
+
+	logging.Errorf("Failed to read request body: %v", err)
+	c.JSON(http.StatusBadRequest, gin.H{
+		"success": false,
+		"message": "Failed to read request body",
+	})
+	return nil, false
+}
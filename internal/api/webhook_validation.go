@@ -0,0 +1,58 @@
+package api
+
+import (
+	"verification-api/internal/models"
+	"verification-api/internal/services"
+)
+
+// validateProjectWebhooks sends a signed test event to every webhook URL configured for the project
+// (default and per-environment, each URL once) and reports whether all of them answered 2xx
+// Used by CreateProject / UpdateProject with validate_webhook=true before the config is saved
+func validateProjectWebhooks(project *models.Project) ([]*services.WebhookTestResult, bool) {
+	endpoint := services.WebhookEndpointFromProject(project)
+	webhookNotifier := services.NewWebhookNotifier()
+
+	var results []*services.WebhookTestResult
+	ok := true
+	seen := make(map[string]bool)
+	for _, url := range []string{endpoint.URL, endpoint.SandboxURL, endpoint.ProductionURL} {
+		if url == "" || seen[url] {
+			continue
+		}
+		seen[url] = true
+
+		target := endpoint
+		target.URL = url
+		result := webhookNotifier.SendTestWebhook(target)
+		if result.Error != "" {
+			ok = false
+		}
+		results = append(results, result)
+	}
+	return results, ok
+}
+
+// projectWithWebhookUpdates returns the stored project with the webhook fields of an update applied
+// Used to validate the webhook configuration a project will have after the update
+func projectWithWebhookUpdates(projectID string, updates map[string]interface{}) (*models.Project, error) {
+	project, err := services.NewProjectService().GetProjectForAdmin(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]*string{
+		"webhook_callback_url":        &project.WebhookCallbackURL,
+		"webhook_secret":              &project.WebhookSecret,
+		"webhook_content_type":        &project.WebhookContentType,
+		"webhook_signature_algorithm": &project.WebhookSignatureAlgorithm,
+		"webhook_signature_format":    &project.WebhookSignatureFormat,
+		"webhook_sandbox_url":         &project.WebhookSandboxURL,
+		"webhook_production_url":      &project.WebhookProductionURL,
+	}
+	for column, field := range fields {
+		if value, ok := updates[column].(string); ok {
+			*field = value
+		}
+	}
+	return project, nil
+}
@@ -3,14 +3,26 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
 	// Server configuration
-	Port string
-	Mode string
+	Port     string
+	Mode     string
+	LogLevel string // debug, info, warn, error
+	BasePath string // 路由前缀（如 /unionhub），为空表示挂载在根路径
+
+	// Admin API authentication
+	AdminAPIKeys []string // 管理接口密钥，格式 name:key（逗号分隔，name 用于审计日志）；为空时管理接口不可用
+
+	// Request capture (sampled full request/response logging for debug_capture projects)
+	RequestCaptureSampleRate   float64 // 抽样比例（0~1，如 0.01 表示 1%），0 表示关闭
+	RequestCaptureTTLSeconds   int     // 抓取记录在 Redis 中的保留时间（秒）
+	RequestCaptureMaxBodyBytes int     // 请求 / 响应 body 保存上限（字节），超出部分截断
+	IdempotencyKeyTTLSeconds   int     // 带 Idempotency-Key 的 POST 请求响应保留时间（秒），0 表示忽略该请求头
 
 	// Database configuration
 	DatabaseURL string
@@ -21,16 +33,118 @@ type Config struct {
 	// Brevo email configuration
 	BrevoAPIKey    string
 	BrevoFromEmail string
+	BrevoDailyCap  int // 每日邮件发送上限（达到后拒绝发送，0 表示不限制）
+
+	// SMTP fallback email configuration (used when Brevo fails)
+	SMTPHost      string
+	SMTPPort      int
+	SMTPUsername  string
+	SMTPPassword  string
+	SMTPFromEmail string // 发件地址，为空时使用 BrevoFromEmail
+
+	// Twilio SMS configuration (channel=sms)
+	TwilioAccountSID          string
+	TwilioAuthToken           string
+	TwilioFromNumber          string // 发送号码（E.164），与 TwilioMessagingServiceSID 二选一
+	TwilioMessagingServiceSID string // Messaging Service SID，配置后优先于发送号码
 
 	// Verification code configuration
-	CodeExpireMinutes int
-	RateLimitMinutes  int
+	CodeExpireMinutes     int
+	RateLimitMinutes      int
+	CodeDailySendLimit    int    // 每个项目+邮箱每天（UTC）最多发送的验证码数（0 表示不限制）
+	CodePolicy            string // latest-only（默认，仅最新验证码有效）或 accept-any-recent（有效期内最近 N 个验证码均有效）
+	CodeMaxOutstanding    int    // accept-any-recent 策略下同时有效的验证码数量上限
+	CodeMaxVerifyAttempts int    // 验证码连续验证失败次数上限，达到后删除验证码（0 表示不限制）
+
+	// Project defaults
+	DefaultMaxRequests int // 新建项目未指定 max_requests 时的默认每日请求数
 
 	// App Store configuration (for subscription center)
-	AppStoreKeyID        string
-	AppStoreIssuerID     string
-	AppStorePrivateKey   string
-	AppStoreSharedSecret string
+	AppStoreKeyID          string
+	AppStoreIssuerID       string
+	AppStorePrivateKey     string
+	AppStorePrivateKeyPath string // .p8 私钥文件路径，APPSTORE_PRIVATE_KEY 为空时使用
+	AppStoreSharedSecret   string
+
+	// App Store notification signature configuration
+	AppleCertCacheTTLMinutes int    // Apple 证书缓存有效期（分钟）
+	AppleCertWarmup          bool   // 启动时预热证书缓存，完成前 /health/ready 返回未就绪
+	AppleRootCertPath        string // 额外信任的 Apple 根证书 PEM 文件（可含多个证书），用于根证书轮换
+	AppleRootCertPEM         string // 额外信任的 Apple 根证书 PEM 内容，与文件同时配置时两者都生效
+
+	// App Store notification data version configuration
+	AppStoreSupportedDataVersions []string // 支持的通知 dataVersion 列表
+	AppStoreStrictDataVersion     bool     // 严格模式：拒绝不支持的 dataVersion（否则仅记录警告）
+
+	// App Store notification queue (async processing after the webhook responds)
+	AppStoreNotificationQueueEnabled bool // 通知验签、去重后写入队列并立即返回 200，由 worker 异步处理（否则同步处理后返回）
+	AppStoreNotificationQueueWorkers int  // 每个实例处理队列的 worker 数
+	AppStoreNotificationMaxAttempts  int  // 处理失败（服务端错误）时的最多尝试次数，达到后标记为 failed
+
+	// App Store JWS algorithm configuration
+	AppleJWSStrictAlg bool // 严格模式：未验签解析的 JWS 头部 alg 必须为 ES256（否则仅记录警告）
+
+	// App Store notification signature fallback (sandbox testing only)
+	AppStoreSandboxSkipSignature bool // sandbox 通知 signedPayload 验签失败时仍按旧逻辑解析（仅用于测试，production 始终验签）
+
+	// StoreKit 2 signed_transaction local verification
+	AppStoreLocalJWSVerification bool // 客户端提交的 signed_transaction 本地验签通过后直接信任，不再调用 App Store Server API（失败时回退到 API）
+
+	// Reconciliation configuration
+	ExpiryDriftToleranceSeconds int // 对账时 expires_date 偏差容忍度（秒），未超过且状态未变化时不更新、不触发 webhook
+
+	// Duplicate transaction_id handling
+	DuplicateTransactionIDPolicy string // 新订阅的 transaction_id 已被同项目其他订阅占用时：upsert（默认，覆盖该记录）、skip（保留原记录）、reject（返回错误）
+
+	// Subscription sync configuration
+	SubscriptionSyncIntervalSeconds int // 同一用户两次 /api/subscription/sync 之间的最小间隔（秒）
+
+	// Subscription status cache configuration
+	SubscriptionStatusCacheTTLSeconds int  // 订阅状态缓存有效期（秒），0 表示禁用
+	EntitlementCacheTTLSeconds        int  // /api/subscription/entitled 结果缓存有效期（秒），0 表示禁用
+	SubscriptionStatusLapsedDetail    bool // 无有效订阅时区分 expired（曾订阅，返回最后到期时间）和 none（从未订阅），关闭时统一返回 inactive
+
+	// Webhook configuration
+	WebhookAllowHTTP         bool // 允许 http 回调地址（仅用于开发环境）
+	WebhookAllowPrivateIPs   bool // 允许回调到内网/回环地址（仅用于开发环境）
+	WebhookMaxBodyBytes      int  // Apple/Google 通知请求体大小上限（字节），超出返回 413
+	WebhookRetryReloadConfig bool // 每次重试前重新读取项目的 webhook 配置（回调地址、密钥的修改在下一次重试生效）
+
+	// Google Pub/Sub push authentication
+	GooglePubSubAudience string // Pub/Sub push 订阅配置的 OIDC audience（为空时不校验 aud）
+
+	// Google Play Developer API credentials (service account key)
+	GooglePlayServiceAccountJSON string // 服务账号 JSON（原文或 base64），优先于文件路径
+	GooglePlayServiceAccountPath string // 服务账号 JSON 文件路径
+	GooglePlayAutoAcknowledge    bool   // 验证订阅时自动确认（acknowledge）未确认的购买，Google 要求 3 天内确认，否则自动退款
+
+	// Scheduled jobs configuration
+	SchedulerEnabled       bool // 是否启用定时任务（多副本通过 Redis 租约选主）
+	ShutdownTimeoutSeconds int  // 优雅关闭时等待请求和定时任务结束的最长时间（秒）
+	JobConcurrency         int  // 批量定时任务的并发 worker 数
+
+	// Store API rate limits shared by all background jobs (token bucket, 0 = unlimited)
+	AppStoreAPIRateLimitPerSecond   float64 // 定时任务调用 App Store Server API 的每秒请求上限
+	GooglePlayAPIRateLimitPerSecond float64 // 定时任务调用 Google Play Developer API 的每秒请求上限
+
+	// Passive restore configuration
+	RestoreLookbackMonths int  // 被动恢复只返回未过期或最近 N 个月内过期的订阅（0 表示不限制）
+	RestoreIncludeExpired bool // 被动恢复是否包含（窗口内）已过期的订阅
+
+	// Unresolved appAccountToken binding retry (store_unresolved policy)
+	BindingRetryIntervalSeconds int // 重试任务执行间隔（秒），0 表示禁用
+	BindingRetryMaxAttempts     int // 每个订阅最多重试次数，达到后放弃
+
+	// Renewal count configuration
+	RenewalCountResubscribePolicy string // 重新订阅时续订次数的处理：continue（默认，继续累计）或 reset（清零）
+
+	// Fraud detection configuration
+	FraudMaxSubscriptionsPerUser int // 单个用户订阅数（不同 original_transaction_id）超过该值时标记并触发 fraud.suspected，0 表示禁用
+
+	// Subscription transition events (analytics pipelines)
+	SubscriptionEventSink         string // 订阅状态变化事件的输出：none（默认）、log（结构化日志）或 redis（Redis Stream）
+	SubscriptionEventStream       string // redis 输出使用的 Stream 名称
+	SubscriptionEventStreamMaxLen int    // Stream 保留的大致最大条数，0 表示不裁剪
 
 	// Database migration configuration
 	AutoMigrate bool // 是否自动迁移数据库（生产环境建议设为 false）
@@ -45,24 +159,97 @@ func InitConfig() error {
 	}
 
 	AppConfig = &Config{
-		Port:                 getEnv("PORT", "8080"),
-		Mode:                 getEnv("GIN_MODE", "debug"),
-		DatabaseURL:          getEnv("DATABASE_URL", ""),
-		RedisURL:             getEnv("REDIS_URL", "redis://localhost:6379/0"),
-		BrevoAPIKey:          getEnv("BREVO_API_KEY", ""),
-		BrevoFromEmail:       getEnv("BREVO_FROM_EMAIL", ""),
-		CodeExpireMinutes:    getEnvInt("CODE_EXPIRE_MINUTES", 5),
-		RateLimitMinutes:     getEnvInt("RATE_LIMIT_MINUTES", 1),
-		AppStoreKeyID:        getEnv("APPSTORE_KEY_ID", ""),
-		AppStoreIssuerID:     getEnv("APPSTORE_ISSUER_ID", ""),
-		AppStorePrivateKey:   getEnv("APPSTORE_PRIVATE_KEY", ""),
-		AppStoreSharedSecret: getEnv("APPSTORE_SHARED_SECRET", ""),
-		AutoMigrate:          getEnvBool("AUTO_MIGRATE", true), // 默认开启，生产环境可设为 false
+		Port:                              getEnv("PORT", "8080"),
+		LogLevel:                          getEnv("LOG_LEVEL", "info"),
+		Mode:                              getEnv("GIN_MODE", "debug"),
+		BasePath:                          normalizeBasePath(getEnv("BASE_PATH", "")),
+		AdminAPIKeys:                      getEnvList("ADMIN_API_KEYS", nil),
+		RequestCaptureSampleRate:          getEnvFloat("REQUEST_CAPTURE_SAMPLE_RATE", 0),
+		RequestCaptureTTLSeconds:          getEnvInt("REQUEST_CAPTURE_TTL_SECONDS", 3600),
+		RequestCaptureMaxBodyBytes:        getEnvInt("REQUEST_CAPTURE_MAX_BODY_BYTES", 64<<10), // 默认 64KB
+		IdempotencyKeyTTLSeconds:          getEnvInt("IDEMPOTENCY_KEY_TTL_SECONDS", 86400),
+		DatabaseURL:                       getEnv("DATABASE_URL", ""),
+		RedisURL:                          getEnv("REDIS_URL", "redis://localhost:6379/0"),
+		BrevoAPIKey:                       getEnv("BREVO_API_KEY", ""),
+		BrevoFromEmail:                    getEnv("BREVO_FROM_EMAIL", ""),
+		BrevoDailyCap:                     getEnvInt("BREVO_DAILY_CAP", 0),
+		SMTPHost:                          getEnv("SMTP_HOST", ""),
+		SMTPPort:                          getEnvInt("SMTP_PORT", 587),
+		SMTPUsername:                      getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:                      getEnv("SMTP_PASSWORD", ""),
+		SMTPFromEmail:                     getEnv("SMTP_FROM_EMAIL", getEnv("BREVO_FROM_EMAIL", "")),
+		TwilioAccountSID:                  getEnv("TWILIO_ACCOUNT_SID", ""),
+		TwilioAuthToken:                   getEnv("TWILIO_AUTH_TOKEN", ""),
+		TwilioFromNumber:                  getEnv("TWILIO_FROM_NUMBER", ""),
+		TwilioMessagingServiceSID:         getEnv("TWILIO_MESSAGING_SERVICE_SID", ""),
+		CodeExpireMinutes:                 getEnvInt("CODE_EXPIRE_MINUTES", 5),
+		RateLimitMinutes:                  getEnvInt("RATE_LIMIT_MINUTES", 1),
+		CodeDailySendLimit:                getEnvInt("CODE_DAILY_SEND_LIMIT", 0),
+		CodePolicy:                        getEnv("CODE_POLICY", "latest-only"),
+		CodeMaxOutstanding:                getEnvInt("CODE_MAX_OUTSTANDING", 3),
+		CodeMaxVerifyAttempts:             getEnvInt("CODE_MAX_VERIFY_ATTEMPTS", 5),
+		DefaultMaxRequests:                getEnvInt("DEFAULT_MAX_REQUESTS", 1000),
+		AppStoreKeyID:                     getEnv("APPSTORE_KEY_ID", ""),
+		AppStoreIssuerID:                  getEnv("APPSTORE_ISSUER_ID", ""),
+		AppStorePrivateKey:                getEnv("APPSTORE_PRIVATE_KEY", ""),
+		AppStorePrivateKeyPath:            getEnv("APPSTORE_PRIVATE_KEY_PATH", ""),
+		AppStoreSharedSecret:              getEnv("APPSTORE_SHARED_SECRET", ""),
+		AppleCertCacheTTLMinutes:          getEnvInt("APPLE_CERT_CACHE_TTL_MINUTES", 1440), // 默认24小时
+		AppleCertWarmup:                   getEnvBool("APPLE_CERT_WARMUP", false),
+		AppleRootCertPath:                 getEnv("APPLE_ROOT_CERT_PATH", ""),
+		AppleRootCertPEM:                  getEnv("APPLE_ROOT_CERT_PEM", ""),
+		AppStoreSupportedDataVersions:     getEnvList("APPSTORE_SUPPORTED_DATA_VERSIONS", []string{"2.0"}),
+		AppStoreStrictDataVersion:         getEnvBool("APPSTORE_STRICT_DATA_VERSION", false),
+		AppStoreNotificationQueueEnabled:  getEnvBool("APPSTORE_NOTIFICATION_QUEUE_ENABLED", true),
+		AppStoreNotificationQueueWorkers:  getEnvInt("APPSTORE_NOTIFICATION_QUEUE_WORKERS", 4),
+		AppStoreNotificationMaxAttempts:   getEnvInt("APPSTORE_NOTIFICATION_MAX_ATTEMPTS", 5),
+		AppleJWSStrictAlg:                 getEnvBool("APPLE_JWS_STRICT_ALG", true),
+		AppStoreSandboxSkipSignature:      getEnvBool("APPSTORE_SANDBOX_SKIP_SIGNATURE", false),
+		AppStoreLocalJWSVerification:      getEnvBool("APPSTORE_LOCAL_JWS_VERIFICATION", false),
+		ExpiryDriftToleranceSeconds:       getEnvInt("EXPIRY_DRIFT_TOLERANCE_SECONDS", 60),
+		DuplicateTransactionIDPolicy:      getEnv("DUPLICATE_TRANSACTION_ID_POLICY", "upsert"),
+		SubscriptionSyncIntervalSeconds:   getEnvInt("SUBSCRIPTION_SYNC_INTERVAL_SECONDS", 60),
+		SubscriptionStatusCacheTTLSeconds: getEnvInt("SUBSCRIPTION_STATUS_CACHE_TTL_SECONDS", 300),
+		EntitlementCacheTTLSeconds:        getEnvInt("ENTITLEMENT_CACHE_TTL_SECONDS", 3600),
+		SubscriptionStatusLapsedDetail:    getEnvBool("SUBSCRIPTION_STATUS_LAPSED_DETAIL", false),
+		WebhookAllowHTTP:                  getEnvBool("WEBHOOK_ALLOW_HTTP", false),
+		WebhookAllowPrivateIPs:            getEnvBool("WEBHOOK_ALLOW_PRIVATE_IPS", false),
+		WebhookMaxBodyBytes:               getEnvInt("WEBHOOK_MAX_BODY_BYTES", 2<<20), // 默认 2MB
+		WebhookRetryReloadConfig:          getEnvBool("WEBHOOK_RETRY_RELOAD_CONFIG", true),
+		GooglePubSubAudience:              getEnv("GOOGLE_PUBSUB_AUDIENCE", ""),
+		GooglePlayServiceAccountJSON:      getEnv("GOOGLE_PLAY_SERVICE_ACCOUNT_JSON", ""),
+		GooglePlayServiceAccountPath:      getEnv("GOOGLE_PLAY_SERVICE_ACCOUNT_PATH", ""),
+		GooglePlayAutoAcknowledge:         getEnvBool("GOOGLE_PLAY_AUTO_ACKNOWLEDGE", true),
+		SchedulerEnabled:                  getEnvBool("SCHEDULER_ENABLED", true),
+		ShutdownTimeoutSeconds:            getEnvInt("SHUTDOWN_TIMEOUT_SECONDS", 30),
+		JobConcurrency:                    getEnvInt("JOB_CONCURRENCY", 4),
+		AppStoreAPIRateLimitPerSecond:     getEnvFloat("APPSTORE_API_RATE_LIMIT_PER_SECOND", 10),
+		GooglePlayAPIRateLimitPerSecond:   getEnvFloat("GOOGLE_PLAY_API_RATE_LIMIT_PER_SECOND", 10),
+		RestoreLookbackMonths:             getEnvInt("RESTORE_LOOKBACK_MONTHS", 12),
+		RestoreIncludeExpired:             getEnvBool("RESTORE_INCLUDE_EXPIRED", true),
+		BindingRetryIntervalSeconds:       getEnvInt("BINDING_RETRY_INTERVAL_SECONDS", 300),
+		BindingRetryMaxAttempts:           getEnvInt("BINDING_RETRY_MAX_ATTEMPTS", 10),
+		FraudMaxSubscriptionsPerUser:      getEnvInt("FRAUD_MAX_SUBSCRIPTIONS_PER_USER", 0),
+		RenewalCountResubscribePolicy:     getEnv("RENEWAL_COUNT_RESUBSCRIBE_POLICY", "continue"),
+		SubscriptionEventSink:             getEnv("SUBSCRIPTION_EVENT_SINK", "none"),
+		SubscriptionEventStream:           getEnv("SUBSCRIPTION_EVENT_STREAM", "subscription_events"),
+		SubscriptionEventStreamMaxLen:     getEnvInt("SUBSCRIPTION_EVENT_STREAM_MAX_LEN", 100000),
+		AutoMigrate:                       getEnvBool("AUTO_MIGRATE", true), // 默认开启，生产环境可设为 false
 	}
 
 	return nil
 }
 
+// normalizeBasePath ensures the prefix has a leading slash and no trailing slash
+// Empty or "/" means no prefix
+func normalizeBasePath(path string) string {
+	path = strings.Trim(strings.TrimSpace(path), "/")
+	if path == "" {
+		return ""
+	}
+	return "/" + path
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -79,6 +266,15 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
@@ -87,3 +283,18 @@ func getEnvBool(key string, defaultValue bool) bool {
 	}
 	return defaultValue
 }
+
+func getEnvList(key string, defaultValue []string) []string {
+	if value := os.Getenv(key); value != "" {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		if len(items) > 0 {
+			return items
+		}
+	}
+	return defaultValue
+}
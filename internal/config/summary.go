@@ -0,0 +1,106 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Summary returns the effective configuration as "key: value" lines for startup logging
+// Secret values are never included, only whether they are configured
+func (c *Config) Summary() []string {
+	databaseDriver := "sqlite"
+	if c.DatabaseURL != "" {
+		databaseDriver = "postgres"
+	}
+
+	emailProvider := "none"
+	if c.BrevoAPIKey != "" {
+		emailProvider = "brevo"
+	}
+	if c.SMTPHost != "" {
+		emailProvider += " (fallback: smtp)"
+	}
+
+	return []string{
+		fmt.Sprintf("port: %s", c.Port),
+		fmt.Sprintf("gin_mode: %s", c.Mode),
+		fmt.Sprintf("log_level: %s", c.LogLevel),
+		fmt.Sprintf("base_path: %q", c.BasePath),
+		fmt.Sprintf("admin_api_keys: %d", len(c.AdminAPIKeys)),
+		fmt.Sprintf("request_capture_sample_rate: %g (ttl_seconds: %d, max_body_bytes: %d)", c.RequestCaptureSampleRate, c.RequestCaptureTTLSeconds, c.RequestCaptureMaxBodyBytes),
+		fmt.Sprintf("idempotency_key_ttl_seconds: %d", c.IdempotencyKeyTTLSeconds),
+		fmt.Sprintf("database_driver: %s", databaseDriver),
+		fmt.Sprintf("database_host: %s", redactURLHost(c.DatabaseURL)),
+		fmt.Sprintf("auto_migrate: %v", c.AutoMigrate),
+		fmt.Sprintf("redis_host: %s", redactURLHost(c.RedisURL)),
+		fmt.Sprintf("email_provider: %s", emailProvider),
+		fmt.Sprintf("email_from: %s", c.BrevoFromEmail),
+		fmt.Sprintf("brevo_daily_cap: %d", c.BrevoDailyCap),
+		fmt.Sprintf("smtp_host: %s:%d (username: %s, password: %s)", c.SMTPHost, c.SMTPPort, c.SMTPUsername, configured(c.SMTPPassword)),
+		fmt.Sprintf("twilio_account_sid: %s (auth_token: %s)", configured(c.TwilioAccountSID), configured(c.TwilioAuthToken)),
+		fmt.Sprintf("twilio_from_number: %s (messaging_service_sid: %s)", c.TwilioFromNumber, c.TwilioMessagingServiceSID),
+		fmt.Sprintf("code_expire_minutes: %d", c.CodeExpireMinutes),
+		fmt.Sprintf("rate_limit_minutes: %d", c.RateLimitMinutes),
+		fmt.Sprintf("code_daily_send_limit: %d", c.CodeDailySendLimit),
+		fmt.Sprintf("code_policy: %s (max_outstanding: %d)", c.CodePolicy, c.CodeMaxOutstanding),
+		fmt.Sprintf("code_max_verify_attempts: %d", c.CodeMaxVerifyAttempts),
+		fmt.Sprintf("default_max_requests: %d", c.DefaultMaxRequests),
+		fmt.Sprintf("appstore_key_id: %s", configured(c.AppStoreKeyID)),
+		fmt.Sprintf("appstore_issuer_id: %s", configured(c.AppStoreIssuerID)),
+		fmt.Sprintf("appstore_private_key: %s", configured(c.AppStorePrivateKey)),
+		fmt.Sprintf("appstore_private_key_path: %s", c.AppStorePrivateKeyPath),
+		fmt.Sprintf("appstore_shared_secret: %s", configured(c.AppStoreSharedSecret)),
+		fmt.Sprintf("apple_cert_cache_ttl_minutes: %d (warmup: %v)", c.AppleCertCacheTTLMinutes, c.AppleCertWarmup),
+		fmt.Sprintf("apple_root_cert_path: %s (pem: %s)", c.AppleRootCertPath, configured(c.AppleRootCertPEM)),
+		fmt.Sprintf("appstore_supported_data_versions: %s (strict: %v)", strings.Join(c.AppStoreSupportedDataVersions, ","), c.AppStoreStrictDataVersion),
+		fmt.Sprintf("appstore_notification_queue_enabled: %v (workers: %d, max_attempts: %d)", c.AppStoreNotificationQueueEnabled, c.AppStoreNotificationQueueWorkers, c.AppStoreNotificationMaxAttempts),
+		fmt.Sprintf("apple_jws_strict_alg: %v", c.AppleJWSStrictAlg),
+		fmt.Sprintf("appstore_sandbox_skip_signature: %v", c.AppStoreSandboxSkipSignature),
+		fmt.Sprintf("appstore_local_jws_verification: %v", c.AppStoreLocalJWSVerification),
+		fmt.Sprintf("expiry_drift_tolerance_seconds: %d", c.ExpiryDriftToleranceSeconds),
+		fmt.Sprintf("duplicate_transaction_id_policy: %s", c.DuplicateTransactionIDPolicy),
+		fmt.Sprintf("subscription_sync_interval_seconds: %d", c.SubscriptionSyncIntervalSeconds),
+		fmt.Sprintf("subscription_status_cache_ttl_seconds: %d", c.SubscriptionStatusCacheTTLSeconds),
+		fmt.Sprintf("entitlement_cache_ttl_seconds: %d", c.EntitlementCacheTTLSeconds),
+		fmt.Sprintf("subscription_status_lapsed_detail: %v", c.SubscriptionStatusLapsedDetail),
+		fmt.Sprintf("webhook_allow_http: %v", c.WebhookAllowHTTP),
+		fmt.Sprintf("webhook_allow_private_ips: %v", c.WebhookAllowPrivateIPs),
+		fmt.Sprintf("webhook_max_body_bytes: %d", c.WebhookMaxBodyBytes),
+		fmt.Sprintf("webhook_retry_reload_config: %v", c.WebhookRetryReloadConfig),
+		fmt.Sprintf("google_pubsub_audience: %s", c.GooglePubSubAudience),
+		fmt.Sprintf("google_play_service_account_json: %s", configured(c.GooglePlayServiceAccountJSON)),
+		fmt.Sprintf("google_play_service_account_path: %s", c.GooglePlayServiceAccountPath),
+		fmt.Sprintf("google_play_auto_acknowledge: %v", c.GooglePlayAutoAcknowledge),
+		fmt.Sprintf("scheduler_enabled: %v", c.SchedulerEnabled),
+		fmt.Sprintf("shutdown_timeout_seconds: %d", c.ShutdownTimeoutSeconds),
+		fmt.Sprintf("job_concurrency: %d", c.JobConcurrency),
+		fmt.Sprintf("appstore_api_rate_limit_per_second: %g (google_play: %g)", c.AppStoreAPIRateLimitPerSecond, c.GooglePlayAPIRateLimitPerSecond),
+		fmt.Sprintf("restore_lookback_months: %d (include_expired: %v)", c.RestoreLookbackMonths, c.RestoreIncludeExpired),
+		fmt.Sprintf("binding_retry_interval_seconds: %d (max_attempts: %d)", c.BindingRetryIntervalSeconds, c.BindingRetryMaxAttempts),
+		fmt.Sprintf("fraud_max_subscriptions_per_user: %d", c.FraudMaxSubscriptionsPerUser),
+		fmt.Sprintf("renewal_count_resubscribe_policy: %s", c.RenewalCountResubscribePolicy),
+		fmt.Sprintf("subscription_event_sink: %s (stream: %s, max_len: %d)", c.SubscriptionEventSink, c.SubscriptionEventStream, c.SubscriptionEventStreamMaxLen),
+	}
+}
+
+// configured reports whether a secret is set without revealing it
+func configured(value string) string {
+	if value == "" {
+		return "not configured"
+	}
+	return "configured"
+}
+
+// redactURLHost returns only the host:port part of a connection URL
+// Credentials, path and query (which may contain passwords) are dropped
+func redactURLHost(rawURL string) string {
+	if rawURL == "" {
+		return "-"
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "***"
+	}
+	return u.Host
+}
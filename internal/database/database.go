@@ -139,12 +139,45 @@ func maskRedisURL(url string) string {
 
 // autoMigrate performs database migration
 func autoMigrate() error {
-	return DB.AutoMigrate(
+	if err := DB.AutoMigrate(
 		&models.Project{},
+		&models.ProjectGroup{}, // 项目组（共享验证码）
 		// VerificationCode, VerificationLog, and RateLimit removed - using Redis only
-		&models.Subscription{}, // 订阅表
-		&models.Transaction{},  // 通用交易表
-	)
+		&models.Subscription{},       // 订阅表
+		&models.Transaction{},        // 通用交易表
+		&models.FlaggedUser{},        // 疑似欺诈用户
+		&models.WebhookDelivery{},    // webhook 投递记录
+		&models.QueuedNotification{}, // 待异步处理的 App Store 通知
+	); err != nil {
+		return err
+	}
+	return dropLegacyTransactionIDIndexes()
+}
+
+// dropLegacyTransactionIDIndexes drops the old unique indexes on transaction_id
+// The full ones also covered soft-deleted rows, which blocked re-creating a deleted subscription / transaction.
+// They are replaced by partial unique indexes (WHERE deleted_at IS NULL); for subscriptions the index is also
+// scoped to the environment, because sandbox transactions may reuse production transaction IDs, and for
+// transactions to the project, so one project's purchase can never overwrite another project's row
+func dropLegacyTransactionIDIndexes() error {
+	legacy := []struct {
+		model interface{}
+		name  string
+	}{
+		{&models.Subscription{}, "idx_subscription_transaction_id"},
+		{&models.Subscription{}, "idx_subscription_active_transaction_id"},
+		{&models.Transaction{}, "idx_transactions_transaction_id"},
+		{&models.Transaction{}, "idx_transactions_active_transaction_id"},
+	}
+	for _, index := range legacy {
+		if DB.Migrator().HasIndex(index.model, index.name) {
+			logging.Infof("Dropping legacy index %s", index.name)
+			if err := DB.Migrator().DropIndex(index.model, index.name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 // GetDB returns database instance
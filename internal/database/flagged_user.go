@@ -0,0 +1,62 @@
+package database
+
+import (
+	"time"
+	"verification-api/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// CountUserSubscriptions 统计用户的订阅数量（按 original_transaction_id 去重，按项目）
+func CountUserSubscriptions(projectID, appAccountToken string) (int64, error) {
+	var count int64
+	err := DB.Model(&models.Subscription{}).
+		Where("project_id = ? AND app_account_token = ?", projectID, appAccountToken).
+		Distinct("original_transaction_id").
+		Count(&count).Error
+	return count, err
+}
+
+// FlagUser 标记疑似欺诈用户，已标记时更新订阅数量
+// 返回 previousCount：之前记录的订阅数量（首次标记为 0）
+func FlagUser(projectID, appAccountToken, reason string, subscriptionCount int64) (int64, error) {
+	var previousCount int64
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var existing models.FlaggedUser
+		err := tx.Where("project_id = ? AND app_account_token = ?", projectID, appAccountToken).First(&existing).Error
+		if err == gorm.ErrRecordNotFound {
+			return tx.Create(&models.FlaggedUser{
+				ProjectID:         projectID,
+				AppAccountToken:   appAccountToken,
+				Reason:            reason,
+				SubscriptionCount: subscriptionCount,
+				LastFlaggedAt:     time.Now(),
+			}).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		previousCount = existing.SubscriptionCount
+		return tx.Model(&existing).Updates(map[string]interface{}{
+			"reason":             reason,
+			"subscription_count": subscriptionCount,
+			"last_flagged_at":    time.Now(),
+		}).Error
+	})
+	return previousCount, err
+}
+
+// ListFlaggedUsers 分页获取项目的疑似欺诈用户（按最近标记时间倒序）
+func ListFlaggedUsers(projectID string, limit, offset int) ([]models.FlaggedUser, int64, error) {
+	query := DB.Model(&models.FlaggedUser{}).Where("project_id = ?", projectID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []models.FlaggedUser
+	err := query.Order("last_flagged_at DESC").Offset(offset).Limit(limit).Find(&users).Error
+	return users, total, err
+}
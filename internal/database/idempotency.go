@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// IdempotencyRecord 带 Idempotency-Key 的请求的处理结果（处理中时只有 Fingerprint）
+type IdempotencyRecord struct {
+	Fingerprint string `json:"fingerprint"` // 请求方法、路径和 body 的摘要，同一 key 用于不同请求时拒绝
+	Pending     bool   `json:"pending"`     // 首次请求仍在处理中
+	StatusCode  int    `json:"status_code,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body,omitempty"`
+}
+
+// RedisIdempotencyStore 在 Redis 中保存幂等请求的结果，key 在 ttl 后过期
+type RedisIdempotencyStore struct{}
+
+// idempotencyRedisKey 幂等记录 key（key 已由调用方按项目和路径区分）
+func idempotencyRedisKey(key string) string {
+	return fmt.Sprintf("idempotency:%s", key)
+}
+
+// Reserve 原子地占用 key（SET NX）并标记为处理中
+// key 已存在时返回已有记录和 false
+func (RedisIdempotencyStore) Reserve(key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	if RedisClient == nil {
+		return nil, false, fmt.Errorf("redis is not initialized")
+	}
+	data, err := json.Marshal(&IdempotencyRecord{Fingerprint: fingerprint, Pending: true})
+	if err != nil {
+		return nil, false, err
+	}
+
+	ctx := context.Background()
+	reserved, err := RedisClient.SetNX(ctx, idempotencyRedisKey(key), data, ttl).Result()
+	if err != nil || reserved {
+		return nil, reserved, err
+	}
+
+	stored, err := RedisClient.Get(ctx, idempotencyRedisKey(key)).Bytes()
+	if err == redis.Nil {
+		// 已有记录刚好过期或被释放，按新请求再占用一次
+		return RedisIdempotencyStore{}.Reserve(key, fingerprint, ttl)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var record IdempotencyRecord
+	if err := json.Unmarshal(stored, &record); err != nil {
+		return nil, false, err
+	}
+	return &record, false, nil
+}
+
+// Complete 保存请求的响应，重复请求在 ttl 内直接返回该响应
+func (RedisIdempotencyStore) Complete(key string, record *IdempotencyRecord, ttl time.Duration) error {
+	if RedisClient == nil {
+		return fmt.Errorf("redis is not initialized")
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return RedisClient.Set(context.Background(), idempotencyRedisKey(key), data, ttl).Err()
+}
+
+// Release 删除 key（处理失败时调用），之后的重试按新请求处理
+func (RedisIdempotencyStore) Release(key string) error {
+	if RedisClient == nil {
+		return fmt.Errorf("redis is not initialized")
+	}
+	return RedisClient.Del(context.Background(), idempotencyRedisKey(key)).Err()
+}
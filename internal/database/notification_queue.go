@@ -0,0 +1,64 @@
+package database
+
+import (
+	"time"
+	"verification-api/internal/models"
+)
+
+// CreateQueuedNotification 保存一条待处理的通知
+func CreateQueuedNotification(notification *models.QueuedNotification) error {
+	return DB.Create(notification).Error
+}
+
+// ClaimQueuedNotification 领取一条待处理的通知（pending -> processing）
+// 条件更新保证多个 worker / 多副本下同一条通知只会被领取一次；未领取到时返回 nil, nil
+func ClaimQueuedNotification(id uint) (*models.QueuedNotification, error) {
+	result := DB.Model(&models.QueuedNotification{}).
+		Where("id = ? AND status = ?", id, models.QueuedNotificationPending).
+		Update("status", models.QueuedNotificationProcessing)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	var notification models.QueuedNotification
+	if err := DB.First(&notification, id).Error; err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+// GetDueQueuedNotificationIDs 获取已到处理时间的 pending 通知ID（按ID升序）
+func GetDueQueuedNotificationIDs(now time.Time, limit int) ([]uint, error) {
+	var ids []uint
+	err := DB.Model(&models.QueuedNotification{}).
+		Where("status = ? AND next_attempt_at <= ?", models.QueuedNotificationPending, now).
+		Order("id ASC").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// RequeueStaleQueuedNotifications 将长时间停留在 processing 的通知放回 pending（worker 处理中途实例退出）
+func RequeueStaleQueuedNotifications(before time.Time) (int64, error) {
+	result := DB.Model(&models.QueuedNotification{}).
+		Where("status = ? AND updated_at < ?", models.QueuedNotificationProcessing, before).
+		Updates(map[string]interface{}{
+			"status":          models.QueuedNotificationPending,
+			"next_attempt_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
+
+// UpdateQueuedNotification 保存通知的处理结果
+func UpdateQueuedNotification(notification *models.QueuedNotification) error {
+	return DB.Model(notification).Updates(map[string]interface{}{
+		"status":          notification.Status,
+		"attempts":        notification.Attempts,
+		"next_attempt_at": notification.NextAttemptAt,
+		"last_error":      notification.LastError,
+		"processed_at":    notification.ProcessedAt,
+	}).Error
+}
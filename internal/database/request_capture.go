@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// requestCaptureListLimit 每个项目最多保留的抓取记录数
+const requestCaptureListLimit = 200
+
+// RequestCapture 抽样抓取的一次完整请求 / 响应（请求头已脱敏）
+type RequestCapture struct {
+	ID              string            `json:"id"`
+	ProjectID       string            `json:"project_id"`
+	Method          string            `json:"method"`
+	Path            string            `json:"path"`
+	Query           string            `json:"query,omitempty"`
+	ClientIP        string            `json:"client_ip"`
+	RequestHeaders  map[string]string `json:"request_headers"`
+	RequestBody     string            `json:"request_body"`
+	StatusCode      int               `json:"status_code"`
+	ResponseHeaders map[string]string `json:"response_headers"`
+	ResponseBody    string            `json:"response_body"`
+	Truncated       bool              `json:"truncated"` // 请求或响应 body 超过上限被截断
+	DurationMs      int64             `json:"duration_ms"`
+	CapturedAt      time.Time         `json:"captured_at"`
+}
+
+// requestCaptureKey 单条抓取记录 key
+func requestCaptureKey(projectID, id string) string {
+	return fmt.Sprintf("request_capture:%s:%s", projectID, id)
+}
+
+// requestCaptureListKey 项目抓取记录ID列表 key（最新的在前）
+func requestCaptureListKey(projectID string) string {
+	return fmt.Sprintf("request_captures:%s", projectID)
+}
+
+// SaveRequestCapture 保存抓取记录，记录和索引列表都在 ttl 后过期
+func SaveRequestCapture(capture *RequestCapture, ttl time.Duration) error {
+	if RedisClient == nil {
+		return fmt.Errorf("redis is not initialized")
+	}
+	data, err := json.Marshal(capture)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	listKey := requestCaptureListKey(capture.ProjectID)
+	pipe := RedisClient.TxPipeline()
+	pipe.Set(ctx, requestCaptureKey(capture.ProjectID, capture.ID), data, ttl)
+	pipe.LPush(ctx, listKey, capture.ID)
+	pipe.LTrim(ctx, listKey, 0, requestCaptureListLimit-1)
+	pipe.Expire(ctx, listKey, ttl)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// ListRequestCaptures 分页获取项目最近的抓取记录（最新的在前），已过期的记录被跳过
+// total 为索引列表长度，可能包含已过期的记录
+func ListRequestCaptures(projectID string, limit, offset int) ([]RequestCapture, int64, error) {
+	if RedisClient == nil {
+		return nil, 0, fmt.Errorf("redis is not initialized")
+	}
+	ctx := context.Background()
+	listKey := requestCaptureListKey(projectID)
+	total, err := RedisClient.LLen(ctx, listKey).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	ids, err := RedisClient.LRange(ctx, listKey, int64(offset), int64(offset+limit)-1).Result()
+	if err != nil || len(ids) == 0 {
+		return []RequestCapture{}, total, err
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = requestCaptureKey(projectID, id)
+	}
+	values, err := RedisClient.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	captures := make([]RequestCapture, 0, len(values))
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var capture RequestCapture
+		if json.Unmarshal([]byte(data), &capture) == nil {
+			captures = append(captures, capture)
+		}
+	}
+	return captures, total, nil
+}
+
+// GetRequestCapture 获取单条抓取记录，不存在或已过期时返回 nil, nil
+func GetRequestCapture(projectID, id string) (*RequestCapture, error) {
+	if RedisClient == nil {
+		return nil, fmt.Errorf("redis is not initialized")
+	}
+	value, err := GetCache(context.Background(), requestCaptureKey(projectID, id))
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var capture RequestCapture
+	if err := json.Unmarshal([]byte(value), &capture); err != nil {
+		return nil, err
+	}
+	return &capture, nil
+}
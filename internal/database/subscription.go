@@ -1,21 +1,143 @@
 package database
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"time"
+	"verification-api/internal/config"
 	"verification-api/internal/models"
 	"verification-api/pkg/logging"
 
 	"gorm.io/gorm"
 )
 
+// ErrDuplicateTransactionID transaction_id 已被其他订阅占用（transaction_id 对未删除记录全局唯一）
+var ErrDuplicateTransactionID = errors.New("transaction_id already belongs to another subscription")
+
+// DUPLICATE_TRANSACTION_ID_POLICY 取值
+const (
+	DuplicateTransactionIDUpsert = "upsert" // 覆盖占用该 transaction_id 的记录（默认）
+	DuplicateTransactionIDSkip   = "skip"   // 保留原记录，丢弃本次数据
+	DuplicateTransactionIDReject = "reject" // 返回 ErrDuplicateTransactionID
+)
+
+// SubscriptionsSupersededHook 在同组订阅被标记为 superseded 且事务提交后调用（由 services 注册，用于 webhook 与状态变化事件）
+// superseded 为更新前的记录（status 仍为原值），superseding 为取代它们的订阅
+var SubscriptionsSupersededHook func(superseding *models.Subscription, superseded []models.Subscription)
+
 // CreateSubscription 创建订阅
 func CreateSubscription(subscription *models.Subscription) error {
-	return DB.Create(subscription).Error
+	var superseded []models.Subscription
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(subscription).Error; err != nil {
+			return err
+		}
+		var err error
+		superseded, err = supersedeGroupSubscriptions(tx, subscription)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	InvalidateSubscriptionStatus(subscription.ProjectID, subscription.AppAccountToken)
+	notifySuperseded(subscription, superseded)
+	return nil
 }
 
 // UpdateSubscription 更新订阅
 func UpdateSubscription(subscription *models.Subscription) error {
-	return DB.Save(subscription).Error
+	var superseded []models.Subscription
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(subscription).Error; err != nil {
+			return err
+		}
+		var err error
+		superseded, err = supersedeGroupSubscriptions(tx, subscription)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	InvalidateSubscriptionStatus(subscription.ProjectID, subscription.AppAccountToken)
+	notifySuperseded(subscription, superseded)
+	return nil
+}
+
+// UpdateSubscriptionBinding 仅写入绑定相关字段（app_account_token / is_resolved / resolve_attempts / next_resolve_at）
+// 供绑定重试任务使用，避免用批次开始时读到的整行覆盖期间由通知或校验写入的状态
+// 写入后 subscription 重新加载为库中最新记录，并按新用户执行同组互斥
+// previousToken 为解析前的 app_account_token，新旧两个用户的状态缓存都会失效
+func UpdateSubscriptionBinding(subscription *models.Subscription, previousToken string) error {
+	var superseded []models.Subscription
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(subscription).Updates(map[string]interface{}{
+			"app_account_token": subscription.AppAccountToken,
+			"is_resolved":       subscription.IsResolved,
+			"resolve_attempts":  subscription.ResolveAttempts,
+			"next_resolve_at":   subscription.NextResolveAt,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.First(subscription, subscription.ID).Error; err != nil {
+			return err
+		}
+		superseded, err = supersedeGroupSubscriptions(tx, subscription)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	InvalidateSubscriptionStatus(subscription.ProjectID, previousToken)
+	InvalidateSubscriptionStatus(subscription.ProjectID, subscription.AppAccountToken)
+	notifySuperseded(subscription, superseded)
+	return nil
+}
+
+// supersedeGroupSubscriptions 同一订阅组内同一用户只保留一个有效订阅
+// subscription 刚写入且为 active 时，将该用户同组、同环境的其他 active 订阅标记为 superseded（升级 / 降级 / 跨级后旧档位不再有效）
+// sandbox 订阅永远不会取代 production 订阅
+// 返回被取代的订阅（更新前的记录），事务提交后由 notifySuperseded 通知
+// 被取代的订阅不会在 subscription 之后退款或过期时自动恢复：旧档位的状态以商店为准，
+// 下一次该订阅的通知、校验或 /sync 会按商店返回的状态重新写入
+func supersedeGroupSubscriptions(tx *gorm.DB, subscription *models.Subscription) ([]models.Subscription, error) {
+	if subscription.SubscriptionGroupID == "" || subscription.AppAccountToken == "" || subscription.Status != "active" {
+		return nil, nil
+	}
+	var superseded []models.Subscription
+	err := whereEnvironment(tx.Set("gorm:query_option", "FOR UPDATE").
+		Where("project_id = ? AND app_account_token = ? AND subscription_group_id = ? AND status = ? AND id <> ?",
+			subscription.ProjectID, subscription.AppAccountToken, subscription.SubscriptionGroupID, "active", subscription.ID),
+		subscription.Environment).
+		Find(&superseded).Error
+	if err != nil || len(superseded) == 0 {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(superseded))
+	for _, s := range superseded {
+		ids = append(ids, s.ID)
+	}
+	if err := tx.Model(&models.Subscription{}).Where("id IN ?", ids).Update("status", "superseded").Error; err != nil {
+		return nil, err
+	}
+	logging.Infof("Superseded %d subscriptions in subscription group - project: %s, group: %s, app_account_token: %s, active original_transaction: %s",
+		len(superseded), subscription.ProjectID, subscription.SubscriptionGroupID, subscription.AppAccountToken, subscription.OriginalTransactionID)
+	return superseded, nil
+}
+
+// notifySuperseded 失效被取代订阅所属用户的状态缓存，并调用 SubscriptionsSupersededHook
+func notifySuperseded(superseding *models.Subscription, superseded []models.Subscription) {
+	if len(superseded) == 0 {
+		return
+	}
+	for _, s := range superseded {
+		InvalidateSubscriptionStatus(s.ProjectID, s.AppAccountToken)
+	}
+	if SubscriptionsSupersededHook != nil {
+		SubscriptionsSupersededHook(superseding, superseded)
+	}
 }
 
 // GetSubscriptionByTransactionID 通过交易ID获取订阅（按项目）
@@ -28,10 +150,12 @@ func GetSubscriptionByTransactionID(projectID, transactionID string) (*models.Su
 	return &subscription, nil
 }
 
-// GetSubscriptionByOriginalTransactionID 通过原始交易ID获取订阅（按项目）
-func GetSubscriptionByOriginalTransactionID(projectID, originalTransactionID string) (*models.Subscription, error) {
+// GetSubscriptionByOriginalTransactionID 通过原始交易ID获取订阅（按项目和环境，environment 为空表示任意环境）
+// sandbox 交易可能复用 production 的原始交易ID，两者是不同的订阅
+func GetSubscriptionByOriginalTransactionID(projectID, originalTransactionID, environment string) (*models.Subscription, error) {
 	var subscription models.Subscription
-	err := DB.Where("project_id = ? AND original_transaction_id = ?", projectID, originalTransactionID).First(&subscription).Error
+	err := whereEnvironment(DB.Where("project_id = ? AND original_transaction_id = ?", projectID, originalTransactionID), environment).
+		First(&subscription).Error
 	if err != nil {
 		return nil, err
 	}
@@ -56,17 +180,43 @@ func GetUserSubscriptions(projectID, appAccountToken string) ([]models.Subscript
 	return subscriptions, err
 }
 
-// CheckUserHasActiveSubscription 检查用户是否有有效订阅
-func CheckUserHasActiveSubscription(projectID, appAccountToken string) (bool, error) {
-	var count int64
-	err := DB.Model(&models.Subscription{}).
+// GetRestorableSubscriptions 获取用于被动恢复的用户订阅（按项目）
+// 仅返回未过期，或在 lookback 时间窗口内过期的订阅（lookback <= 0 表示不限制）
+// includeExpired 为 false 时只返回未过期的订阅
+func GetRestorableSubscriptions(projectID, appAccountToken string, lookback time.Duration, includeExpired bool) ([]models.Subscription, error) {
+	query := DB.Where("project_id = ? AND app_account_token = ?", projectID, appAccountToken)
+	now := time.Now()
+	switch {
+	case !includeExpired:
+		query = query.Where("expires_date > ?", now)
+	case lookback > 0:
+		query = query.Where("expires_date > ?", now.Add(-lookback))
+	}
+
+	var subscriptions []models.Subscription
+	err := query.Order("expires_date DESC").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// CheckUserHasActiveSubscription 检查用户是否有有效订阅（productID 为空表示任意产品）
+// 有效时同时返回最晚的过期时间；条件与 Subscription.IsEntitled 一致（退款 / 撤销的订阅不是 active）
+func CheckUserHasActiveSubscription(projectID, appAccountToken, productID string) (bool, time.Time, error) {
+	query := DB.Model(&models.Subscription{}).
 		Where("project_id = ? AND app_account_token = ? AND status = ? AND expires_date > ?",
-			projectID, appAccountToken, "active", time.Now()).
-		Count(&count).Error
+			projectID, appAccountToken, "active", time.Now())
+	if productID != "" {
+		query = query.Where("product_id = ?", productID)
+	}
+
+	var subscription models.Subscription
+	err := query.Select("expires_date").Order("expires_date DESC").First(&subscription).Error
+	if err == gorm.ErrRecordNotFound {
+		return false, time.Time{}, nil
+	}
 	if err != nil {
-		return false, err
+		return false, time.Time{}, err
 	}
-	return count > 0, nil
+	return true, subscription.ExpiresDate, nil
 }
 
 // GetLatestSubscriptionByUser 获取用户的最新订阅（用于恢复购买）
@@ -85,24 +235,64 @@ func GetLatestSubscriptionByUser(projectID, appAccountToken string) (*models.Sub
 // 优先通过 original_transaction_id 查找，支持绑定 user_id
 // 使用数据库事务确保并发安全
 func CreateOrUpdateSubscription(subscription *models.Subscription) error {
-	return DB.Transaction(func(tx *gorm.DB) error {
-		// 首先通过 project_id + original_transaction_id 查找（不考虑 uuid）
-		// 这样可以找到 webhook 创建的 uuid 为空的订阅
+	// 记录写入后需要失效缓存的用户（可能是已绑定的 appAccountToken）
+	affectedToken := subscription.AppAccountToken
+	var superseded []models.Subscription
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		// 首先通过 project_id + original_transaction_id + environment 查找（不考虑 uuid）
+		// 这样可以找到 webhook 创建的 uuid 为空的订阅；其他环境复用相同原始交易ID的订阅不会被覆盖
 		// 使用 SELECT FOR UPDATE 锁定行，防止并发问题
 		var existingSubscription models.Subscription
-		err := tx.Set("gorm:query_option", "FOR UPDATE").
+		err := whereEnvironment(tx.Set("gorm:query_option", "FOR UPDATE").
 			Where("project_id = ? AND original_transaction_id = ?",
-				subscription.ProjectID, subscription.OriginalTransactionID).
+				subscription.ProjectID, subscription.OriginalTransactionID), subscription.Environment).
 			First(&existingSubscription).Error
 
 		if err != nil {
 			if err == gorm.ErrRecordNotFound {
+				// transaction_id 在同一环境内唯一，可能已被其他 original_transaction_id 的订阅占用，直接插入会因唯一约束失败
+				// 其他环境的相同交易ID（如 sandbox 测试复用了 production 的交易ID）不冲突，作为独立订阅写入
+				if subscription.TransactionID != "" {
+					var conflicting models.Subscription
+					err := whereEnvironment(tx.Set("gorm:query_option", "FOR UPDATE").
+						Where("transaction_id = ?", subscription.TransactionID), subscription.Environment).
+						First(&conflicting).Error
+					if err == nil {
+						token, err := resolveDuplicateTransactionID(tx, &conflicting, subscription)
+						affectedToken = token
+						return err
+					}
+					if err != gorm.ErrRecordNotFound {
+						return err
+					}
+				}
+
 				// 创建新订阅
-				return tx.Create(subscription).Error
+				subscription.StateChanged = true
+				if err := wrapDuplicateTransactionID(tx.Create(subscription).Error, subscription.TransactionID); err != nil {
+					return err
+				}
+				superseded, err = supersedeGroupSubscriptions(tx, subscription)
+				return err
 			}
 			return err
 		}
 
+		// 与 Apple / Google 对账时，过期时间的细微偏差（秒级）不视为变化
+		// 只有状态变化或偏差超过阈值时才更新，避免无意义的写入和 webhook 通知
+		if !isSignificantSubscriptionChange(&existingSubscription, subscription) {
+			logging.Debugf("Subscription unchanged within tolerance, skipping update - original_transaction_id: %s",
+				subscription.OriginalTransactionID)
+			// 调用方拿到的是已存储的记录（ID、已解析的绑定、续订次数等），而不是本次传入的数据
+			*subscription = existingSubscription
+			subscription.StateChanged = false
+			affectedToken = ""
+			return nil
+		}
+		subscription.StateChanged = true
+		previous := existingSubscription
+		subscription.Previous = &previous
+
 		// 更新现有订阅
 		// 处理 appAccountToken 绑定逻辑
 		if existingSubscription.AppAccountToken == "" {
@@ -111,7 +301,15 @@ func CreateOrUpdateSubscription(subscription *models.Subscription) error {
 				logging.Infof("Binding appAccountToken to subscription - original_transaction_id: %s, app_account_token: %s",
 					subscription.OriginalTransactionID, subscription.AppAccountToken)
 				existingSubscription.AppAccountToken = subscription.AppAccountToken
+				existingSubscription.IsResolved = subscription.IsResolved
 			}
+		} else if !existingSubscription.IsBindingResolved() && subscription.IsBindingResolved() && subscription.AppAccountToken != "" {
+			// 现有绑定未解析（store_unresolved 策略），使用已解析的 user_id 替换
+			logging.Infof("Resolved pending appAccountToken binding - original_transaction_id: %s, app_account_token: %s -> %s",
+				subscription.OriginalTransactionID, existingSubscription.AppAccountToken, subscription.AppAccountToken)
+			InvalidateSubscriptionStatus(existingSubscription.ProjectID, existingSubscription.AppAccountToken)
+			existingSubscription.AppAccountToken = subscription.AppAccountToken
+			existingSubscription.SetResolved(true)
 		} else {
 			// 如果现有订阅已有 appAccountToken
 			if subscription.AppAccountToken != "" && existingSubscription.AppAccountToken != subscription.AppAccountToken {
@@ -141,9 +339,142 @@ func CreateOrUpdateSubscription(subscription *models.Subscription) error {
 		existingSubscription.TransactionID = subscription.TransactionID
 		existingSubscription.Environment = subscription.Environment
 		existingSubscription.PurchaseDate = subscription.PurchaseDate
+		if subscription.BillingPeriod != "" {
+			existingSubscription.BillingPeriod = subscription.BillingPeriod
+		}
+		if subscription.SubscriptionGroupID != "" {
+			existingSubscription.SubscriptionGroupID = subscription.SubscriptionGroupID
+		}
+		// 续订次数只增不减；过期原因和通知子类型只在本次数据带有时覆盖（验证接口的数据通常没有）
+		existingSubscription.RenewalCount = max(existingSubscription.RenewalCount, subscription.RenewalCount)
+		if subscription.ExpirationIntent != 0 {
+			existingSubscription.ExpirationIntent = subscription.ExpirationIntent
+		}
+		if subscription.LastSubtype != "" {
+			existingSubscription.LastSubtype = subscription.LastSubtype
+		}
 
-		return tx.Save(&existingSubscription).Error
+		affectedToken = existingSubscription.AppAccountToken
+		if err := wrapDuplicateTransactionID(tx.Save(&existingSubscription).Error, subscription.TransactionID); err != nil {
+			return err
+		}
+		if superseded, err = supersedeGroupSubscriptions(tx, &existingSubscription); err != nil {
+			return err
+		}
+		// 返回合并后的已存储记录，StateChanged / Previous 保留本次结果
+		*subscription = existingSubscription
+		subscription.StateChanged = true
+		subscription.Previous = &previous
+		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	InvalidateSubscriptionStatus(subscription.ProjectID, affectedToken)
+	notifySuperseded(subscription, superseded)
+	return nil
+}
+
+// whereEnvironment 按环境过滤，environment 为空时不过滤
+// 不区分大小写：收据接口和 Apple 通知使用 Sandbox / Production，其他来源为小写
+func whereEnvironment(query *gorm.DB, environment string) *gorm.DB {
+	if environment == "" {
+		return query
+	}
+	return query.Where("LOWER(environment) = ?", strings.ToLower(environment))
+}
+
+// resolveDuplicateTransactionID 处理新订阅的 transaction_id 已被 conflicting 占用的情况（按 DUPLICATE_TRANSACTION_ID_POLICY）
+// 其他项目的记录永远不会被覆盖；返回需要失效缓存的用户
+func resolveDuplicateTransactionID(tx *gorm.DB, conflicting, subscription *models.Subscription) (string, error) {
+	policy := config.AppConfig.DuplicateTransactionIDPolicy
+	if conflicting.ProjectID != subscription.ProjectID {
+		policy = DuplicateTransactionIDReject
+	}
+	logging.Warnf("Duplicate transaction_id - transaction_id: %s, project: %s, original_transaction_id: %s (%s), existing: %s / %s (%s), policy: %s",
+		subscription.TransactionID, subscription.ProjectID, subscription.OriginalTransactionID, subscription.Environment,
+		conflicting.ProjectID, conflicting.OriginalTransactionID, conflicting.Environment, policy)
+
+	switch policy {
+	case DuplicateTransactionIDReject:
+		return "", fmt.Errorf("%w: %s", ErrDuplicateTransactionID, subscription.TransactionID)
+	case DuplicateTransactionIDSkip:
+		*subscription = *conflicting
+		subscription.StateChanged = false
+		return "", nil
+	}
+
+	// upsert：用新数据整体替换原记录（保留主键和创建时间，新数据没有用户时沿用原绑定）
+	previous := *conflicting
+	subscription.ID = conflicting.ID
+	subscription.CreatedAt = conflicting.CreatedAt
+	if subscription.AppAccountToken == "" {
+		subscription.AppAccountToken = conflicting.AppAccountToken
+		subscription.IsResolved = conflicting.IsResolved
+	}
+	if subscription.BillingPeriod == "" {
+		subscription.BillingPeriod = conflicting.BillingPeriod
+	}
+	subscription.StateChanged = true
+	subscription.Previous = &previous
+	if err := tx.Save(subscription).Error; err != nil {
+		return "", err
+	}
+	if conflicting.AppAccountToken != subscription.AppAccountToken {
+		InvalidateSubscriptionStatus(conflicting.ProjectID, conflicting.AppAccountToken)
+	}
+	return subscription.AppAccountToken, nil
+}
+
+// wrapDuplicateTransactionID 将 transaction_id 唯一约束冲突（如并发插入）转换为 ErrDuplicateTransactionID
+func wrapDuplicateTransactionID(err error, transactionID string) error {
+	if err != nil && isUniqueViolation(err) {
+		return fmt.Errorf("%w: %s", ErrDuplicateTransactionID, transactionID)
+	}
+	return err
+}
+
+// isUniqueViolation 判断是否为唯一约束冲突（PostgreSQL / SQLite）
+func isUniqueViolation(err error) bool {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	message := err.Error()
+	return strings.Contains(message, "duplicate key value violates unique constraint") ||
+		strings.Contains(message, "UNIQUE constraint failed")
+}
+
+// isSignificantSubscriptionChange 判断新数据与已存储订阅相比是否有实质变化
+// expires_date 的差异不超过 EXPIRY_DRIFT_TOLERANCE_SECONDS 时视为相同
+func isSignificantSubscriptionChange(existing, incoming *models.Subscription) bool {
+	if existing.Status != incoming.Status ||
+		existing.AutoRenewStatus != incoming.AutoRenewStatus ||
+		existing.ProductID != incoming.ProductID ||
+		existing.TransactionID != incoming.TransactionID ||
+		existing.Environment != incoming.Environment {
+		return true
+	}
+
+	// 需要绑定 appAccountToken（或替换未解析的绑定）
+	if existing.AppAccountToken == "" && incoming.AppAccountToken != "" {
+		return true
+	}
+	if !existing.IsBindingResolved() && incoming.IsBindingResolved() && incoming.AppAccountToken != "" {
+		return true
+	}
+
+	// 计费周期变化（或旧数据首次补全）
+	if incoming.BillingPeriod != "" && existing.BillingPeriod != incoming.BillingPeriod {
+		return true
+	}
+
+	tolerance := time.Duration(config.AppConfig.ExpiryDriftToleranceSeconds) * time.Second
+	drift := existing.ExpiresDate.Sub(incoming.ExpiresDate)
+	if drift < 0 {
+		drift = -drift
+	}
+	return drift > tolerance
 }
 
 // FindSubscriptionByOriginalTransactionID finds subscription by original transaction ID (across all projects)
@@ -167,9 +498,186 @@ func FindSubscriptionByPurchaseToken(purchaseToken string) (*models.Subscription
 	return &subscription, nil
 }
 
+// ListProjectSubscriptions lists subscriptions of a project filtered by product and status with pagination
+// Empty productID / status means no filter. Returns the page and the total matching count
+func ListProjectSubscriptions(projectID, productID, status string, limit, offset int) ([]models.Subscription, int64, error) {
+	query := DB.Model(&models.Subscription{}).Where("project_id = ?", projectID)
+	if productID != "" {
+		query = query.Where("product_id = ?", productID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var subscriptions []models.Subscription
+	err := query.Order("updated_at DESC").Offset(offset).Limit(limit).Find(&subscriptions).Error
+	return subscriptions, total, err
+}
+
 // GetAllUserSubscriptions gets all subscriptions for a user across all projects
 func GetAllUserSubscriptions(appAccountToken string) ([]models.Subscription, error) {
 	var subscriptions []models.Subscription
 	err := DB.Where("app_account_token = ?", appAccountToken).Order("created_at DESC").Find(&subscriptions).Error
 	return subscriptions, err
 }
+
+// SubscriptionMergeResult 重复订阅合并结果
+type SubscriptionMergeResult struct {
+	ProjectID             string `json:"project_id"`
+	OriginalTransactionID string `json:"original_transaction_id"`
+	KeptID                uint   `json:"kept_id"`     // 保留的订阅记录 ID
+	RemovedIDs            []uint `json:"removed_ids"` // 被合并删除的订阅记录 ID
+}
+
+// DeduplicateSubscriptions 合并重复订阅（相同 project_id + original_transaction_id）
+// 保留过期时间最晚（其次更新时间最新）的记录，并补齐其缺失的 appAccountToken / 收据信息
+// dryRun 为 true 时只返回将执行的操作，不修改数据
+func DeduplicateSubscriptions(dryRun bool) ([]SubscriptionMergeResult, error) {
+	var groups []struct {
+		ProjectID             string
+		OriginalTransactionID string
+	}
+	err := DB.Model(&models.Subscription{}).
+		Select("project_id, original_transaction_id").
+		Where("original_transaction_id <> ?", "").
+		Group("project_id, original_transaction_id").
+		Having("COUNT(*) > 1").
+		Scan(&groups).Error
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SubscriptionMergeResult, 0, len(groups))
+	for _, group := range groups {
+		var result SubscriptionMergeResult
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			var subscriptions []models.Subscription
+			if err := tx.Set("gorm:query_option", "FOR UPDATE").
+				Where("project_id = ? AND original_transaction_id = ?", group.ProjectID, group.OriginalTransactionID).
+				Order("expires_date DESC, updated_at DESC, id DESC").
+				Find(&subscriptions).Error; err != nil {
+				return err
+			}
+			if len(subscriptions) < 2 {
+				return nil
+			}
+
+			keeper := subscriptions[0]
+			result = SubscriptionMergeResult{
+				ProjectID:             group.ProjectID,
+				OriginalTransactionID: group.OriginalTransactionID,
+				KeptID:                keeper.ID,
+			}
+
+			for _, duplicate := range subscriptions[1:] {
+				result.RemovedIDs = append(result.RemovedIDs, duplicate.ID)
+				// 补齐保留记录缺失的字段
+				if keeper.AppAccountToken == "" && duplicate.AppAccountToken != "" {
+					keeper.AppAccountToken = duplicate.AppAccountToken
+				}
+				if keeper.LatestReceipt == "" && duplicate.LatestReceipt != "" {
+					keeper.LatestReceipt = duplicate.LatestReceipt
+					keeper.LatestReceiptInfo = duplicate.LatestReceiptInfo
+				}
+				if !duplicate.StartDate.IsZero() && (keeper.StartDate.IsZero() || duplicate.StartDate.Before(keeper.StartDate)) {
+					keeper.StartDate = duplicate.StartDate
+				}
+			}
+
+			if dryRun {
+				return nil
+			}
+
+			if err := tx.Where("id IN ?", result.RemovedIDs).Delete(&models.Subscription{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Save(&keeper).Error; err != nil {
+				return err
+			}
+			for _, subscription := range subscriptions {
+				InvalidateSubscriptionStatus(subscription.ProjectID, subscription.AppAccountToken)
+			}
+			return nil
+		})
+		if err != nil {
+			return results, err
+		}
+		if result.KeptID != 0 {
+			if !dryRun {
+				logging.Infof("Merged duplicate subscriptions - project_id: %s, original_transaction_id: %s, kept: %d, removed: %v",
+					result.ProjectID, result.OriginalTransactionID, result.KeptID, result.RemovedIDs)
+			}
+			results = append(results, result)
+		}
+	}
+
+	return results, nil
+}
+
+// SubscriptionDeleteResult 删除订阅结果
+type SubscriptionDeleteResult struct {
+	SubscriptionID      uint  `json:"subscription_id"`
+	HardDelete          bool  `json:"hard_delete"`
+	DeletedTransactions int64 `json:"deleted_transactions"` // 关联删除的交易记录数
+}
+
+// DeleteSubscription 删除订阅及其关联交易（同一数据库事务内）
+// 关联交易：同项目下 transaction_id 或 original_transaction_id 与订阅相同的记录
+// hardDelete 为 true 时物理删除（包括已软删除的记录），用于 GDPR 数据擦除
+func DeleteSubscription(id uint, hardDelete bool) (*SubscriptionDeleteResult, error) {
+	result := &SubscriptionDeleteResult{SubscriptionID: id, HardDelete: hardDelete}
+	var affectedProjectID, affectedToken string
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if hardDelete {
+			tx = tx.Unscoped().Session(&gorm.Session{})
+		}
+
+		var subscription models.Subscription
+		if err := tx.Where("id = ?", id).First(&subscription).Error; err != nil {
+			return err
+		}
+
+		transactions := tx.Where("project_id = ?", subscription.ProjectID)
+		if subscription.OriginalTransactionID != "" {
+			transactions = transactions.Where("transaction_id = ? OR original_transaction_id = ?",
+				subscription.TransactionID, subscription.OriginalTransactionID)
+		} else {
+			transactions = transactions.Where("transaction_id = ?", subscription.TransactionID)
+		}
+		deleted := transactions.Delete(&models.Transaction{})
+		if deleted.Error != nil {
+			return deleted.Error
+		}
+		result.DeletedTransactions = deleted.RowsAffected
+
+		if err := tx.Delete(&subscription).Error; err != nil {
+			return err
+		}
+		affectedProjectID, affectedToken = subscription.ProjectID, subscription.AppAccountToken
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	InvalidateSubscriptionStatus(affectedProjectID, affectedToken)
+
+	logging.Infof("Deleted subscription - id: %d, hard_delete: %v, deleted_transactions: %d",
+		id, hardDelete, result.DeletedTransactions)
+	return result, nil
+}
+
+// GetSubscriptionByID 通过数据库 ID 获取订阅
+func GetSubscriptionByID(id uint) (*models.Subscription, error) {
+	var subscription models.Subscription
+	if err := DB.First(&subscription, id).Error; err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
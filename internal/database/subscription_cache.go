@@ -0,0 +1,134 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+	"verification-api/internal/config"
+	"verification-api/pkg/logging"
+	"verification-api/pkg/metrics"
+)
+
+// subscriptionStatusCacheKey 订阅状态缓存 key（按项目 + 用户）
+func subscriptionStatusCacheKey(projectID, appAccountToken string) string {
+	return fmt.Sprintf("subscription_status:%s:%s", projectID, appAccountToken)
+}
+
+// subscriptionStatusCacheTTL 返回缓存有效期，0 表示禁用缓存
+func subscriptionStatusCacheTTL() time.Duration {
+	if config.AppConfig == nil || RedisClient == nil {
+		return 0
+	}
+	return time.Duration(config.AppConfig.SubscriptionStatusCacheTTLSeconds) * time.Second
+}
+
+// GetCachedSubscriptionStatus 读取缓存的订阅状态到 dest，命中返回 true
+func GetCachedSubscriptionStatus(projectID, appAccountToken string, dest interface{}) bool {
+	if subscriptionStatusCacheTTL() <= 0 || appAccountToken == "" {
+		return false
+	}
+
+	value, err := GetCache(context.Background(), subscriptionStatusCacheKey(projectID, appAccountToken))
+	if err != nil || json.Unmarshal([]byte(value), dest) != nil {
+		metrics.IncCounter("subscription_status_cache_total", map[string]string{"result": "miss"})
+		return false
+	}
+
+	metrics.IncCounter("subscription_status_cache_total", map[string]string{"result": "hit"})
+	return true
+}
+
+// SetCachedSubscriptionStatus 缓存计算后的订阅状态
+func SetCachedSubscriptionStatus(projectID, appAccountToken string, value interface{}) {
+	ttl := subscriptionStatusCacheTTL()
+	if ttl <= 0 || appAccountToken == "" {
+		return
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	if err := SetCache(context.Background(), subscriptionStatusCacheKey(projectID, appAccountToken), data, ttl); err != nil {
+		logging.Errorf("Failed to cache subscription status - project_id: %s, error: %v", projectID, err)
+	}
+}
+
+// EntitlementCheck 缓存的 /api/subscription/entitled 结果
+type EntitlementCheck struct {
+	Entitled    bool      `json:"entitled"`
+	ExpiresDate time.Time `json:"expires_date"`
+}
+
+// entitlementCacheKey entitled 缓存 key（按项目 + 用户，hash field 为 product_id，"*" 表示任意产品）
+func entitlementCacheKey(projectID, appAccountToken string) string {
+	return fmt.Sprintf("subscription_entitled:%s:%s", projectID, appAccountToken)
+}
+
+// entitlementCacheField 返回 product_id 对应的 hash field
+func entitlementCacheField(productID string) string {
+	if productID == "" {
+		return "*"
+	}
+	return productID
+}
+
+// entitlementCacheTTL 返回 entitled 缓存有效期，0 表示禁用缓存
+func entitlementCacheTTL() time.Duration {
+	if config.AppConfig == nil || RedisClient == nil {
+		return 0
+	}
+	return time.Duration(config.AppConfig.EntitlementCacheTTLSeconds) * time.Second
+}
+
+// GetCachedEntitlement 读取缓存的 entitled 结果，命中返回 true
+// 已过期的 entitled 结果视为未命中（订阅到期不会产生写入，不能依赖失效）
+func GetCachedEntitlement(projectID, appAccountToken, productID string) (EntitlementCheck, bool) {
+	var check EntitlementCheck
+	if entitlementCacheTTL() <= 0 || appAccountToken == "" {
+		return check, false
+	}
+
+	value, err := RedisClient.HGet(context.Background(), entitlementCacheKey(projectID, appAccountToken), entitlementCacheField(productID)).Result()
+	if err != nil || json.Unmarshal([]byte(value), &check) != nil || (check.Entitled && !check.ExpiresDate.After(time.Now())) {
+		metrics.IncCounter("entitlement_cache_total", map[string]string{"result": "miss"})
+		return EntitlementCheck{}, false
+	}
+
+	metrics.IncCounter("entitlement_cache_total", map[string]string{"result": "hit"})
+	return check, true
+}
+
+// SetCachedEntitlement 缓存 entitled 结果
+func SetCachedEntitlement(projectID, appAccountToken, productID string, check EntitlementCheck) {
+	ttl := entitlementCacheTTL()
+	if ttl <= 0 || appAccountToken == "" {
+		return
+	}
+
+	data, err := json.Marshal(check)
+	if err != nil {
+		return
+	}
+	ctx := context.Background()
+	key := entitlementCacheKey(projectID, appAccountToken)
+	pipe := RedisClient.TxPipeline()
+	pipe.HSet(ctx, key, entitlementCacheField(productID), data)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logging.Errorf("Failed to cache entitlement - project_id: %s, error: %v", projectID, err)
+	}
+}
+
+// InvalidateSubscriptionStatus 删除用户的订阅状态缓存（包括 entitled 缓存）
+// 在任何订阅 / 交易写入后调用（webhook、verify、绑定、删除）
+func InvalidateSubscriptionStatus(projectID, appAccountToken string) {
+	if RedisClient == nil || appAccountToken == "" {
+		return
+	}
+	keys := []string{subscriptionStatusCacheKey(projectID, appAccountToken), entitlementCacheKey(projectID, appAccountToken)}
+	if err := RedisClient.Del(context.Background(), keys...).Err(); err != nil {
+		logging.Errorf("Failed to invalidate subscription status cache - project_id: %s, error: %v", projectID, err)
+	}
+}
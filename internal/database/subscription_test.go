@@ -0,0 +1,286 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"verification-api/internal/config"
+	"verification-api/internal/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupTestDB points DB at a fresh in-memory SQLite database with the production schema
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	config.AppConfig = &config.Config{
+		DuplicateTransactionIDPolicy: DuplicateTransactionIDUpsert,
+		ExpiryDriftToleranceSeconds:  60,
+	}
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", name)), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	DB = db
+	if err := autoMigrate(); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+func newTestSubscription(environment, transactionID, originalTransactionID string) *models.Subscription {
+	now := time.Now()
+	return &models.Subscription{
+		ProjectID:             "test-project",
+		AppAccountToken:       "user-1",
+		Platform:              "ios",
+		Status:                "active",
+		ProductID:             "com.example.pro.monthly",
+		TransactionID:         transactionID,
+		OriginalTransactionID: originalTransactionID,
+		Environment:           environment,
+		PurchaseDate:          now,
+		ExpiresDate:           now.AddDate(0, 1, 0),
+	}
+}
+
+// A sandbox transaction reusing a production transaction_id must not overwrite the production subscription
+func TestCreateOrUpdateSubscriptionSandboxReusesProductionTransactionID(t *testing.T) {
+	setupTestDB(t)
+
+	production := newTestSubscription("production", "1000000001", "1000000001")
+	if err := CreateOrUpdateSubscription(production); err != nil {
+		t.Fatalf("create production subscription: %v", err)
+	}
+
+	sandbox := newTestSubscription("sandbox", "1000000001", "2000000001")
+	sandbox.Status = "expired"
+	if err := CreateOrUpdateSubscription(sandbox); err != nil {
+		t.Fatalf("create sandbox subscription: %v", err)
+	}
+	if sandbox.ID == production.ID {
+		t.Fatalf("sandbox transaction was written over the production subscription (id %d)", production.ID)
+	}
+
+	stored, err := GetSubscriptionByOriginalTransactionID("test-project", "1000000001", "production")
+	if err != nil {
+		t.Fatalf("get production subscription: %v", err)
+	}
+	if stored.Environment != "production" || stored.Status != "active" || stored.OriginalTransactionID != "1000000001" {
+		t.Errorf("production subscription changed: environment %q, status %q, original_transaction_id %q",
+			stored.Environment, stored.Status, stored.OriginalTransactionID)
+	}
+}
+
+// A sandbox transaction reusing both the transaction_id and the original_transaction_id of a production
+// subscription is stored as a separate subscription
+func TestCreateOrUpdateSubscriptionSandboxReusesProductionOriginalTransactionID(t *testing.T) {
+	setupTestDB(t)
+
+	production := newTestSubscription("production", "1000000001", "1000000001")
+	if err := CreateOrUpdateSubscription(production); err != nil {
+		t.Fatalf("create production subscription: %v", err)
+	}
+
+	sandbox := newTestSubscription("Sandbox", "1000000001", "1000000001")
+	sandbox.Status = "expired"
+	sandbox.ExpiresDate = time.Now().Add(-time.Hour)
+	if err := CreateOrUpdateSubscription(sandbox); err != nil {
+		t.Fatalf("create sandbox subscription: %v", err)
+	}
+	if sandbox.ID == production.ID {
+		t.Fatalf("sandbox transaction was written over the production subscription (id %d)", production.ID)
+	}
+
+	stored, err := GetSubscriptionByOriginalTransactionID("test-project", "1000000001", "Production")
+	if err != nil {
+		t.Fatalf("get production subscription: %v", err)
+	}
+	if stored.ID != production.ID || stored.Environment != "production" || stored.Status != "active" {
+		t.Errorf("production subscription changed: id %d, environment %q, status %q", stored.ID, stored.Environment, stored.Status)
+	}
+	storedSandbox, err := GetSubscriptionByOriginalTransactionID("test-project", "1000000001", "sandbox")
+	if err != nil {
+		t.Fatalf("get sandbox subscription: %v", err)
+	}
+	if storedSandbox.ID != sandbox.ID || storedSandbox.Status != "expired" {
+		t.Errorf("sandbox subscription = id %d, status %q, want id %d, expired", storedSandbox.ID, storedSandbox.Status, sandbox.ID)
+	}
+
+	// Updating the sandbox subscription again still leaves the production one alone
+	sandbox = newTestSubscription("Sandbox", "1000000002", "1000000001")
+	if err := CreateOrUpdateSubscription(sandbox); err != nil {
+		t.Fatalf("update sandbox subscription: %v", err)
+	}
+	if sandbox.ID != storedSandbox.ID {
+		t.Errorf("sandbox update wrote subscription %d, want %d", sandbox.ID, storedSandbox.ID)
+	}
+	stored, _ = GetSubscriptionByOriginalTransactionID("test-project", "1000000001", "production")
+	if stored.TransactionID != "1000000001" {
+		t.Errorf("production transaction_id = %s, want 1000000001", stored.TransactionID)
+	}
+}
+
+// Within one environment a reused transaction_id is resolved by the policy instead of a raw constraint error
+func TestCreateOrUpdateSubscriptionDuplicateTransactionIDPolicy(t *testing.T) {
+	tests := []struct {
+		policy  string
+		wantErr bool
+		wantOTI string // original_transaction_id of the row holding the transaction_id afterwards
+	}{
+		{DuplicateTransactionIDUpsert, false, "2000000001"},
+		{DuplicateTransactionIDSkip, false, "1000000001"},
+		{DuplicateTransactionIDReject, true, "1000000001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			setupTestDB(t)
+			config.AppConfig.DuplicateTransactionIDPolicy = tt.policy
+
+			if err := CreateOrUpdateSubscription(newTestSubscription("production", "1000000001", "1000000001")); err != nil {
+				t.Fatalf("create subscription: %v", err)
+			}
+			err := CreateOrUpdateSubscription(newTestSubscription("production", "1000000001", "2000000001"))
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("CreateOrUpdateSubscription() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var subscriptions []models.Subscription
+			if err := DB.Where("transaction_id = ?", "1000000001").Find(&subscriptions).Error; err != nil {
+				t.Fatalf("list subscriptions: %v", err)
+			}
+			if len(subscriptions) != 1 || subscriptions[0].OriginalTransactionID != tt.wantOTI {
+				t.Errorf("got %d subscriptions %+v, want one with original_transaction_id %s", len(subscriptions), subscriptions, tt.wantOTI)
+			}
+		})
+	}
+}
+
+// The caller's subscription is replaced by the stored record, with and without a significant change
+func TestCreateOrUpdateSubscriptionReturnsStoredRecord(t *testing.T) {
+	setupTestDB(t)
+
+	original := newTestSubscription("production", "1000000001", "1000000001")
+	original.RenewalCount = 3
+	original.LastSubtype = "AUTO_RENEW_ENABLED"
+	if err := CreateOrUpdateSubscription(original); err != nil {
+		t.Fatalf("create subscription: %v", err)
+	}
+
+	// Same state, no App Account Token (e.g. a verification without user_id)
+	unchanged := newTestSubscription("production", "1000000001", "1000000001")
+	unchanged.AppAccountToken = ""
+	unchanged.ExpiresDate = original.ExpiresDate
+	if err := CreateOrUpdateSubscription(unchanged); err != nil {
+		t.Fatalf("verify unchanged subscription: %v", err)
+	}
+	if unchanged.StateChanged {
+		t.Errorf("unchanged subscription reported StateChanged")
+	}
+	if unchanged.ID != original.ID || unchanged.AppAccountToken != "user-1" || unchanged.RenewalCount != 3 {
+		t.Errorf("unchanged: got id %d, token %q, renewal_count %d; want stored id %d, token user-1, renewal_count 3",
+			unchanged.ID, unchanged.AppAccountToken, unchanged.RenewalCount, original.ID)
+	}
+
+	// Renewed: new transaction, later expiry
+	renewed := newTestSubscription("production", "1000000002", "1000000001")
+	renewed.ExpiresDate = original.ExpiresDate.AddDate(0, 1, 0)
+	if err := CreateOrUpdateSubscription(renewed); err != nil {
+		t.Fatalf("verify renewed subscription: %v", err)
+	}
+	if !renewed.StateChanged || renewed.Previous == nil || renewed.Previous.TransactionID != "1000000001" {
+		t.Errorf("renewed: StateChanged %v, Previous %+v", renewed.StateChanged, renewed.Previous)
+	}
+	if renewed.ID != original.ID || renewed.RenewalCount != 3 || renewed.LastSubtype != "AUTO_RENEW_ENABLED" {
+		t.Errorf("renewed: got id %d, renewal_count %d, last_subtype %q; want stored values", renewed.ID, renewed.RenewalCount, renewed.LastSubtype)
+	}
+}
+
+// The binding retry writes only the binding columns, a status stored after the batch was loaded survives
+func TestUpdateSubscriptionBindingKeepsConcurrentStatus(t *testing.T) {
+	setupTestDB(t)
+
+	stored := newTestSubscription("production", "1000000001", "1000000001")
+	stored.AppAccountToken = "pending-token"
+	stored.SetResolved(false)
+	if err := CreateSubscription(stored); err != nil {
+		t.Fatalf("create subscription: %v", err)
+	}
+
+	// Snapshot loaded at batch start, then a refund notification lands
+	loaded := *stored
+	if err := DB.Model(&models.Subscription{}).Where("id = ?", stored.ID).Update("status", "refunded").Error; err != nil {
+		t.Fatalf("refund subscription: %v", err)
+	}
+
+	loaded.AppAccountToken = "device-1"
+	loaded.SetResolved(true)
+	loaded.ResolveAttempts = 0
+	loaded.NextResolveAt = nil
+	if err := UpdateSubscriptionBinding(&loaded, "pending-token"); err != nil {
+		t.Fatalf("update binding: %v", err)
+	}
+
+	got, err := GetSubscriptionByID(stored.ID)
+	if err != nil {
+		t.Fatalf("load subscription: %v", err)
+	}
+	if got.Status != "refunded" {
+		t.Errorf("status = %q, want refunded", got.Status)
+	}
+	if got.AppAccountToken != "device-1" || !got.IsBindingResolved() {
+		t.Errorf("binding = %q (resolved %v), want device-1 (resolved)", got.AppAccountToken, got.IsBindingResolved())
+	}
+	if loaded.Status != "refunded" {
+		t.Errorf("returned status = %q, want the stored refunded status", loaded.Status)
+	}
+}
+
+// Activating a tier supersedes the user's other active subscription of the group and reports it once committed
+func TestCreateSubscriptionReportsSupersededGroupSubscriptions(t *testing.T) {
+	setupTestDB(t)
+
+	var reported []models.Subscription
+	SubscriptionsSupersededHook = func(superseding *models.Subscription, superseded []models.Subscription) {
+		reported = append(reported, superseded...)
+	}
+	t.Cleanup(func() { SubscriptionsSupersededHook = nil })
+
+	basic := newTestSubscription("production", "1000000001", "1000000001")
+	basic.SubscriptionGroupID = "group-1"
+	if err := CreateSubscription(basic); err != nil {
+		t.Fatalf("create basic subscription: %v", err)
+	}
+	if len(reported) != 0 {
+		t.Fatalf("reported %d superseded subscriptions for the first tier, want 0", len(reported))
+	}
+
+	pro := newTestSubscription("production", "2000000001", "2000000001")
+	pro.SubscriptionGroupID = "group-1"
+	pro.ProductID = "com.example.pro.yearly"
+	if err := CreateSubscription(pro); err != nil {
+		t.Fatalf("create pro subscription: %v", err)
+	}
+
+	if len(reported) != 1 || reported[0].ID != basic.ID || reported[0].Status != "active" {
+		t.Fatalf("reported = %+v, want the basic subscription with its previous status", reported)
+	}
+	stored, err := GetSubscriptionByID(basic.ID)
+	if err != nil {
+		t.Fatalf("load basic subscription: %v", err)
+	}
+	if stored.Status != "superseded" {
+		t.Errorf("basic status = %q, want superseded", stored.Status)
+	}
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"verification-api/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// CreateOrUpdateTransaction 创建或更新交易（按项目内的 transaction_id）
+func CreateOrUpdateTransaction(transaction *models.Transaction) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var existing models.Transaction
+		err := tx.Set("gorm:query_option", "FOR UPDATE").
+			Where("project_id = ? AND transaction_id = ?", transaction.ProjectID, transaction.TransactionID).
+			First(&existing).Error
+
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return tx.Create(transaction).Error
+			}
+			return err
+		}
+
+		// 保留已绑定的 appAccountToken
+		if existing.AppAccountToken == "" {
+			existing.AppAccountToken = transaction.AppAccountToken
+		}
+		existing.ProductID = transaction.ProductID
+		existing.Type = transaction.Type
+		existing.Environment = transaction.Environment
+		existing.PurchasedAt = transaction.PurchasedAt
+		existing.PurchaseToken = transaction.PurchaseToken
+
+		if err := tx.Save(&existing).Error; err != nil {
+			return err
+		}
+		*transaction = existing
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	InvalidateSubscriptionStatus(transaction.ProjectID, transaction.AppAccountToken)
+	return nil
+}
+
+// GetUserTransactionsByType 获取用户指定类型的交易（按项目）
+func GetUserTransactionsByType(projectID, appAccountToken, transactionType string) ([]models.Transaction, error) {
+	var transactions []models.Transaction
+	err := DB.Where("project_id = ? AND app_account_token = ? AND type = ?", projectID, appAccountToken, transactionType).
+		Order("purchased_at DESC").
+		Find(&transactions).Error
+	return transactions, err
+}
+
+// DeleteTransactionByPurchaseToken 删除交易（Android，按 purchase token，软删除）
+func DeleteTransactionByPurchaseToken(projectID, purchaseToken string) (int64, error) {
+	var appAccountTokens []string
+	DB.Model(&models.Transaction{}).Where("project_id = ? AND purchase_token = ?", projectID, purchaseToken).
+		Pluck("app_account_token", &appAccountTokens)
+
+	result := DB.Where("project_id = ? AND purchase_token = ?", projectID, purchaseToken).Delete(&models.Transaction{})
+	if result.Error == nil {
+		for _, appAccountToken := range appAccountTokens {
+			InvalidateSubscriptionStatus(projectID, appAccountToken)
+		}
+	}
+	return result.RowsAffected, result.Error
+}
+
+// BindTransactionsByPurchaseToken 将 purchase token 对应的交易绑定到用户（Android 一次性内购，purchase 中没有 obfuscatedExternalAccountId 时由 bind_account 调用）
+// 返回绑定的交易数量
+func BindTransactionsByPurchaseToken(purchaseToken, appAccountToken string) (int64, error) {
+	var transactions []models.Transaction
+	if err := DB.Where("purchase_token = ?", purchaseToken).Find(&transactions).Error; err != nil {
+		return 0, err
+	}
+	if len(transactions) == 0 {
+		return 0, nil
+	}
+
+	result := DB.Model(&models.Transaction{}).Where("purchase_token = ?", purchaseToken).
+		Update("app_account_token", appAccountToken)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	for _, transaction := range transactions {
+		InvalidateSubscriptionStatus(transaction.ProjectID, transaction.AppAccountToken)
+		InvalidateSubscriptionStatus(transaction.ProjectID, appAccountToken)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"testing"
+	"time"
+	"verification-api/internal/models"
+)
+
+func newTestTransaction(projectID, appAccountToken, transactionID string) *models.Transaction {
+	return &models.Transaction{
+		ProjectID:             projectID,
+		AppAccountToken:       appAccountToken,
+		TransactionID:         transactionID,
+		OriginalTransactionID: transactionID,
+		ProductID:             "com.example.lifetime",
+		Type:                  "non_consumable",
+		Environment:           "production",
+		PurchasedAt:           time.Now(),
+		PurchaseToken:         "token-" + projectID,
+	}
+}
+
+// The same order ID in two projects is stored twice instead of one project overwriting the other
+func TestCreateOrUpdateTransactionScopedByProject(t *testing.T) {
+	setupTestDB(t)
+
+	if err := CreateOrUpdateTransaction(newTestTransaction("app-a", "user-a", "GPA.1111")); err != nil {
+		t.Fatalf("create app-a transaction: %v", err)
+	}
+	if err := CreateOrUpdateTransaction(newTestTransaction("app-b", "user-b", "GPA.1111")); err != nil {
+		t.Fatalf("create app-b transaction: %v", err)
+	}
+
+	for projectID, user := range map[string]string{"app-a": "user-a", "app-b": "user-b"} {
+		transactions, err := GetUserTransactionsByType(projectID, user, "non_consumable")
+		if err != nil {
+			t.Fatalf("load %s transactions: %v", projectID, err)
+		}
+		if len(transactions) != 1 || transactions[0].PurchaseToken != "token-"+projectID {
+			t.Errorf("%s transactions = %+v, want its own purchase", projectID, transactions)
+		}
+	}
+}
+
+// A purchase stored without a user becomes visible once bound, and re-verifying it keeps the bound user
+func TestBindTransactionsByPurchaseToken(t *testing.T) {
+	setupTestDB(t)
+
+	if err := CreateOrUpdateTransaction(newTestTransaction("app-a", "", "GPA.1111")); err != nil {
+		t.Fatalf("create transaction: %v", err)
+	}
+	bound, err := BindTransactionsByPurchaseToken("token-app-a", "user-a")
+	if err != nil || bound != 1 {
+		t.Fatalf("BindTransactionsByPurchaseToken() = %d, %v, want 1 bound", bound, err)
+	}
+	if bound, err := BindTransactionsByPurchaseToken("unknown-token", "user-a"); err != nil || bound != 0 {
+		t.Errorf("BindTransactionsByPurchaseToken(unknown) = %d, %v, want 0", bound, err)
+	}
+
+	if err := CreateOrUpdateTransaction(newTestTransaction("app-a", "", "GPA.1111")); err != nil {
+		t.Fatalf("re-verify transaction: %v", err)
+	}
+	transactions, err := GetUserTransactionsByType("app-a", "user-a", "non_consumable")
+	if err != nil {
+		t.Fatalf("load transactions: %v", err)
+	}
+	if len(transactions) != 1 {
+		t.Errorf("user-a owns %d one-time products, want 1", len(transactions))
+	}
+}
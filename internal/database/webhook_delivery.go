@@ -0,0 +1,54 @@
+package database
+
+import (
+	"time"
+	"verification-api/internal/models"
+)
+
+// CreateWebhookDelivery 保存一次 webhook 投递结果
+func CreateWebhookDelivery(delivery *models.WebhookDelivery) error {
+	return DB.Create(delivery).Error
+}
+
+// GetWebhookDeliveryByID 根据主键获取 webhook 投递记录
+func GetWebhookDeliveryByID(id uint) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	if err := DB.First(&delivery, id).Error; err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// ListWebhookDeliveries 分页获取项目的 webhook 投递记录（按创建时间倒序）
+// succeeded 为 nil 时返回全部，否则只返回成功 / 失败的记录
+func ListWebhookDeliveries(projectID string, succeeded *bool, limit, offset int) ([]models.WebhookDelivery, int64, error) {
+	query := DB.Model(&models.WebhookDelivery{}).Where("project_id = ?", projectID)
+	if succeeded != nil {
+		query = query.Where("succeeded = ?", *succeeded)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var deliveries []models.WebhookDelivery
+	err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&deliveries).Error
+	return deliveries, total, err
+}
+
+// GetUndeliveredWebhookDeliveries 获取项目在 [from, to) 时间窗口内投递失败的记录（按创建时间升序）
+// 同一 event_id 已有成功投递（包括窗口之后的重新投递）的记录不返回；用于故障后重放 webhook，最多返回 limit 条
+func GetUndeliveredWebhookDeliveries(projectID string, from, to time.Time, limit int) ([]models.WebhookDelivery, error) {
+	delivered := DB.Model(&models.WebhookDelivery{}).
+		Select("event_id").
+		Where("project_id = ? AND succeeded = ? AND event_id <> ''", projectID, true)
+
+	var deliveries []models.WebhookDelivery
+	err := DB.Where("project_id = ? AND succeeded = ? AND created_at >= ? AND created_at < ?", projectID, false, from, to).
+		Where("event_id NOT IN (?)", delivered).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
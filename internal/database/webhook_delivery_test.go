@@ -0,0 +1,39 @@
+package database
+
+import (
+	"testing"
+	"time"
+	"verification-api/internal/models"
+)
+
+// Replay candidates are failed deliveries whose event never succeeded, also not after the window
+func TestGetUndeliveredWebhookDeliveries(t *testing.T) {
+	setupTestDB(t)
+
+	for _, delivery := range []models.WebhookDelivery{
+		{ProjectID: "test-project", EventID: "event-failed", Succeeded: false},
+		{ProjectID: "test-project", EventID: "event-failed", Succeeded: false},
+		{ProjectID: "test-project", EventID: "event-redelivered", Succeeded: false},
+		{ProjectID: "test-project", EventID: "event-redelivered", Succeeded: true},
+		{ProjectID: "test-project", EventID: "event-ok", Succeeded: true},
+		{ProjectID: "other-project", EventID: "event-other", Succeeded: false},
+	} {
+		if err := CreateWebhookDelivery(&delivery); err != nil {
+			t.Fatalf("create delivery: %v", err)
+		}
+	}
+
+	now := time.Now()
+	deliveries, err := GetUndeliveredWebhookDeliveries("test-project", now.Add(-time.Hour), now.Add(time.Hour), 100)
+	if err != nil {
+		t.Fatalf("get undelivered deliveries: %v", err)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("got %d deliveries, want the 2 failed deliveries of event-failed", len(deliveries))
+	}
+	for _, delivery := range deliveries {
+		if delivery.EventID != "event-failed" {
+			t.Errorf("got event %q, want event-failed", delivery.EventID)
+		}
+	}
+}
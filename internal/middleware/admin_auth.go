@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"verification-api/internal/config"
+	"verification-api/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminUserKey is the context key of the authenticated admin operator (name of the matching ADMIN_API_KEYS entry)
+const AdminUserKey = "admin_user"
+
+// AdminAuthMiddleware authenticates admin requests against ADMIN_API_KEYS
+// The key is sent as X-Admin-Key or Authorization: Bearer <key>
+// Without configured keys the admin API is disabled (503) instead of open
+func AdminAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys := config.AppConfig.AdminAPIKeys
+		if len(keys) == 0 {
+			c.JSON(http.StatusServiceUnavailable, response.Error(http.StatusServiceUnavailable, "Admin API is disabled (ADMIN_API_KEYS not configured)"))
+			c.Abort()
+			return
+		}
+
+		key := c.GetHeader("X-Admin-Key")
+		if key == "" {
+			if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+				key = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+			}
+		}
+		if key == "" {
+			c.JSON(http.StatusUnauthorized, response.Error(http.StatusUnauthorized, "Missing admin key"))
+			c.Abort()
+			return
+		}
+
+		operator, ok := matchAdminKey(keys, key)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, response.Error(http.StatusUnauthorized, "Invalid admin key"))
+			c.Abort()
+			return
+		}
+
+		c.Set(AdminUserKey, operator)
+		c.Next()
+	}
+}
+
+// matchAdminKey returns the operator name of the entry matching key
+// Entries are "name:key"; an entry without a name is reported as "admin"
+// Every entry is compared in constant time so the match position doesn't leak through timing
+func matchAdminKey(entries []string, key string) (string, bool) {
+	operator, found := "", false
+	for _, entry := range entries {
+		name, secret := "admin", entry
+		if i := strings.Index(entry, ":"); i >= 0 {
+			name, secret = entry[:i], entry[i+1:]
+		}
+		if secret == "" {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(key)) == 1 && !found {
+			operator, found = name, true
+		}
+	}
+	return operator, found
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"time"
 	"verification-api/internal/services"
@@ -40,7 +41,14 @@ func ProjectAuthMiddleware() gin.HandlerFunc {
 		}
 
 		// Validate project using database
-		if !ProjectService.ValidateProject(projectID, apiKey) {
+		if err := ProjectService.ValidateProject(projectID, apiKey); err != nil {
+			if errors.Is(err, services.ErrProjectInactive) {
+				resp := response.Error(http.StatusForbidden, "Project is inactive")
+				resp.Code = services.ProjectInactiveCode
+				c.JSON(http.StatusForbidden, resp)
+				c.Abort()
+				return
+			}
 			c.JSON(http.StatusUnauthorized, response.Error(http.StatusUnauthorized, "Invalid project_id or api_key"))
 			c.Abort()
 			return
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+	"verification-api/internal/config"
+	"verification-api/internal/database"
+	"verification-api/internal/response"
+	"verification-api/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Idempotency-Key limits
+const (
+	maxIdempotencyKeyLength    = 255
+	maxIdempotentResponseBytes = 1 << 20 // Larger responses are not stored, their retries run again
+)
+
+// IdempotencyStore keeps the outcome of requests sent with an Idempotency-Key
+type IdempotencyStore interface {
+	// Reserve marks key as in progress; when it already exists the stored record is returned with false
+	Reserve(key, fingerprint string, ttl time.Duration) (*database.IdempotencyRecord, bool, error)
+	Complete(key string, record *database.IdempotencyRecord, ttl time.Duration) error
+	Release(key string) error
+}
+
+// IdempotencyMiddleware makes POST requests carrying an Idempotency-Key safe to retry
+// The first request runs normally and its response is stored for IDEMPOTENCY_KEY_TTL_SECONDS; a retry with the same key
+// and body gets the stored response (Idempotent-Replayed: true) instead of running again. A retry while the first request
+// is still running gets 409, a key reused for a different request 422. 5xx responses are not stored, so they can be retried.
+// Keys are scoped to the X-Project-ID header and the route. Without Redis requests run as if no key was sent
+func IdempotencyMiddleware(store IdempotencyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		ttl := time.Duration(config.AppConfig.IdempotencyKeyTTLSeconds) * time.Second
+		if c.Request.Method != http.MethodPost || key == "" || ttl <= 0 {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.JSON(http.StatusBadRequest, response.Error(http.StatusBadRequest, "Idempotency-Key must be at most 255 characters"))
+			c.Abort()
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			var err error
+			if body, err = io.ReadAll(c.Request.Body); err != nil {
+				c.JSON(http.StatusBadRequest, response.Error(http.StatusBadRequest, "Failed to read request body"))
+				c.Abort()
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		scopedKey := c.GetHeader("X-Project-ID") + ":" + c.FullPath() + ":" + key
+		fingerprint := idempotencyFingerprint(c.Request.Method, c.FullPath(), body)
+		existing, reserved, err := store.Reserve(scopedKey, fingerprint, ttl)
+		if err != nil {
+			logging.Warnf("Idempotency-Key ignored, store unavailable - path: %s, error: %v", c.FullPath(), err)
+			c.Next()
+			return
+		}
+		if !reserved {
+			replayIdempotentResponse(c, existing, fingerprint)
+			return
+		}
+
+		writer := &captureWriter{ResponseWriter: c.Writer, limit: maxIdempotentResponseBytes}
+		c.Writer = writer
+		c.Next()
+
+		status := writer.Status()
+		if status >= http.StatusInternalServerError || writer.truncated {
+			if err := store.Release(scopedKey); err != nil {
+				logging.Errorf("Failed to release Idempotency-Key - path: %s, error: %v", c.FullPath(), err)
+			}
+			return
+		}
+		record := &database.IdempotencyRecord{
+			Fingerprint: fingerprint,
+			StatusCode:  status,
+			ContentType: writer.Header().Get("Content-Type"),
+			Body:        writer.body.String(),
+		}
+		if err := store.Complete(scopedKey, record, ttl); err != nil {
+			logging.Errorf("Failed to store idempotent response - path: %s, error: %v", c.FullPath(), err)
+		}
+	}
+}
+
+// replayIdempotentResponse answers a request whose key was already used
+func replayIdempotentResponse(c *gin.Context, existing *database.IdempotencyRecord, fingerprint string) {
+	switch {
+	case existing.Fingerprint != fingerprint:
+		c.JSON(http.StatusUnprocessableEntity, response.Error(http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request"))
+	case existing.Pending:
+		c.JSON(http.StatusConflict, response.Error(http.StatusConflict, "A request with this Idempotency-Key is still being processed"))
+	default:
+		c.Header("Idempotent-Replayed", "true")
+		c.Data(existing.StatusCode, existing.ContentType, []byte(existing.Body))
+	}
+	c.Abort()
+}
+
+// idempotencyFingerprint identifies the request a key was first used for
+func idempotencyFingerprint(method, path string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"verification-api/internal/config"
+	"verification-api/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memoryIdempotencyStore keeps idempotency records in memory
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]database.IdempotencyRecord
+}
+
+func (s *memoryIdempotencyStore) Reserve(key, fingerprint string, ttl time.Duration) (*database.IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if record, ok := s.records[key]; ok {
+		return &record, false, nil
+	}
+	s.records[key] = database.IdempotencyRecord{Fingerprint: fingerprint, Pending: true}
+	return nil, true, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(key string, record *database.IdempotencyRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = *record
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+// newIdempotencyRouter serves POST /verify, answering with status and counting handler runs
+func newIdempotencyRouter(t *testing.T, store IdempotencyStore, status *int, calls *int) *gin.Engine {
+	t.Helper()
+	original := config.AppConfig
+	config.AppConfig = &config.Config{IdempotencyKeyTTLSeconds: 60}
+	t.Cleanup(func() { config.AppConfig = original })
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(IdempotencyMiddleware(store))
+	router.POST("/verify", func(c *gin.Context) {
+		*calls++
+		c.JSON(*status, gin.H{"success": *status < 400, "call": *calls})
+	})
+	return router
+}
+
+func postWithKey(router *gin.Engine, key, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/verify", strings.NewReader(body))
+	request.Header.Set("X-Project-ID", "app-a")
+	if key != "" {
+		request.Header.Set("Idempotency-Key", key)
+	}
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestIdempotencyMiddlewareReplaysResponse(t *testing.T) {
+	store := &memoryIdempotencyStore{records: map[string]database.IdempotencyRecord{}}
+	status, calls := http.StatusOK, 0
+	router := newIdempotencyRouter(t, store, &status, &calls)
+
+	first := postWithKey(router, "key-1", `{"user_id":"u1"}`)
+	second := postWithKey(router, "key-1", `{"user_id":"u1"}`)
+	if calls != 1 {
+		t.Fatalf("handler ran %d times, want 1", calls)
+	}
+	if second.Code != first.Code || second.Body.String() != first.Body.String() {
+		t.Errorf("replay = %d %s, want %d %s", second.Code, second.Body.String(), first.Code, first.Body.String())
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Idempotent-Replayed header missing on replay")
+	}
+	if ct := second.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("replay Content-Type = %q, want application/json", ct)
+	}
+
+	postWithKey(router, "", `{"user_id":"u1"}`)
+	postWithKey(router, "key-2", `{"user_id":"u1"}`)
+	if calls != 3 {
+		t.Errorf("handler ran %d times, want 3 (no key and a new key are processed)", calls)
+	}
+}
+
+func TestIdempotencyMiddlewareRejectsReuse(t *testing.T) {
+	tests := []struct {
+		name       string
+		existing   database.IdempotencyRecord
+		wantStatus int
+	}{
+		{name: "different body", existing: database.IdempotencyRecord{Fingerprint: "other", StatusCode: http.StatusOK}, wantStatus: http.StatusUnprocessableEntity},
+		{name: "still processing", existing: database.IdempotencyRecord{Pending: true}, wantStatus: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existing := tt.existing
+			if existing.Fingerprint == "" {
+				existing.Fingerprint = idempotencyFingerprint(http.MethodPost, "/verify", []byte(`{"user_id":"u1"}`))
+			}
+			store := &memoryIdempotencyStore{records: map[string]database.IdempotencyRecord{"app-a:/verify:key-1": existing}}
+			status, calls := http.StatusOK, 0
+			router := newIdempotencyRouter(t, store, &status, &calls)
+
+			recorder := postWithKey(router, "key-1", `{"user_id":"u1"}`)
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+			if calls != 0 {
+				t.Errorf("handler ran %d times, want 0", calls)
+			}
+		})
+	}
+}
+
+func TestIdempotencyMiddlewareReleasesServerErrors(t *testing.T) {
+	store := &memoryIdempotencyStore{records: map[string]database.IdempotencyRecord{}}
+	status, calls := http.StatusInternalServerError, 0
+	router := newIdempotencyRouter(t, store, &status, &calls)
+
+	if recorder := postWithKey(router, "key-1", `{}`); recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("first status = %d, want 500", recorder.Code)
+	}
+	status = http.StatusOK
+	if recorder := postWithKey(router, "key-1", `{}`); recorder.Code != http.StatusOK {
+		t.Fatalf("retry status = %d, want 200", recorder.Code)
+	}
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want 2 (a 5xx is not stored)", calls)
+	}
+}
@@ -0,0 +1,238 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"verification-api/internal/config"
+	"verification-api/internal/database"
+	"verification-api/pkg/logging"
+	"verification-api/pkg/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// redactedValue replaces sensitive header and query values in captures
+const redactedValue = "[REDACTED]"
+
+// sensitiveNameParts marks header / query / JSON field names whose values are never captured
+var sensitiveNameParts = []string{"authorization", "cookie", "key", "secret", "token", "signature", "password"}
+
+// sensitiveBodyFields are JSON body fields redacted by exact name (too generic to match as a part)
+var sensitiveBodyFields = []string{"code"}
+
+// captureWriter tees the response body into a bounded buffer
+type captureWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (w *captureWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *captureWriter) capture(data []byte) {
+	if remaining := w.limit - w.body.Len(); remaining < len(data) {
+		w.body.Write(data[:max(remaining, 0)])
+		w.truncated = true
+		return
+	}
+	w.body.Write(data)
+}
+
+// RequestCaptureMiddleware captures full requests and responses for a sampled share of traffic
+// A request is sampled with probability REQUEST_CAPTURE_SAMPLE_RATE; the capture is only kept when the request
+// belongs to a project with debug_capture enabled. Captures are logged and stored in Redis for REQUEST_CAPTURE_TTL_SECONDS
+// Sensitive headers, query parameters and JSON / form body fields (API keys, tokens, signatures, cookies, verification codes) are redacted
+func RequestCaptureMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rate := config.AppConfig.RequestCaptureSampleRate
+		if rate <= 0 || mathrand.Float64() >= rate {
+			c.Next()
+			return
+		}
+
+		limit := config.AppConfig.RequestCaptureMaxBodyBytes
+		startTime := time.Now()
+
+		// Read at most limit+1 bytes and put them back in front of the rest of the body,
+		// so handlers (and body size limits) still see the whole stream
+		var requestBody []byte
+		if c.Request.Body != nil {
+			requestBody, _ = io.ReadAll(io.LimitReader(c.Request.Body, int64(limit)+1))
+			c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(requestBody), c.Request.Body), c.Request.Body}
+		}
+		truncated := len(requestBody) > limit
+		if truncated {
+			requestBody = requestBody[:limit]
+		}
+
+		writer := &captureWriter{ResponseWriter: c.Writer, limit: limit}
+		c.Writer = writer
+		c.Next()
+
+		projectID := c.GetString("project_id")
+		if projectID == "" {
+			projectID = c.GetHeader("X-Project-ID")
+		}
+		if projectID == "" {
+			projectID = c.Query("project_id")
+		}
+		if projectID == "" || ProjectService == nil {
+			return
+		}
+		project, err := ProjectService.GetProjectByID(projectID)
+		if err != nil || !project.DebugCapture {
+			return
+		}
+
+		capture := &database.RequestCapture{
+			ID:              newCaptureID(),
+			ProjectID:       projectID,
+			Method:          c.Request.Method,
+			Path:            c.Request.URL.Path,
+			Query:           redactQuery(c.Request.URL.Query()),
+			ClientIP:        c.ClientIP(),
+			RequestHeaders:  redactHeaders(c.Request.Header),
+			RequestBody:     redactBody(c.ContentType(), requestBody),
+			StatusCode:      writer.Status(),
+			ResponseHeaders: redactHeaders(writer.Header()),
+			ResponseBody:    redactBody(writer.Header().Get("Content-Type"), writer.body.Bytes()),
+			Truncated:       truncated || writer.truncated,
+			DurationMs:      time.Since(startTime).Milliseconds(),
+			CapturedAt:      startTime,
+		}
+		metrics.IncCounter("request_captures_total", map[string]string{"project_id": projectID})
+
+		if data, err := json.Marshal(capture); err == nil {
+			logging.Infof("Request capture - project: %s, id: %s, capture: %s", projectID, capture.ID, data)
+		}
+		ttl := time.Duration(config.AppConfig.RequestCaptureTTLSeconds) * time.Second
+		if err := database.SaveRequestCapture(capture, ttl); err != nil {
+			logging.Errorf("Failed to store request capture - project: %s, id: %s, error: %v", projectID, capture.ID, err)
+		}
+	}
+}
+
+// readCloser reads from the replayed body and closes the original one
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// newCaptureID returns a random capture ID
+func newCaptureID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+// isSensitiveName reports whether a header / query parameter value must be redacted
+func isSensitiveName(name string) bool {
+	name = strings.ToLower(name)
+	for _, part := range sensitiveNameParts {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactHeaders flattens headers, replacing sensitive values
+func redactHeaders(header http.Header) map[string]string {
+	redacted := make(map[string]string, len(header))
+	for name, values := range header {
+		if isSensitiveName(name) {
+			redacted[name] = redactedValue
+			continue
+		}
+		redacted[name] = strings.Join(values, ", ")
+	}
+	return redacted
+}
+
+// redactQuery encodes the query string, replacing sensitive values
+func redactQuery(query url.Values) string {
+	for name := range query {
+		if isSensitiveName(name) {
+			query[name] = []string{redactedValue}
+		}
+	}
+	return query.Encode()
+}
+
+// redactBody replaces sensitive fields of a JSON or form body
+// A JSON body that can't be parsed (e.g. truncated by the capture limit) is redacted whole,
+// other content types are kept as is
+func redactBody(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			return redactQuery(form)
+		}
+		return redactedValue
+	}
+	if !strings.Contains(contentType, "json") {
+		return string(body)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return redactedValue
+	}
+	data, err := json.Marshal(redactJSONValue(value))
+	if err != nil {
+		return redactedValue
+	}
+	return string(data)
+}
+
+// redactJSONValue walks a decoded JSON value, replacing the values of sensitive fields
+func redactJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, field := range v {
+			if isSensitiveName(name) || isSensitiveBodyField(name) {
+				v[name] = redactedValue
+				continue
+			}
+			v[name] = redactJSONValue(field)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactJSONValue(item)
+		}
+	}
+	return value
+}
+
+// isSensitiveBodyField reports whether a JSON field is redacted by its exact name
+func isSensitiveBodyField(name string) bool {
+	for _, field := range sensitiveBodyFields {
+		if strings.EqualFold(name, field) {
+			return true
+		}
+	}
+	return false
+}
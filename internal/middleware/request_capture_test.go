@@ -0,0 +1,27 @@
+package middleware
+
+import "testing"
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{"verification code", "application/json", `{"email":"a@example.com","code":"123456"}`, `{"code":"[REDACTED]","email":"a@example.com"}`},
+		{"nested token", "application/json", `{"items":[{"purchase_token":"abc","product_id":"pro"}]}`, `{"items":[{"product_id":"pro","purchase_token":"[REDACTED]"}]}`},
+		{"code is matched exactly", "application/json", `{"error_code":"E1","count":12}`, `{"count":12,"error_code":"E1"}`},
+		{"truncated json", "application/json; charset=utf-8", `{"code":"123`, redactedValue},
+		{"form", "application/x-www-form-urlencoded", "api_key=secret&user=1", "api_key=%5BREDACTED%5D&user=1"},
+		{"other content type", "text/plain", "code=123456", "code=123456"},
+		{"empty", "application/json", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactBody(tt.contentType, []byte(tt.body)); got != tt.want {
+				t.Errorf("redactBody() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
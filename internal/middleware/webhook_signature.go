@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"verification-api/internal/services"
+	"verification-api/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookSignatureMiddleware rejects requests without a valid X-UnionHub-Signature header
+// For routes that accept signed callbacks; secretLookup returns the shared secret of the caller
+// (empty when unknown), and the HMAC of the raw body is checked in constant time (see VerifySignature)
+// The body is restored afterwards so handlers can read it as usual
+func WebhookSignatureMiddleware(secretLookup func(c *gin.Context) string) gin.HandlerFunc {
+	webhookNotifier := services.NewWebhookNotifier()
+	return func(c *gin.Context) {
+		signature := c.GetHeader("X-UnionHub-Signature")
+		if signature == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "Missing X-UnionHub-Signature header",
+			})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+					"success": false,
+					"message": "Request body too large",
+				})
+			} else {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"success": false,
+					"message": "Failed to read request body",
+				})
+			}
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		if !webhookNotifier.VerifySignature(body, secretLookup(c), signature) {
+			logging.Warnf("Invalid webhook signature - path: %s, ip: %s", c.FullPath(), c.ClientIP())
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "Invalid webhook signature",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -1,11 +1,25 @@
 package models
 
+import "encoding/json"
+
 // AppStoreNotificationWrapper represents the outer wrapper of App Store Server Notification V2
 // Apple sends notifications as a JWT in the signedPayload field
 type AppStoreNotificationWrapper struct {
 	SignedPayload string `json:"signedPayload"` // JWT containing the actual notification
 }
 
+// AppStoreNotificationV1 represents the legacy App Store Server Notification V1 format
+// Only the fields needed to recognize a V1 payload are modeled; V1 is not processed
+type AppStoreNotificationV1 struct {
+	NotificationType string          `json:"notification_type"` // e.g., "INITIAL_BUY", "DID_RENEW"
+	UnifiedReceipt   json.RawMessage `json:"unified_receipt"`   // Receipt info (V1 only)
+}
+
+// IsV1 reports whether the payload looks like a V1 notification
+func (n *AppStoreNotificationV1) IsV1() bool {
+	return n.NotificationType != "" || len(n.UnifiedReceipt) > 0
+}
+
 // AppStoreNotification represents App Store Server Notification V2
 // This is the decoded content from the signedPayload JWT
 // Apple uses camelCase for field names
@@ -13,7 +27,7 @@ type AppStoreNotification struct {
 	NotificationType   string          `json:"notificationType"`   // e.g., "SUBSCRIBED", "DID_RENEW"
 	Subtype            string          `json:"subtype,omitempty"`  // Optional subtype
 	NotificationUUID   string          `json:"notificationUUID"`    // Unique notification ID
-	DataVersion        string          `json:"dataVersion"`         // Version of the data format
+	DataVersion        string          `json:"version"`             // Version of the data format (Apple sends it as "version", e.g. "2.0")
 	SignedDate         int64           `json:"signedDate"`          // Timestamp when notification was signed
 	Data               NotificationData `json:"data"`               // Notification data payload
 }
@@ -26,6 +40,18 @@ type NotificationData struct {
 	BundleVersion         string `json:"bundleVersion"`         // App version
 	Environment           string `json:"environment"`           // "Sandbox" or "Production"
 	SignedTransactionInfo string `json:"signedTransactionInfo"`  // JWT containing transaction info
+	SignedRenewalInfo     string `json:"signedRenewalInfo,omitempty"` // JWT containing renewal info (auto-renewable subscriptions)
+}
+
+// RenewalInfo represents decoded renewal information (signedRenewalInfo)
+// Apple uses camelCase for field names
+type RenewalInfo struct {
+	OriginalTransactionID  string `json:"originalTransactionId"`
+	AutoRenewProductID     string `json:"autoRenewProductId"`     // Product the subscription renews to
+	AutoRenewStatus        int    `json:"autoRenewStatus"`        // 1=on, 0=off
+	ExpirationIntent       int    `json:"expirationIntent"`       // 1=cancelled by user, 2=billing error, 3=price increase not consented, 4=product unavailable, 5=other
+	GracePeriodExpiresDate int64  `json:"gracePeriodExpiresDate"` // Unix timestamp in milliseconds
+	IsInBillingRetryPeriod bool   `json:"isInBillingRetryPeriod"`
 }
 
 // TransactionInfo represents decoded transaction information
@@ -38,5 +64,12 @@ type TransactionInfo struct {
 	AutoRenewStatus       int    `json:"auto_renew_status"`
 	Environment           string `json:"environment"`
 	AppAccountToken       string `json:"app_account_token"` // User ID passed from client during purchase
+	Type                  string `json:"type"`              // e.g., "Auto-Renewable Subscription", "Non-Consumable"
+	BillingPeriod         string `json:"billing_period"`    // ISO 8601 billing period, e.g. P1W, P1M, P1Y
+	SubscriptionGroupID   string `json:"subscription_group_id"` // Apple subscriptionGroupIdentifier (auto-renewable subscriptions)
+	Unresolved            bool   `json:"-"`                 // AppAccountToken could not be resolved to a user_id (store_unresolved policy)
+
+	// Decoded signedRenewalInfo of the notification, nil when absent
+	RenewalInfo *RenewalInfo `json:"-"`
 }
 
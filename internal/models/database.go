@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -21,6 +22,7 @@ type Project struct {
 	ProjectName  string `json:"project_name" gorm:"not null"`
 	APIKey       string `json:"api_key" gorm:"uniqueIndex;not null"`
 	FromName     string `json:"from_name" gorm:"not null"`
+	FromEmail    string `json:"from_email,omitempty"` // 项目发件地址（需在 Brevo 中验证），为空时使用 BREVO_FROM_EMAIL
 	TemplateID   string `json:"template_id"`
 	CustomConfig string `json:"custom_config" gorm:"type:text"` // JSON string
 	IsActive     bool   `json:"is_active" gorm:"default:true"`
@@ -33,8 +35,79 @@ type Project struct {
 	PackageName string `json:"package_name" gorm:"uniqueIndex"` // Android package name，用于识别 Android App
 
 	// Webhook 配置（用于通知 App Backend 订阅状态变化）
-	WebhookCallbackURL string `json:"webhook_callback_url" gorm:"type:varchar(500)"` // App Backend 的 webhook 地址
-	WebhookSecret      string `json:"webhook_secret" gorm:"type:varchar(255)"`       // 用于签名验证（可选）
+	WebhookCallbackURL        string `json:"webhook_callback_url" gorm:"type:varchar(500)"`       // App Backend 的 webhook 地址
+	WebhookSecret             string `json:"webhook_secret" gorm:"type:varchar(255)"`             // 用于签名验证（可选）
+	WebhookContentType        string `json:"webhook_content_type" gorm:"type:varchar(20)"`        // 回调编码：json（默认）或 form（application/x-www-form-urlencoded）
+	WebhookSignatureAlgorithm string `json:"webhook_signature_algorithm" gorm:"type:varchar(20)"` // 签名算法：sha256（默认）或 sha512
+	WebhookSignatureFormat    string `json:"webhook_signature_format" gorm:"type:varchar(20)"`    // 签名头格式：hex（默认，原始十六进制）或 prefixed（如 sha256=<hex>）
+	WebhookSandboxURL         string `json:"webhook_sandbox_url" gorm:"type:varchar(500)"`        // sandbox 环境订阅的 webhook 地址，为空时使用 webhook_callback_url
+	WebhookProductionURL      string `json:"webhook_production_url" gorm:"type:varchar(500)"`     // production 环境订阅的 webhook 地址，为空时使用 webhook_callback_url
+	WebhookMaxRetries         int    `json:"webhook_max_retries" gorm:"default:0"`                // 首次投递失败后的重试次数（0 表示默认 2 次，-1 表示不重试）
+	WebhookBackoffBaseMs      int    `json:"webhook_backoff_base_ms" gorm:"default:0"`            // 指数退避基数（毫秒），第 n 次重试前等待 base * 2^n（带抖动），0 表示默认间隔 1s、5s
+
+	// 订阅套餐解析（从 product_id 得到 plan）
+	PlanStrategy string `json:"plan_strategy" gorm:"type:varchar(20)"` // suffix（默认）、map、regex、passthrough
+	PlanMapping  string `json:"plan_mapping" gorm:"type:text"`         // map 策略：JSON 对象 product_id -> plan
+	PlanPattern  string `json:"plan_pattern" gorm:"type:varchar(255)"` // regex 策略：取第一个捕获组作为 plan
+
+	// 权益映射（从 product_id 得到 entitlements）
+	EntitlementMapping string `json:"entitlement_mapping" gorm:"type:text"` // JSON 对象 product_id -> 权益名称列表，为空表示不返回 entitlements
+
+	// App Store 环境限制
+	AllowedEnvironments string `json:"allowed_environments" gorm:"type:varchar(50)"` // 允许的环境（逗号分隔：sandbox,production），为空表示都允许
+
+	// 验证码投递
+	CodeDeliveryMode string `json:"code_delivery_mode" gorm:"type:varchar(20)"` // email（默认，通过 Brevo 发送邮件）或 webhook（POST 到 code_delivery_url，由接入方自行发送）
+	CodeDeliveryURL  string `json:"code_delivery_url" gorm:"type:varchar(500)"` // webhook 模式的投递地址（使用 webhook_secret 签名）
+
+	// 验证码格式
+	CodeLength int    `json:"code_length" gorm:"default:0"`      // 验证码长度（4~12），0 表示默认 6 位
+	CodeType   string `json:"code_type" gorm:"type:varchar(20)"` // numeric（默认，纯数字）或 alphanumeric（大写字母 + 数字，校验时不区分大小写）
+
+	// 验证码有效期（分钟），0 表示使用全局 CODE_EXPIRE_MINUTES
+	CodeExpireMinutes int `json:"code_expire_minutes" gorm:"default:0"`
+
+	// appAccountToken 解析（通过 App Backend 查询 device_id）
+	TokenResolutionPolicy string `json:"token_resolution_policy" gorm:"type:varchar(30)"` // 查询失败时的处理：fallback_to_token（默认，使用 token 作为 user_id）、store_unresolved（保存并标记为未解析，后台任务重试）、reject（丢弃通知）
+
+	// 交易有效期限制（防止重放旧收据）
+	MaxTransactionAgeDays int `json:"max_transaction_age_days" gorm:"default:0"` // 验证请求中购买时间早于该天数的交易将被拒绝（transaction_too_old），0 表示不限制
+
+	// Apple/Google 通知验证
+	RequireWebhookSignature bool `json:"require_webhook_signature" gorm:"default:false"` // 严格模式：签名缺失或验证失败的通知返回 401（默认宽松：仅记录警告）
+
+	// 调试抓取
+	DebugCapture bool `json:"debug_capture" gorm:"default:false"` // 按 REQUEST_CAPTURE_SAMPLE_RATE 抽样抓取该项目的完整请求 / 响应（请求头脱敏），保存在 Redis 供排查
+
+	// 项目组（共享 SSO：同组项目之间验证码互通）
+	GroupID string `json:"group_id" gorm:"type:varchar(100);index"` // 所属项目组，为空表示不加入任何组
+}
+
+// ProjectGroup represents a group of projects sharing verification codes
+// A code sent for one project of the group can be verified by any other project of the group
+type ProjectGroup struct {
+	BaseModel
+	GroupID     string `json:"group_id" gorm:"uniqueIndex;not null"`
+	Name        string `json:"name" gorm:"not null"`
+	Description string `json:"description"`
+}
+
+// AllowsEnvironment reports whether the project allows verification in the given environment
+func (p *Project) AllowsEnvironment(environment string) bool {
+	if strings.TrimSpace(p.AllowedEnvironments) == "" {
+		return true
+	}
+	for _, allowed := range strings.Split(p.AllowedEnvironments, ",") {
+		if strings.EqualFold(strings.TrimSpace(allowed), environment) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasWebhook reports whether any App Backend webhook URL (default or per-environment) is configured
+func (p *Project) HasWebhook() bool {
+	return p.WebhookCallbackURL != "" || p.WebhookSandboxURL != "" || p.WebhookProductionURL != ""
 }
 
 // VerificationCode and RateLimit removed - using Redis only
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// FlaggedUser 疑似欺诈用户
+// 同一 user_id 累积的订阅（不同 original_transaction_id）超过阈值时标记（共享账号 / 收据共享）
+// 仅用于告警和人工审核，不会阻止验证
+type FlaggedUser struct {
+	BaseModel
+
+	ProjectID         string    `json:"project_id" gorm:"not null;uniqueIndex:idx_flagged_user_project_user,priority:1"`        // 项目ID
+	AppAccountToken   string    `json:"app_account_token" gorm:"not null;uniqueIndex:idx_flagged_user_project_user,priority:2"` // 用户ID（app_account_token）
+	Reason            string    `json:"reason" gorm:"size:50"`                                                                  // 标记原因，如 subscription_count
+	SubscriptionCount int64     `json:"subscription_count"`                                                                     // 最近一次检测时的订阅数量
+	LastFlaggedAt     time.Time `json:"last_flagged_at"`                                                                        // 最近一次检测超出阈值的时间
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+// 队列中通知的处理状态
+const (
+	QueuedNotificationPending    = "pending"    // 等待处理（含失败后等待重试）
+	QueuedNotificationProcessing = "processing" // 已被 worker 领取
+	QueuedNotificationProcessed  = "processed"  // 处理完成
+	QueuedNotificationFailed     = "failed"     // 重试次数用尽或不可重试的错误
+)
+
+// QueuedNotification 已验签、待异步处理的 App Store 通知
+// webhook 完成验签和去重后立即写入并返回 200，由 worker 完成后续处理（数据库写入、查询 device_id、App Backend webhook）
+type QueuedNotification struct {
+	BaseModel
+
+	Environment      string     `json:"environment" gorm:"size:20"`                                                  // 接收通知的 webhook 环境（production / sandbox）
+	NotificationUUID string     `json:"notification_uuid" gorm:"size:64;index"`                                      // Apple notificationUUID
+	NotificationType string     `json:"notification_type" gorm:"size:50"`                                            // 通知类型
+	Subtype          string     `json:"subtype" gorm:"size:50"`                                                      // 通知子类型
+	BundleID         string     `json:"bundle_id" gorm:"size:255"`                                                   // App bundle identifier
+	Body             string     `json:"body" gorm:"type:text"`                                                       // 原始通知 body（{"signedPayload": "..."}），可用于 reprocess
+	Payload          string     `json:"payload" gorm:"type:text"`                                                    // 已验签的 signedPayload 解码结果（JSON）
+	Status           string     `json:"status" gorm:"size:20;index:idx_queued_notification_status_next,priority:1"`  // 处理状态
+	Attempts         int        `json:"attempts"`                                                                    // 已处理次数
+	NextAttemptAt    time.Time  `json:"next_attempt_at" gorm:"index:idx_queued_notification_status_next,priority:2"` // 下一次可处理的时间
+	LastError        string     `json:"last_error" gorm:"type:text"`                                                 // 最后一次处理失败的错误信息
+	ProcessedAt      *time.Time `json:"processed_at"`                                                                // 处理完成时间
+}
@@ -10,27 +10,71 @@ type Subscription struct {
 	BaseModel
 
 	// 关联字段
-	AppAccountToken string `json:"app_account_token" gorm:"not null;index;column:app_account_token"` // App Account Token (UUID 格式)
-	ProjectID       string `json:"project_id" gorm:"not null;index"`                                 // 项目ID，关联到project表
-	Platform        string `json:"platform" gorm:"size:20;default:'ios';index"`                      // 平台：ios 或 android
+	AppAccountToken string `json:"app_account_token" gorm:"not null;index;column:app_account_token"`                          // App Account Token (UUID 格式)
+	ProjectID       string `json:"project_id" gorm:"not null;index;index:idx_subscription_project_product_status,priority:1"` // 项目ID，关联到project表
+	Platform        string `json:"platform" gorm:"size:20;default:'ios';index"`                                               // 平台：ios 或 android
+	IsResolved      *bool  `json:"is_resolved" gorm:"default:true;index"`                                                     // app_account_token 是否已解析为 user_id（store_unresolved 策略下查询失败时为 false；nil 视为已解析）
+
+	// 未解析绑定的重试状态（后台任务）
+	ResolveAttempts int        `json:"resolve_attempts" gorm:"default:0"` // 已重试解析的次数
+	NextResolveAt   *time.Time `json:"next_resolve_at,omitempty"`         // 下次重试时间（指数退避），nil 表示尽快
 
 	// 订阅状态字段
-	Status string `json:"status" gorm:"not null;size:20;index"` // 订阅状态：active(激活)、inactive(未激活)、cancelled(已取消)、expired(过期)
+	Status string `json:"status" gorm:"not null;size:20;index;index:idx_subscription_project_product_status,priority:3"` // 订阅状态：active(激活)、inactive(未激活)、cancelled(已取消)、expired(过期)、superseded(被同一订阅组内更新的订阅取代)
 
 	// 订阅时间字段
 	StartDate time.Time `json:"start_date"` // 订阅开始时间
 	EndDate   time.Time `json:"end_date"`   // 订阅结束时间
 
 	// App Store / Google Play 相关字段
-	ProductID             string    `json:"product_id" gorm:"size:100"`                    // 产品ID
-	TransactionID         string    `json:"transaction_id" gorm:"size:100;uniqueIndex"`    // 交易ID
-	OriginalTransactionID string    `json:"original_transaction_id" gorm:"size:100;index"` // 原始交易ID
-	Environment           string    `json:"environment" gorm:"size:20"`                    // 环境：sandbox, production
-	PurchaseDate          time.Time `json:"purchase_date"`                                 // 购买日期
-	ExpiresDate           time.Time `json:"expires_date" gorm:"index"`                     // 过期日期
-	AutoRenewStatus       bool      `json:"auto_renew_status"`                             // 自动续费状态
+	ProductID             string    `json:"product_id" gorm:"size:100;index:idx_subscription_project_product_status,priority:2"`                                       // 产品ID
+	TransactionID         string    `json:"transaction_id" gorm:"size:100;uniqueIndex:idx_subscription_active_env_transaction_id,priority:1,where:deleted_at IS NULL"` // 交易ID（同一环境内、仅对未删除记录唯一）
+	OriginalTransactionID string    `json:"original_transaction_id" gorm:"size:100;index"`                                                                             // 原始交易ID
+	Environment           string    `json:"environment" gorm:"size:20;uniqueIndex:idx_subscription_active_env_transaction_id,priority:2,where:deleted_at IS NULL"`     // 环境：sandbox, production（sandbox 可能复用 production 的交易ID）
+	PurchaseDate          time.Time `json:"purchase_date"`                                                                                                             // 购买日期
+	ExpiresDate           time.Time `json:"expires_date" gorm:"index"`                                                                                                 // 过期日期
+	AutoRenewStatus       bool      `json:"auto_renew_status"`                                                                                                         // 自动续费状态
+	BillingPeriod         string    `json:"billing_period" gorm:"size:20"`                                                                                             // 计费周期（ISO 8601，如 P1W、P1M、P3M、P1Y）
+	SubscriptionGroupID   string    `json:"subscription_group_id,omitempty" gorm:"size:100;index"`                                                                     // Apple subscriptionGroupIdentifier，同一组内同一用户只有一个订阅有效（新档位取代旧档位）
+
+	// 续订信息（来自 Apple 通知的 signedRenewalInfo）
+	ExpirationIntent       int        `json:"expiration_intent,omitempty"`           // 到期原因：1=用户取消、2=扣费失败、3=未同意涨价、4=产品不可用、5=其他，0 表示未知/未到期
+	GracePeriodExpiresDate *time.Time `json:"grace_period_expires_date,omitempty"`   // 扣费失败后宽限期的结束时间
+	LastSubtype            string     `json:"last_subtype,omitempty" gorm:"size:50"` // 最近一次 Apple 通知的 subtype（如 UPGRADE、AUTO_RENEW_DISABLED、VOLUNTARY、BILLING_RETRY）
+
+	// 续订统计
+	RenewalCount             int    `json:"renewal_count" gorm:"default:0"` // 成功续订次数（每个 DID_RENEW 计一次，重新订阅时按配置继续或清零）
+	LastRenewalTransactionID string `json:"-" gorm:"size:100"`              // 最近一次计入续订次数的交易ID（防止重复计数）
 
 	// 收据相关字段（用于恢复购买）
 	LatestReceipt     string `json:"latest_receipt" gorm:"type:text"`      // 最新收据（iOS base64 或 Android token）
 	LatestReceiptInfo string `json:"latest_receipt_info" gorm:"type:text"` // 完整收据信息（JSON格式）
+
+	// 非持久化字段
+	StateChanged bool          `json:"-" gorm:"-"` // 本次 CreateOrUpdateSubscription 是否产生实质变化（用于决定是否触发 webhook）
+	Previous     *Subscription `json:"-" gorm:"-"` // CreateOrUpdateSubscription 更新前的已存储订阅（新建时为 nil）
+}
+
+// IsEntitled reports whether the subscription grants access at now
+// Only active, unexpired subscriptions are entitled. Refunded and revoked subscriptions never are,
+// even with a future expires_date (access ends at the refund, not at the end of the period)
+func (s *Subscription) IsEntitled(now time.Time) bool {
+	switch s.Status {
+	case "refunded", "revoked":
+		return false
+	case "active":
+		return s.ExpiresDate.After(now)
+	default:
+		return false
+	}
+}
+
+// IsBindingResolved reports whether app_account_token holds a resolved user_id
+func (s *Subscription) IsBindingResolved() bool {
+	return s.IsResolved == nil || *s.IsResolved
+}
+
+// SetResolved sets the is_resolved flag
+func (s *Subscription) SetResolved(resolved bool) {
+	s.IsResolved = &resolved
 }
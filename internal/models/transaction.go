@@ -10,12 +10,12 @@ type Transaction struct {
 	BaseModel
 
 	// 关联字段
-	ProjectID       string `json:"project_id" gorm:"not null;index"`       // 项目ID
-	AppAccountToken string `json:"app_account_token" gorm:"size:36;index"` // App Account Token (UUID)
+	ProjectID       string `json:"project_id" gorm:"not null;index;uniqueIndex:idx_transactions_active_project_transaction_id,priority:1,where:deleted_at IS NULL"` // 项目ID
+	AppAccountToken string `json:"app_account_token" gorm:"size:36;index"`                                                                                          // App Account Token (UUID)
 
 	// 交易标识
-	TransactionID         string `json:"transaction_id" gorm:"not null;size:100;uniqueIndex"` // 交易ID
-	OriginalTransactionID string `json:"original_transaction_id" gorm:"size:100;index"`       // 原始交易ID（用于关联续订）
+	TransactionID         string `json:"transaction_id" gorm:"not null;size:100;uniqueIndex:idx_transactions_active_project_transaction_id,priority:2,where:deleted_at IS NULL"` // 交易ID（同一项目内、仅对未删除记录唯一）
+	OriginalTransactionID string `json:"original_transaction_id" gorm:"size:100;index"`                                                                                          // 原始交易ID（用于关联续订）
 
 	// 产品信息
 	ProductID string `json:"product_id" gorm:"size:100"` // 产品ID
@@ -28,6 +28,9 @@ type Transaction struct {
 
 	// 时间
 	PurchasedAt time.Time `json:"purchased_at"` // 购买时间
+
+	// Android 购买凭证
+	PurchaseToken string `json:"purchase_token,omitempty" gorm:"type:text"` // Google Play purchase token
 }
 
 // TableName 指定表名
@@ -0,0 +1,19 @@
+package models
+
+// WebhookDelivery App Backend webhook 投递记录
+// 每次投递结束（成功或重试全部失败）时写入一条，保存原始 payload 以便人工重新投递
+type WebhookDelivery struct {
+	BaseModel
+
+	ProjectID     string `json:"project_id" gorm:"not null;index:idx_webhook_delivery_project_created,priority:1"` // 项目ID
+	EventID       string `json:"event_id" gorm:"size:64;index"`                                                    // 事件ID（payload 的 event_id / X-UnionHub-Event-Id，重试和重新投递时不变）
+	Event         string `json:"event" gorm:"size:50"`                                                             // 事件类型，如 subscription.updated
+	TransactionID string `json:"transaction_id" gorm:"size:255;index"`                                             // payload 中的交易ID
+	URL           string `json:"url" gorm:"type:varchar(500)"`                                                     // 最后一次尝试的地址
+	Environment   string `json:"environment" gorm:"size:20"`                                                       // 订阅环境（用于重新投递时选择地址）
+	StatusCode    int    `json:"status_code"`                                                                      // 最后一次尝试的 HTTP 状态码（无响应为 0）
+	Attempts      int    `json:"attempts"`                                                                         // 尝试次数
+	LastError     string `json:"last_error" gorm:"type:text"`                                                      // 最后一次失败的错误信息
+	Succeeded     bool   `json:"succeeded" gorm:"index"`                                                           // 是否投递成功
+	Payload       string `json:"payload" gorm:"type:text"`                                                         // 投递的 payload（JSON）
+}
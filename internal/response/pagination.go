@@ -0,0 +1,72 @@
+package response
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Default and maximum page size of list endpoints
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 200
+)
+
+// Pagination describes the page of a list response
+type Pagination struct {
+	Limit   int   `json:"limit"`
+	Offset  int   `json:"offset"`
+	Total   int64 `json:"total"`
+	HasMore bool  `json:"has_more"`
+}
+
+// PaginatedResponse represents a standard list response
+type PaginatedResponse struct {
+	Success    bool        `json:"success"`
+	Data       interface{} `json:"data"`
+	Pagination Pagination  `json:"pagination"`
+}
+
+// ParsePagination reads limit / offset from the query (limit defaults to 50, max 200)
+// The older page / page_size parameters are still accepted when limit / offset are absent
+func ParsePagination(c *gin.Context) (limit, offset int) {
+	limit, offset = DefaultPageLimit, 0
+	if value := c.Query("limit"); value != "" {
+		limit, _ = strconv.Atoi(value)
+	} else if value := c.Query("page_size"); value != "" {
+		limit, _ = strconv.Atoi(value)
+	}
+	if limit < 1 || limit > MaxPageLimit {
+		limit = DefaultPageLimit
+	}
+
+	if value := c.Query("offset"); value != "" {
+		offset, _ = strconv.Atoi(value)
+	} else if page, _ := strconv.Atoi(c.Query("page")); page > 1 {
+		offset = (page - 1) * limit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// Paginated returns a list response for one page of total items
+func Paginated(data interface{}, limit, offset int, total int64) PaginatedResponse {
+	return PaginatedResponse{
+		Success: true,
+		Data:    data,
+		Pagination: Pagination{
+			Limit:   limit,
+			Offset:  offset,
+			Total:   total,
+			HasMore: int64(offset+limit) < total,
+		},
+	}
+}
+
+// PaginatedJSON sends a list JSON response
+func PaginatedJSON(c *gin.Context, data interface{}, limit, offset int, total int64) {
+	c.JSON(http.StatusOK, Paginated(data, limit, offset, total))
+}
@@ -10,6 +10,7 @@ import (
 type Response struct {
 	Success bool        `json:"success"`
 	Message string      `json:"message"`
+	Code    string      `json:"code,omitempty"` // Error code, e.g. PROJECT_INACTIVE
 	Data    interface{} `json:"data,omitempty"`
 }
 
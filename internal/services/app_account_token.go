@@ -0,0 +1,142 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"verification-api/internal/models"
+	"verification-api/pkg/logging"
+)
+
+// appAccountToken resolution policies (when the App Backend lookup fails)
+const (
+	TokenResolutionFallbackToToken = "fallback_to_token" // 使用 appAccountToken 作为 user_id（默认）
+	TokenResolutionStoreUnresolved = "store_unresolved"  // 使用 appAccountToken 保存并标记 is_resolved=false，后续重试解析
+	TokenResolutionReject          = "reject"            // 丢弃该通知 / 验证请求
+)
+
+// ErrAppAccountTokenUnresolved is returned by ResolveAppAccountToken under the reject policy
+var ErrAppAccountTokenUnresolved = errors.New("appAccountToken could not be resolved to a user_id")
+
+// IsValidTokenResolutionPolicy reports whether the policy is supported (empty means fallback_to_token)
+func IsValidTokenResolutionPolicy(policy string) bool {
+	switch policy {
+	case "", TokenResolutionFallbackToToken, TokenResolutionStoreUnresolved, TokenResolutionReject:
+		return true
+	}
+	return false
+}
+
+// ResolveAppAccountToken resolves an appAccountToken to the App Backend's device_id (user_id)
+// appAccountToken is a UUID set by the client during purchase; the App Backend (derived from
+// the project's webhook callback URL) maps it to a device_id. Without a callback URL the token
+// itself is the user_id.
+// Returns the user_id to store and whether it is resolved. When the lookup fails the project's
+// token_resolution_policy applies: the token is used as is (fallback_to_token), used but marked
+// unresolved (store_unresolved), or ErrAppAccountTokenUnresolved is returned (reject)
+func ResolveAppAccountToken(project *models.Project, appAccountToken string) (string, bool, error) {
+	if appAccountToken == "" || project.WebhookCallbackURL == "" {
+		return appAccountToken, true, nil
+	}
+
+	deviceID, err := QueryDeviceID(project, appAccountToken)
+	if err == nil {
+		logging.Infof("Resolved device_id from appAccountToken - AppAccountToken: %s, DeviceID: %s", appAccountToken, deviceID)
+		return deviceID, true, nil
+	}
+
+	switch project.TokenResolutionPolicy {
+	case TokenResolutionStoreUnresolved:
+		logging.Warnf("Failed to query device_id from App Backend: %v, storing appAccountToken as unresolved user_id", err)
+		return appAccountToken, false, nil
+	case TokenResolutionReject:
+		logging.Warnf("Failed to query device_id from App Backend: %v, rejecting (token_resolution_policy: reject)", err)
+		return "", false, ErrAppAccountTokenUnresolved
+	default:
+		// Fallback: use appAccountToken as user_id (UUID format)
+		// This is acceptable as appAccountToken is already a UUID
+		logging.Infof("Failed to query device_id from App Backend: %v, will use appAccountToken (UUID) as user_id", err)
+		return appAccountToken, true, nil
+	}
+}
+
+// QueryDeviceID queries the project's App Backend for the device_id of an appAccountToken
+func QueryDeviceID(project *models.Project, appAccountToken string) (string, error) {
+	// Extract base URL from webhook callback URL (e.g., https://api.example.com/webhooks/unionhub -> https://api.example.com)
+	baseURL := extractBaseURL(project.WebhookCallbackURL)
+	if baseURL == "" {
+		return "", fmt.Errorf("no App Backend base URL for project %s", project.ProjectID)
+	}
+	deviceID, err := queryDeviceIDFromAppBackend(baseURL, appAccountToken)
+	if err != nil {
+		return "", err
+	}
+	if deviceID == "" {
+		return "", fmt.Errorf("empty device_id in response")
+	}
+	return deviceID, nil
+}
+
+// extractBaseURL extracts base URL from webhook callback URL
+// e.g., https://api.example.com/webhooks/unionhub -> https://api.example.com
+func extractBaseURL(webhookURL string) string {
+	// Simple extraction: remove /webhooks/unionhub or similar paths
+	if strings.Contains(webhookURL, "/webhooks/") {
+		parts := strings.Split(webhookURL, "/webhooks/")
+		if len(parts) > 0 {
+			return parts[0]
+		}
+	}
+	// If no /webhooks/ found, try to extract base URL by removing last path segment
+	lastSlash := strings.LastIndex(webhookURL, "/")
+	if lastSlash > 0 {
+		// Find the protocol part (http:// or https://)
+		protocolEnd := strings.Index(webhookURL, "://")
+		if protocolEnd > 0 {
+			// Find the next slash after protocol
+			pathStart := strings.Index(webhookURL[protocolEnd+3:], "/")
+			if pathStart > 0 {
+				return webhookURL[:protocolEnd+3+pathStart]
+			}
+		}
+		return webhookURL[:lastSlash]
+	}
+	return webhookURL
+}
+
+// queryDeviceIDFromAppBackend queries App Backend to get device_id from app_account_token
+func queryDeviceIDFromAppBackend(baseURL, appAccountToken string) (string, error) {
+	url := fmt.Sprintf("%s/api/app-account-token/device-id?app_account_token=%s", baseURL, appAccountToken)
+
+	client := NewWebhookHTTPClient(5 * time.Second)
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("failed to query app backend: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("app backend returned status %d", resp.StatusCode)
+	}
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if success, ok := result["success"].(bool); !ok || !success {
+		return "", fmt.Errorf("App Backend query failed")
+	}
+
+	if data, ok := result["data"].(map[string]interface{}); ok {
+		if deviceID, ok := data["device_id"].(string); ok {
+			return deviceID, nil
+		}
+	}
+
+	return "", fmt.Errorf("device_id not found in response")
+}
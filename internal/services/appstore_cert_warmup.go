@@ -0,0 +1,28 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// Warmup 预热证书缓存：解析受信任的 Apple 根证书并写入缓存
+// x5c 链中的根证书之后直接命中缓存，避免部署后首个通知的解析开销
+func (v *SignatureVerifier) Warmup() error {
+	// x5c 中的证书为 base64 DER（无 PEM 头尾），按相同格式作为缓存键
+	roots := appleRoots().certs
+	chain := make([]string, 0, len(roots))
+	for _, root := range roots {
+		chain = append(chain, base64.StdEncoding.EncodeToString(root.Raw))
+	}
+	if _, err := v.getCertificateChain(chain); err != nil {
+		return fmt.Errorf("failed to cache Apple root certificates: %w", err)
+	}
+
+	v.warmedUp.Store(true)
+	return nil
+}
+
+// IsWarmedUp 是否已完成证书缓存预热
+func (v *SignatureVerifier) IsWarmedUp() bool {
+	return v.warmedUp.Load()
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"time"
+	"verification-api/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// oidAppleLeafCertificate App Store 签名叶子证书扩展 OID
+	oidAppleLeafCertificate = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 11, 1}
+	// oidAppleIntermediateCertificate Apple WWDR 中间证书扩展 OID
+	oidAppleIntermediateCertificate = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 2, 1}
+)
+
+// VerifyJWS 验证 Apple 签名的 JWS（signedPayload / signedTransactionInfo 等）
+// 从 x5c 头部提取证书链，校验至 Apple 根证书，并验证 ES256 签名
+// 验证通过后返回 JWS 中的 claims
+func (v *SignatureVerifier) VerifyJWS(signedPayload string) (jwt.MapClaims, error) {
+	if signedPayload == "" {
+		return nil, fmt.Errorf("empty JWS")
+	}
+
+	claims := jwt.MapClaims{}
+	// Apple 只使用 ES256，显式限定算法以防止算法混淆（alg: none / HS256 等）
+	parser := jwt.NewParser(jwt.WithoutClaimsValidation(), jwt.WithValidMethods([]string{AppleJWSAlgorithm}))
+	_, err := parser.ParseWithClaims(signedPayload, claims, func(token *jwt.Token) (interface{}, error) {
+		certChain, err := v.extractX5CChain(token)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := v.verifyJWSCertificateChain(certChain); err != nil {
+			return nil, fmt.Errorf("failed to verify certificate chain: %w", err)
+		}
+
+		publicKey, ok := certChain[0].PublicKey.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("certificate does not contain ECDSA public key")
+		}
+		return publicKey, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify JWS: %w", err)
+	}
+
+	// 首个验证通过的通知之后，整条证书链都已缓存
+	v.warmedUp.Store(true)
+	return claims, nil
+}
+
+// clientJWSVerifier 验证客户端提交的 StoreKit 2 jwsRepresentation（APPSTORE_LOCAL_JWS_VERIFICATION）
+var clientJWSVerifier = NewSignatureVerifier()
+
+// verifyClientSignedTransaction 在本地验证客户端的 signed_transaction（Transaction.jwsRepresentation）
+// 签名需校验至 Apple 根证书，且 bundleId 必须与项目一致（防止提交其他 App 的交易）
+func verifyClientSignedTransaction(signedTransaction, expectedBundleID string) error {
+	claims, err := clientJWSVerifier.VerifyJWS(signedTransaction)
+	if err != nil {
+		return err
+	}
+	bundleID, _ := claims["bundleId"].(string)
+	if expectedBundleID == "" || bundleID != expectedBundleID {
+		return fmt.Errorf("bundleId %q does not match the project's bundle_id %q", bundleID, expectedBundleID)
+	}
+	return nil
+}
+
+// isStaleClientTransaction 判断本地验证的 signed_transaction 是否比已存储的订阅旧
+// jwsRepresentation 签发后永久有效：退款 / 续订之前签发的 JWS 仍能通过验证，
+// 不能用它把已退款的订阅改回 active，或把 transaction_id / expires_date 回滚
+func isStaleClientTransaction(stored, incoming *models.Subscription) bool {
+	if stored == nil {
+		return false
+	}
+	switch stored.Status {
+	case "refunded", "revoked":
+		return true
+	}
+	return stored.PurchaseDate.After(incoming.PurchaseDate) || stored.ExpiresDate.After(incoming.ExpiresDate)
+}
+
+// DecodeUnverifiedJWS 解析 JWS 的 claims 但不验证签名（仅检查 alg）
+// 仅用于 sandbox 测试时的回退（APPSTORE_SANDBOX_SKIP_SIGNATURE），生产环境必须使用 VerifyJWS
+func DecodeUnverifiedJWS(signedPayload string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	if err := decodeJWSPayload(signedPayload, &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// extractX5CChain 从 JWS 头部的 x5c 字段中解析证书链（叶子证书在前）
+func (v *SignatureVerifier) extractX5CChain(token *jwt.Token) ([]*x509.Certificate, error) {
+	rawChain, ok := token.Header["x5c"].([]interface{})
+	if !ok || len(rawChain) == 0 {
+		return nil, fmt.Errorf("missing x5c header")
+	}
+
+	chain := make([]string, 0, len(rawChain))
+	for i, raw := range rawChain {
+		cert, ok := raw.(string)
+		if !ok || cert == "" {
+			return nil, fmt.Errorf("invalid x5c entry at index %d", i)
+		}
+		chain = append(chain, cert)
+	}
+
+	return v.getCertificateChain(chain)
+}
+
+// verifyJWSCertificateChain 校验 x5c 证书链是否由 Apple 根证书签发
+// x5c 顺序为：叶子证书、中间证书、根证书
+func (v *SignatureVerifier) verifyJWSCertificateChain(certChain []*x509.Certificate) error {
+	if len(certChain) < 2 {
+		return fmt.Errorf("certificate chain too short: %d", len(certChain))
+	}
+
+	leaf := certChain[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range certChain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         appleRoots().pool,
+		Intermediates: intermediates,
+		CurrentTime:   time.Now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return err
+	}
+
+	// 检查 Apple 专用扩展，防止使用其他 Apple 证书签名
+	if !hasExtension(leaf, oidAppleLeafCertificate) {
+		return fmt.Errorf("leaf certificate is not an App Store signing certificate")
+	}
+	if !hasExtension(certChain[1], oidAppleIntermediateCertificate) {
+		return fmt.Errorf("intermediate certificate is not an Apple WWDR certificate")
+	}
+
+	return nil
+}
+
+// hasExtension 检查证书是否包含指定 OID 的扩展
+func hasExtension(cert *x509.Certificate, oid asn1.ObjectIdentifier) bool {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"verification-api/internal/config"
+	"verification-api/pkg/logging"
+)
+
+// AppleJWSAlgorithm is the only signing algorithm used by Apple for App Store JWS
+const AppleJWSAlgorithm = "ES256"
+
+// CheckJWSAlgorithm returns an error unless the JWS header declares alg ES256
+// Rejecting every other alg (especially "none") prevents algorithm-confusion attacks
+func CheckJWSAlgorithm(jws string) error {
+	header, _, ok := strings.Cut(jws, ".")
+	if !ok {
+		return fmt.Errorf("invalid JWS format")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(header)
+	if err != nil {
+		return fmt.Errorf("failed to decode JWS header: %w", err)
+	}
+	var h struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(data, &h); err != nil {
+		return fmt.Errorf("failed to parse JWS header: %w", err)
+	}
+	if h.Alg != AppleJWSAlgorithm {
+		return fmt.Errorf("unexpected JWS alg %q (expected %s)", h.Alg, AppleJWSAlgorithm)
+	}
+	return nil
+}
+
+// EnforceJWSAlgorithm checks the alg of a JWS that is decoded without signature verification
+// In strict mode (APPLE_JWS_STRICT_ALG, default) a non-ES256 alg is an error, otherwise it is only logged
+// VerifyJWS always requires ES256 regardless of this setting
+func EnforceJWSAlgorithm(jws string) error {
+	err := CheckJWSAlgorithm(jws)
+	if err == nil {
+		return nil
+	}
+	if config.AppConfig == nil || config.AppConfig.AppleJWSStrictAlg {
+		return err
+	}
+	logging.Warnf("Accepting JWS with unexpected algorithm (APPLE_JWS_STRICT_ALG=false): %v", err)
+	return nil
+}
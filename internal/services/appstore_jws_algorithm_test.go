@@ -0,0 +1,50 @@
+package services
+
+import (
+	"encoding/base64"
+	"testing"
+	"verification-api/internal/config"
+)
+
+// testJWS builds a JWS with the given header; payload and signature are placeholders
+func testJWS(header string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(header)) + ".e30.c2ln"
+}
+
+func TestEnforceJWSAlgorithm(t *testing.T) {
+	tests := []struct {
+		name       string
+		jws        string
+		wantCheck  bool // CheckJWSAlgorithm accepts
+		wantStrict bool // EnforceJWSAlgorithm accepts with APPLE_JWS_STRICT_ALG=true
+		wantLax    bool // EnforceJWSAlgorithm accepts with APPLE_JWS_STRICT_ALG=false
+	}{
+		{"ES256", testJWS(`{"alg":"ES256","x5c":[]}`), true, true, true},
+		{"none", testJWS(`{"alg":"none"}`), false, false, true},
+		{"HS256", testJWS(`{"alg":"HS256"}`), false, false, true},
+		{"lowercase es256", testJWS(`{"alg":"es256"}`), false, false, true},
+		{"missing alg", testJWS(`{}`), false, false, true},
+		{"malformed header", "not-base64!.e30.c2ln", false, false, true},
+	}
+
+	original := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = original })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckJWSAlgorithm(tt.jws); (err == nil) != tt.wantCheck {
+				t.Errorf("CheckJWSAlgorithm() error = %v, want accepted %v", err, tt.wantCheck)
+			}
+
+			config.AppConfig = &config.Config{AppleJWSStrictAlg: true}
+			if err := EnforceJWSAlgorithm(tt.jws); (err == nil) != tt.wantStrict {
+				t.Errorf("strict EnforceJWSAlgorithm() error = %v, want accepted %v", err, tt.wantStrict)
+			}
+
+			config.AppConfig = &config.Config{AppleJWSStrictAlg: false}
+			if err := EnforceJWSAlgorithm(tt.jws); (err == nil) != tt.wantLax {
+				t.Errorf("lax EnforceJWSAlgorithm() error = %v, want accepted %v", err, tt.wantLax)
+			}
+		})
+	}
+}
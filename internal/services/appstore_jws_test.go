@@ -0,0 +1,33 @@
+package services
+
+import (
+	"testing"
+	"time"
+	"verification-api/internal/models"
+)
+
+func TestIsStaleClientTransaction(t *testing.T) {
+	purchase := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	incoming := &models.Subscription{Status: "active", PurchaseDate: purchase, ExpiresDate: purchase.AddDate(0, 1, 0)}
+
+	tests := []struct {
+		name   string
+		stored *models.Subscription
+		want   bool
+	}{
+		{"no stored subscription", nil, false},
+		{"same transaction", &models.Subscription{Status: "active", PurchaseDate: purchase, ExpiresDate: purchase.AddDate(0, 1, 0)}, false},
+		{"older stored transaction", &models.Subscription{Status: "expired", PurchaseDate: purchase.AddDate(0, -1, 0), ExpiresDate: purchase}, false},
+		{"stored refunded", &models.Subscription{Status: "refunded", PurchaseDate: purchase, ExpiresDate: purchase.AddDate(0, 1, 0)}, true},
+		{"stored revoked", &models.Subscription{Status: "revoked", PurchaseDate: purchase, ExpiresDate: purchase.AddDate(0, 1, 0)}, true},
+		{"stored renewal", &models.Subscription{Status: "active", PurchaseDate: purchase.AddDate(0, 1, 0), ExpiresDate: purchase.AddDate(0, 2, 0)}, true},
+		{"stored later expiry", &models.Subscription{Status: "active", PurchaseDate: purchase, ExpiresDate: purchase.AddDate(0, 2, 0)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isStaleClientTransaction(tt.stored, incoming); got != tt.want {
+				t.Errorf("isStaleClientTransaction() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
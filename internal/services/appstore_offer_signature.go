@@ -0,0 +1,77 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+	"verification-api/internal/config"
+)
+
+// offerSignatureSeparator Apple 规定的字段分隔符（U+2063 INVISIBLE SEPARATOR）
+const offerSignatureSeparator = "\u2063"
+
+// PromotionalOfferSignature 推介促销优惠签名（用于 SKPaymentDiscount / Product.SubscriptionOffer）
+type PromotionalOfferSignature struct {
+	KeyID     string
+	Nonce     string // 小写 UUID
+	Timestamp int64  // 毫秒
+	Signature string // base64 编码的 DER ECDSA 签名
+}
+
+// GeneratePromotionalOfferSignature 使用 App Store 私钥生成推介促销优惠签名
+// 签名内容：bundleID + keyID + productID + offerID + appAccountToken + nonce + timestamp（以 U+2063 分隔）
+func GeneratePromotionalOfferSignature(bundleID, productID, offerID, appAccountToken string) (*PromotionalOfferSignature, error) {
+	keyID := config.AppConfig.AppStoreKeyID
+	if keyID == "" {
+		return nil, fmt.Errorf("App Store API credentials not configured")
+	}
+
+	key, err := loadAppStorePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := newUUIDv4()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	timestamp := time.Now().UnixMilli()
+
+	payload := strings.Join([]string{
+		bundleID,
+		keyID,
+		productID,
+		offerID,
+		strings.ToLower(appAccountToken),
+		nonce,
+		fmt.Sprintf("%d", timestamp),
+	}, offerSignatureSeparator)
+
+	hash := sha256.Sum256([]byte(payload))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign offer: %w", err)
+	}
+
+	return &PromotionalOfferSignature{
+		KeyID:     keyID,
+		Nonce:     nonce,
+		Timestamp: timestamp,
+		Signature: base64.StdEncoding.EncodeToString(signature),
+	}, nil
+}
+
+// newUUIDv4 生成小写的随机 UUID（version 4）
+func newUUIDv4() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
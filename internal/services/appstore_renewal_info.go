@@ -0,0 +1,101 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// appStoreLastTransaction is the latest transaction of a subscription in the App Store subscription status response
+type appStoreLastTransaction struct {
+	OriginalTransactionID string `json:"originalTransactionId"`
+	SignedTransactionInfo string `json:"signedTransactionInfo"`
+	SignedRenewalInfo     string `json:"signedRenewalInfo"`
+}
+
+// fetchLastTransaction queries the App Store Server API subscription status endpoint
+// and returns the latest transaction of the subscription
+// GET /inApps/v1/subscriptions/{originalTransactionId}
+func (s *SubscriptionVerificationService) fetchLastTransaction(baseURL, authToken, originalTransactionID string) (*appStoreLastTransaction, error) {
+	if err := s.waitStoreAPI(appStoreAPILimiter); err != nil {
+		return nil, fmt.Errorf("App Store API rate limit wait aborted: %w", err)
+	}
+
+	apiURL := fmt.Sprintf("%s/inApps/v1/subscriptions/%s", baseURL, originalTransactionID)
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call App Store Server API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("App Store Server API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var statusResp struct {
+		Data []struct {
+			LastTransactions []appStoreLastTransaction `json:"lastTransactions"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &statusResp); err != nil {
+		return nil, fmt.Errorf("failed to parse subscription status response: %w", err)
+	}
+
+	for _, group := range statusResp.Data {
+		for i := range group.LastTransactions {
+			if group.LastTransactions[i].OriginalTransactionID == originalTransactionID {
+				return &group.LastTransactions[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no subscription status for original transaction %s", originalTransactionID)
+}
+
+// fetchAutoRenewStatus returns autoRenewStatus from the signedRenewalInfo of the subscription
+func (s *SubscriptionVerificationService) fetchAutoRenewStatus(baseURL, authToken, originalTransactionID string) (bool, error) {
+	last, err := s.fetchLastTransaction(baseURL, authToken, originalTransactionID)
+	if err != nil {
+		return false, err
+	}
+	if last.SignedRenewalInfo == "" {
+		return false, fmt.Errorf("no renewal info for original transaction %s", originalTransactionID)
+	}
+
+	var renewalInfo struct {
+		AutoRenewStatus int `json:"autoRenewStatus"` // 1 = 自动续订开启，0 = 已关闭
+	}
+	if err := decodeJWSPayload(last.SignedRenewalInfo, &renewalInfo); err != nil {
+		return false, fmt.Errorf("failed to parse signedRenewalInfo: %w", err)
+	}
+	return renewalInfo.AutoRenewStatus == 1, nil
+}
+
+// decodeJWSPayload decodes the payload of a JWS (header.payload.signature) without verifying it
+// Only used for responses fetched from the App Store Server API over TLS
+func decodeJWSPayload(jws string, v interface{}) error {
+	if err := EnforceJWSAlgorithm(jws); err != nil {
+		return err
+	}
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("invalid JWT format: expected 3 parts, got %d", len(parts))
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fmt.Errorf("failed to decode JWT payload: %w", err)
+	}
+	return json.Unmarshal(payload, v)
+}
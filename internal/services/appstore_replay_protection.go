@@ -10,29 +10,46 @@ import (
 )
 
 // ReplayProtection 重放攻击防护
+// 配置 Redis 时记录保存在 Redis 中（多副本共享、重启不丢失），Redis 出错时回退到内存记录
 type ReplayProtection struct {
+	redis                  *RedisService // nil 表示仅使用内存
 	processedNotifications map[string]time.Time
 	mutex                  sync.RWMutex
 	cleanupInterval        time.Duration
 	notificationTTL        time.Duration
-	stopCleanup            chan bool
+
+	// 清理协程生命周期：Start / Stop 均可重复调用
+	startOnce   sync.Once
+	stopOnce    sync.Once
+	stopCleanup chan struct{}
+	cleanupDone chan struct{}
 }
 
 // NewReplayProtection 创建重放攻击防护实例
-func NewReplayProtection() *ReplayProtection {
+// redis 为 nil 时使用内存记录（仅对当前实例有效）
+func NewReplayProtection(redis *RedisService) *ReplayProtection {
 	rp := &ReplayProtection{
+		redis:                  redis,
 		processedNotifications: make(map[string]time.Time),
 		cleanupInterval:        time.Hour,      // 每小时清理一次
 		notificationTTL:        time.Hour * 24, // 通知记录保存24小时
-		stopCleanup:            make(chan bool),
+		stopCleanup:            make(chan struct{}),
+		cleanupDone:            make(chan struct{}),
 	}
 
 	// 启动清理协程
-	go rp.startCleanupRoutine()
+	rp.Start()
 
 	return rp
 }
 
+// Start 启动清理协程（重复调用无效果）
+func (rp *ReplayProtection) Start() {
+	rp.startOnce.Do(func() {
+		go rp.startCleanupRoutine()
+	})
+}
+
 // IsReplay 检查是否为重放攻击
 // 返回 true 如果是重放，false 如果不是
 func (rp *ReplayProtection) IsReplay(notificationUUID string, timestamp int64) bool {
@@ -42,12 +59,26 @@ func (rp *ReplayProtection) IsReplay(notificationUUID string, timestamp int64) b
 		return false
 	}
 
-	rp.mutex.Lock()
-	defer rp.mutex.Unlock()
-
 	// 生成通知的唯一标识符
 	notificationID := rp.generateNotificationID(notificationUUID, timestamp)
 
+	// Redis：SET NX 原子地检查并记录，多副本共享
+	if rp.redis != nil {
+		recorded, err := rp.redis.RecordNotification(notificationID, rp.notificationTTL)
+		if err == nil {
+			if !recorded {
+				logging.Infof("Replay detected - notification_id: %s (redis)", notificationID)
+				return true
+			}
+			logging.Infof("New notification recorded - notification_id: %s", notificationID)
+			return false
+		}
+		logging.Warnf("Replay protection Redis error, falling back to memory - notification_id: %s, error: %v", notificationID, err)
+	}
+
+	rp.mutex.Lock()
+	defer rp.mutex.Unlock()
+
 	// 检查是否已处理过
 	if processedTime, exists := rp.processedNotifications[notificationID]; exists {
 		logging.Infof("Replay detected - notification_id: %s, previously processed at: %v", notificationID, processedTime)
@@ -61,6 +92,26 @@ func (rp *ReplayProtection) IsReplay(notificationUUID string, timestamp int64) b
 	return false
 }
 
+// Release 撤销 IsReplay 的记录，使 Apple 的重试能再次被处理
+// IsReplay 在处理之前就记录了通知，处理失败（返回 5xx）时必须调用，否则重试会在 24 小时内都被当作重放拒绝
+func (rp *ReplayProtection) Release(notificationUUID string, timestamp int64) {
+	if notificationUUID == "" {
+		return
+	}
+	notificationID := rp.generateNotificationID(notificationUUID, timestamp)
+
+	if rp.redis != nil {
+		if err := rp.redis.ForgetNotification(notificationID); err != nil {
+			logging.Errorf("Failed to release replay record - notification_id: %s, error: %v", notificationID, err)
+		}
+	}
+
+	rp.mutex.Lock()
+	delete(rp.processedNotifications, notificationID)
+	rp.mutex.Unlock()
+	logging.Infof("Replay record released for retry - notification_id: %s", notificationID)
+}
+
 // generateNotificationID 生成通知的唯一标识符
 func (rp *ReplayProtection) generateNotificationID(notificationUUID string, timestamp int64) string {
 	// 使用 SHA256 哈希生成唯一标识符
@@ -71,6 +122,8 @@ func (rp *ReplayProtection) generateNotificationID(notificationUUID string, time
 
 // startCleanupRoutine 启动清理协程
 func (rp *ReplayProtection) startCleanupRoutine() {
+	defer close(rp.cleanupDone)
+
 	ticker := time.NewTicker(rp.cleanupInterval)
 	defer ticker.Stop()
 
@@ -105,11 +158,17 @@ func (rp *ReplayProtection) cleanup() {
 }
 
 // GetStats 获取统计信息
+// 使用 Redis 时 total_processed 只统计回退到内存的记录
 func (rp *ReplayProtection) GetStats() map[string]interface{} {
 	rp.mutex.RLock()
 	defer rp.mutex.RUnlock()
 
+	store := "memory"
+	if rp.redis != nil {
+		store = "redis"
+	}
 	return map[string]interface{}{
+		"store":            store,
 		"total_processed":  len(rp.processedNotifications),
 		"cleanup_interval": rp.cleanupInterval.String(),
 		"notification_ttl": rp.notificationTTL.String(),
@@ -124,8 +183,26 @@ func (rp *ReplayProtection) Clear() {
 	rp.processedNotifications = make(map[string]time.Time)
 }
 
-// Stop 停止清理协程
-func (rp *ReplayProtection) Stop() {
-	close(rp.stopCleanup)
+// Stop 停止清理协程并等待其退出（最多等待 timeout）
+// 可重复调用；未启动时直接返回
+func (rp *ReplayProtection) Stop(timeout time.Duration) {
+	rp.stopOnce.Do(func() {
+		close(rp.stopCleanup)
+	})
+
+	// 未启动过：标记启动已完成，确保之后的 Start 不会再启动
+	started := true
+	rp.startOnce.Do(func() {
+		started = false
+	})
+	if !started {
+		return
+	}
+
+	select {
+	case <-rp.cleanupDone:
+	case <-time.After(timeout):
+		logging.Warnf("Replay protection cleanup routine did not stop within %v", timeout)
+	}
 }
 
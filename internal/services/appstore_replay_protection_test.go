@@ -0,0 +1,27 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplayProtectionRelease(t *testing.T) {
+	rp := NewReplayProtection(nil)
+	defer rp.Stop(time.Second)
+
+	if rp.IsReplay("uuid-1", 1700000000000) {
+		t.Fatal("first delivery reported as replay")
+	}
+	if !rp.IsReplay("uuid-1", 1700000000000) {
+		t.Fatal("second delivery not reported as replay")
+	}
+
+	// A failed attempt releases the record so Apple's retry is processed
+	rp.Release("uuid-1", 1700000000000)
+	if rp.IsReplay("uuid-1", 1700000000000) {
+		t.Error("retry after Release reported as replay")
+	}
+	if !rp.IsReplay("uuid-1", 1700000000000) {
+		t.Error("delivery after the successful retry not reported as replay")
+	}
+}
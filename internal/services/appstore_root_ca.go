@@ -0,0 +1,131 @@
+package services
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+	"verification-api/internal/config"
+	"verification-api/pkg/logging"
+)
+
+// appleRootCAG3PEM Apple Root CA - G3 证书
+// App Store Server Notifications V2 及 StoreKit 2 的 JWS 签名证书链均以此为根
+// 来源: https://www.apple.com/certificateauthority/AppleRootCA-G3.cer
+const appleRootCAG3PEM = `-----BEGIN CERTIFICATE-----
+MIICQzCCAcmgAwIBAgIILcX8iNLFS5UwCgYIKoZIzj0EAwMwZzEbMBkGA1UEAwwS
+QXBwbGUgUm9vdCBDQSAtIEczMSYwJAYDVQQLDB1BcHBsZSBDZXJ0aWZpY2F0aW9u
+IEF1dGhvcml0eTETMBEGA1UECgwKQXBwbGUgSW5jLjELMAkGA1UEBhMCVVMwHhcN
+MTQwNDMwMTgxOTA2WhcNMzkwNDMwMTgxOTA2WjBnMRswGQYDVQQDDBJBcHBsZSBS
+b290IENBIC0gRzMxJjAkBgNVBAsMHUFwcGxlIENlcnRpZmljYXRpb24gQXV0aG9y
+aXR5MRMwEQYDVQQKDApBcHBsZSBJbmMuMQswCQYDVQQGEwJVUzB2MBAGByqGSM49
+AgEGBSuBBAAiA2IABJjpLz1AcqTtkyJygRMc3RCV8cWjTnHcFBbZDuWmBSp3ZHtf
+TjjTuxxEtX/1H7YyYl3J6YRbTzBPEVoA/VhYDKX1DyxNB0cTddqXl5dvMVztK517
+IDvYuVTZXpmkOlEKMaNCMEAwHQYDVR0OBBYEFLuw3qFYM4iapIqZ3r6966/ayySr
+MA8GA1UdEwEB/wQFMAMBAf8wDgYDVR0PAQH/BAQDAgEGMAoGCCqGSM49BAMDA2gA
+MGUCMQCD6cHEFl4aXTQY2e3v9GwOAEZLuN+yRhHFD/3meoyhpmvOwgPUnPWTxnS4
+at+qIxUCMG1mihDK1A3UT82NQz60imOlM27jbdoXt2QfyFMm+YhidDkLF1vLUagM
+6BgD56KyKA==
+-----END CERTIFICATE-----`
+
+// appleRootSet 受信任的 Apple 根证书及对应的证书池
+type appleRootSet struct {
+	certs []*x509.Certificate
+	pool  *x509.CertPool
+}
+
+// trustedAppleRoots 当前受信任的 Apple 根证书（内置 G3 + APPLE_ROOT_CERT_PATH / APPLE_ROOT_CERT_PEM）
+// 未调用 LoadAppleRootCertificates 时仅包含内置根证书
+var trustedAppleRoots atomic.Pointer[appleRootSet]
+
+// LoadAppleRootCertificates 加载额外配置的 Apple 根证书并与内置根证书合并
+// 用于 Apple 轮换根证书时无需重新构建；启动时调用，任一证书无效则返回错误
+func LoadAppleRootCertificates() error {
+	builtIn, err := parseAppleRootCertificates([]byte(appleRootCAG3PEM), "built-in")
+	if err != nil {
+		return err
+	}
+	roots := builtIn
+
+	if path := config.AppConfig.AppleRootCertPath; path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read APPLE_ROOT_CERT_PATH: %w", err)
+		}
+		certs, err := parseAppleRootCertificates(data, "APPLE_ROOT_CERT_PATH")
+		if err != nil {
+			return err
+		}
+		roots = append(roots, certs...)
+	}
+	if raw := config.AppConfig.AppleRootCertPEM; raw != "" {
+		certs, err := parseAppleRootCertificates([]byte(raw), "APPLE_ROOT_CERT_PEM")
+		if err != nil {
+			return err
+		}
+		roots = append(roots, certs...)
+	}
+
+	trustedAppleRoots.Store(newAppleRootSet(roots))
+	if extra := len(roots) - len(builtIn); extra > 0 {
+		logging.Infof("Trusting %d additional Apple root certificate(s)", extra)
+	}
+	return nil
+}
+
+// appleRoots 返回当前受信任的 Apple 根证书
+func appleRoots() *appleRootSet {
+	if roots := trustedAppleRoots.Load(); roots != nil {
+		return roots
+	}
+	builtIn, _ := parseAppleRootCertificates([]byte(appleRootCAG3PEM), "built-in")
+	roots := newAppleRootSet(builtIn)
+	trustedAppleRoots.CompareAndSwap(nil, roots)
+	return trustedAppleRoots.Load()
+}
+
+// newAppleRootSet 创建包含指定根证书的证书池
+func newAppleRootSet(certs []*x509.Certificate) *appleRootSet {
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	return &appleRootSet{certs: certs, pool: pool}
+}
+
+// parseAppleRootCertificates 解析 PEM 中的全部根证书并校验
+// 每个证书必须是自签名的 CA 证书且在有效期内
+func parseAppleRootCertificates(data []byte, source string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	now := time.Now()
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s Apple root certificate: %w", source, err)
+		}
+		if !cert.IsCA {
+			return nil, fmt.Errorf("invalid %s Apple root certificate %q: not a CA certificate", source, cert.Subject.CommonName)
+		}
+		if err := cert.CheckSignatureFrom(cert); err != nil {
+			return nil, fmt.Errorf("invalid %s Apple root certificate %q: not self-signed: %w", source, cert.Subject.CommonName, err)
+		}
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return nil, fmt.Errorf("invalid %s Apple root certificate %q: expired or not yet valid", source, cert.Subject.CommonName)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found in %s Apple root certificates", source)
+	}
+	return certs, nil
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// appStoreTokenLifetime App Store Server API JWT 有效期（Apple 允许最长 60 分钟）
+const appStoreTokenLifetime = 20 * time.Minute
+
+// appStoreTokenRefreshMargin 在 JWT 过期前多久重新生成，避免请求途中过期
+const appStoreTokenRefreshMargin = 2 * time.Minute
+
+// appStoreTokenCache caches signed App Store Server API tokens per bundle ID
+type appStoreTokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]cachedAppStoreToken
+}
+
+// cachedAppStoreToken 缓存的 JWT 及其需要重新生成的时间
+type cachedAppStoreToken struct {
+	token     string
+	refreshAt time.Time
+}
+
+// sharedAppStoreTokenCache is used by every SubscriptionVerificationService (services are created per request)
+var sharedAppStoreTokenCache = &appStoreTokenCache{tokens: make(map[string]cachedAppStoreToken)}
+
+// get returns the cached token of bundleID, signing a new one with sign when missing or about to expire
+// The lock is held while signing so concurrent requests don't all mint a token
+func (c *appStoreTokenCache) get(bundleID string, sign func() (string, time.Time, error)) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cached, ok := c.tokens[bundleID]; ok && time.Now().Before(cached.refreshAt) {
+		return cached.token, nil
+	}
+	token, expiresAt, err := sign()
+	if err != nil {
+		return "", err
+	}
+	c.tokens[bundleID] = cachedAppStoreToken{
+		token:     token,
+		refreshAt: expiresAt.Add(-appStoreTokenRefreshMargin),
+	}
+	return token, nil
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAppStoreTokenCacheGet(t *testing.T) {
+	cache := &appStoreTokenCache{tokens: make(map[string]cachedAppStoreToken)}
+	signed := 0
+	sign := func(expiresIn time.Duration) func() (string, time.Time, error) {
+		return func() (string, time.Time, error) {
+			signed++
+			return fmt.Sprintf("token-%d", signed), time.Now().Add(expiresIn), nil
+		}
+	}
+
+	// Back-to-back calls reuse the token signed by the first one
+	first, err := cache.get("com.example.app", sign(appStoreTokenLifetime))
+	if err != nil {
+		t.Fatalf("first get: %v", err)
+	}
+	second, err := cache.get("com.example.app", sign(appStoreTokenLifetime))
+	if err != nil {
+		t.Fatalf("second get: %v", err)
+	}
+	if first != second || signed != 1 {
+		t.Fatalf("got %q then %q with %d signatures, want the same token signed once", first, second, signed)
+	}
+
+	// Tokens are cached per bundle ID
+	if other, _ := cache.get("com.example.other", sign(appStoreTokenLifetime)); other == first || signed != 2 {
+		t.Errorf("other bundle got %q with %d signatures, want a new token", other, signed)
+	}
+
+	// A token within the refresh margin of its expiry is signed again
+	cache.get("com.example.expiring", sign(appStoreTokenRefreshMargin/2))
+	before := signed
+	cache.get("com.example.expiring", sign(appStoreTokenLifetime))
+	if signed != before+1 {
+		t.Errorf("expiring token signed %d times on reuse, want 1", signed-before)
+	}
+
+	// Signing failures are returned and not cached
+	failing := func() (string, time.Time, error) { return "", time.Time{}, errors.New("no key") }
+	if _, err := cache.get("com.example.failing", failing); err == nil {
+		t.Errorf("get with failing sign returned no error")
+	}
+	if token, err := cache.get("com.example.failing", sign(appStoreTokenLifetime)); err != nil || token == "" {
+		t.Errorf("get after failure = %q, %v, want a new token", token, err)
+	}
+}
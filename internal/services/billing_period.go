@@ -0,0 +1,116 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Standard billing periods (ISO 8601 durations)
+const (
+	BillingPeriodWeekly     = "P1W"
+	BillingPeriodMonthly    = "P1M"
+	BillingPeriodQuarterly  = "P3M"
+	BillingPeriodSemiannual = "P6M"
+	BillingPeriodYearly     = "P1Y"
+)
+
+// billingPeriodPlans maps standard billing periods to plan names
+var billingPeriodPlans = map[string]string{
+	BillingPeriodWeekly:     "weekly",
+	BillingPeriodMonthly:    "monthly",
+	BillingPeriodQuarterly:  "quarterly",
+	BillingPeriodSemiannual: "semiannual",
+	BillingPeriodYearly:     "yearly",
+}
+
+// sandboxBillingPeriods maps the accelerated sandbox renewal durations (minutes) to billing periods
+// See Apple "Testing auto-renewable subscriptions in the sandbox"
+var sandboxBillingPeriods = map[int]string{
+	3:  BillingPeriodWeekly,
+	5:  BillingPeriodMonthly,
+	10: "P2M",
+	15: BillingPeriodQuarterly,
+	30: BillingPeriodSemiannual,
+	60: BillingPeriodYearly,
+}
+
+var (
+	isoPeriodPattern   = regexp.MustCompile(`^P(\d+)([DWMY])$`)
+	periodLabelPattern = regexp.MustCompile(`^(\d+)(day|week|month|year)s?$`)
+)
+
+// NormalizeBillingPeriod normalizes an ISO 8601 period (e.g. "p1m" -> "P1M")
+// Returns "" if the value is not a single-unit period such as P1W, P3M or P1Y
+func NormalizeBillingPeriod(period string) string {
+	period = strings.ToUpper(strings.TrimSpace(period))
+	match := isoPeriodPattern.FindStringSubmatch(period)
+	if match == nil {
+		return ""
+	}
+	n, err := strconv.Atoi(match[1])
+	if err != nil || n <= 0 {
+		return ""
+	}
+	// 12 个月统一为 P1Y，7 天统一为 P1W
+	switch {
+	case match[2] == "M" && n%12 == 0:
+		return fmt.Sprintf("P%dY", n/12)
+	case match[2] == "D" && n%7 == 0:
+		return fmt.Sprintf("P%dW", n/7)
+	}
+	return fmt.Sprintf("P%d%s", n, match[2])
+}
+
+// BillingPeriodFromDates infers the billing period from the purchase and expiry of a single transaction
+// Spans under two hours are sandbox transactions using Apple's accelerated renewal durations
+// Returns "" if the span doesn't match a period
+func BillingPeriodFromDates(purchase, expires time.Time) string {
+	if purchase.IsZero() || expires.IsZero() || !expires.After(purchase) {
+		return ""
+	}
+	span := expires.Sub(purchase)
+
+	if span < 2*time.Hour {
+		return sandboxBillingPeriods[int(math.Round(span.Minutes()))]
+	}
+
+	days := span.Hours() / 24
+	if math.Abs(days-365) <= 2 {
+		return BillingPeriodYearly
+	}
+	// 周：天数接近 7 的整数倍（少于 4 周）
+	if weeks := math.Round(days / 7); weeks >= 1 && weeks < 4 && math.Abs(days-weeks*7) <= 0.5 {
+		return fmt.Sprintf("P%dW", int(weeks))
+	}
+	// 月：按平均月长计算，允许 3 天误差（不同月份天数不同）
+	if months := math.Round(days / 30.44); months >= 1 && months < 12 && math.Abs(days-months*30.44) <= 3 {
+		return fmt.Sprintf("P%dM", int(months))
+	}
+	return ""
+}
+
+// PlanFromBillingPeriod returns the plan name of a billing period
+// Standard periods map to weekly/monthly/quarterly/semiannual/yearly, other periods use the ISO value (e.g. "P2M")
+func PlanFromBillingPeriod(period string) string {
+	period = NormalizeBillingPeriod(period)
+	if period == "" {
+		return ""
+	}
+	if plan, ok := billingPeriodPlans[period]; ok {
+		return plan
+	}
+	return period
+}
+
+// billingPeriodFromLabel parses numeric product_id segments such as "3month" or "2weeks" into a billing period
+func billingPeriodFromLabel(label string) string {
+	match := periodLabelPattern.FindStringSubmatch(label)
+	if match == nil {
+		return ""
+	}
+	return NormalizeBillingPeriod("P" + match[1] + strings.ToUpper(match[2][:1]))
+}
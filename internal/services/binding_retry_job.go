@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+	"verification-api/internal/config"
+	"verification-api/internal/database"
+	"verification-api/internal/models"
+	"verification-api/pkg/logging"
+	"verification-api/pkg/metrics"
+)
+
+// bindingRetryBatchSize 每次执行最多处理的订阅数
+const bindingRetryBatchSize = 100
+
+// bindingRetryMaxBackoff 两次重试之间的最长间隔
+const bindingRetryMaxBackoff = 24 * time.Hour
+
+// NewBindingRetryJob creates the job retrying unresolved appAccountToken bindings (store_unresolved policy)
+// Each run re-queries the App Backend for subscriptions due for a retry; on success the
+// subscription is bound to the device_id and the App Backend webhook fires
+func NewBindingRetryJob(interval time.Duration) Job {
+	return Job{
+		Name:     "binding_retry",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			return retryUnresolvedBindings(ctx, interval)
+		},
+	}
+}
+
+// retryUnresolvedBindings retries the device_id lookup of unresolved subscriptions due for a retry
+func retryUnresolvedBindings(ctx context.Context, interval time.Duration) error {
+	maxAttempts := config.AppConfig.BindingRetryMaxAttempts
+	now := time.Now()
+
+	var subscriptions []*models.Subscription
+	err := database.GetDB().
+		Where("is_resolved = ? AND resolve_attempts < ? AND (next_resolve_at IS NULL OR next_resolve_at <= ?)", false, maxAttempts, now).
+		Order("id ASC").
+		Limit(bindingRetryBatchSize).
+		Find(&subscriptions).Error
+	if err != nil {
+		return err
+	}
+	if len(subscriptions) == 0 {
+		return nil
+	}
+
+	// 先串行加载项目，worker 只读该 map
+	projectService := NewProjectService()
+	projects := make(map[string]*models.Project)
+	for _, subscription := range subscriptions {
+		if _, ok := projects[subscription.ProjectID]; ok {
+			continue
+		}
+		project, err := projectService.GetProjectByID(subscription.ProjectID)
+		if err != nil {
+			project = nil
+		}
+		projects[subscription.ProjectID] = project
+	}
+
+	var resolved atomic.Int64
+	ForEachConcurrent(ctx, subscriptions, JobConcurrency(), func(ctx context.Context, subscription *models.Subscription) {
+		project := projects[subscription.ProjectID]
+		if project == nil || project.WebhookCallbackURL == "" {
+			// 项目已停用或未配置 App Backend，无法解析，按失败计入重试次数
+			recordBindingRetryFailure(subscription, interval, maxAttempts, "no App Backend configured")
+			return
+		}
+
+		token := subscription.AppAccountToken
+		deviceID, err := QueryDeviceID(project, token)
+		if err != nil {
+			recordBindingRetryFailure(subscription, interval, maxAttempts, err.Error())
+			return
+		}
+
+		subscription.AppAccountToken = deviceID
+		subscription.SetResolved(true)
+		subscription.ResolveAttempts = 0
+		subscription.NextResolveAt = nil
+		if err := database.UpdateSubscriptionBinding(subscription, token); err != nil {
+			logging.Errorf("Failed to save resolved binding - subscription: %d, error: %v", subscription.ID, err)
+			return
+		}
+		resolved.Add(1)
+		metrics.IncCounter("binding_retry_total", map[string]string{"result": "resolved"})
+		logging.Infof("Resolved pending appAccountToken binding - project: %s, original_transaction: %s, app_account_token: %s -> %s",
+			subscription.ProjectID, subscription.OriginalTransactionID, token, deviceID)
+
+		webhookNotifier := NewWebhookNotifier()
+		webhookNotifier.NotifyAppBackendAsync(WebhookEndpointFromProject(project), subscription)
+	})
+
+	logging.Infof("Binding retry finished - candidates: %d, resolved: %d", len(subscriptions), resolved.Load())
+	return nil
+}
+
+// recordBindingRetryFailure counts a failed attempt and schedules the next one with exponential backoff
+func recordBindingRetryFailure(subscription *models.Subscription, interval time.Duration, maxAttempts int, reason string) {
+	subscription.ResolveAttempts++
+	backoff := bindingRetryMaxBackoff
+	if shift := subscription.ResolveAttempts - 1; shift < 16 {
+		backoff = min(interval<<shift, bindingRetryMaxBackoff)
+	}
+	next := time.Now().Add(backoff)
+	subscription.NextResolveAt = &next
+
+	err := database.GetDB().Model(subscription).Updates(map[string]interface{}{
+		"resolve_attempts": subscription.ResolveAttempts,
+		"next_resolve_at":  next,
+	}).Error
+	if err != nil {
+		logging.Errorf("Failed to record binding retry - subscription: %d, error: %v", subscription.ID, err)
+	}
+
+	if subscription.ResolveAttempts >= maxAttempts {
+		metrics.IncCounter("binding_retry_total", map[string]string{"result": "abandoned"})
+		logging.Warnf("Giving up resolving appAccountToken after %d attempts - project: %s, original_transaction: %s, app_account_token: %s, last error: %s",
+			subscription.ResolveAttempts, subscription.ProjectID, subscription.OriginalTransactionID, subscription.AppAccountToken, reason)
+		return
+	}
+	metrics.IncCounter("binding_retry_total", map[string]string{"result": "failed"})
+	logging.Debugf("Binding retry failed - subscription: %d, attempt: %d, next: %s, error: %s",
+		subscription.ID, subscription.ResolveAttempts, next.Format(time.RFC3339), reason)
+}
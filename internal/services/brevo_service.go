@@ -3,8 +3,12 @@ package services
 import (
 	"context"
 	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
 	"verification-api/internal/config"
 	"verification-api/internal/models"
+	"verification-api/pkg/logging"
 
 	brevo "github.com/getbrevo/brevo-go/lib"
 )
@@ -31,7 +35,8 @@ func NewBrevoService() *BrevoService {
 }
 
 // SendVerificationCodeEmail sends verification code email (supports multi-project and multi-language)
-func (s *BrevoService) SendVerificationCodeEmail(projectID, to, code, language string) error {
+// expireMinutes is the project's code validity (see CodeExpireMinutesForProject)
+func (s *BrevoService) SendVerificationCodeEmail(projectID, to, code, language string, expireMinutes int) error {
 	// Get project configuration
 	projectConfig := s.getProjectConfig(projectID)
 
@@ -39,8 +44,21 @@ func (s *BrevoService) SendVerificationCodeEmail(projectID, to, code, language s
 	fmt.Printf("DEBUG: Language parameter received: '%s'\n", language)
 
 	// Get email content based on language
-	// 从配置中获取过期时间，默认为5分钟
-	expireMinutes := config.AppConfig.CodeExpireMinutes
+
+	// Projects with a Brevo template get the branded template, the built-in strings are only used without one
+	if projectConfig.TemplateID != "" {
+		templateID, err := ParseBrevoTemplateID(projectConfig.TemplateID)
+		if err == nil {
+			return s.sendTemplateEmailWithSDK(projectConfig.FromName, projectConfig.FromEmail, to, templateID, map[string]interface{}{
+				"code":           code,
+				"project_name":   projectConfig.ProjectName,
+				"expire_minutes": expireMinutes,
+			})
+		}
+		// 模板 ID 在写入时已校验，这里解析失败只可能是历史数据
+		logging.Warnf("Invalid template_id %q for project %s, using built-in content: %v", projectConfig.TemplateID, projectID, err)
+	}
+
 	subject, htmlContent, textContent := s.getEmailContent(language, projectConfig.ProjectName, code, expireMinutes)
 
 	// Debug: Log generated content
@@ -66,13 +84,17 @@ func (s *BrevoService) getProjectConfig(projectID string) *models.ProjectConfig
 	}
 
 	// Convert database model to config model
-	// Always use the service's configured email (single sender limitation)
-	// But use project-specific from_name
+	// Use the project's from_email (verified in Brevo on create/update) when set, otherwise the service's configured email
+	fromEmail := s.FromEmail
+	if project.FromEmail != "" {
+		fromEmail = project.FromEmail
+	}
 	return &models.ProjectConfig{
 		ProjectID:   project.ProjectID,
 		ProjectName: project.ProjectName,
-		FromEmail:   s.FromEmail,      // Force use service default email
+		FromEmail:   fromEmail,
 		FromName:    project.FromName, // Use project-specific from_name
+		TemplateID:  project.TemplateID,
 	}
 }
 
@@ -116,6 +138,25 @@ func (s *BrevoService) sendEmailWithSDK(fromName, fromEmail, to, subject, htmlCo
 	return nil
 }
 
+// sendTemplateEmailWithSDK sends a Brevo transactional template, params are available as {{ params.name }}
+func (s *BrevoService) sendTemplateEmailWithSDK(fromName, fromEmail, to string, templateID int64, params map[string]interface{}) error {
+	emailRequest := brevo.SendSmtpEmail{
+		Sender:     &brevo.SendSmtpEmailSender{Name: fromName, Email: fromEmail},
+		To:         []brevo.SendSmtpEmailTo{{Email: to}},
+		TemplateId: templateID,
+		Params:     params,
+	}
+
+	_, httpResp, err := s.client.TransactionalEmailsApi.SendTransacEmail(context.Background(), emailRequest)
+	if err != nil {
+		return fmt.Errorf("failed to send template email via Brevo SDK (template %d): %w", templateID, err)
+	}
+	if httpResp.StatusCode != 200 && httpResp.StatusCode != 201 {
+		return fmt.Errorf("brevo API error: status %d (template %d)", httpResp.StatusCode, templateID)
+	}
+	return nil
+}
+
 // getEmailContent 根据语言获取邮件内容
 func (s *BrevoService) getEmailContent(language, projectName, verificationCode string, expireMinutes int) (subject, htmlContent, textContent string) {
 	// 默认使用英文
@@ -176,3 +217,47 @@ func (s *BrevoService) getEmailContent(language, projectName, verificationCode s
 
 	return subject, htmlContent, textContent
 }
+
+// Send implements CodeSender, recipient is the email address
+func (s *BrevoService) Send(projectID, recipient, code, language string, expireMinutes int) error {
+	return s.SendVerificationCodeEmail(projectID, recipient, code, language, expireMinutes)
+}
+
+// ParseBrevoTemplateID parses a project template_id (the numeric ID of a Brevo transactional template)
+func ParseBrevoTemplateID(raw string) (int64, error) {
+	templateID, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+	if err != nil || templateID <= 0 {
+		return 0, fmt.Errorf("template_id must be the numeric ID of a Brevo template, e.g. 12")
+	}
+	return templateID, nil
+}
+
+// ValidateFromEmail checks that a project from_email is a plain, syntactically valid address
+func ValidateFromEmail(email string) error {
+	if strings.TrimSpace(email) == "" {
+		return fmt.Errorf("from_email must not be empty")
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return fmt.Errorf("from_email must be a valid email address, e.g. noreply@example.com")
+	}
+	return nil
+}
+
+// VerifySender checks that the address is an active sender of the Brevo account
+// Brevo rejects emails from unverified senders, so projects can only use verified addresses
+func (s *BrevoService) VerifySender(email string) error {
+	senders, _, err := s.client.SendersApi.GetSenders(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to list Brevo senders: %w", err)
+	}
+	for _, sender := range senders.Senders {
+		if strings.EqualFold(sender.Email, email) {
+			if !sender.Active {
+				return fmt.Errorf("from_email %s is not verified in Brevo yet", email)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("from_email %s is not a sender of the Brevo account", email)
+}
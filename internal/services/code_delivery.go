@@ -0,0 +1,86 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+	"verification-api/internal/models"
+	"verification-api/pkg/logging"
+)
+
+// Verification code delivery modes (per project)
+const (
+	CodeDeliveryEmail   = "email"   // 通过 Brevo 发送邮件（默认）
+	CodeDeliveryWebhook = "webhook" // POST 到项目的 code_delivery_url，由接入方自行发送
+)
+
+// IsValidCodeDeliveryMode reports whether the delivery mode is supported (empty means email)
+func IsValidCodeDeliveryMode(mode string) bool {
+	return mode == "" || mode == CodeDeliveryEmail || mode == CodeDeliveryWebhook
+}
+
+// CodeDeliveryEndpointFromProject builds the code delivery endpoint of a project
+// Signed with the project's webhook secret and signature settings
+func CodeDeliveryEndpointFromProject(project *models.Project) WebhookEndpoint {
+	endpoint := WebhookEndpointFromProject(project)
+	endpoint.URL = project.CodeDeliveryURL
+	return endpoint
+}
+
+// VerificationCodePayload represents the payload sent to the code delivery webhook
+type VerificationCodePayload struct {
+	Event     string `json:"event"` // verification_code.created
+	ProjectID string `json:"project_id"`
+	Email     string `json:"email"`
+	Code      string `json:"code"`
+	Language  string `json:"language,omitempty"`
+	ExpiresAt string `json:"expires_at"` // ISO 8601 format
+	Timestamp string `json:"timestamp"`  // ISO 8601 format
+}
+
+// DeliverVerificationCode posts a verification code to the project's delivery webhook (single attempt)
+// The caller decides how to report a failure, like a failed email
+func (wn *WebhookNotifier) DeliverVerificationCode(endpoint WebhookEndpoint, projectID, email, code, language string, expireMinutes int) error {
+	if endpoint.URL == "" {
+		return fmt.Errorf("code_delivery_url is not configured")
+	}
+
+	now := time.Now()
+	payload := VerificationCodePayload{
+		Event:     "verification_code.created",
+		ProjectID: projectID,
+		Email:     email,
+		Code:      code,
+		Language:  language,
+		ExpiresAt: now.Add(time.Duration(expireMinutes) * time.Minute).Format(time.RFC3339),
+		Timestamp: now.Format(time.RFC3339),
+	}
+
+	var body []byte
+	contentType := "application/json"
+	if endpoint.ContentType == WebhookContentTypeForm {
+		values := url.Values{}
+		values.Set("event", payload.Event)
+		values.Set("project_id", payload.ProjectID)
+		values.Set("email", payload.Email)
+		values.Set("code", payload.Code)
+		values.Set("language", payload.Language)
+		values.Set("expires_at", payload.ExpiresAt)
+		values.Set("timestamp", payload.Timestamp)
+		body = []byte(values.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	} else {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return fmt.Errorf("failed to marshal payload: %w", err)
+		}
+	}
+
+	if _, err := wn.post(endpoint, body, contentType, ""); err != nil {
+		logging.Errorf("Verification code delivery failed - project: %s, url: %s, error: %v", projectID, endpoint.URL, err)
+		return err
+	}
+	logging.Infof("Verification code delivered to webhook - project: %s, url: %s", projectID, endpoint.URL)
+	return nil
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"verification-api/internal/config"
+	"verification-api/internal/models"
+)
+
+// CodeCharsetDigits is the charset of numeric verification codes
+const CodeCharsetDigits = "0123456789"
+
+// CodeCharsetAlphanumeric is the charset of alphanumeric verification codes
+// Codes are generated uppercase; submitted codes are uppercased before they are checked
+const CodeCharsetAlphanumeric = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// Verification code types (project code_type)
+const (
+	CodeTypeNumeric      = "numeric"
+	CodeTypeAlphanumeric = "alphanumeric"
+)
+
+// Verification code length limits (project code_length)
+const (
+	MinCodeLength = 4
+	MaxCodeLength = 12
+)
+
+// MaxCodeExpireMinutes caps the project code_expire_minutes (one day)
+const MaxCodeExpireMinutes = 1440
+
+// CodeFormat describes the verification codes of a project
+type CodeFormat struct {
+	Length  int    // 验证码长度
+	Charset string // 允许的字符
+}
+
+// DefaultCodeFormat is the format of projects without code settings (6 digits)
+var DefaultCodeFormat = CodeFormat{Length: 6, Charset: CodeCharsetDigits}
+
+// CodeFormatForProject returns the verification code format of a project
+// project may be nil (unknown project), in which case the default format is used
+func CodeFormatForProject(project *models.Project) CodeFormat {
+	format := DefaultCodeFormat
+	if project == nil {
+		return format
+	}
+	if project.CodeLength > 0 {
+		format.Length = project.CodeLength
+	}
+	if project.CodeType == CodeTypeAlphanumeric {
+		format.Charset = CodeCharsetAlphanumeric
+	}
+	return format
+}
+
+// Alphanumeric reports whether the format uses letters as well as digits
+func (f CodeFormat) Alphanumeric() bool {
+	return f.Charset == CodeCharsetAlphanumeric
+}
+
+// Normalize prepares a submitted code for validation and comparison (alphanumeric codes are case-insensitive)
+func (f CodeFormat) Normalize(code string) string {
+	code = strings.TrimSpace(code)
+	if f.Alphanumeric() {
+		return strings.ToUpper(code)
+	}
+	return code
+}
+
+// Validate checks a submitted code against the format
+// Used to reject malformed input before it reaches Redis
+func (f CodeFormat) Validate(code string) error {
+	if len(code) != f.Length {
+		return fmt.Errorf("code must be %d characters", f.Length)
+	}
+	for _, ch := range code {
+		if !strings.ContainsRune(f.Charset, ch) {
+			return fmt.Errorf("code contains invalid character %q", ch)
+		}
+	}
+	return nil
+}
+
+// ValidateCodeSettings checks a project's code_length and code_type before they are stored
+// 0 / empty keep the default (6 digits)
+func ValidateCodeSettings(length int, codeType string) error {
+	if length != 0 && (length < MinCodeLength || length > MaxCodeLength) {
+		return fmt.Errorf("code_length must be between %d and %d (0 = default of %d)", MinCodeLength, MaxCodeLength, DefaultCodeFormat.Length)
+	}
+	switch codeType {
+	case "", CodeTypeNumeric, CodeTypeAlphanumeric:
+		return nil
+	default:
+		return fmt.Errorf("code_type must be %s or %s", CodeTypeNumeric, CodeTypeAlphanumeric)
+	}
+}
+
+// CodeExpireMinutesForProject returns how long the verification codes of a project stay valid
+// project may be nil (unknown project); 0 uses the global CODE_EXPIRE_MINUTES
+func CodeExpireMinutesForProject(project *models.Project) int {
+	if project != nil && project.CodeExpireMinutes > 0 {
+		return project.CodeExpireMinutes
+	}
+	return config.AppConfig.CodeExpireMinutes
+}
+
+// ValidateCodeExpireMinutes checks a project's code_expire_minutes before it is stored
+func ValidateCodeExpireMinutes(minutes int) error {
+	if minutes < 0 || minutes > MaxCodeExpireMinutes {
+		return fmt.Errorf("code_expire_minutes must be between 1 and %d (0 = CODE_EXPIRE_MINUTES)", MaxCodeExpireMinutes)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"testing"
+	"verification-api/internal/models"
+)
+
+func TestCodeFormatValidate(t *testing.T) {
+	numeric := DefaultCodeFormat
+	short := CodeFormatForProject(&models.Project{CodeLength: 4})
+	alphanumeric := CodeFormatForProject(&models.Project{CodeLength: 8, CodeType: CodeTypeAlphanumeric})
+
+	tests := []struct {
+		name   string
+		format CodeFormat
+		code   string
+		valid  bool
+	}{
+		{"numeric", numeric, "012345", true},
+		{"numeric too short", numeric, "12345", false},
+		{"numeric too long", numeric, "1234567", false},
+		{"numeric with letter", numeric, "12345A", false},
+		{"numeric with space", numeric, "123 45", false},
+		{"numeric non-ascii digit", numeric, "12345٣", false},
+		{"4 digits", short, "0042", true},
+		{"4 digits given 6", short, "004200", false},
+		{"alphanumeric", alphanumeric, "AB12CD34", true},
+		{"alphanumeric lowercase", alphanumeric, "ab12cd34", false},
+		{"alphanumeric normalized", alphanumeric, alphanumeric.Normalize(" ab12cd34 "), true},
+		{"alphanumeric with symbol", alphanumeric, "AB12CD3-", false},
+		{"alphanumeric length of numeric", alphanumeric, "AB12CD", false},
+		{"empty", numeric, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.format.Validate(tt.code); (err == nil) != tt.valid {
+				t.Errorf("Validate(%q) error = %v, want valid %v", tt.code, err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"verification-api/pkg/logging"
+	"verification-api/pkg/metrics"
+)
+
+// CodeSender delivers a verification code to a recipient (email address or phone number)
+// expireMinutes is the code's validity shown in the message, the same value the code is stored with
+type CodeSender interface {
+	Send(projectID, recipient, code, language string, expireMinutes int) error
+}
+
+// Verification code channels (send-code channel field)
+const (
+	CodeChannelEmail = "email" // 邮件（默认，Brevo）
+	CodeChannelSMS   = "sms"   // 短信（Twilio）
+)
+
+// e164Pattern matches E.164 phone numbers: + followed by up to 15 digits, no leading zero
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+// IsValidCodeChannel reports whether the channel is supported (empty means email)
+func IsValidCodeChannel(channel string) bool {
+	return channel == "" || channel == CodeChannelEmail || channel == CodeChannelSMS
+}
+
+// ValidateE164 checks that a phone number is in E.164 format, e.g. +14155552671
+func ValidateE164(phone string) error {
+	if !e164Pattern.MatchString(phone) {
+		return fmt.Errorf("phone must be in E.164 format, e.g. +14155552671")
+	}
+	return nil
+}
+
+// NewCodeSender returns the sender of a channel
+// Email goes through Brevo, falling back to SMTP when SMTP_* is configured; SMS requires the TWILIO_* configuration
+func NewCodeSender(channel string) (CodeSender, error) {
+	switch channel {
+	case "", CodeChannelEmail:
+		if smtpService := NewSMTPService(); smtpService.Configured() {
+			return &fallbackEmailSender{primary: NewBrevoService(), fallback: smtpService}, nil
+		}
+		return NewBrevoService(), nil
+	case CodeChannelSMS:
+		twilioService := NewTwilioService()
+		if !twilioService.Configured() {
+			return nil, fmt.Errorf("SMS delivery is not configured (TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM_NUMBER or TWILIO_MESSAGING_SERVICE_SID)")
+		}
+		return twilioService, nil
+	default:
+		return nil, fmt.Errorf("unsupported channel: %s", channel)
+	}
+}
+
+// fallbackEmailSender sends through the primary provider (Brevo) and retries once through the fallback (SMTP) on error
+type fallbackEmailSender struct {
+	primary  CodeSender
+	fallback CodeSender
+}
+
+// Send implements CodeSender, logging which provider delivered the email
+func (s *fallbackEmailSender) Send(projectID, recipient, code, language string, expireMinutes int) error {
+	primaryErr := s.primary.Send(projectID, recipient, code, language, expireMinutes)
+	if primaryErr == nil {
+		logging.Infof("Verification email delivered - project: %s, provider: brevo", projectID)
+		return nil
+	}
+
+	logging.Warnf("Brevo send failed, falling back to SMTP - project: %s, error: %v", projectID, primaryErr)
+	metrics.IncCounter("email_fallback_total", nil)
+	if err := s.fallback.Send(projectID, recipient, code, language, expireMinutes); err != nil {
+		logging.Errorf("SMTP fallback failed - project: %s, error: %v", projectID, err)
+		return fmt.Errorf("brevo: %v; smtp fallback: %w", primaryErr, err)
+	}
+	logging.Infof("Verification email delivered - project: %s, provider: smtp", projectID)
+	metrics.IncCounter("smtp_emails_sent_total", nil)
+	return nil
+}
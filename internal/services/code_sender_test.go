@@ -0,0 +1,67 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeCodeSender records the codes it was asked to send and fails with err when set
+type fakeCodeSender struct {
+	err   error
+	sends []string
+}
+
+func (f *fakeCodeSender) Send(projectID, recipient, code, language string, expireMinutes int) error {
+	f.sends = append(f.sends, recipient+":"+code)
+	return f.err
+}
+
+func TestFallbackEmailSender(t *testing.T) {
+	tests := []struct {
+		name          string
+		brevoErr      error
+		smtpErr       error
+		wantErr       string
+		wantSMTPSends int
+	}{
+		{name: "brevo succeeds", wantSMTPSends: 0},
+		{name: "brevo fails, smtp delivers", brevoErr: errors.New("brevo down"), wantSMTPSends: 1},
+		{
+			name:          "both fail",
+			brevoErr:      errors.New("brevo down"),
+			smtpErr:       errors.New("connection refused"),
+			wantErr:       "brevo: brevo down; smtp fallback: connection refused",
+			wantSMTPSends: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			brevo := &fakeCodeSender{err: tt.brevoErr}
+			smtp := &fakeCodeSender{err: tt.smtpErr}
+			sender := &fallbackEmailSender{primary: brevo, fallback: smtp}
+
+			err := sender.Send("proj-a", "user@example.com", "123456", "en", 5)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Send() error = %v, want %q", err, tt.wantErr)
+			}
+			if tt.smtpErr != nil && !errors.Is(err, tt.smtpErr) {
+				t.Errorf("Send() error doesn't wrap the SMTP error: %v", err)
+			}
+
+			if len(brevo.sends) != 1 {
+				t.Errorf("brevo sends = %d, want 1", len(brevo.sends))
+			}
+			if len(smtp.sends) != tt.wantSMTPSends {
+				t.Fatalf("smtp sends = %d, want %d", len(smtp.sends), tt.wantSMTPSends)
+			}
+			if tt.wantSMTPSends > 0 && smtp.sends[0] != "user@example.com:123456" {
+				t.Errorf("smtp sent %q, want the same recipient and code as brevo", smtp.sends[0])
+			}
+		})
+	}
+}
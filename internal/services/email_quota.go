@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"time"
+	"verification-api/pkg/metrics"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// reserveEmailQuotaScript 原子地检查并增加当日发送计数（邮件总量、单个邮箱的验证码发送次数和项目每日配额共用）
+// 返回 -1 表示已达到上限（ARGV[1] 为 0 时不限制）
+var reserveEmailQuotaScript = redis.NewScript(`
+local cap = tonumber(ARGV[1])
+local current = tonumber(redis.call("GET", KEYS[1]) or "0")
+if cap > 0 and current >= cap then
+	return -1
+end
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("EXPIRE", KEYS[1], ARGV[2])
+end
+return count
+`)
+
+// releaseQuotaScript 归还一次 reserveEmailQuotaScript 的计数
+// 只递减仍存在且大于 0 的计数器：计数器已过期时不会重新创建一个没有 TTL 的负数 key
+var releaseQuotaScript = redis.NewScript(`
+local current = tonumber(redis.call("GET", KEYS[1]) or "0")
+if current <= 0 then
+	return 0
+end
+return redis.call("DECR", KEYS[1])
+`)
+
+// emailQuotaKeyTTL keeps a day's counter a little longer than the day itself
+const emailQuotaKeyTTL = 48 * time.Hour
+
+// EmailQuotaDate returns the quota day (UTC, YYYY-MM-DD) of a time
+// Brevo resets its daily sending limit at midnight UTC
+func EmailQuotaDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+func emailQuotaKey(date string) string {
+	return "brevo_daily_sent:" + date
+}
+
+// ReserveDailyEmailQuota counts an email against the Brevo quota of the day of now before it is sent
+// Returns false without counting when dailyCap > 0 and the cap has been reached
+// Pass the same now to ReleaseDailyEmailQuota, so a release after midnight UTC gives back the right day
+func (r *RedisService) ReserveDailyEmailQuota(dailyCap int, now time.Time) (int64, bool, error) {
+	ctx := context.Background()
+	count, err := reserveEmailQuotaScript.Run(ctx, r.client,
+		[]string{emailQuotaKey(EmailQuotaDate(now))}, dailyCap, int(emailQuotaKeyTTL.Seconds())).Int64()
+	if err != nil {
+		return 0, false, err
+	}
+	if count < 0 {
+		metrics.IncCounter("brevo_quota_rejections_total", nil)
+		return int64(dailyCap), false, nil
+	}
+	metrics.SetGauge("brevo_daily_emails_sent", nil, float64(count))
+	return count, true, nil
+}
+
+// dailyCodeSendsKey counts the verification codes sent to an email of a project on a quota day
+func dailyCodeSendsKey(projectID, email, date string) string {
+	return "code_daily_sends:" + projectID + ":" + email + ":" + date
+}
+
+// ReserveDailyCodeSend counts a verification code send for project + email against the limit of the day of now
+// Returns false without counting when dailyLimit > 0 and the limit has been reached
+// Uses the same UTC day as the Brevo quota; pass the same now to ReleaseDailyCodeSend
+func (r *RedisService) ReserveDailyCodeSend(projectID, email string, dailyLimit int, now time.Time) (bool, error) {
+	ctx := context.Background()
+	count, err := reserveEmailQuotaScript.Run(ctx, r.client,
+		[]string{dailyCodeSendsKey(projectID, email, EmailQuotaDate(now))}, dailyLimit, int(emailQuotaKeyTTL.Seconds())).Int64()
+	if err != nil {
+		return false, err
+	}
+	return count >= 0, nil
+}
+
+// ReleaseDailyCodeSend gives back a send counted by ReserveDailyCodeSend (with the same now) whose code was not delivered
+func (r *RedisService) ReleaseDailyCodeSend(projectID, email string, now time.Time) error {
+	ctx := context.Background()
+	return releaseQuotaScript.Run(ctx, r.client, []string{dailyCodeSendsKey(projectID, email, EmailQuotaDate(now))}).Err()
+}
+
+// ReleaseDailyEmailQuota gives back a reservation of ReserveDailyEmailQuota (with the same now) whose email was not sent
+func (r *RedisService) ReleaseDailyEmailQuota(now time.Time) error {
+	ctx := context.Background()
+	return releaseQuotaScript.Run(ctx, r.client, []string{emailQuotaKey(EmailQuotaDate(now))}).Err()
+}
+
+// GetDailyEmailCount returns the number of emails counted on a quota day
+func (r *RedisService) GetDailyEmailCount(date string) (int64, error) {
+	ctx := context.Background()
+	count, err := r.client.Get(ctx, emailQuotaKey(date)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return count, err
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"verification-api/internal/models"
+)
+
+// ParseEntitlementMapping parses a project entitlement mapping
+// JSON object of product_id -> entitlement names, e.g. {"com.example.pro.monthly": ["pro"], "com.example.lifetime": ["pro", "lifetime"]}
+// An empty mapping is valid and grants no entitlements
+func ParseEntitlementMapping(raw string) (map[string][]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var mapping map[string][]string
+	if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+		return nil, fmt.Errorf("entitlement_mapping must be a JSON object of product_id to entitlement names: %w", err)
+	}
+	for productID, names := range mapping {
+		if productID == "" {
+			return nil, fmt.Errorf("entitlement_mapping contains an empty product_id")
+		}
+		for _, name := range names {
+			if strings.TrimSpace(name) == "" {
+				return nil, fmt.Errorf("entitlement_mapping contains an empty entitlement name for %s", productID)
+			}
+		}
+	}
+	return mapping, nil
+}
+
+// ValidateEntitlementMapping checks an entitlement mapping before it is stored
+func ValidateEntitlementMapping(raw string) error {
+	_, err := ParseEntitlementMapping(raw)
+	return err
+}
+
+// ResolveEntitlements returns the sorted entitlement names granted by the owned products
+// productIDs are the active subscription and the owned non-consumables of a user
+// Products missing from the mapping grant nothing; returns nil when the project has no mapping
+func ResolveEntitlements(project *models.Project, productIDs []string) []string {
+	if project == nil {
+		return nil
+	}
+	mapping, err := ParseEntitlementMapping(project.EntitlementMapping)
+	if err != nil || len(mapping) == 0 {
+		// 映射在写入时已校验，这里解析失败只可能是历史数据
+		return nil
+	}
+
+	granted := make(map[string]bool)
+	for _, productID := range productIDs {
+		for _, name := range mapping[productID] {
+			granted[strings.TrimSpace(name)] = true
+		}
+	}
+
+	entitlements := make([]string, 0, len(granted))
+	for name := range granted {
+		entitlements = append(entitlements, name)
+	}
+	sort.Strings(entitlements)
+	return entitlements
+}
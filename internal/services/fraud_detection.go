@@ -0,0 +1,64 @@
+package services
+
+import (
+	"runtime/debug"
+	"verification-api/internal/config"
+	"verification-api/internal/database"
+	"verification-api/internal/models"
+	"verification-api/pkg/logging"
+	"verification-api/pkg/metrics"
+)
+
+// FraudReasonSubscriptionCount flags users holding more subscriptions than FRAUD_MAX_SUBSCRIPTIONS_PER_USER
+const FraudReasonSubscriptionCount = "subscription_count"
+
+// CheckSubscriptionFraudAsync checks the owner of a saved subscription against the per-user subscription threshold
+// Runs in a new goroutine and never blocks or fails verification; disabled when the threshold is 0
+func CheckSubscriptionFraudAsync(project *models.Project, subscription *models.Subscription) {
+	threshold := config.AppConfig.FraudMaxSubscriptionsPerUser
+	if threshold <= 0 || project == nil || subscription == nil || subscription.AppAccountToken == "" {
+		return
+	}
+	// 复制一份，避免与调用方后续修改产生竞争
+	snapshot := *subscription
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logging.Errorf("Fraud check panic recovered - project: %s, panic: %v\n%s", project.ProjectID, r, debug.Stack())
+			}
+		}()
+		checkSubscriptionFraud(project, &snapshot, int64(threshold))
+	}()
+}
+
+// checkSubscriptionFraud flags the user and fires fraud.suspected when the count exceeds the threshold
+// The webhook fires on the first flag and again whenever the count grows
+func checkSubscriptionFraud(project *models.Project, subscription *models.Subscription, threshold int64) {
+	count, err := database.CountUserSubscriptions(project.ProjectID, subscription.AppAccountToken)
+	if err != nil {
+		logging.Errorf("Failed to count user subscriptions - project: %s, user: %s, error: %v",
+			project.ProjectID, subscription.AppAccountToken, err)
+		return
+	}
+	if count <= threshold {
+		return
+	}
+
+	previousCount, err := database.FlagUser(project.ProjectID, subscription.AppAccountToken, FraudReasonSubscriptionCount, count)
+	if err != nil {
+		logging.Errorf("Failed to flag user - project: %s, user: %s, error: %v",
+			project.ProjectID, subscription.AppAccountToken, err)
+		return
+	}
+	if count <= previousCount {
+		return
+	}
+
+	metrics.IncCounter("fraud_suspected_total", map[string]string{"reason": FraudReasonSubscriptionCount})
+	logging.Warnf("Suspected fraud - project: %s, user: %s, subscriptions: %d (threshold: %d)",
+		project.ProjectID, subscription.AppAccountToken, count, threshold)
+
+	webhookNotifier := NewWebhookNotifier()
+	webhookNotifier.NotifyFraudSuspected(WebhookEndpointFromProject(project), subscription, count)
+}
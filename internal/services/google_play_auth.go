@@ -0,0 +1,180 @@
+package services
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"verification-api/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// googlePlayScope is the OAuth2 scope of the Google Play Developer API
+const googlePlayScope = "https://www.googleapis.com/auth/androidpublisher"
+
+// googleTokenURL is the default OAuth2 token endpoint of service accounts
+const googleTokenURL = "https://oauth2.googleapis.com/token"
+
+// ErrGooglePlayCredentialsNotConfigured is returned when neither service-account variable is set
+var ErrGooglePlayCredentialsNotConfigured = errors.New("Google Play credentials not configured: set GOOGLE_PLAY_SERVICE_ACCOUNT_JSON or GOOGLE_PLAY_SERVICE_ACCOUNT_PATH")
+
+// googleServiceAccount holds the fields of a service-account key file used for the JWT bearer flow
+type googleServiceAccount struct {
+	ClientEmail string
+	TokenURI    string
+	PrivateKey  *rsa.PrivateKey
+}
+
+// googlePlayToken caches the OAuth2 access token shared by all SubscriptionVerificationService instances
+// Credentials are loaded on first use; a new token is requested shortly before the cached one expires
+var googlePlayToken struct {
+	mutex       sync.Mutex
+	account     *googleServiceAccount
+	accessToken string
+	expiresAt   time.Time
+}
+
+// getGooglePlayAccessToken returns an OAuth2 access token for the Google Play Developer API
+func (s *SubscriptionVerificationService) getGooglePlayAccessToken() (string, error) {
+	googlePlayToken.mutex.Lock()
+	defer googlePlayToken.mutex.Unlock()
+
+	if googlePlayToken.accessToken != "" && time.Until(googlePlayToken.expiresAt) > time.Minute {
+		return googlePlayToken.accessToken, nil
+	}
+
+	if googlePlayToken.account == nil {
+		account, err := loadGoogleCredentials(config.AppConfig.GooglePlayServiceAccountJSON, config.AppConfig.GooglePlayServiceAccountPath)
+		if err != nil {
+			return "", err
+		}
+		googlePlayToken.account = account
+	}
+
+	accessToken, expiresIn, err := s.exchangeGoogleJWT(googlePlayToken.account)
+	if err != nil {
+		return "", err
+	}
+	googlePlayToken.accessToken = accessToken
+	googlePlayToken.expiresAt = time.Now().Add(expiresIn)
+	return accessToken, nil
+}
+
+// exchangeGoogleJWT exchanges a signed service-account JWT for an access token (JWT bearer grant)
+func (s *SubscriptionVerificationService) exchangeGoogleJWT(account *googleServiceAccount) (string, time.Duration, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   account.ClientEmail,
+		"scope": googlePlayScope,
+		"aud":   account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(account.PrivateKey)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to sign service account JWT: %w", err)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+	resp, err := s.httpClient.PostForm(account.TokenURI, form)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to request Google access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("Google token endpoint returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return "", 0, fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return "", 0, fmt.Errorf("access_token is missing in token response")
+	}
+	return tokenResp.AccessToken, time.Duration(tokenResp.ExpiresIn) * time.Second, nil
+}
+
+// loadGoogleCredentials loads a service-account key from JSON (raw or base64) or from a key file path
+// jsonStr takes precedence over path; returns ErrGooglePlayCredentialsNotConfigured when both are empty
+func loadGoogleCredentials(jsonStr, path string) (*googleServiceAccount, error) {
+	var data []byte
+	switch {
+	case strings.TrimSpace(jsonStr) != "":
+		data = []byte(jsonStr)
+		// Try to decode as base64 first
+		if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(jsonStr)); err == nil {
+			data = decoded
+		}
+	case path != "":
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to read Google service account file: %w", err)
+		}
+	default:
+		return nil, ErrGooglePlayCredentialsNotConfigured
+	}
+
+	var key struct {
+		Type        string `json:"type"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("failed to parse Google service account JSON: %w", err)
+	}
+	if key.Type != "" && key.Type != "service_account" {
+		return nil, fmt.Errorf("Google credentials must be a service account key (type %q)", key.Type)
+	}
+	if key.ClientEmail == "" || key.PrivateKey == "" {
+		return nil, fmt.Errorf("Google service account JSON must contain client_email and private_key")
+	}
+
+	// Parse PEM
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse service account private key PEM block")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to parse service account private key: %w", err)
+		}
+	}
+	rsaKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("service account key is not an RSA private key")
+	}
+
+	tokenURI := key.TokenURI
+	if tokenURI == "" {
+		tokenURI = googleTokenURL
+	}
+	return &googleServiceAccount{
+		ClientEmail: key.ClientEmail,
+		TokenURI:    tokenURI,
+		PrivateKey:  rsaKey,
+	}, nil
+}
@@ -0,0 +1,367 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"verification-api/internal/config"
+	"verification-api/internal/database"
+	"verification-api/internal/models"
+	"verification-api/pkg/logging"
+)
+
+// googlePlayAPIBaseURL Google Play Developer API base URL
+const googlePlayAPIBaseURL = "https://androidpublisher.googleapis.com/androidpublisher/v3"
+
+// GooglePlayProductPurchase represents Google Play one-time product purchase response
+// API: GET .../applications/{packageName}/purchases/products/{productId}/tokens/{token}
+type GooglePlayProductPurchase struct {
+	PurchaseTimeMillis          string `json:"purchaseTimeMillis"`
+	PurchaseState               int    `json:"purchaseState"` // 0=Purchased, 1=Canceled, 2=Pending
+	ConsumptionState            int    `json:"consumptionState"`
+	OrderID                     string `json:"orderId"`
+	AcknowledgementState        int    `json:"acknowledgementState"`   // 0=Yet to be acknowledged, 1=Acknowledged
+	PurchaseType                *int   `json:"purchaseType,omitempty"` // 0=Test, 1=Promo, 2=Rewarded (absent for regular purchases)
+	ObfuscatedExternalAccountID string `json:"obfuscatedExternalAccountId"`
+}
+
+// GooglePlaySubscriptionPurchaseV2 represents Google Play subscription purchase (v2) response
+// API: GET .../applications/{packageName}/purchases/subscriptionsv2/tokens/{token}
+type GooglePlaySubscriptionPurchaseV2 struct {
+	SubscriptionState          string                       `json:"subscriptionState"` // SUBSCRIPTION_STATE_ACTIVE, SUBSCRIPTION_STATE_CANCELED, ...
+	LatestOrderID              string                       `json:"latestOrderId"`
+	StartTime                  string                       `json:"startTime"` // RFC 3339
+	LinkedPurchaseToken        string                       `json:"linkedPurchaseToken"`
+	AcknowledgementState       string                       `json:"acknowledgementState"`   // ACKNOWLEDGEMENT_STATE_PENDING or ACKNOWLEDGEMENT_STATE_ACKNOWLEDGED
+	TestPurchase               *struct{}                    `json:"testPurchase,omitempty"` // Present for license test purchases
+	LineItems                  []GooglePlaySubscriptionItem `json:"lineItems"`
+	ExternalAccountIdentifiers *struct {
+		ObfuscatedExternalAccountID string `json:"obfuscatedExternalAccountId"`
+	} `json:"externalAccountIdentifiers,omitempty"`
+}
+
+// GooglePlaySubscriptionItem represents a line item (one product) of a subscription purchase
+type GooglePlaySubscriptionItem struct {
+	ProductID        string `json:"productId"`
+	ExpiryTime       string `json:"expiryTime"` // RFC 3339
+	AutoRenewingPlan *struct {
+		AutoRenewEnabled bool `json:"autoRenewEnabled"`
+	} `json:"autoRenewingPlan,omitempty"`
+}
+
+// googlePlaySubscriptionStatuses maps Google subscription states to our status strings
+var googlePlaySubscriptionStatuses = map[string]string{
+	"SUBSCRIPTION_STATE_ACTIVE":                    "active",
+	"SUBSCRIPTION_STATE_CANCELED":                  "cancelled", // 已关闭自动续订，到期前仍可使用
+	"SUBSCRIPTION_STATE_IN_GRACE_PERIOD":           "grace_period",
+	"SUBSCRIPTION_STATE_ON_HOLD":                   "on_hold",
+	"SUBSCRIPTION_STATE_PAUSED":                    "paused",
+	"SUBSCRIPTION_STATE_EXPIRED":                   "expired",
+	"SUBSCRIPTION_STATE_PENDING":                   "inactive",
+	"SUBSCRIPTION_STATE_PENDING_PURCHASE_CANCELED": "inactive",
+}
+
+// GooglePlaySubscriptionStatus maps a Google subscription state to our status (unknown states are inactive)
+func GooglePlaySubscriptionStatus(state string) string {
+	if status, ok := googlePlaySubscriptionStatuses[state]; ok {
+		return status
+	}
+	return "inactive"
+}
+
+// googlePlayBaseOrderID strips the renewal suffix of an order ID (GPA.1234-5678-9012-34567..5 -> GPA.1234-5678-9012-34567)
+// The base order ID identifies the subscription across renewals like Apple's original transaction ID
+func googlePlayBaseOrderID(orderID string) string {
+	if i := strings.Index(orderID, ".."); i > 0 {
+		return orderID[:i]
+	}
+	return orderID
+}
+
+// googlePlayRenewalCount returns the renewal number of an order ID (GPA.1234-5678-9012-34567..5 -> 5, 0 for the first order)
+func googlePlayRenewalCount(orderID string) int {
+	i := strings.Index(orderID, "..")
+	if i < 0 {
+		return 0
+	}
+	n, err := strconv.Atoi(orderID[i+2:])
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// googlePlayLatestOrderDate estimates when the latest order (current billing period) was placed
+// subscriptionsv2 only reports the subscription start and the line item expiry, so the span is split evenly
+// over the first order and its renewals: expiry - (expiry - start) / (renewals + 1)
+// Returns startDate for the first order or when either date is missing
+func googlePlayLatestOrderDate(startDate, expiresDate time.Time, latestOrderID string) time.Time {
+	renewals := googlePlayRenewalCount(latestOrderID)
+	if renewals == 0 || startDate.IsZero() || !expiresDate.After(startDate) {
+		return startDate
+	}
+	period := expiresDate.Sub(startDate) / time.Duration(renewals+1)
+	return expiresDate.Add(-period)
+}
+
+// VerifyGooglePlayPurchase verifies Android subscription purchase using Google Play Developer API (subscriptionsv2)
+// and stores it like the Apple path; the purchase token is kept in LatestReceipt (FindSubscriptionByPurchaseToken)
+// productID selects the line item; empty means the line item expiring last
+func (s *SubscriptionVerificationService) VerifyGooglePlayPurchase(projectID, purchaseToken, productID, userID string) (*models.Subscription, error) {
+	if purchaseToken == "" {
+		return nil, fmt.Errorf("purchase_token is required")
+	}
+
+	// Get project to retrieve package_name (using database directly to avoid circular import)
+	db := database.GetDB()
+	var project models.Project
+	if err := db.Where("project_id = ? AND is_active = ?", projectID, true).First(&project).Error; err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	if project.PackageName == "" {
+		return nil, fmt.Errorf("package_name is not configured for project %s", projectID)
+	}
+
+	apiURL := fmt.Sprintf("%s/applications/%s/purchases/subscriptionsv2/tokens/%s",
+		googlePlayAPIBaseURL, url.PathEscape(project.PackageName), url.PathEscape(purchaseToken))
+
+	body, err := s.callGooglePlayAPI("GET", apiURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var purchase GooglePlaySubscriptionPurchaseV2
+	if err := json.Unmarshal(body, &purchase); err != nil {
+		return nil, fmt.Errorf("failed to parse subscription purchase response: %w", err)
+	}
+	if purchase.LatestOrderID == "" {
+		return nil, fmt.Errorf("latestOrderId is missing in subscription purchase response")
+	}
+
+	// Pick the requested product, otherwise the line item expiring last
+	var lineItem *GooglePlaySubscriptionItem
+	var expiresDate time.Time
+	for i := range purchase.LineItems {
+		item := &purchase.LineItems[i]
+		expiry, err := time.Parse(time.RFC3339Nano, item.ExpiryTime)
+		if err != nil {
+			continue
+		}
+		if productID != "" {
+			if item.ProductID == productID {
+				lineItem, expiresDate = item, expiry
+				break
+			}
+			continue
+		}
+		if lineItem == nil || expiry.After(expiresDate) {
+			lineItem, expiresDate = item, expiry
+		}
+	}
+	if lineItem == nil {
+		return nil, fmt.Errorf("no line item with an expiry time for product %q in subscription purchase", productID)
+	}
+
+	startDate, _ := time.Parse(time.RFC3339Nano, purchase.StartTime)
+
+	// testPurchase is set for license test purchases
+	environment := "production"
+	if purchase.TestPurchase != nil {
+		environment = "sandbox"
+	}
+
+	// Use obfuscatedExternalAccountId (equivalent of iOS appAccountToken) if available
+	finalUserID := userID
+	if ids := purchase.ExternalAccountIdentifiers; ids != nil && ids.ObfuscatedExternalAccountID != "" {
+		finalUserID = ids.ObfuscatedExternalAccountID
+	}
+
+	subscription := &models.Subscription{
+		AppAccountToken:       finalUserID,
+		ProjectID:             projectID,
+		Platform:              "android",
+		Status:                GooglePlaySubscriptionStatus(purchase.SubscriptionState),
+		StartDate:             startDate,
+		EndDate:               expiresDate,
+		ProductID:             lineItem.ProductID,
+		TransactionID:         purchase.LatestOrderID,
+		OriginalTransactionID: googlePlayBaseOrderID(purchase.LatestOrderID),
+		Environment:           environment,
+		PurchaseDate:          startDate,
+		ExpiresDate:           expiresDate,
+		AutoRenewStatus:       lineItem.AutoRenewingPlan != nil && lineItem.AutoRenewingPlan.AutoRenewEnabled,
+		LatestReceipt:         purchaseToken,
+		LatestReceiptInfo:     string(body),
+	}
+	// Age of the latest order like the latest transaction on iOS, so renewing subscriptions don't age out
+	if err := s.checkTransactionAge(googlePlayLatestOrderDate(startDate, expiresDate, purchase.LatestOrderID)); err != nil {
+		return nil, err
+	}
+
+	// Save or update subscription
+	if err := database.CreateOrUpdateSubscription(subscription); err != nil {
+		return nil, fmt.Errorf("failed to save subscription: %w", err)
+	}
+	if subscription.StateChanged {
+		PublishSubscriptionTransitionAsync(subscription.Previous, subscription, SubscriptionTrigger{Source: TransitionSourceVerification})
+	}
+
+	logging.Infof("Google Play subscription verified - project: %s, product: %s, order: %s, state: %s, environment: %s",
+		projectID, subscription.ProductID, purchase.LatestOrderID, purchase.SubscriptionState, environment)
+
+	// Acknowledge within 3 days or Google refunds the purchase; failures only get logged
+	if config.AppConfig.GooglePlayAutoAcknowledge && needsGooglePlayAcknowledgement(&purchase) {
+		if err := s.acknowledgeGooglePlaySubscription(project.PackageName, lineItem.ProductID, purchaseToken); err != nil {
+			logging.Errorf("Failed to acknowledge Google Play subscription - project: %s, product: %s, order: %s, error: %v",
+				projectID, lineItem.ProductID, purchase.LatestOrderID, err)
+		} else {
+			logging.Infof("Google Play subscription acknowledged - project: %s, product: %s, order: %s",
+				projectID, lineItem.ProductID, purchase.LatestOrderID)
+		}
+	}
+
+	return subscription, nil
+}
+
+// needsGooglePlayAcknowledgement reports whether a subscription purchase is paid but not acknowledged yet
+// Pending purchases can't be acknowledged until the payment completes
+func needsGooglePlayAcknowledgement(purchase *GooglePlaySubscriptionPurchaseV2) bool {
+	if purchase.AcknowledgementState != "ACKNOWLEDGEMENT_STATE_PENDING" {
+		return false
+	}
+	return purchase.SubscriptionState != "SUBSCRIPTION_STATE_PENDING" &&
+		purchase.SubscriptionState != "SUBSCRIPTION_STATE_PENDING_PURCHASE_CANCELED"
+}
+
+// acknowledgeGooglePlaySubscription acknowledges a subscription purchase
+// API: POST .../applications/{packageName}/purchases/subscriptions/{subscriptionId}/tokens/{token}:acknowledge
+func (s *SubscriptionVerificationService) acknowledgeGooglePlaySubscription(packageName, subscriptionID, purchaseToken string) error {
+	apiURL := fmt.Sprintf("%s/applications/%s/purchases/subscriptions/%s/tokens/%s:acknowledge",
+		googlePlayAPIBaseURL, url.PathEscape(packageName), url.PathEscape(subscriptionID), url.PathEscape(purchaseToken))
+	_, err := s.callGooglePlayAPI("POST", apiURL)
+	return err
+}
+
+// VerifyGooglePlayProduct verifies Android one-time product (non-consumable) purchase
+// and stores it as a non_consumable transaction
+func (s *SubscriptionVerificationService) VerifyGooglePlayProduct(projectID, purchaseToken, productID, userID string) (*models.Transaction, error) {
+	if purchaseToken == "" || productID == "" {
+		return nil, fmt.Errorf("purchase_token and product_id are required")
+	}
+
+	// Get project to retrieve package_name (using database directly to avoid circular import)
+	db := database.GetDB()
+	var project models.Project
+	if err := db.Where("project_id = ? AND is_active = ?", projectID, true).First(&project).Error; err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	if project.PackageName == "" {
+		return nil, fmt.Errorf("package_name is not configured for project %s", projectID)
+	}
+
+	apiURL := fmt.Sprintf("%s/applications/%s/purchases/products/%s/tokens/%s",
+		googlePlayAPIBaseURL, url.PathEscape(project.PackageName), url.PathEscape(productID), url.PathEscape(purchaseToken))
+
+	body, err := s.callGooglePlayAPI("GET", apiURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var purchase GooglePlayProductPurchase
+	if err := json.Unmarshal(body, &purchase); err != nil {
+		return nil, fmt.Errorf("failed to parse product purchase response: %w", err)
+	}
+
+	if purchase.PurchaseState != 0 {
+		return nil, fmt.Errorf("product purchase is not in purchased state: %d", purchase.PurchaseState)
+	}
+	if purchase.OrderID == "" {
+		return nil, fmt.Errorf("orderId is missing in product purchase response")
+	}
+
+	purchaseTimeMS, err := strconv.ParseInt(purchase.PurchaseTimeMillis, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse purchase time: %w", err)
+	}
+
+	// purchaseType=0 means a license test purchase
+	environment := "production"
+	if purchase.PurchaseType != nil && *purchase.PurchaseType == 0 {
+		environment = "sandbox"
+	}
+
+	// Use obfuscatedExternalAccountId (equivalent of iOS appAccountToken) if available
+	finalUserID := userID
+	if purchase.ObfuscatedExternalAccountID != "" {
+		finalUserID = purchase.ObfuscatedExternalAccountID
+	}
+
+	transaction := &models.Transaction{
+		ProjectID:             projectID,
+		AppAccountToken:       finalUserID,
+		TransactionID:         purchase.OrderID,
+		OriginalTransactionID: purchase.OrderID,
+		ProductID:             productID,
+		Type:                  "non_consumable",
+		Environment:           environment,
+		PurchasedAt:           time.UnixMilli(purchaseTimeMS),
+		PurchaseToken:         purchaseToken,
+	}
+
+	if err := database.CreateOrUpdateTransaction(transaction); err != nil {
+		return nil, fmt.Errorf("failed to save transaction: %w", err)
+	}
+
+	logging.Infof("Google Play product verified - project: %s, product: %s, order: %s, environment: %s",
+		projectID, productID, purchase.OrderID, environment)
+	if transaction.AppAccountToken == "" {
+		// Without an obfuscatedExternalAccountId the purchase stays unowned until the app binds it
+		logging.Warnf("Google Play product purchase has no user, bind it via bind_account - project: %s, order: %s",
+			projectID, purchase.OrderID)
+	}
+
+	return transaction, nil
+}
+
+// callGooglePlayAPI performs an authenticated Google Play Developer API request
+func (s *SubscriptionVerificationService) callGooglePlayAPI(method, apiURL string) ([]byte, error) {
+	accessToken, err := s.getGooglePlayAccessToken()
+	if errors.Is(err, ErrGooglePlayCredentialsNotConfigured) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Google Play access token: %w", err)
+	}
+	if err := s.waitStoreAPI(googlePlayAPILimiter); err != nil {
+		return nil, fmt.Errorf("Google Play API rate limit wait aborted: %w", err)
+	}
+
+	req, err := http.NewRequest(method, apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Google Play Developer API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Google Play Developer API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return body, nil
+}
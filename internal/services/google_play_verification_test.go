@@ -0,0 +1,28 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGooglePlayLatestOrderDate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		expires time.Time
+		orderID string
+		want    time.Time
+	}{
+		{"first order", start.AddDate(0, 0, 30), "GPA.1234-5678-9012-34567", start},
+		{"tenth renewal", start.AddDate(0, 0, 330), "GPA.1234-5678-9012-34567..10", start.AddDate(0, 0, 300)},
+		{"unparsable suffix", start.AddDate(0, 0, 330), "GPA.1234-5678-9012-34567..x", start},
+		{"missing expiry", time.Time{}, "GPA.1234-5678-9012-34567..3", start},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := googlePlayLatestOrderDate(start, tt.expires, tt.orderID); !got.Equal(tt.want) {
+				t.Errorf("googlePlayLatestOrderDate() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// googleOIDCCertsURL Google OIDC 签名公钥（JWKS）
+const googleOIDCCertsURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+// PubSubPushVerifier 验证 Google Pub/Sub push 请求携带的 OIDC token（Authorization: Bearer <jwt>）
+type PubSubPushVerifier struct {
+	audience   string // 期望的 aud（push 订阅配置的 audience），为空时不校验
+	httpClient *http.Client
+
+	mutex     sync.RWMutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+	keysTTL   time.Duration
+}
+
+// NewPubSubPushVerifier 创建 Pub/Sub push 验证器
+func NewPubSubPushVerifier(audience string) *PubSubPushVerifier {
+	return &PubSubPushVerifier{
+		audience:   audience,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		keys:       make(map[string]*rsa.PublicKey),
+		keysTTL:    time.Hour,
+	}
+}
+
+// VerifyAuthorizationHeader 验证 Authorization 请求头中的 OIDC token
+func (v *PubSubPushVerifier) VerifyAuthorizationHeader(header string) error {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		return fmt.Errorf("missing bearer token")
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer("https://accounts.google.com"),
+		jwt.WithExpirationRequired(),
+	}
+	if v.audience != "" {
+		options = append(options, jwt.WithAudience(v.audience))
+	}
+
+	_, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.publicKey(kid)
+	}, options...)
+	if err != nil {
+		return fmt.Errorf("invalid Pub/Sub OIDC token: %w", err)
+	}
+	return nil
+}
+
+// publicKey 获取 kid 对应的公钥，缓存过期或 kid 未知时重新拉取 JWKS
+func (v *PubSubPushVerifier) publicKey(kid string) (*rsa.PublicKey, error) {
+	v.mutex.RLock()
+	key, ok := v.keys[kid]
+	age := time.Since(v.fetchedAt)
+	v.mutex.RUnlock()
+	if ok && age < v.keysTTL {
+		return key, nil
+	}
+	// 未知 kid 最多每分钟刷新一次，避免伪造的 token 触发频繁拉取
+	if !ok && age < time.Minute {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	if err := v.refreshKeys(); err != nil {
+		return nil, err
+	}
+
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// refreshKeys 拉取 Google JWKS 并更新缓存
+func (v *PubSubPushVerifier) refreshKeys() error {
+	resp, err := v.httpClient.Get(googleOIDCCertsURL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch Google certs: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read Google certs: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch Google certs: status %d", resp.StatusCode)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &jwks); err != nil {
+		return fmt.Errorf("failed to parse Google certs: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	v.mutex.Lock()
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	v.mutex.Unlock()
+	return nil
+}
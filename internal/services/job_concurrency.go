@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"verification-api/internal/config"
+)
+
+// Store API limiters shared by all background jobs, so concurrent jobs together stay within
+// the Apple / Google quotas; nil means unlimited (see InitStoreAPILimiters)
+var (
+	appStoreAPILimiter   *TokenBucket
+	googlePlayAPILimiter *TokenBucket
+)
+
+// InitStoreAPILimiters creates the shared store API limiters from the configuration
+// Must be called before the scheduler starts
+func InitStoreAPILimiters() {
+	appStoreAPILimiter = NewTokenBucket(config.AppConfig.AppStoreAPIRateLimitPerSecond, int(config.AppConfig.AppStoreAPIRateLimitPerSecond))
+	googlePlayAPILimiter = NewTokenBucket(config.AppConfig.GooglePlayAPIRateLimitPerSecond, int(config.AppConfig.GooglePlayAPIRateLimitPerSecond))
+}
+
+// JobConcurrency returns the number of workers a bulk job uses (at least 1)
+func JobConcurrency() int {
+	return max(config.AppConfig.JobConcurrency, 1)
+}
+
+// ForEachConcurrent calls fn for every item with up to workers goroutines and waits for all of them
+// Items not yet started when ctx is done are skipped
+func ForEachConcurrent[T any](ctx context.Context, items []T, workers int, fn func(ctx context.Context, item T)) {
+	workers = min(max(workers, 1), len(items))
+	queue := make(chan T)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range queue {
+				fn(ctx, item)
+			}
+		}()
+	}
+
+feed:
+	for _, item := range items {
+		select {
+		case <-ctx.Done():
+			break feed
+		case queue <- item:
+		}
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// WithStoreRateLimit makes the service wait on the shared store API limiters before each
+// App Store / Google Play call; used by background jobs, request handlers are never throttled
+// Waiting stops when ctx is done (e.g. on shutdown) and the call fails with the context error
+func (s *SubscriptionVerificationService) WithStoreRateLimit(ctx context.Context) *SubscriptionVerificationService {
+	s.rateLimitCtx = ctx
+	return s
+}
+
+// NewJobVerificationService creates the verification service background jobs use for store calls
+// Every App Store / Google Play call it makes waits on the shared limiters; jobs must not use
+// NewSubscriptionVerificationService directly, or concurrent jobs could exceed the store quotas
+func NewJobVerificationService(ctx context.Context) *SubscriptionVerificationService {
+	return NewSubscriptionVerificationService().WithStoreRateLimit(ctx)
+}
+
+// waitStoreAPI blocks on limiter when the service is rate limited (see WithStoreRateLimit)
+func (s *SubscriptionVerificationService) waitStoreAPI(limiter *TokenBucket) error {
+	if s.rateLimitCtx == nil {
+		return nil
+	}
+	return limiter.Wait(s.rateLimitCtx)
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+	"verification-api/internal/database"
+	"verification-api/internal/models"
+	"verification-api/pkg/logging"
+	"verification-api/pkg/metrics"
+)
+
+const (
+	// notificationQueueBuffer 内存中等待 worker 的通知ID上限，超出的由定时扫描补上
+	notificationQueueBuffer = 1000
+	// notificationQueueSweepInterval 扫描到期 / 卡住通知的间隔
+	notificationQueueSweepInterval = 15 * time.Second
+	// notificationQueueStaleAfter processing 状态超过该时长视为 worker 已退出，重新放回队列
+	notificationQueueStaleAfter = 10 * time.Minute
+	// notificationQueueBaseBackoff / notificationQueueMaxBackoff 失败重试的退避间隔
+	notificationQueueBaseBackoff = 30 * time.Second
+	notificationQueueMaxBackoff  = time.Hour
+)
+
+// NotificationHandler processes one queued notification
+// retry reports whether a failed notification should be attempted again (e.g. a database error)
+type NotificationHandler func(notification *models.QueuedNotification) (retry bool, err error)
+
+// NotificationQueue processes verified App Store notifications asynchronously
+// Notifications are persisted before the webhook responds, so nothing is lost when the instance stops;
+// workers are fed in memory and a periodic sweep picks up retries, overflow and notifications of stopped instances
+type NotificationQueue struct {
+	handler     NotificationHandler
+	workers     int
+	maxAttempts int
+
+	ids      chan uint
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewNotificationQueue creates a notification queue, call Start to run the workers
+func NewNotificationQueue(handler NotificationHandler, workers, maxAttempts int) *NotificationQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &NotificationQueue{
+		handler:     handler,
+		workers:     workers,
+		maxAttempts: maxAttempts,
+		ids:         make(chan uint, notificationQueueBuffer),
+		stop:        make(chan struct{}),
+	}
+}
+
+// Start runs the workers and the sweep routine
+func (q *NotificationQueue) Start() {
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	q.wg.Add(1)
+	go q.sweepLoop()
+	logging.Infof("Notification queue started - workers: %d, max_attempts: %d", q.workers, q.maxAttempts)
+}
+
+// Stop stops the workers, waiting at most timeout for notifications being processed
+// Notifications left in the queue stay pending and are processed after the next start
+func (q *NotificationQueue) Stop(timeout time.Duration) {
+	q.stopOnce.Do(func() {
+		close(q.stop)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		logging.Warnf("Notification queue workers did not stop within %v", timeout)
+	}
+}
+
+// Enqueue persists the notification as pending and hands it to a worker
+// An error means the notification was not stored, the caller should process it inline instead
+func (q *NotificationQueue) Enqueue(notification *models.QueuedNotification) error {
+	notification.Status = models.QueuedNotificationPending
+	notification.NextAttemptAt = time.Now()
+	if err := database.CreateQueuedNotification(notification); err != nil {
+		return err
+	}
+	metrics.IncCounter("appstore_notification_queue_total", map[string]string{"result": "enqueued"})
+	q.offer(notification.ID)
+	return nil
+}
+
+// offer hands an ID to the workers without blocking; when the buffer is full the sweep picks it up later
+func (q *NotificationQueue) offer(id uint) {
+	select {
+	case q.ids <- id:
+	default:
+		logging.Debugf("Notification queue buffer full, notification %d left for the next sweep", id)
+	}
+}
+
+// work processes notification IDs until the queue is stopped
+func (q *NotificationQueue) work() {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case id := <-q.ids:
+			q.process(id)
+		}
+	}
+}
+
+// sweepLoop periodically re-offers due notifications and requeues the stale ones
+func (q *NotificationQueue) sweepLoop() {
+	defer q.wg.Done()
+	ticker := time.NewTicker(notificationQueueSweepInterval)
+	defer ticker.Stop()
+
+	q.sweep()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+			q.sweep()
+		}
+	}
+}
+
+// sweep requeues notifications stuck in processing and offers the pending ones that are due
+func (q *NotificationQueue) sweep() {
+	if requeued, err := database.RequeueStaleQueuedNotifications(time.Now().Add(-notificationQueueStaleAfter)); err != nil {
+		logging.Errorf("Failed to requeue stale notifications: %v", err)
+	} else if requeued > 0 {
+		logging.Warnf("Requeued %d notifications stuck in processing for more than %v", requeued, notificationQueueStaleAfter)
+	}
+
+	ids, err := database.GetDueQueuedNotificationIDs(time.Now(), notificationQueueBuffer-len(q.ids))
+	if err != nil {
+		logging.Errorf("Failed to load pending notifications: %v", err)
+		return
+	}
+	for _, id := range ids {
+		q.offer(id)
+	}
+}
+
+// process claims one notification, runs the handler and stores the outcome
+func (q *NotificationQueue) process(id uint) {
+	notification, err := database.ClaimQueuedNotification(id)
+	if err != nil {
+		logging.Errorf("Failed to claim queued notification %d: %v", id, err)
+		return
+	}
+	if notification == nil {
+		// 已被其他 worker / 实例领取
+		return
+	}
+
+	startTime := time.Now()
+	retry, err := q.handle(notification)
+	notification.Attempts++
+
+	result := "processed"
+	switch {
+	case err == nil:
+		now := time.Now()
+		notification.Status = models.QueuedNotificationProcessed
+		notification.LastError = ""
+		notification.ProcessedAt = &now
+	case retry && notification.Attempts < q.maxAttempts:
+		result = "retry"
+		notification.Status = models.QueuedNotificationPending
+		notification.LastError = err.Error()
+		notification.NextAttemptAt = time.Now().Add(notificationQueueBackoff(notification.Attempts))
+	default:
+		result = "failed"
+		notification.Status = models.QueuedNotificationFailed
+		notification.LastError = err.Error()
+	}
+	metrics.IncCounter("appstore_notification_queue_total", map[string]string{"result": result})
+
+	if updateErr := database.UpdateQueuedNotification(notification); updateErr != nil {
+		logging.Errorf("Failed to save queued notification %d (status: %s): %v", notification.ID, notification.Status, updateErr)
+	}
+
+	switch result {
+	case "processed":
+		logging.Infof("Queued notification processed - id: %d, uuid: %s, type: %s, attempts: %d, time: %v",
+			notification.ID, notification.NotificationUUID, notification.NotificationType, notification.Attempts, time.Since(startTime))
+	case "retry":
+		logging.Warnf("Queued notification failed, retrying at %s - id: %d, uuid: %s, attempt: %d/%d, error: %v",
+			notification.NextAttemptAt.Format(time.RFC3339), notification.ID, notification.NotificationUUID, notification.Attempts, q.maxAttempts, err)
+	default:
+		logging.Errorf("Queued notification failed - id: %d, uuid: %s, type: %s, attempts: %d, error: %v",
+			notification.ID, notification.NotificationUUID, notification.NotificationType, notification.Attempts, err)
+	}
+}
+
+// handle runs the handler, converting a panic into a retryable error
+func (q *NotificationQueue) handle(notification *models.QueuedNotification) (retry bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logging.Errorf("Queued notification panic recovered - id: %d, panic: %v\n%s", notification.ID, r, debug.Stack())
+			retry, err = true, fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return q.handler(notification)
+}
+
+// notificationQueueBackoff returns the delay before the next attempt: 30s, 1m, 2m, ... up to 1h
+func notificationQueueBackoff(attempts int) time.Duration {
+	if shift := attempts - 1; shift < 8 {
+		return min(notificationQueueBaseBackoff<<shift, notificationQueueMaxBackoff)
+	}
+	return notificationQueueMaxBackoff
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"verification-api/internal/models"
+)
+
+// Plan resolution strategies (per project)
+const (
+	PlanStrategySuffix      = "suffix"      // 从 product_id 末尾提取周期（默认），如 com.app.pro.monthly -> monthly
+	PlanStrategyMap         = "map"         // 使用显式映射 plan_mapping（product_id -> plan）
+	PlanStrategyRegex       = "regex"       // 使用 plan_pattern 正则的第一个捕获组
+	PlanStrategyPassthrough = "passthrough" // plan 即 product_id
+)
+
+// DefaultPlan is returned when the plan cannot be resolved
+const DefaultPlan = "basic"
+
+// planSuffixes maps product_id suffixes to plan names (suffix strategy)
+var planSuffixes = map[string]string{
+	"weekly":     "weekly",
+	"week":       "weekly",
+	"monthly":    "monthly",
+	"month":      "monthly",
+	"quarterly":  "quarterly",
+	"quarter":    "quarterly",
+	"semiannual": "semiannual",
+	"halfyear":   "semiannual",
+	"yearly":     "yearly",
+	"year":       "yearly",
+	"annual":     "yearly",
+	"annually":   "yearly",
+	"lifetime":   "lifetime",
+}
+
+// ResolvePlan resolves the plan of a product using the project's plan strategy
+func ResolvePlan(project *models.Project, productID string) string {
+	if productID == "" {
+		return ""
+	}
+	if project == nil {
+		return planFromSuffix(productID)
+	}
+
+	switch project.PlanStrategy {
+	case PlanStrategyPassthrough:
+		return productID
+	case PlanStrategyMap:
+		var mapping map[string]string
+		if err := json.Unmarshal([]byte(project.PlanMapping), &mapping); err == nil {
+			if plan, ok := mapping[productID]; ok {
+				return plan
+			}
+		}
+		return planFromSuffix(productID)
+	case PlanStrategyRegex:
+		if re, err := regexp.Compile(project.PlanPattern); err == nil {
+			if match := re.FindStringSubmatch(productID); match != nil {
+				if len(match) > 1 && match[1] != "" {
+					return match[1]
+				}
+				return match[0]
+			}
+		}
+		return DefaultPlan
+	default:
+		return planFromSuffix(productID)
+	}
+}
+
+// planFromSuffix extracts the plan from the last segment of the product_id (separated by . _ -)
+func planFromSuffix(productID string) string {
+	segments := strings.FieldsFunc(strings.ToLower(productID), func(r rune) bool {
+		return r == '.' || r == '_' || r == '-'
+	})
+	for i := len(segments) - 1; i >= 0; i-- {
+		if plan, ok := planSuffixes[segments[i]]; ok {
+			return plan
+		}
+		// 带数字的周期，如 3month、2weeks
+		if period := billingPeriodFromLabel(segments[i]); period != "" {
+			return PlanFromBillingPeriod(period)
+		}
+	}
+	return DefaultPlan
+}
+
+// ResolveSubscriptionPlan resolves the plan of a subscription
+// Falls back to the stored billing period when the product_id doesn't carry a recognizable plan
+func ResolveSubscriptionPlan(project *models.Project, subscription *models.Subscription) string {
+	plan := ResolvePlan(project, subscription.ProductID)
+	if plan == DefaultPlan && subscription.BillingPeriod != "" {
+		if periodPlan := PlanFromBillingPeriod(subscription.BillingPeriod); periodPlan != "" {
+			return periodPlan
+		}
+	}
+	return plan
+}
+
+// ValidatePlanConfig validates a project's plan strategy configuration
+func ValidatePlanConfig(strategy, mapping, pattern string) error {
+	switch strategy {
+	case "", PlanStrategySuffix, PlanStrategyPassthrough:
+		return nil
+	case PlanStrategyMap:
+		var m map[string]string
+		if err := json.Unmarshal([]byte(mapping), &m); err != nil {
+			return fmt.Errorf("plan_mapping must be a JSON object of product_id to plan: %w", err)
+		}
+		return nil
+	case PlanStrategyRegex:
+		if pattern == "" {
+			return fmt.Errorf("plan_pattern is required for regex strategy")
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid plan_pattern: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid plan_strategy %q (must be suffix, map, regex or passthrough)", strategy)
+	}
+}
+
+// PlanResolver resolves plans for subscriptions of multiple projects, caching project lookups
+type PlanResolver struct {
+	projectService *ProjectService
+	projects       map[string]*models.Project
+}
+
+// NewPlanResolver creates a new plan resolver
+func NewPlanResolver() *PlanResolver {
+	return &PlanResolver{
+		projectService: NewProjectService(),
+		projects:       make(map[string]*models.Project),
+	}
+}
+
+// Resolve resolves the plan of a subscription in its project
+func (r *PlanResolver) Resolve(subscription *models.Subscription) string {
+	project, ok := r.projects[subscription.ProjectID]
+	if !ok {
+		project, _ = r.projectService.GetProjectForAdmin(subscription.ProjectID)
+		r.projects[subscription.ProjectID] = project
+	}
+	return ResolveSubscriptionPlan(project, subscription)
+}
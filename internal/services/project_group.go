@@ -0,0 +1,89 @@
+package services
+
+import (
+	"fmt"
+	"verification-api/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// CodeNamespace returns the Redis namespace of a project's verification codes
+// Projects in a group share the "group:<group_id>" namespace, so a code sent for one
+// project of the group can be verified by the others; other projects use their project ID
+func CodeNamespace(project *models.Project) string {
+	if project.GroupID != "" {
+		return "group:" + project.GroupID
+	}
+	return project.ProjectID
+}
+
+// GetProjectGroup gets a project group by group ID
+func (s *ProjectService) GetProjectGroup(groupID string) (*models.ProjectGroup, error) {
+	var group models.ProjectGroup
+	result := s.db.Where("group_id = ?", groupID).First(&group)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("project group not found: %s", groupID)
+		}
+		return nil, result.Error
+	}
+	return &group, nil
+}
+
+// ListProjectGroups lists all project groups
+func (s *ProjectService) ListProjectGroups() ([]*models.ProjectGroup, error) {
+	var groups []*models.ProjectGroup
+	if err := s.db.Order("id ASC").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// CreateProjectGroup creates a new project group
+func (s *ProjectService) CreateProjectGroup(group *models.ProjectGroup) error {
+	var existing models.ProjectGroup
+	if result := s.db.Where("group_id = ?", group.GroupID).First(&existing); result.Error == nil {
+		return fmt.Errorf("project group with ID %s already exists", group.GroupID)
+	}
+
+	if err := s.db.Create(group).Error; err != nil {
+		return fmt.Errorf("failed to create project group: %w", err)
+	}
+	return nil
+}
+
+// GetGroupProjects gets the project IDs of a group's members
+func (s *ProjectService) GetGroupProjects(groupID string) ([]string, error) {
+	var projectIDs []string
+	if err := s.db.Model(&models.Project{}).Where("group_id = ?", groupID).Order("id ASC").Pluck("project_id", &projectIDs).Error; err != nil {
+		return nil, err
+	}
+	return projectIDs, nil
+}
+
+// ValidateGroupCodeSettings checks that a grouped project uses the same code format and expiry as the other members
+// Codes are shared within a group but checked against the format and expiry of the project verifying them,
+// so members with different settings would reject each other's codes
+func (s *ProjectService) ValidateGroupCodeSettings(project *models.Project) error {
+	if project.GroupID == "" {
+		return nil
+	}
+	var members []models.Project
+	if err := s.db.Where("group_id = ? AND project_id <> ?", project.GroupID, project.ProjectID).Find(&members).Error; err != nil {
+		return err
+	}
+
+	format := CodeFormatForProject(project)
+	expireMinutes := CodeExpireMinutesForProject(project)
+	for i := range members {
+		if CodeFormatForProject(&members[i]) != format {
+			return fmt.Errorf("code_length / code_type must match the other projects of group %s (project %s differs)",
+				project.GroupID, members[i].ProjectID)
+		}
+		if CodeExpireMinutesForProject(&members[i]) != expireMinutes {
+			return fmt.Errorf("code_expire_minutes must match the other projects of group %s (project %s differs)",
+				project.GroupID, members[i].ProjectID)
+		}
+	}
+	return nil
+}
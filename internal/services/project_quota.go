@@ -0,0 +1,39 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// projectQuotaKey counts the verification codes sent by a project on a UTC day
+func projectQuotaKey(projectID string, t time.Time) string {
+	return fmt.Sprintf("quota:%s:%s", projectID, t.UTC().Format("20060102"))
+}
+
+// ReserveDailyQuota atomically counts a verification code against the project's daily quota (max_requests) of the day of now
+// Returns false without counting when the quota has been reached; maxRequests <= 0 means unlimited
+// A reservation whose code is not delivered is given back with ReleaseDailyQuota and the same now; the counter expires at the end of the UTC day
+// Replaces CheckDailyQuota + IncrementDailyQuota, whose separate check and increment let concurrent sends exceed the quota
+func (r *RedisService) ReserveDailyQuota(projectID string, maxRequests int, now time.Time) (int64, bool, error) {
+	ctx := context.Background()
+	now = now.UTC()
+	endOfDay := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	ttl := max(int(endOfDay.Sub(now).Seconds()), 1)
+
+	count, err := reserveEmailQuotaScript.Run(ctx, r.client,
+		[]string{projectQuotaKey(projectID, now)}, maxRequests, ttl).Int64()
+	if err != nil {
+		return 0, false, err
+	}
+	if count < 0 {
+		return int64(maxRequests), false, nil
+	}
+	return count, true, nil
+}
+
+// ReleaseDailyQuota gives back a reservation taken by ReserveDailyQuota (with the same now) whose code was not delivered
+func (r *RedisService) ReleaseDailyQuota(projectID string, now time.Time) error {
+	ctx := context.Background()
+	return releaseQuotaScript.Run(ctx, r.client, []string{projectQuotaKey(projectID, now)}).Err()
+}
@@ -1,13 +1,35 @@
 package services
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"verification-api/internal/database"
 	"verification-api/internal/models"
 
 	"gorm.io/gorm"
 )
 
+// Project lookup errors, distinguishable with errors.Is
+var (
+	ErrProjectNotFound = errors.New("project not found")
+	ErrProjectInactive = errors.New("project is inactive")
+)
+
+// Error codes returned to clients for the project lookup errors
+const (
+	ProjectNotFoundCode = "PROJECT_NOT_FOUND"
+	ProjectInactiveCode = "PROJECT_INACTIVE"
+)
+
+// ProjectErrorCode returns the client error code of a project lookup error
+func ProjectErrorCode(err error) string {
+	if errors.Is(err, ErrProjectInactive) {
+		return ProjectInactiveCode
+	}
+	return ProjectNotFoundCode
+}
+
 // ProjectService provides project management operations
 type ProjectService struct {
 	db *gorm.DB
@@ -20,13 +42,41 @@ func NewProjectService() *ProjectService {
 	}
 }
 
+// findActiveProject gets the active project matching column = value
+// Returns ErrProjectInactive when only deactivated projects match, ErrProjectNotFound when none does
+func (s *ProjectService) findActiveProject(column, value string) (*models.Project, error) {
+	var project models.Project
+	result := s.db.Where(column+" = ? AND is_active = ?", value, true).First(&project)
+	if result.Error == nil {
+		return &project, nil
+	}
+	if result.Error != gorm.ErrRecordNotFound {
+		return nil, result.Error
+	}
+
+	// 区分"已停用"和"不存在"
+	var count int64
+	if err := s.db.Model(&models.Project{}).Where(column+" = ?", value).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrProjectInactive
+	}
+	return nil, ErrProjectNotFound
+}
+
 // GetProjectByID gets project by ID
 func (s *ProjectService) GetProjectByID(projectID string) (*models.Project, error) {
+	return s.findActiveProject("project_id", projectID)
+}
+
+// GetProjectForAdmin gets project by ID regardless of active status (for admin use)
+func (s *ProjectService) GetProjectForAdmin(projectID string) (*models.Project, error) {
 	var project models.Project
-	result := s.db.Where("project_id = ? AND is_active = ?", projectID, true).First(&project)
+	result := s.db.Where("project_id = ?", projectID).First(&project)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("project not found")
+			return nil, ErrProjectNotFound
 		}
 		return nil, result.Error
 	}
@@ -35,50 +85,39 @@ func (s *ProjectService) GetProjectByID(projectID string) (*models.Project, erro
 
 // GetProjectByAPIKey gets project by API key
 func (s *ProjectService) GetProjectByAPIKey(apiKey string) (*models.Project, error) {
-	var project models.Project
-	result := s.db.Where("api_key = ? AND is_active = ?", apiKey, true).First(&project)
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("project not found")
-		}
-		return nil, result.Error
-	}
-	return &project, nil
+	return s.findActiveProject("api_key", apiKey)
 }
 
 // ValidateProject validates project ID and API key
-func (s *ProjectService) ValidateProject(projectID, apiKey string) bool {
-	project, err := s.GetProjectByID(projectID)
-	if err != nil {
-		return false
+// Returns ErrProjectInactive only when the API key matches a deactivated project, so the
+// status of a project is not revealed without its key; any other failure is ErrProjectNotFound
+func (s *ProjectService) ValidateProject(projectID, apiKey string) error {
+	project, err := s.GetProjectForAdmin(projectID)
+	if err != nil || project.APIKey != apiKey {
+		return ErrProjectNotFound
+	}
+	if !project.IsActive {
+		return ErrProjectInactive
 	}
-	return project.APIKey == apiKey && project.IsActive
+	return nil
 }
 
 // GetProjectByBundleID gets project by bundle ID (iOS App identification)
 func (s *ProjectService) GetProjectByBundleID(bundleID string) (*models.Project, error) {
-	var project models.Project
-	result := s.db.Where("bundle_id = ? AND is_active = ?", bundleID, true).First(&project)
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("project not found for bundle_id: %s", bundleID)
-		}
-		return nil, result.Error
+	project, err := s.findActiveProject("bundle_id", bundleID)
+	if errors.Is(err, ErrProjectNotFound) || errors.Is(err, ErrProjectInactive) {
+		return nil, fmt.Errorf("%w for bundle_id: %s", err, bundleID)
 	}
-	return &project, nil
+	return project, err
 }
 
 // GetProjectByPackageName gets project by package name (Android App identification)
 func (s *ProjectService) GetProjectByPackageName(packageName string) (*models.Project, error) {
-	var project models.Project
-	result := s.db.Where("package_name = ? AND is_active = ?", packageName, true).First(&project)
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("project not found for package_name: %s", packageName)
-		}
-		return nil, result.Error
+	project, err := s.findActiveProject("package_name", packageName)
+	if errors.Is(err, ErrProjectNotFound) || errors.Is(err, ErrProjectInactive) {
+		return nil, fmt.Errorf("%w for package_name: %s", err, packageName)
 	}
-	return &project, nil
+	return project, err
 }
 
 // GetAllProjects gets all active projects
@@ -91,6 +130,47 @@ func (s *ProjectService) GetAllProjects() ([]*models.Project, error) {
 	return projects, nil
 }
 
+// ProjectFilter represents admin project listing filters
+type ProjectFilter struct {
+	Query       string // Fuzzy match on project_id, project_name, contact_email, bundle_id
+	BundleID    string // Exact match
+	PackageName string // Exact match
+	IsActive    *bool  // nil means all projects
+}
+
+// ListProjects lists projects matching the filter with pagination
+// Returns the projects of the requested page and the total matching count
+func (s *ProjectService) ListProjects(filter ProjectFilter, limit, offset int) ([]*models.Project, int64, error) {
+	query := s.db.Model(&models.Project{})
+
+	if filter.Query != "" {
+		like := "%" + strings.ToLower(filter.Query) + "%"
+		query = query.Where("LOWER(project_id) LIKE ? OR LOWER(project_name) LIKE ? OR LOWER(contact_email) LIKE ? OR LOWER(bundle_id) LIKE ?",
+			like, like, like, like)
+	}
+	if filter.BundleID != "" {
+		query = query.Where("bundle_id = ?", filter.BundleID)
+	}
+	if filter.PackageName != "" {
+		query = query.Where("package_name = ?", filter.PackageName)
+	}
+	if filter.IsActive != nil {
+		query = query.Where("is_active = ?", *filter.IsActive)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var projects []*models.Project
+	result := query.Order("id ASC").Offset(offset).Limit(limit).Find(&projects)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+	return projects, total, nil
+}
+
 // CreateProject creates a new project
 func (s *ProjectService) CreateProject(project *models.Project) error {
 	// Check if project ID already exists
@@ -139,7 +219,7 @@ func (s *ProjectService) UpdateProject(projectID string, updates map[string]inte
 	var existingProject models.Project
 	result := s.db.Where("project_id = ?", projectID).First(&existingProject)
 	if result.Error != nil {
-		return fmt.Errorf("project not found")
+		return ErrProjectNotFound
 	}
 
 	// Check if bundle_id conflicts with another project (if being updated)
@@ -169,7 +249,7 @@ func (s *ProjectService) UpdateProject(projectID string, updates map[string]inte
 		return fmt.Errorf("failed to update project: %w", result.Error)
 	}
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("project not found")
+		return ErrProjectNotFound
 	}
 	return nil
 }
@@ -181,7 +261,7 @@ func (s *ProjectService) DeleteProject(projectID string) error {
 		return fmt.Errorf("failed to delete project: %w", result.Error)
 	}
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("project not found")
+		return ErrProjectNotFound
 	}
 	return nil
 }
@@ -3,7 +3,9 @@ package services
 import (
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
+	"math/big"
 	"time"
 	"verification-api/internal/config"
 
@@ -33,21 +35,68 @@ func NewRedisService() (*RedisService, error) {
 	return &RedisService{client: client}, nil
 }
 
-// GenerateCode generates a 6-digit verification code
-func (r *RedisService) GenerateCode() (string, error) {
-	bytes := make([]byte, 3)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
+// AppendToStream adds an entry to a Redis stream, trimming it to about maxLen entries (0 = no limit)
+func (r *RedisService) AppendToStream(ctx context.Context, stream string, maxLen int64, values map[string]interface{}) error {
+	return r.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: maxLen,
+		Approx: maxLen > 0,
+		Values: values,
+	}).Err()
+}
+
+// GenerateCode generates a verification code of length characters
+// Numeric codes are digits only (leading zeros kept), alphanumeric codes use uppercase letters and digits
+func (r *RedisService) GenerateCode(length int, alphanumeric bool) (string, error) {
+	charset := CodeCharsetDigits
+	if alphanumeric {
+		charset = CodeCharsetAlphanumeric
+	}
+
+	code := make([]byte, length)
+	size := big.NewInt(int64(len(charset)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", err
+		}
+		code[i] = charset[n.Int64()]
 	}
-	// Generate 6-digit verification code
-	code := (int(bytes[0])<<16 | int(bytes[1])<<8 | int(bytes[2])) % 1000000
-	return fmt.Sprintf("%06d", code), nil
+	return string(code), nil
+}
+
+// Verification code policies
+const (
+	// CodePolicyLatestOnly 仅最新发送的验证码有效（再次发送会覆盖之前的验证码）
+	CodePolicyLatestOnly = "latest-only"
+	// CodePolicyAcceptAnyRecent 有效期内最近 N 个验证码均有效
+	// 体验更好（先发的邮件后到也能用），但同时有效的验证码增多，暴力猜测的成功率按 N 倍提高
+	CodePolicyAcceptAnyRecent = "accept-any-recent"
+)
+
+// ErrCodeNotFound is returned when no valid verification code exists
+var ErrCodeNotFound = errors.New("verification code not found or expired")
+
+func codeKey(projectID, email string) string {
+	return fmt.Sprintf("verification_code:%s:%s", projectID, email)
+}
+
+func recentCodesKey(projectID, email string) string {
+	return fmt.Sprintf("verification_codes:%s:%s", projectID, email)
+}
+
+func acceptAnyRecent() bool {
+	return config.AppConfig.CodePolicy == CodePolicyAcceptAnyRecent
 }
 
 // StoreCode stores verification code (supports multi-project)
 func (r *RedisService) StoreCode(projectID, email, code string, expireMinutes int) error {
+	if acceptAnyRecent() {
+		return r.storeRecentCode(projectID, email, code, expireMinutes)
+	}
+
 	ctx := context.Background()
-	key := fmt.Sprintf("verification_code:%s:%s", projectID, email)
+	key := codeKey(projectID, email)
 
 	data := map[string]interface{}{
 		"code":       code,
@@ -62,15 +111,38 @@ func (r *RedisService) StoreCode(projectID, email, code string, expireMinutes in
 	return r.client.Expire(ctx, key, expire).Err()
 }
 
+// storeRecentCode adds the code to a sorted set (score = created_at)
+// Codes older than the TTL are removed and only the latest CodeMaxOutstanding codes are kept
+func (r *RedisService) storeRecentCode(projectID, email, code string, expireMinutes int) error {
+	ctx := context.Background()
+	key := recentCodesKey(projectID, email)
+	now := time.Now()
+	expire := time.Duration(expireMinutes) * time.Minute
+
+	maxOutstanding := config.AppConfig.CodeMaxOutstanding
+	if maxOutstanding < 1 {
+		maxOutstanding = 1
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.Unix()), Member: code})
+	pipe.ZRemRangeByScore(ctx, key, "-inf", fmt.Sprintf("(%d", now.Add(-expire).Unix()))
+	pipe.ZRemRangeByRank(ctx, key, 0, int64(-maxOutstanding-1))
+	pipe.Expire(ctx, key, expire)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
 // GetCode gets verification code (supports multi-project)
+// Only applies to the latest-only policy
 func (r *RedisService) GetCode(projectID, email string) (string, error) {
 	ctx := context.Background()
-	key := fmt.Sprintf("verification_code:%s:%s", projectID, email)
+	key := codeKey(projectID, email)
 
 	code, err := r.client.HGet(ctx, key, "code").Result()
 	if err != nil {
 		if err == redis.Nil {
-			return "", fmt.Errorf("verification code not found or expired")
+			return "", ErrCodeNotFound
 		}
 		return "", err
 	}
@@ -78,10 +150,108 @@ func (r *RedisService) GetCode(projectID, email string) (string, error) {
 	return code, nil
 }
 
+// CheckCode checks whether the code is valid under the configured policy
+// Returns ErrCodeNotFound if there is no outstanding code at all
+func (r *RedisService) CheckCode(projectID, email, code string, expireMinutes int) (bool, error) {
+	if !acceptAnyRecent() {
+		storedCode, err := r.GetCode(projectID, email)
+		if err != nil {
+			return false, err
+		}
+		return storedCode == code, nil
+	}
+
+	ctx := context.Background()
+	key := recentCodesKey(projectID, email)
+
+	count, err := r.client.ZCard(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	if count == 0 {
+		return false, ErrCodeNotFound
+	}
+
+	createdAt, err := r.client.ZScore(ctx, key, code).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return false, nil
+		}
+		return false, err
+	}
+
+	expire := time.Duration(expireMinutes) * time.Minute
+	return time.Since(time.Unix(int64(createdAt), 0)) <= expire, nil
+}
+
 // DeleteCode deletes verification code (supports multi-project)
+// Removes all outstanding codes of the email, whichever policy stored them
 func (r *RedisService) DeleteCode(projectID, email string) error {
 	ctx := context.Background()
-	key := fmt.Sprintf("verification_code:%s:%s", projectID, email)
+	return r.client.Del(ctx, codeKey(projectID, email), recentCodesKey(projectID, email)).Err()
+}
+
+func failedAttemptsKey(projectID, email string) string {
+	return fmt.Sprintf("verify_attempts:%s:%s", projectID, email)
+}
+
+// incrFailedAttemptScript increments the failed attempt counter and sets its expiry in one step
+// A counter without expiry (left by a failed EXPIRE before this script existed) gets one as well
+var incrFailedAttemptScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 or redis.call("PTTL", KEYS[1]) < 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// IncrFailedAttempt counts a failed verification of the email and returns the new count
+// The counter expires ttl after the first failure (the code expiry), so it resets with the code
+// INCR and the expiry run atomically, so a counter can never be left without expiry and lock the email out for good
+func (r *RedisService) IncrFailedAttempt(projectID, email string, ttl time.Duration) (int64, error) {
+	ctx := context.Background()
+	return incrFailedAttemptScript.Run(ctx, r.client, []string{failedAttemptsKey(projectID, email)}, ttl.Milliseconds()).Int64()
+}
+
+// GetFailedAttempts returns the failed verifications of the email since the counter was reset
+func (r *RedisService) GetFailedAttempts(projectID, email string) (int64, error) {
+	ctx := context.Background()
+	count, err := r.client.Get(ctx, failedAttemptsKey(projectID, email)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return count, err
+}
+
+// ResetFailedAttempts clears the failed verification counter of the email
+func (r *RedisService) ResetFailedAttempts(projectID, email string) error {
+	ctx := context.Background()
+	return r.client.Del(ctx, failedAttemptsKey(projectID, email)).Err()
+}
+
+// AcquireSyncSlot reserves a subscription sync for the user
+// Returns false if the user already synced within the interval
+func (r *RedisService) AcquireSyncSlot(projectID, userID string, interval time.Duration) (bool, error) {
+	if interval <= 0 {
+		return true, nil
+	}
+	ctx := context.Background()
+	key := fmt.Sprintf("subscription_sync:%s:%s", projectID, userID)
+	return r.client.SetNX(ctx, key, "1", interval).Result()
+}
+
+// RecordNotification records a processed store notification for ttl
+// Returns false if it was already recorded (a replay)
+func (r *RedisService) RecordNotification(notificationID string, ttl time.Duration) (bool, error) {
+	ctx := context.Background()
+	key := fmt.Sprintf("processed_notification:%s", notificationID)
+	return r.client.SetNX(ctx, key, time.Now().Unix(), ttl).Result()
+}
+
+// ForgetNotification removes a recorded store notification so it can be processed again
+func (r *RedisService) ForgetNotification(notificationID string) error {
+	ctx := context.Background()
+	key := fmt.Sprintf("processed_notification:%s", notificationID)
 	return r.client.Del(ctx, key).Err()
 }
 
@@ -93,6 +263,19 @@ func (r *RedisService) SetRateLimit(projectID, email string, limitMinutes int) e
 	return r.client.Set(ctx, key, "1", expire).Err()
 }
 
+// ClearRateLimit removes the send-code rate limit of an email
+// Returns false if the email was not rate limited
+func (r *RedisService) ClearRateLimit(projectID, email string) (bool, error) {
+	ctx := context.Background()
+	key := fmt.Sprintf("rate_limit:%s:%s", projectID, email)
+
+	deleted, err := r.client.Del(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, nil
+}
+
 // CheckRateLimit checks rate limit (supports multi-project)
 func (r *RedisService) CheckRateLimit(projectID, email string) (bool, error) {
 	ctx := context.Background()
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"verification-api/internal/config"
+	"verification-api/internal/models"
+)
+
+// Renewal count policies on resubscribe (RENEWAL_COUNT_RESUBSCRIBE_POLICY)
+const (
+	RenewalCountContinue = "continue" // default: keep counting across lapses
+	RenewalCountReset    = "reset"    // start again from 0 when the user resubscribes
+)
+
+// RecordRenewal counts a DID_RENEW of the subscription
+// Each renewal transaction is counted once, so reprocessed notifications do not inflate the count
+func RecordRenewal(subscription *models.Subscription, transactionID string) {
+	if transactionID == "" || transactionID == subscription.LastRenewalTransactionID {
+		return
+	}
+	subscription.RenewalCount++
+	subscription.LastRenewalTransactionID = transactionID
+}
+
+// RecordResubscribe applies the resubscribe policy when a lapsed subscription starts again with a new transaction
+func RecordResubscribe(subscription *models.Subscription, transactionID string) {
+	if transactionID == "" || transactionID == subscription.TransactionID {
+		return
+	}
+	if config.AppConfig.RenewalCountResubscribePolicy == RenewalCountReset {
+		subscription.RenewalCount = 0
+	}
+}
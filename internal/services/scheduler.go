@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+	"verification-api/pkg/logging"
+	"verification-api/pkg/metrics"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Job 定时任务
+type Job struct {
+	Name     string                          // 任务名（同时作为 Redis 锁的 key）
+	Interval time.Duration                   // 执行间隔
+	Run      func(ctx context.Context) error // 任务逻辑，ctx 在关闭时取消
+}
+
+// Scheduler 定时任务调度器
+// 每个任务每个周期通过 Redis SET NX 租约选主，保证多副本下只有一个实例执行
+type Scheduler struct {
+	redis      *redis.Client
+	instanceID string
+	jobs       []Job
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// renewLeaseScript 仅当租约仍属于本实例时续期
+var renewLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// NewScheduler 创建调度器
+func NewScheduler(redisService *RedisService) *Scheduler {
+	return &Scheduler{
+		redis:      redisService.client,
+		instanceID: newInstanceID(),
+	}
+}
+
+// Register 注册定时任务（需在 Start 之前调用）
+func (s *Scheduler) Register(job Job) {
+	if job.Interval <= 0 {
+		logging.Infof("Scheduled job %s disabled (interval <= 0)", job.Name)
+		return
+	}
+	s.jobs = append(s.jobs, job)
+}
+
+// Start 启动所有已注册的任务
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, job)
+	}
+	logging.Infof("Scheduler started - instance: %s, jobs: %d", s.instanceID, len(s.jobs))
+}
+
+// Stop 停止调度并等待正在执行的任务结束（最多等待 timeout）
+func (s *Scheduler) Stop(timeout time.Duration) {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logging.Infof("Scheduler stopped")
+	case <-time.After(timeout):
+		logging.Warnf("Scheduler stop timed out after %v, some jobs are still running", timeout)
+	}
+}
+
+// loop 按间隔尝试执行任务
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runIfLeader(ctx, job)
+		}
+	}
+}
+
+// leaseDuration 返回任务的租约时长：略短于执行间隔
+// 租约执行完不释放，本周期内其他实例都会跳过；但必须在持有者的下一次 tick 之前过期，
+// 否则下一周期所有实例（包括持有者）都会因租约仍在而跳过，任务实际只按一半的频率执行
+func leaseDuration(interval time.Duration) time.Duration {
+	return interval - interval/10
+}
+
+// runIfLeader 获取本周期的租约后执行任务
+func (s *Scheduler) runIfLeader(ctx context.Context, job Job) {
+	key := "scheduler_lock:" + job.Name
+	lease := leaseDuration(job.Interval)
+	acquired, err := s.redis.SetNX(ctx, key, s.instanceID, lease).Result()
+	if err != nil {
+		logging.Errorf("Scheduled job %s skipped, failed to acquire lease: %v", job.Name, err)
+		return
+	}
+	if !acquired {
+		logging.Debugf("Scheduled job %s is running on another instance", job.Name)
+		return
+	}
+
+	// 执行时间超过间隔时持续续期，避免其他实例重复执行
+	runCtx, stopRenew := context.WithCancel(ctx)
+	defer stopRenew()
+	go s.renewLease(runCtx, key, lease)
+
+	start := time.Now()
+	result := "success"
+	if err := s.safeRun(runCtx, job); err != nil {
+		result = "error"
+		logging.Errorf("Scheduled job %s failed after %v: %v", job.Name, time.Since(start), err)
+	} else {
+		logging.Debugf("Scheduled job %s finished in %v", job.Name, time.Since(start))
+	}
+	metrics.IncCounter("scheduled_job_runs_total", map[string]string{"job": job.Name, "result": result})
+}
+
+// safeRun 执行任务并将 panic 转为错误
+func (s *Scheduler) safeRun(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return job.Run(ctx)
+}
+
+// renewLease 每 1/3 租约时长续期一次，直到 ctx 取消
+func (s *Scheduler) renewLease(ctx context.Context, key string, lease time.Duration) {
+	ticker := time.NewTicker(lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := renewLeaseScript.Run(ctx, s.redis, []string{key}, s.instanceID, lease.Milliseconds()).Err(); err != nil && ctx.Err() == nil {
+				logging.Warnf("Failed to renew scheduler lease %s: %v", key, err)
+			}
+		}
+	}
+}
+
+// newInstanceID 生成实例标识（主机名 + 随机后缀）
+func newInstanceID() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	rand.Read(b)
+	return host + "-" + hex.EncodeToString(b)
+}
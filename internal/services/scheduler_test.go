@@ -0,0 +1,15 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeaseDuration(t *testing.T) {
+	for _, interval := range []time.Duration{time.Second, time.Minute, 15 * time.Minute, 24 * time.Hour} {
+		lease := leaseDuration(interval)
+		if lease <= interval/2 || lease >= interval {
+			t.Errorf("leaseDuration(%v) = %v, want between half the interval and the interval", interval, lease)
+		}
+	}
+}
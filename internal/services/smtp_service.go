@@ -0,0 +1,115 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+	"verification-api/internal/config"
+)
+
+// SMTPService sends verification code emails through an SMTP server
+// Used as the fallback when Brevo fails; content and sender name are the same as Brevo's
+type SMTPService struct {
+	host      string
+	port      int
+	username  string
+	password  string
+	fromEmail string
+}
+
+// NewSMTPService creates an SMTP service from the SMTP_* configuration
+func NewSMTPService() *SMTPService {
+	return &SMTPService{
+		host:      config.AppConfig.SMTPHost,
+		port:      config.AppConfig.SMTPPort,
+		username:  config.AppConfig.SMTPUsername,
+		password:  config.AppConfig.SMTPPassword,
+		fromEmail: config.AppConfig.SMTPFromEmail,
+	}
+}
+
+// Configured reports whether a host and a from address are set
+func (s *SMTPService) Configured() bool {
+	return s.host != "" && s.fromEmail != ""
+}
+
+// SendVerificationCodeEmail sends verification code email (same contract as BrevoService.SendVerificationCodeEmail)
+func (s *SMTPService) SendVerificationCodeEmail(projectID, to, code, language string, expireMinutes int) error {
+	// Reuse the Brevo project config and localized content so both providers send the same email
+	brevoService := &BrevoService{FromEmail: s.fromEmail}
+	projectConfig := brevoService.getProjectConfig(projectID)
+	subject, htmlContent, textContent := brevoService.getEmailContent(language, projectConfig.ProjectName, code, expireMinutes)
+
+	message, err := buildSMTPMessage(projectConfig.FromName, s.fromEmail, to, subject, htmlContent, textContent)
+	if err != nil {
+		return err
+	}
+
+	// STARTTLS is used when the server offers it; authentication requires TLS (or localhost)
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+	addr := net.JoinHostPort(s.host, strconv.Itoa(s.port))
+	if err := smtp.SendMail(addr, auth, s.fromEmail, []string{to}, message); err != nil {
+		return fmt.Errorf("failed to send email via SMTP: %w", err)
+	}
+	return nil
+}
+
+// Send implements CodeSender, recipient is the email address
+func (s *SMTPService) Send(projectID, recipient, code, language string, expireMinutes int) error {
+	return s.SendVerificationCodeEmail(projectID, recipient, code, language, expireMinutes)
+}
+
+// buildSMTPMessage builds a multipart/alternative (text + HTML) message
+func buildSMTPMessage(fromName, fromEmail, to, subject, htmlContent, textContent string) ([]byte, error) {
+	recipient, err := mail.ParseAddress(to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient address: %w", err)
+	}
+	boundaryBytes := make([]byte, 12)
+	if _, err := rand.Read(boundaryBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate MIME boundary: %w", err)
+	}
+	boundary := "unionhub-" + hex.EncodeToString(boundaryBytes)
+
+	from := mail.Address{Name: stripHeaderNewlines(fromName), Address: fromEmail}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", recipient.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", stripHeaderNewlines(subject)))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	for _, part := range []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain", textContent},
+		{"text/html", htmlContent},
+	} {
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		fmt.Fprintf(&buf, "Content-Type: %s; charset=utf-8\r\n", part.contentType)
+		buf.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+		buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(part.body, "\r\n", "\n"), "\n", "\r\n"))
+		buf.WriteString("\r\n")
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	return buf.Bytes(), nil
+}
+
+// stripHeaderNewlines removes CR/LF so header values cannot inject extra headers
+func stripHeaderNewlines(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"runtime/debug"
+	"time"
+	"verification-api/internal/config"
+	"verification-api/internal/models"
+	"verification-api/pkg/logging"
+	"verification-api/pkg/metrics"
+)
+
+// Subscription event sinks (SUBSCRIPTION_EVENT_SINK)
+const (
+	SubscriptionEventSinkNone  = "none"
+	SubscriptionEventSinkLog   = "log"
+	SubscriptionEventSinkRedis = "redis"
+)
+
+// Sources of a subscription transition
+const (
+	TransitionSourceVerification       = "verification"        // verify / restore / sync / admin refresh against the store
+	TransitionSourceAppleNotification  = "apple_notification"  // App Store Server Notification
+	TransitionSourceGoogleNotification = "google_notification" // Google Play RTDN
+	TransitionSourceSubscriptionGroup  = "subscription_group"  // superseded by another subscription of the same group
+)
+
+// SubscriptionTrigger describes what caused a subscription transition
+type SubscriptionTrigger struct {
+	Source           string `json:"source"`
+	NotificationType string `json:"notification_type,omitempty"` // e.g. DID_RENEW, or the Google notificationType number
+	Subtype          string `json:"subtype,omitempty"`
+}
+
+// SubscriptionSnapshot is the state of a subscription before or after a transition
+type SubscriptionSnapshot struct {
+	Status          string `json:"status"`
+	ProductID       string `json:"product_id"`
+	TransactionID   string `json:"transaction_id"`
+	AppAccountToken string `json:"app_account_token"`
+	Environment     string `json:"environment"`
+	ExpiresDate     string `json:"expires_date,omitempty"` // RFC 3339
+	AutoRenewStatus bool   `json:"auto_renew_status"`
+}
+
+// SubscriptionTransition is published for each subscription status change
+// Before is nil when the subscription was created by the change
+type SubscriptionTransition struct {
+	ProjectID             string                `json:"project_id"`
+	OriginalTransactionID string                `json:"original_transaction_id"`
+	Platform              string                `json:"platform"`
+	FromStatus            string                `json:"from_status"`
+	ToStatus              string                `json:"to_status"`
+	Before                *SubscriptionSnapshot `json:"before"`
+	After                 SubscriptionSnapshot  `json:"after"`
+	Trigger               SubscriptionTrigger   `json:"trigger"`
+	OccurredAt            string                `json:"occurred_at"` // RFC 3339
+}
+
+// SubscriptionEventSink receives subscription transitions for downstream pipelines
+type SubscriptionEventSink interface {
+	Publish(ctx context.Context, transition SubscriptionTransition) error
+}
+
+// noopSubscriptionEventSink drops every transition (default)
+type noopSubscriptionEventSink struct{}
+
+func (noopSubscriptionEventSink) Publish(context.Context, SubscriptionTransition) error { return nil }
+
+// logSubscriptionEventSink writes each transition as one JSON log line
+type logSubscriptionEventSink struct{}
+
+func (logSubscriptionEventSink) Publish(_ context.Context, transition SubscriptionTransition) error {
+	body, err := json.Marshal(transition)
+	if err != nil {
+		return err
+	}
+	logging.Infof("subscription_transition %s", body)
+	return nil
+}
+
+// redisSubscriptionEventSink appends each transition to a Redis stream (XADD, approximately capped)
+type redisSubscriptionEventSink struct {
+	redis  *RedisService
+	stream string
+	maxLen int64
+}
+
+func (s *redisSubscriptionEventSink) Publish(ctx context.Context, transition SubscriptionTransition) error {
+	body, err := json.Marshal(transition)
+	if err != nil {
+		return err
+	}
+	return s.redis.AppendToStream(ctx, s.stream, s.maxLen, map[string]interface{}{
+		"project_id": transition.ProjectID,
+		"to_status":  transition.ToStatus,
+		"event":      string(body),
+	})
+}
+
+// subscriptionEventSink is the configured sink (see InitSubscriptionEventSink)
+var subscriptionEventSink SubscriptionEventSink = noopSubscriptionEventSink{}
+
+// InitSubscriptionEventSink creates the sink selected by SUBSCRIPTION_EVENT_SINK (unknown values mean none)
+// When Redis is unavailable for the redis sink, transitions are dropped and an error is logged
+func InitSubscriptionEventSink() {
+	switch config.AppConfig.SubscriptionEventSink {
+	case SubscriptionEventSinkLog:
+		subscriptionEventSink = logSubscriptionEventSink{}
+	case SubscriptionEventSinkRedis:
+		redisService, err := NewRedisService()
+		if err != nil {
+			logging.Errorf("Subscription event sink disabled, Redis unavailable: %v", err)
+			return
+		}
+		subscriptionEventSink = &redisSubscriptionEventSink{
+			redis:  redisService,
+			stream: config.AppConfig.SubscriptionEventStream,
+			maxLen: int64(config.AppConfig.SubscriptionEventStreamMaxLen),
+		}
+	}
+}
+
+// SetSubscriptionEventSink replaces the sink, e.g. to plug in another pipeline
+func SetSubscriptionEventSink(sink SubscriptionEventSink) {
+	if sink == nil {
+		sink = noopSubscriptionEventSink{}
+	}
+	subscriptionEventSink = sink
+}
+
+// SubscriptionEventsEnabled reports whether transitions are published
+// Callers use it to skip loading the "before" state when nothing consumes it
+func SubscriptionEventsEnabled() bool {
+	_, noop := subscriptionEventSink.(noopSubscriptionEventSink)
+	return !noop
+}
+
+// PublishSubscriptionTransitionAsync publishes the transition from before to after in a new goroutine
+// Nothing is published when the status did not change; before is nil for a new subscription
+func PublishSubscriptionTransitionAsync(before, after *models.Subscription, trigger SubscriptionTrigger) {
+	if after == nil || !SubscriptionEventsEnabled() {
+		return
+	}
+	transition := SubscriptionTransition{
+		ProjectID:             after.ProjectID,
+		OriginalTransactionID: after.OriginalTransactionID,
+		Platform:              after.Platform,
+		ToStatus:              after.Status,
+		After:                 newSubscriptionSnapshot(after),
+		Trigger:               trigger,
+		OccurredAt:            time.Now().UTC().Format(time.RFC3339),
+	}
+	if before != nil {
+		if before.Status == after.Status {
+			return
+		}
+		snapshot := newSubscriptionSnapshot(before)
+		transition.FromStatus = before.Status
+		transition.Before = &snapshot
+	}
+
+	sink := subscriptionEventSink
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logging.Errorf("Subscription event sink panic recovered - original_transaction: %s, panic: %v\n%s",
+					transition.OriginalTransactionID, r, debug.Stack())
+				metrics.IncCounter("subscription_events_total", map[string]string{"result": "failed"})
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := sink.Publish(ctx, transition); err != nil {
+			logging.Errorf("Failed to publish subscription transition - original_transaction: %s, %s -> %s, error: %v",
+				transition.OriginalTransactionID, transition.FromStatus, transition.ToStatus, err)
+			metrics.IncCounter("subscription_events_total", map[string]string{"result": "failed"})
+			return
+		}
+		metrics.IncCounter("subscription_events_total", map[string]string{"result": "published"})
+	}()
+}
+
+// newSubscriptionSnapshot copies the transition-relevant fields of a subscription
+func newSubscriptionSnapshot(subscription *models.Subscription) SubscriptionSnapshot {
+	snapshot := SubscriptionSnapshot{
+		Status:          subscription.Status,
+		ProductID:       subscription.ProductID,
+		TransactionID:   subscription.TransactionID,
+		AppAccountToken: subscription.AppAccountToken,
+		Environment:     subscription.Environment,
+		AutoRenewStatus: subscription.AutoRenewStatus,
+	}
+	if !subscription.ExpiresDate.IsZero() {
+		snapshot.ExpiresDate = subscription.ExpiresDate.UTC().Format(time.RFC3339)
+	}
+	return snapshot
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"verification-api/internal/database"
+	"verification-api/internal/models"
+	"verification-api/pkg/logging"
+)
+
+// RefreshSubscription re-reads a stored subscription from its store and saves the authoritative state
+// iOS: latest transaction of the original transaction (App Store Server API); Android: the stored purchase token
+// The stored user binding is kept unless the store reports an appAccountToken / obfuscatedExternalAccountId
+func (s *SubscriptionVerificationService) RefreshSubscription(stored *models.Subscription) (*models.Subscription, error) {
+	if stored.Platform == "android" {
+		if stored.LatestReceipt == "" {
+			return nil, fmt.Errorf("no purchase token stored for subscription %d", stored.ID)
+		}
+		return s.VerifyGooglePlayPurchase(stored.ProjectID, stored.LatestReceipt, stored.ProductID, stored.AppAccountToken)
+	}
+
+	transactionID := stored.TransactionID
+	if stored.OriginalTransactionID != "" {
+		if latest, err := s.latestAppleTransactionID(stored); err != nil {
+			// Fall back to the last known transaction (may miss renewals since)
+			logging.Warnf("Failed to get latest transaction, refreshing stored transaction - subscription: %d, original_transaction: %s, error: %v",
+				stored.ID, stored.OriginalTransactionID, err)
+		} else {
+			transactionID = latest
+		}
+	}
+	if transactionID == "" {
+		return nil, fmt.Errorf("no transaction ID stored for subscription %d", stored.ID)
+	}
+	return s.VerifyAppleTransaction(stored.ProjectID, "", transactionID, stored.ProductID, stored.AppAccountToken, stored.Environment)
+}
+
+// latestAppleTransactionID returns the ID of the latest transaction of the stored subscription's original transaction
+func (s *SubscriptionVerificationService) latestAppleTransactionID(stored *models.Subscription) (string, error) {
+	var project models.Project
+	if err := database.GetDB().Where("project_id = ?", stored.ProjectID).First(&project).Error; err != nil {
+		return "", fmt.Errorf("failed to get project: %w", err)
+	}
+	authToken, err := s.generateAppStoreJWT(project.BundleID)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate auth token: %w", err)
+	}
+
+	baseURL := appStoreServerAPIProductionURL
+	if stored.Environment != "" && !strings.EqualFold(stored.Environment, "production") {
+		baseURL = appStoreServerAPISandboxURL
+	}
+	last, err := s.fetchLastTransaction(baseURL, authToken, stored.OriginalTransactionID)
+	if err != nil {
+		return "", err
+	}
+
+	var transactionInfo struct {
+		TransactionID string `json:"transactionId"`
+	}
+	if err := decodeJWSPayload(last.SignedTransactionInfo, &transactionInfo); err != nil {
+		return "", fmt.Errorf("failed to parse signedTransactionInfo: %w", err)
+	}
+	if transactionInfo.TransactionID == "" {
+		return "", fmt.Errorf("transactionId is missing in signedTransactionInfo")
+	}
+	return transactionInfo.TransactionID, nil
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"verification-api/internal/database"
+	"verification-api/internal/models"
+	"verification-api/pkg/logging"
+)
+
+// InitSupersededSubscriptionNotifications reports subscriptions superseded within their subscription group
+// Each superseded subscription sends the App Backend webhook and publishes a transition to "superseded",
+// like any other status change, so the integrator doesn't keep granting the old tier
+func InitSupersededSubscriptionNotifications() {
+	database.SubscriptionsSupersededHook = notifySupersededSubscriptions
+}
+
+// notifySupersededSubscriptions notifies the App Backend and the event sink about superseded subscriptions
+func notifySupersededSubscriptions(superseding *models.Subscription, superseded []models.Subscription) {
+	project, err := NewProjectService().GetProjectByID(superseding.ProjectID)
+	if err != nil {
+		logging.Warnf("Failed to load project for superseded subscriptions, skipping webhooks - project: %s, error: %v", superseding.ProjectID, err)
+		project = nil
+	}
+
+	trigger := SubscriptionTrigger{Source: TransitionSourceSubscriptionGroup}
+	webhookNotifier := NewWebhookNotifier()
+	for i := range superseded {
+		before := superseded[i]
+		after := before
+		after.Status = "superseded"
+		PublishSubscriptionTransitionAsync(&before, &after, trigger)
+		if project != nil && project.HasWebhook() {
+			webhookNotifier.NotifyAppBackendAsync(WebhookEndpointFromProject(project), &after)
+		}
+	}
+}
@@ -2,14 +2,17 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 	"verification-api/internal/config"
@@ -22,7 +25,10 @@ import (
 
 // SubscriptionVerificationService provides subscription verification operations
 type SubscriptionVerificationService struct {
-	httpClient *http.Client
+	httpClient        *http.Client
+	maxTransactionAge time.Duration   // 0 = no limit (see WithMaxTransactionAge)
+	rateLimitCtx      context.Context // non-nil = store calls wait on the shared limiters (see WithStoreRateLimit)
+	tokenCache        *appStoreTokenCache
 }
 
 // NewSubscriptionVerificationService creates a new subscription verification service
@@ -31,6 +37,7 @@ func NewSubscriptionVerificationService() *SubscriptionVerificationService {
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		tokenCache: sharedAppStoreTokenCache,
 	}
 }
 
@@ -57,14 +64,27 @@ type AppleReceiptResponse struct {
 			PurchaseDate          string `json:"purchase_date_ms"`
 			ExpiresDate           string `json:"expires_date_ms"`
 			IsTrialPeriod         string `json:"is_trial_period"`
+			IsInIntroOfferPeriod  string `json:"is_in_intro_offer_period"`
+			CancellationDate      string `json:"cancellation_date_ms"` // Set when Apple refunded / revoked the transaction
+			SubscriptionGroupID   string `json:"subscription_group_identifier"`
 		} `json:"latest_receipt_info"`
 	} `json:"receipt"`
-	LatestReceipt string `json:"latest_receipt"`
+	LatestReceipt      string `json:"latest_receipt"`
+	PendingRenewalInfo []struct {
+		AutoRenewProductID    string `json:"auto_renew_product_id"`
+		OriginalTransactionID string `json:"original_transaction_id"`
+		AutoRenewStatus       string `json:"auto_renew_status"` // "1" = 自动续订开启，"0" = 已关闭
+	} `json:"pending_renewal_info"`
 }
 
 // VerifyAppleReceipt verifies iOS receipt
 // Returns error code 21007 means receipt is from sandbox, should retry with sandbox URL
-func (s *SubscriptionVerificationService) VerifyAppleReceipt(projectID, receiptData, userID string) (*models.Subscription, error) {
+// environment forces sandbox or production; empty means auto-detect
+func (s *SubscriptionVerificationService) VerifyAppleReceipt(projectID, receiptData, userID, environment string) (*models.Subscription, error) {
+	if environment != "" {
+		return s.verifyWithApple(receiptData, environment, projectID, userID)
+	}
+
 	// Try production first
 	subscription, err := s.verifyWithApple(receiptData, "production", projectID, userID)
 	if err != nil {
@@ -100,6 +120,10 @@ func (s *SubscriptionVerificationService) verifyWithApple(receiptData, environme
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
+	if err := s.waitStoreAPI(appStoreAPILimiter); err != nil {
+		return nil, fmt.Errorf("App Store API rate limit wait aborted: %w", err)
+	}
+
 	// Make request
 	resp, err := s.httpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
@@ -146,6 +170,31 @@ func (s *SubscriptionVerificationService) verifyWithApple(receiptData, environme
 	if expiresDate.Before(time.Now()) {
 		status = "expired"
 	}
+	refunded := latestReceiptInfo.CancellationDate != ""
+	if refunded {
+		// Refunded before expiry: never entitled, regardless of expires_date
+		status = "refunded"
+	}
+
+	// Auto-renew status from pending_renewal_info; receipts only list auto-renewable
+	// subscriptions in latest_receipt_info, so default to true when it's missing
+	autoRenew := true
+	for _, renewal := range appleResp.PendingRenewalInfo {
+		if renewal.OriginalTransactionID == latestReceiptInfo.OriginalTransactionID {
+			autoRenew = renewal.AutoRenewStatus == "1"
+			break
+		}
+	}
+	if refunded {
+		autoRenew = false
+	}
+
+	// Infer the billing period from the transaction dates, except during a free trial or
+	// introductory offer, whose duration differs from the regular period
+	billingPeriod := ""
+	if latestReceiptInfo.IsTrialPeriod != "true" && latestReceiptInfo.IsInIntroOfferPeriod != "true" {
+		billingPeriod = BillingPeriodFromDates(purchaseDate, expiresDate)
+	}
 
 	// Create subscription model
 	subscription := &models.Subscription{
@@ -161,34 +210,51 @@ func (s *SubscriptionVerificationService) verifyWithApple(receiptData, environme
 		Environment:           appleResp.Environment,
 		PurchaseDate:          purchaseDate,
 		ExpiresDate:           expiresDate,
-		AutoRenewStatus:       true, // Default, will be updated by webhook
+		AutoRenewStatus:       autoRenew,
+		BillingPeriod:         billingPeriod,
+		SubscriptionGroupID:   latestReceiptInfo.SubscriptionGroupID,
 		LatestReceipt:         appleResp.LatestReceipt,
 		LatestReceiptInfo:     string(body),
 	}
+	if err := s.checkTransactionAge(purchaseDate); err != nil {
+		return nil, err
+	}
 
 	// Save or update subscription
 	if err := database.CreateOrUpdateSubscription(subscription); err != nil {
 		return nil, fmt.Errorf("failed to save subscription: %w", err)
 	}
+	if subscription.StateChanged {
+		PublishSubscriptionTransitionAsync(subscription.Previous, subscription, SubscriptionTrigger{Source: TransitionSourceVerification})
+	}
 
 	return subscription, nil
 }
 
+// App Store Server API base URLs
+const (
+	appStoreServerAPIProductionURL = "https://api.storekit.itunes.apple.com"
+	appStoreServerAPISandboxURL    = "https://api.storekit-sandbox.itunes.apple.com"
+)
+
 // VerifyAppleTransaction verifies iOS transaction using App Store Server API (modern approach)
 // Uses signed_transaction JWT or transaction_id to query App Store Server API
-func (s *SubscriptionVerificationService) VerifyAppleTransaction(projectID, signedTransaction, transactionID, productID, userID string) (*models.Subscription, error) {
+// environmentOverride forces sandbox or production, otherwise the environment is inferred from the JWT
+func (s *SubscriptionVerificationService) VerifyAppleTransaction(projectID, signedTransaction, transactionID, productID, userID, environmentOverride string) (*models.Subscription, error) {
 	// Parse signed_transaction JWT if provided
 	var actualTransactionID string
 	var bundleID string
 	var environment string
+	var signedAppAccountToken string
 
 	if signedTransaction != "" {
 		// Parse JWT to extract transaction_id (without verification, just parsing)
+		// The transaction is verified against the App Store Server API below; only the alg is checked here
+		if err := EnforceJWSAlgorithm(signedTransaction); err != nil {
+			return nil, fmt.Errorf("invalid signed_transaction: %w", err)
+		}
 		parser := jwt.NewParser(jwt.WithoutClaimsValidation())
-		token, err := parser.Parse(signedTransaction, func(token *jwt.Token) (interface{}, error) {
-			// Apple uses ES256, we don't need to verify signature here, just parse
-			return nil, nil
-		})
+		token, _, err := parser.ParseUnverified(signedTransaction, jwt.MapClaims{})
 
 		if err == nil {
 			if claims, ok := token.Claims.(jwt.MapClaims); ok {
@@ -202,6 +268,9 @@ func (s *SubscriptionVerificationService) VerifyAppleTransaction(projectID, sign
 				if env, ok := claims["environment"].(string); ok {
 					environment = env
 				}
+				if token, ok := claims["appAccountToken"].(string); ok {
+					signedAppAccountToken = token
+				}
 			}
 		}
 	}
@@ -215,7 +284,10 @@ func (s *SubscriptionVerificationService) VerifyAppleTransaction(projectID, sign
 		return nil, fmt.Errorf("transaction_id is required")
 	}
 
-	// Determine environment (default to production if not specified)
+	// Determine environment: explicit override > JWT claim > production
+	if environmentOverride != "" {
+		environment = environmentOverride
+	}
 	if environment == "" {
 		environment = "Production"
 	}
@@ -227,72 +299,60 @@ func (s *SubscriptionVerificationService) VerifyAppleTransaction(projectID, sign
 		return nil, fmt.Errorf("failed to get project: %w", err)
 	}
 
-	// 添加详细日志：项目信息
-	logging.Infof("验证订阅 - ProjectID: %s, ProjectName: %s, BundleID: %s, TransactionID: %s, UserID: %s, Environment: %s",
+	// 详细日志：项目信息（仅 Debug 级别）
+	logging.Debugf("验证订阅 - ProjectID: %s, ProjectName: %s, BundleID: %s, TransactionID: %s, UserID: %s, Environment: %s",
 		project.ProjectID, project.ProjectName, project.BundleID, actualTransactionID, userID, environment)
 
-	// Generate JWT token for App Store Server API authentication
-	authToken, err := s.generateAppStoreJWT(project.BundleID)
-	if err != nil {
-		// 添加详细日志：JWT 生成失败
-		logging.Errorf("生成 App Store JWT 失败 - ProjectID: %s, ProjectName: %s, BundleID: %s, Error: %v",
-			project.ProjectID, project.ProjectName, project.BundleID, err)
-		return nil, fmt.Errorf("failed to generate auth token: %w", err)
-	}
-
-	// 添加详细日志：JWT 生成成功
-	logging.Infof("App Store JWT 生成成功 - ProjectID: %s, BundleID: %s, JWT长度: %d",
-		project.ProjectID, project.BundleID, len(authToken))
-
-	// Call App Store Server API
-	apiURL := fmt.Sprintf("https://api.storekit.itunes.apple.com/inApps/v1/transactions/%s", actualTransactionID)
-
-	// 添加详细日志：API 调用信息
-	logging.Infof("调用 App Store Server API - ProjectID: %s, ProjectName: %s, BundleID: %s, URL: %s, Environment: %s",
-		project.ProjectID, project.ProjectName, project.BundleID, apiURL, environment)
-
-	req, err := http.NewRequest("GET", apiURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+authToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := s.httpClient.Do(req)
-	if err != nil {
-		// 添加详细日志：网络请求失败
-		logging.Errorf("App Store Server API 网络请求失败 - ProjectID: %s, ProjectName: %s, BundleID: %s, URL: %s, Error: %v",
-			project.ProjectID, project.ProjectName, project.BundleID, apiURL, err)
-		return nil, fmt.Errorf("failed to call App Store Server API: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		// 添加详细日志：API 返回错误
-		logging.Errorf("App Store Server API 返回错误 - ProjectID: %s, ProjectName: %s, BundleID: %s, StatusCode: %d, Response: %s",
-			project.ProjectID, project.ProjectName, project.BundleID, resp.StatusCode, string(body))
-		return nil, fmt.Errorf("App Store Server API returned status %d: %s", resp.StatusCode, string(body))
+	// Sandbox and Xcode transactions are served by the sandbox endpoint
+	baseURL := appStoreServerAPIProductionURL
+	if !strings.EqualFold(environment, "production") {
+		baseURL = appStoreServerAPISandboxURL
+	}
+
+	// StoreKit 2 jwsRepresentation is self-contained: when its signature verifies locally, trust it without the API call
+	// authToken stays empty in that case (no renewal info lookup either)
+	var authToken string
+	var signedTransactionInfo string
+	var body []byte
+	var err error
+	verifiedLocally := false
+	if signedTransaction != "" && config.AppConfig.AppStoreLocalJWSVerification {
+		if err := verifyClientSignedTransaction(signedTransaction, project.BundleID); err != nil {
+			logging.Warnf("Local signed_transaction verification failed, falling back to App Store Server API - ProjectID: %s, TransactionID: %s, Error: %v",
+				project.ProjectID, actualTransactionID, err)
+		} else {
+			logging.Debugf("signed_transaction verified locally - ProjectID: %s, TransactionID: %s", project.ProjectID, actualTransactionID)
+			signedTransactionInfo = signedTransaction
+			verifiedLocally = true
+			body, _ = json.Marshal(map[string]string{"signedTransactionInfo": signedTransaction})
+		}
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
+	if signedTransactionInfo == "" {
+		// Generate JWT token for App Store Server API authentication
+		authToken, err = s.generateAppStoreJWT(project.BundleID)
+		if err != nil {
+			// 添加详细日志：JWT 生成失败
+			logging.Errorf("生成 App Store JWT 失败 - ProjectID: %s, ProjectName: %s, BundleID: %s, Error: %v",
+				project.ProjectID, project.ProjectName, project.BundleID, err)
+			return nil, fmt.Errorf("failed to generate auth token: %w", err)
+		}
 
-	// Parse transaction response
-	var transactionResp struct {
-		SignedTransactionInfo string `json:"signedTransactionInfo"`
-	}
+		// 添加详细日志：JWT 生成成功
+		logging.Debugf("App Store JWT 生成成功 - ProjectID: %s, BundleID: %s, JWT长度: %d",
+			project.ProjectID, project.BundleID, len(authToken))
 
-	if err := json.Unmarshal(body, &transactionResp); err != nil {
-		return nil, fmt.Errorf("failed to parse transaction response: %w", err)
+		if signedTransactionInfo, body, err = s.fetchTransactionInfo(&project, baseURL, authToken, actualTransactionID, environment); err != nil {
+			return nil, err
+		}
 	}
 
 	// signedTransactionInfo is a JWT (header.payload.signature), not base64-encoded JSON
 	// Parse it as JWT to extract claims
-	parts := strings.Split(transactionResp.SignedTransactionInfo, ".")
+	if err := EnforceJWSAlgorithm(signedTransactionInfo); err != nil {
+		return nil, fmt.Errorf("invalid signedTransactionInfo: %w", err)
+	}
+	parts := strings.Split(signedTransactionInfo, ".")
 	if len(parts) != 3 {
 		return nil, fmt.Errorf("invalid JWT format: expected 3 parts, got %d", len(parts))
 	}
@@ -314,15 +374,24 @@ func (s *SubscriptionVerificationService) VerifyAppleTransaction(projectID, sign
 		IsInGracePeriod       bool   `json:"isInGracePeriod"`
 		IsTrialPeriod         bool   `json:"isTrialPeriod"`
 		AppAccountToken       string `json:"appAccountToken"` // Extract appAccountToken
+		Type                  string `json:"type"`            // e.g., "Auto-Renewable Subscription", "Non-Consumable"
+		OfferType             int    `json:"offerType"`       // Set while an offer applies: 1=introductory, 2=promotional, 3=offer code, 4=win-back
+		RevocationDate        int64  `json:"revocationDate"`  // Set when Apple refunded / revoked the transaction
+		SubscriptionGroupID   string `json:"subscriptionGroupIdentifier"`
 	}
 
 	if err := json.Unmarshal(payload, &transactionInfo); err != nil {
 		return nil, fmt.Errorf("failed to parse transaction info: %w", err)
 	}
 
+	// expiresDate is required for auto-renewable subscriptions
+	if transactionInfo.ExpiresDate <= 0 && IsAutoRenewableType(transactionInfo.Type) {
+		return nil, fmt.Errorf("expiresDate is missing in transaction info (type: %q)", transactionInfo.Type)
+	}
+
 	// Parse dates
-	purchaseDate := time.Unix(transactionInfo.PurchaseDate/1000, 0)
-	expiresDate := time.Unix(transactionInfo.ExpiresDate/1000, 0)
+	purchaseDate := TimeFromMillis(transactionInfo.PurchaseDate)
+	expiresDate := TimeFromMillis(transactionInfo.ExpiresDate)
 
 	// Determine status
 	status := "active"
@@ -335,6 +404,11 @@ func (s *SubscriptionVerificationService) VerifyAppleTransaction(projectID, sign
 	if transactionInfo.IsInGracePeriod {
 		status = "grace_period"
 	}
+	refunded := transactionInfo.RevocationDate > 0
+	if refunded {
+		// Refunded / revoked: never entitled, regardless of expires_date
+		status = "refunded"
+	}
 
 	// Normalize environment
 	env := strings.ToLower(transactionInfo.Environment)
@@ -344,14 +418,46 @@ func (s *SubscriptionVerificationService) VerifyAppleTransaction(projectID, sign
 		env = "sandbox"
 	}
 
-	// Use appAccountToken from API response if available, otherwise use provided userID
+	// Apple doesn't report the billing period, so infer it from the transaction dates
+	// Skipped while an offer or free trial applies: its duration differs from the regular period
+	billingPeriod := ""
+	if IsAutoRenewableType(transactionInfo.Type) && transactionInfo.OfferType == 0 && !transactionInfo.IsTrialPeriod {
+		billingPeriod = BillingPeriodFromDates(purchaseDate, expiresDate)
+	}
+
+	// Auto-renew status from the subscription's renewal info; if it can't be fetched,
+	// default to true only for confirmed auto-renewable subscriptions (webhooks correct it later)
+	// Locally verified transactions skip the lookup (no App Store Server API call at all)
+	autoRenew := false
+	if IsAutoRenewableType(transactionInfo.Type) && transactionInfo.ExpiresDate > 0 && !refunded {
+		autoRenew = true
+		if authToken != "" {
+			if enabled, err := s.fetchAutoRenewStatus(baseURL, authToken, transactionInfo.OriginalTransactionID); err != nil {
+				logging.Warnf("Failed to fetch renewal info, assuming auto-renew on - ProjectID: %s, OriginalTransactionID: %s, Error: %v",
+					projectID, transactionInfo.OriginalTransactionID, err)
+			} else {
+				autoRenew = enabled
+			}
+		}
+	}
+
+	// Use appAccountToken from API response, then from the client's signed_transaction, otherwise the provided userID
+	// The token is resolved to the App Backend's device_id like in the webhook path
+	appAccountToken := transactionInfo.AppAccountToken
+	if appAccountToken == "" {
+		appAccountToken = signedAppAccountToken
+	}
 	finalUserID := userID
-	if transactionInfo.AppAccountToken != "" {
-		finalUserID = transactionInfo.AppAccountToken
-		logging.Infof("Using appAccountToken from App Store Server API: %s", finalUserID)
+	resolved := true
+	if appAccountToken != "" {
+		finalUserID, resolved, err = ResolveAppAccountToken(&project, appAccountToken)
+		if err != nil {
+			return nil, err
+		}
+		logging.Debugf("Using appAccountToken from transaction: %s (user_id: %s)", appAccountToken, finalUserID)
 	} else {
 		// appAccountToken is empty (client didn't set it), use provided userID
-		logging.Infof("No appAccountToken in API response, using provided userID: %s", finalUserID)
+		logging.Debugf("No appAccountToken in transaction, using provided userID: %s", finalUserID)
 	}
 
 	// Create subscription model
@@ -368,39 +474,122 @@ func (s *SubscriptionVerificationService) VerifyAppleTransaction(projectID, sign
 		Environment:           env,
 		PurchaseDate:          purchaseDate,
 		ExpiresDate:           expiresDate,
-		AutoRenewStatus:       true, // Will be updated by webhook
+		AutoRenewStatus:       autoRenew,
+		BillingPeriod:         billingPeriod,
+		SubscriptionGroupID:   transactionInfo.SubscriptionGroupID,
 		LatestReceipt:         signedTransaction,
 		LatestReceiptInfo:     string(body),
 	}
+	if !resolved {
+		subscription.SetResolved(false)
+	}
+	if err := s.checkTransactionAge(purchaseDate); err != nil {
+		return nil, err
+	}
+
+	// A locally verified JWS may predate a refund or renewal; it never overwrites newer stored state
+	if verifiedLocally {
+		if stored, err := database.GetSubscriptionByOriginalTransactionID(projectID, subscription.OriginalTransactionID, subscription.Environment); err == nil && isStaleClientTransaction(stored, subscription) {
+			logging.Infof("Locally verified signed_transaction is older than the stored subscription, keeping stored state - ProjectID: %s, OriginalTransactionID: %s, stored status: %s",
+				projectID, subscription.OriginalTransactionID, stored.Status)
+			return stored, nil
+		}
+	}
 
 	// Save or update subscription
 	if err := database.CreateOrUpdateSubscription(subscription); err != nil {
 		return nil, fmt.Errorf("failed to save subscription: %w", err)
 	}
+	if subscription.StateChanged {
+		PublishSubscriptionTransitionAsync(subscription.Previous, subscription, SubscriptionTrigger{Source: TransitionSourceVerification})
+	}
 
 	return subscription, nil
 }
 
-// generateAppStoreJWT generates JWT token for App Store Server API authentication
+// fetchTransactionInfo gets a transaction from the App Store Server API (GET /inApps/v1/transactions/{transactionId})
+// Returns the signedTransactionInfo and the raw response body
+func (s *SubscriptionVerificationService) fetchTransactionInfo(project *models.Project, baseURL, authToken, transactionID, environment string) (string, []byte, error) {
+	apiURL := fmt.Sprintf("%s/inApps/v1/transactions/%s", baseURL, transactionID)
+
+	// 添加详细日志：API 调用信息
+	logging.Debugf("调用 App Store Server API - ProjectID: %s, ProjectName: %s, BundleID: %s, URL: %s, Environment: %s",
+		project.ProjectID, project.ProjectName, project.BundleID, apiURL, environment)
+
+	if err := s.waitStoreAPI(appStoreAPILimiter); err != nil {
+		return "", nil, fmt.Errorf("App Store API rate limit wait aborted: %w", err)
+	}
+
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+authToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		// 添加详细日志：网络请求失败
+		logging.Errorf("App Store Server API 网络请求失败 - ProjectID: %s, ProjectName: %s, BundleID: %s, URL: %s, Error: %v",
+			project.ProjectID, project.ProjectName, project.BundleID, apiURL, err)
+		return "", nil, fmt.Errorf("failed to call App Store Server API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		// 添加详细日志：API 返回错误
+		logging.Errorf("App Store Server API 返回错误 - ProjectID: %s, ProjectName: %s, BundleID: %s, StatusCode: %d, Response: %s",
+			project.ProjectID, project.ProjectName, project.BundleID, resp.StatusCode, string(body))
+		return "", nil, fmt.Errorf("App Store Server API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	// Parse transaction response
+	var transactionResp struct {
+		SignedTransactionInfo string `json:"signedTransactionInfo"`
+	}
+
+	if err := json.Unmarshal(body, &transactionResp); err != nil {
+		return "", nil, fmt.Errorf("failed to parse transaction response: %w", err)
+	}
+	return transactionResp.SignedTransactionInfo, body, nil
+}
+
+// generateAppStoreJWT returns a JWT token for App Store Server API authentication
 // bundleID is optional and can be empty (Apple allows omitting bid in JWT)
+// Tokens are cached per bundleID and re-signed a couple of minutes before they expire
 func (s *SubscriptionVerificationService) generateAppStoreJWT(bundleID string) (string, error) {
+	return s.tokenCache.get(bundleID, func() (string, time.Time, error) {
+		return s.signAppStoreJWT(bundleID)
+	})
+}
+
+// signAppStoreJWT signs a new App Store Server API token and returns it with its expiry
+func (s *SubscriptionVerificationService) signAppStoreJWT(bundleID string) (string, time.Time, error) {
 	keyID := config.AppConfig.AppStoreKeyID
 	issuerID := config.AppConfig.AppStoreIssuerID
 	privateKey := config.AppConfig.AppStorePrivateKey
+	privateKeyPath := config.AppConfig.AppStorePrivateKeyPath
 
 	// 添加详细日志：配置检查
-	logging.Infof("检查 App Store API 配置 - KeyID存在: %v, IssuerID存在: %v, PrivateKey存在: %v, BundleID: %s",
-		keyID != "", issuerID != "", privateKey != "", bundleID)
+	logging.Debugf("检查 App Store API 配置 - KeyID存在: %v, IssuerID存在: %v, PrivateKey存在: %v, PrivateKeyPath: %s, BundleID: %s",
+		keyID != "", issuerID != "", privateKey != "", privateKeyPath, bundleID)
 
 	// 添加详细日志：配置值（隐藏敏感信息）
 	if keyID != "" {
-		logging.Infof("App Store KeyID: %s (长度: %d)", keyID, len(keyID))
+		logging.Debugf("App Store KeyID: %s (长度: %d)", keyID, len(keyID))
 	} else {
 		logging.Errorf("App Store KeyID 未配置")
 	}
 
 	if issuerID != "" {
-		logging.Infof("App Store IssuerID: %s (长度: %d)", issuerID, len(issuerID))
+		logging.Debugf("App Store IssuerID: %s (长度: %d)", issuerID, len(issuerID))
 	} else {
 		logging.Errorf("App Store IssuerID 未配置")
 	}
@@ -411,32 +600,33 @@ func (s *SubscriptionVerificationService) generateAppStoreJWT(bundleID string) (
 		if len(privateKey) < previewLen {
 			previewLen = len(privateKey)
 		}
-		logging.Infof("App Store PrivateKey: 已配置 (长度: %d, 前%d字符: %s...)", len(privateKey), previewLen, privateKey[:previewLen])
-	} else {
+		logging.Debugf("App Store PrivateKey: 已配置 (长度: %d, 前%d字符: %s...)", len(privateKey), previewLen, privateKey[:previewLen])
+	} else if privateKeyPath == "" {
 		logging.Errorf("App Store PrivateKey 未配置")
 	}
 
-	if keyID == "" || issuerID == "" || privateKey == "" {
-		return "", fmt.Errorf("App Store API credentials not configured")
+	if keyID == "" || issuerID == "" {
+		return "", time.Time{}, fmt.Errorf("App Store API credentials not configured")
 	}
 
-	// Load private key from environment variable (base64 or PEM)
-	key, err := loadPrivateKeyFromString(privateKey)
+	// Load private key (APPSTORE_PRIVATE_KEY, otherwise the .p8 file at APPSTORE_PRIVATE_KEY_PATH)
+	key, err := loadAppStorePrivateKey()
 	if err != nil {
 		// 添加详细日志：私钥加载失败
-		logging.Errorf("加载 App Store 私钥失败 - Error: %v, PrivateKey长度: %d", err, len(privateKey))
-		return "", fmt.Errorf("failed to load private key: %w", err)
+		logging.Errorf("加载 App Store 私钥失败 - Error: %v, PrivateKey长度: %d, PrivateKeyPath: %s", err, len(privateKey), privateKeyPath)
+		return "", time.Time{}, err
 	}
 
 	// 添加详细日志：私钥加载成功
-	logging.Infof("App Store 私钥加载成功 - Key类型: ECDSA")
+	logging.Debugf("App Store 私钥加载成功 - Key类型: ECDSA")
 
 	// Create JWT token
 	now := time.Now()
+	expiresAt := now.Add(appStoreTokenLifetime)
 	claims := jwt.MapClaims{
 		"iss": issuerID,
 		"iat": now.Unix(),
-		"exp": now.Add(20 * time.Minute).Unix(),
+		"exp": expiresAt.Unix(),
 		"aud": "appstoreconnect-v1",
 	}
 	// Add bundle_id only if provided (optional field)
@@ -448,20 +638,52 @@ func (s *SubscriptionVerificationService) generateAppStoreJWT(bundleID string) (
 	token.Header["kid"] = keyID
 
 	// 添加详细日志：JWT Claims
-	logging.Infof("生成 App Store JWT - Issuer: %s, KeyID: %s, BundleID: %s, IAT: %d, EXP: %d",
-		issuerID, keyID, bundleID, now.Unix(), now.Add(20*time.Minute).Unix())
+	logging.Debugf("生成 App Store JWT - Issuer: %s, KeyID: %s, BundleID: %s, IAT: %d, EXP: %d",
+		issuerID, keyID, bundleID, now.Unix(), expiresAt.Unix())
 
 	tokenString, err := token.SignedString(key)
 	if err != nil {
 		// 添加详细日志：JWT 签名失败
 		logging.Errorf("App Store JWT 签名失败 - Error: %v", err)
-		return "", fmt.Errorf("failed to sign token: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to sign token: %w", err)
 	}
 
 	// 添加详细日志：JWT 生成成功
-	logging.Infof("App Store JWT 生成成功 - JWT长度: %d", len(tokenString))
+	logging.Debugf("App Store JWT 生成成功 - JWT长度: %d", len(tokenString))
 
-	return tokenString, nil
+	return tokenString, expiresAt, nil
+}
+
+// ErrAppStorePrivateKeyNotConfigured is returned when neither APPSTORE_PRIVATE_KEY nor APPSTORE_PRIVATE_KEY_PATH is set
+var ErrAppStorePrivateKeyNotConfigured = errors.New("App Store private key not configured: set APPSTORE_PRIVATE_KEY or APPSTORE_PRIVATE_KEY_PATH")
+
+// loadAppStorePrivateKey loads the App Store Connect API key
+// The inline APPSTORE_PRIVATE_KEY takes precedence over the file at APPSTORE_PRIVATE_KEY_PATH
+func loadAppStorePrivateKey() (*ecdsa.PrivateKey, error) {
+	if privateKey := config.AppConfig.AppStorePrivateKey; privateKey != "" {
+		key, err := loadPrivateKeyFromString(privateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load private key from APPSTORE_PRIVATE_KEY: %w", err)
+		}
+		return key, nil
+	}
+	if path := config.AppConfig.AppStorePrivateKeyPath; path != "" {
+		return loadPrivateKeyFromPath(path)
+	}
+	return nil, ErrAppStorePrivateKeyNotConfigured
+}
+
+// loadPrivateKeyFromPath loads ECDSA private key from a file (the .p8 downloaded from App Store Connect)
+func loadPrivateKeyFromPath(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file %s: %w", path, err)
+	}
+	key, err := loadPrivateKeyFromString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load private key from %s: %w", path, err)
+	}
+	return key, nil
 }
 
 // loadPrivateKeyFromString loads ECDSA private key from string (PEM or base64)
@@ -492,14 +714,6 @@ func loadPrivateKeyFromString(keyStr string) (*ecdsa.PrivateKey, error) {
 	return ecdsaKey, nil
 }
 
-// VerifyGooglePlayPurchase verifies Android purchase using Google Play Developer API
-func (s *SubscriptionVerificationService) VerifyGooglePlayPurchase(projectID, purchaseToken, productID, userID string) (*models.Subscription, error) {
-	// TODO: Implement Google Play verification using Google Play Developer API
-	// API: GET https://androidpublisher.googleapis.com/androidpublisher/v3/applications/{packageName}/purchases/subscriptions/{subscriptionId}/tokens/{token}
-	// Requires: Google Service Account credentials
-	return nil, fmt.Errorf("Google Play verification not yet implemented")
-}
-
 // AppleVerificationError represents Apple verification error
 type AppleVerificationError struct {
 	Status int
@@ -509,6 +723,21 @@ func (e *AppleVerificationError) Error() string {
 	return fmt.Sprintf("Apple verification failed with status: %d", e.Status)
 }
 
+// TimeFromMillis converts milliseconds since epoch to time.Time
+// Returns zero time (unset) instead of 1970-01-01 when the timestamp is missing
+func TimeFromMillis(ms int64) time.Time {
+	if ms <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// IsAutoRenewableType reports whether an Apple transaction type requires an expiresDate
+// An empty type is treated as auto-renewable for backward compatibility
+func IsAutoRenewableType(transactionType string) bool {
+	return transactionType == "" || transactionType == "Auto-Renewable Subscription"
+}
+
 // parseAppleTimestamp parses Apple timestamp (milliseconds since epoch)
 func parseAppleTimestamp(timestampStr string) (time.Time, error) {
 	if timestampStr == "" {
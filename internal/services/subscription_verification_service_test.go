@@ -0,0 +1,46 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeFromMillis(t *testing.T) {
+	tests := []struct {
+		name string
+		ms   int64
+		want time.Time
+	}{
+		{"missing", 0, time.Time{}},
+		{"negative", -1, time.Time{}},
+		{"epoch millisecond", 1, time.Unix(0, int64(time.Millisecond))},
+		{"purchase date", 1735689600123, time.Date(2025, 1, 1, 0, 0, 0, 123*int(time.Millisecond), time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TimeFromMillis(tt.ms)
+			if !got.Equal(tt.want) || got.IsZero() != tt.want.IsZero() {
+				t.Errorf("TimeFromMillis(%d) = %v, want %v", tt.ms, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsAutoRenewableType(t *testing.T) {
+	tests := []struct {
+		transactionType string
+		want            bool
+	}{
+		{"", true},
+		{"Auto-Renewable Subscription", true},
+		{"Non-Renewing Subscription", false},
+		{"Consumable", false},
+		{"Non-Consumable", false},
+		{"auto-renewable subscription", false},
+	}
+	for _, tt := range tests {
+		if got := IsAutoRenewableType(tt.transactionType); got != tt.want {
+			t.Errorf("IsAutoRenewableType(%q) = %v, want %v", tt.transactionType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketWait(t *testing.T) {
+	t.Run("burst is served without waiting", func(t *testing.T) {
+		bucket := NewTokenBucket(10, 3)
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			if err := bucket.Wait(context.Background()); err != nil {
+				t.Fatalf("Wait() error = %v", err)
+			}
+		}
+		if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+			t.Errorf("burst took %v, want no wait", elapsed)
+		}
+	})
+
+	t.Run("calls beyond the burst wait for a refill", func(t *testing.T) {
+		bucket := NewTokenBucket(20, 1) // one token every 50ms
+		ctx := context.Background()
+		bucket.Wait(ctx)
+		start := time.Now()
+		if err := bucket.Wait(ctx); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+			t.Errorf("second call waited %v, want about 50ms", elapsed)
+		}
+	})
+
+	t.Run("waiting stops when the context is done", func(t *testing.T) {
+		bucket := NewTokenBucket(0.1, 1) // next token after 10s
+		bucket.Wait(context.Background())
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if err := bucket.Wait(ctx); err != context.DeadlineExceeded {
+			t.Errorf("Wait() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("zero rate is unlimited", func(t *testing.T) {
+		bucket := NewTokenBucket(0, 0)
+		if bucket != nil {
+			t.Fatalf("NewTokenBucket(0) = %+v, want nil", bucket)
+		}
+		if err := bucket.Wait(context.Background()); err != nil {
+			t.Errorf("nil bucket Wait() error = %v", err)
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"verification-api/internal/models"
+	"verification-api/pkg/metrics"
+)
+
+// TransactionTooOldCode is the verify error code for transactions older than the project's maximum age
+const TransactionTooOldCode = "transaction_too_old"
+
+// ErrTransactionTooOld is returned by the verify functions for transactions older than the maximum age
+var ErrTransactionTooOld = errors.New("transaction is older than the maximum accepted age")
+
+// MaxTransactionAge returns the project's maximum accepted transaction age (0 = disabled)
+func MaxTransactionAge(project *models.Project) time.Duration {
+	if project == nil || project.MaxTransactionAgeDays <= 0 {
+		return 0
+	}
+	return time.Duration(project.MaxTransactionAgeDays) * 24 * time.Hour
+}
+
+// WithMaxTransactionAge makes the verify functions reject transactions purchased longer than maxAge ago
+// Limits replay of old (still valid) receipts; the check runs before the subscription is saved
+// Only set for client verify requests, store notifications and syncs must always be applied
+func (s *SubscriptionVerificationService) WithMaxTransactionAge(maxAge time.Duration) *SubscriptionVerificationService {
+	s.maxTransactionAge = maxAge
+	return s
+}
+
+// checkTransactionAge returns ErrTransactionTooOld when the purchase date is older than the maximum age
+func (s *SubscriptionVerificationService) checkTransactionAge(purchaseDate time.Time) error {
+	if s.maxTransactionAge <= 0 || purchaseDate.IsZero() {
+		return nil
+	}
+	if age := time.Since(purchaseDate); age > s.maxTransactionAge {
+		metrics.IncCounter("transaction_too_old_total", nil)
+		return fmt.Errorf("%w: purchased %s, maximum age %s",
+			ErrTransactionTooOld, purchaseDate.UTC().Format(time.RFC3339), s.maxTransactionAge)
+	}
+	return nil
+}
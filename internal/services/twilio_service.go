@@ -0,0 +1,104 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"verification-api/internal/config"
+)
+
+// twilioAPIBaseURL is the Twilio REST API endpoint
+const twilioAPIBaseURL = "https://api.twilio.com/2010-04-01"
+
+// TwilioService sends verification codes by SMS through the Twilio Messages API
+type TwilioService struct {
+	accountSID          string
+	authToken           string
+	fromNumber          string
+	messagingServiceSID string
+	httpClient          *http.Client
+}
+
+// NewTwilioService creates a Twilio service from the TWILIO_* configuration
+func NewTwilioService() *TwilioService {
+	return &TwilioService{
+		accountSID:          config.AppConfig.TwilioAccountSID,
+		authToken:           config.AppConfig.TwilioAuthToken,
+		fromNumber:          config.AppConfig.TwilioFromNumber,
+		messagingServiceSID: config.AppConfig.TwilioMessagingServiceSID,
+		httpClient:          &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Configured reports whether credentials and a sender (number or messaging service) are set
+func (s *TwilioService) Configured() bool {
+	return s.accountSID != "" && s.authToken != "" && (s.fromNumber != "" || s.messagingServiceSID != "")
+}
+
+// Send implements CodeSender, recipient is the E.164 phone number
+func (s *TwilioService) Send(projectID, recipient, code, language string, expireMinutes int) error {
+	projectName := "UnionHub"
+	if project, err := NewProjectService().GetProjectByID(projectID); err == nil {
+		projectName = project.ProjectName
+	}
+
+	form := url.Values{}
+	form.Set("To", recipient)
+	form.Set("Body", smsContent(language, projectName, code, expireMinutes))
+	if s.messagingServiceSID != "" {
+		form.Set("MessagingServiceSid", s.messagingServiceSID)
+	} else {
+		form.Set("From", s.fromNumber)
+	}
+
+	endpoint := fmt.Sprintf("%s/Accounts/%s/Messages.json", twilioAPIBaseURL, url.PathEscape(s.accountSID))
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create Twilio request: %w", err)
+	}
+	req.SetBasicAuth(s.accountSID, s.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send SMS via Twilio: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		// Twilio errors are JSON: {"code": 21211, "message": "The 'To' number is not a valid phone number."}
+		var apiErr struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("twilio API error: status %d, code %d: %s", resp.StatusCode, apiErr.Code, apiErr.Message)
+		}
+		return fmt.Errorf("twilio API error: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// smsContent returns the SMS text in the requested language (English by default)
+func smsContent(language, projectName, code string, expireMinutes int) string {
+	templates := map[string]string{
+		"en":    "[%s] Your verification code is %s. It expires in %d minutes.",
+		"zh-CN": "【%s】您的验证码是 %s，%d 分钟内有效。",
+		"zh-TW": "【%s】您的驗證碼是 %s，%d 分鐘內有效。",
+		"ja":    "[%s] 認証コードは %s です。%d分間有効です。",
+		"ko":    "[%s] 인증 코드는 %s 입니다. %d분 후에 만료됩니다.",
+		"es":    "[%s] Su código de verificación es %s. Expira en %d minutos.",
+		"fr":    "[%s] Votre code de vérification est %s. Il expire dans %d minutes.",
+		"de":    "[%s] Ihr Bestätigungscode lautet %s. Er läuft in %d Minuten ab.",
+	}
+	template, ok := templates[language]
+	if !ok {
+		template = templates["en"]
+	}
+	return fmt.Sprintf(template, projectName, code, expireMinutes)
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+	"verification-api/internal/database"
+	"verification-api/internal/models"
+	"verification-api/pkg/logging"
+	"verification-api/pkg/metrics"
+)
+
+// recordWebhookDelivery stores the final outcome of a webhook delivery and returns it
+// deliveryErr is nil on success; failures to store are logged and never affect the delivery (ID stays 0)
+func recordWebhookDelivery(endpoint WebhookEndpoint, payload WebhookPayload, statusCode, attempts int, deliveryErr error) *models.WebhookDelivery {
+	body, _ := json.Marshal(payload) // WebhookPayload only has plain string / int fields
+
+	delivery := &models.WebhookDelivery{
+		ProjectID:     endpoint.ProjectID,
+		EventID:       payload.EventID,
+		Event:         payload.Event,
+		TransactionID: payload.TransactionID,
+		URL:           endpoint.URL,
+		Environment:   endpoint.Environment,
+		StatusCode:    statusCode,
+		Attempts:      attempts,
+		Succeeded:     deliveryErr == nil,
+		Payload:       string(body),
+	}
+	if deliveryErr != nil {
+		delivery.LastError = deliveryErr.Error()
+		metrics.IncCounter("webhook_deliveries_failed_total", nil)
+	}
+	if endpoint.ProjectID == "" || database.DB == nil {
+		return delivery
+	}
+
+	if err := database.CreateWebhookDelivery(delivery); err != nil {
+		logging.Errorf("Failed to store webhook delivery - project: %s, transaction: %s, error: %v",
+			endpoint.ProjectID, payload.TransactionID, err)
+	}
+	return delivery
+}
+
+// RedeliverWebhook sends the stored payload of a delivery again, once and synchronously
+// The project's current webhook config is used (URL chosen by the stored environment); the payload is sent unchanged,
+// keeping its event_id so a backend that did process the first delivery can ignore it
+// The new attempt is stored as a new WebhookDelivery, which is returned
+func (wn *WebhookNotifier) RedeliverWebhook(delivery *models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	var payload WebhookPayload
+	if err := json.Unmarshal([]byte(delivery.Payload), &payload); err != nil {
+		return nil, fmt.Errorf("stored payload is invalid: %w", err)
+	}
+
+	project, err := NewProjectService().GetProjectForAdmin(delivery.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	endpoint := WebhookEndpointFromProject(project).ForEnvironment(delivery.Environment)
+	if endpoint.URL == "" {
+		return nil, fmt.Errorf("webhook callback URL is not configured for this project")
+	}
+
+	start := time.Now()
+	statusCode, deliveryErr := wn.deliver(endpoint, payload)
+	logging.Infof("Webhook redelivered - delivery: %d, url: %s, transaction: %s, status: %d, latency: %s, error: %v",
+		delivery.ID, endpoint.URL, payload.TransactionID, statusCode, time.Since(start), deliveryErr)
+	metrics.IncCounter("webhook_redeliveries_total", nil)
+
+	return recordWebhookDelivery(endpoint, payload, statusCode, 1, deliveryErr), nil
+}
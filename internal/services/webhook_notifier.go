@@ -4,13 +4,20 @@ import (
 	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"hash"
 	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
 	"time"
+	"verification-api/internal/config"
 	"verification-api/internal/models"
 	"verification-api/pkg/logging"
+	"verification-api/pkg/metrics"
 )
 
 // WebhookNotifier handles webhook notifications to App Backend
@@ -21,36 +28,209 @@ type WebhookNotifier struct {
 // NewWebhookNotifier creates a new webhook notifier
 func NewWebhookNotifier() *WebhookNotifier {
 	return &WebhookNotifier{
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second, // 10 second timeout
-		},
+		httpClient: NewWebhookHTTPClient(10 * time.Second), // 10 second timeout
 	}
 }
 
+// Webhook content types
+const (
+	WebhookContentTypeJSON = "json" // application/json (default)
+	WebhookContentTypeForm = "form" // application/x-www-form-urlencoded (legacy backends)
+)
+
+// Webhook signature algorithms and header formats
+const (
+	WebhookSignatureSHA256   = "sha256"   // HMAC-SHA256 (default)
+	WebhookSignatureSHA512   = "sha512"   // HMAC-SHA512
+	WebhookSignatureHex      = "hex"      // raw hex digest (default)
+	WebhookSignaturePrefixed = "prefixed" // "<algorithm>=<hex>", e.g. sha256=<hex> (GitHub-style)
+)
+
+// WebhookEndpoint represents an App Backend webhook destination
+type WebhookEndpoint struct {
+	ProjectID          string // Project the endpoint belongs to, used to re-read the config between retries
+	Environment        string // Subscription environment the URL was chosen for (see ForEnvironment)
+	URL                string
+	SandboxURL         string // Used for sandbox subscriptions when set (falls back to URL)
+	ProductionURL      string // Used for production subscriptions when set (falls back to URL)
+	Secret             string
+	ContentType        string // json (default) or form
+	SignatureAlgorithm string // sha256 (default) or sha512
+	SignatureFormat    string // hex (default) or prefixed
+	MaxRetries         int    // Retries after the first attempt (0 = default, -1 = none), see newWebhookRetryPolicy
+	BackoffBaseMs      int    // Exponential backoff base in milliseconds (0 = default schedule)
+}
+
+// WebhookEndpointFromProject builds the webhook endpoint configured for a project
+func WebhookEndpointFromProject(project *models.Project) WebhookEndpoint {
+	return WebhookEndpoint{
+		ProjectID:          project.ProjectID,
+		URL:                project.WebhookCallbackURL,
+		SandboxURL:         project.WebhookSandboxURL,
+		ProductionURL:      project.WebhookProductionURL,
+		Secret:             project.WebhookSecret,
+		ContentType:        project.WebhookContentType,
+		SignatureAlgorithm: project.WebhookSignatureAlgorithm,
+		SignatureFormat:    project.WebhookSignatureFormat,
+		MaxRetries:         project.WebhookMaxRetries,
+		BackoffBaseMs:      project.WebhookBackoffBaseMs,
+	}
+}
+
+// ForEnvironment returns the endpoint with URL set to the destination of a subscription environment
+// Empty or unknown environments (and environments without a dedicated URL) use the default URL
+// Any non-production App Store environment ("Sandbox", "Xcode") counts as sandbox
+func (e WebhookEndpoint) ForEnvironment(environment string) WebhookEndpoint {
+	e.Environment = environment
+	switch {
+	case environment == "":
+	case strings.EqualFold(environment, "production"):
+		if e.ProductionURL != "" {
+			e.URL = e.ProductionURL
+		}
+	default:
+		if e.SandboxURL != "" {
+			e.URL = e.SandboxURL
+		}
+	}
+	return e
+}
+
+// ValidateWebhookSignatureConfig validates the signature algorithm and header format (empty means default)
+func ValidateWebhookSignatureConfig(algorithm, format string) error {
+	switch algorithm {
+	case "", WebhookSignatureSHA256, WebhookSignatureSHA512:
+	default:
+		return fmt.Errorf("invalid webhook_signature_algorithm %q (must be sha256 or sha512)", algorithm)
+	}
+	switch format {
+	case "", WebhookSignatureHex, WebhookSignaturePrefixed:
+	default:
+		return fmt.Errorf("invalid webhook_signature_format %q (must be hex or prefixed)", format)
+	}
+	return nil
+}
+
+// IsValidWebhookContentType reports whether the content type is supported (empty means json)
+func IsValidWebhookContentType(contentType string) bool {
+	return contentType == "" || contentType == WebhookContentTypeJSON || contentType == WebhookContentTypeForm
+}
+
 // WebhookPayload represents the payload sent to App Backend
 type WebhookPayload struct {
-	Event                 string `json:"event"`                   // e.g., "subscription.updated"
-	TransactionID         string `json:"transaction_id"`          // App Store/Google Play transaction ID
-	OriginalTransactionID string `json:"original_transaction_id"` // Original transaction ID (for renewals)
-	AppAccountToken       string `json:"app_account_token"`       // App Account Token (UUID format)
-	Status                string `json:"status"`                  // Subscription status: active, cancelled, expired, refunded, etc.
-	ProductID             string `json:"product_id"`              // Product ID
-	ExpiresDate           string `json:"expires_date"`            // ISO 8601 format
-	Platform              string `json:"platform"`                // ios or android
-	Timestamp             string `json:"timestamp"`               // ISO 8601 format
+	EventID               string `json:"event_id"`                    // Unique per event, unchanged across retries (also sent as X-UnionHub-Event-Id)
+	Event                 string `json:"event"`                       // e.g., "subscription.updated"
+	TransactionID         string `json:"transaction_id"`              // App Store/Google Play transaction ID
+	OriginalTransactionID string `json:"original_transaction_id"`     // Original transaction ID (for renewals)
+	AppAccountToken       string `json:"app_account_token"`           // App Account Token (UUID format)
+	Status                string `json:"status"`                      // Subscription status: active, cancelled, expired, refunded, etc.
+	ProductID             string `json:"product_id"`                  // Product ID
+	ExpiresDate           string `json:"expires_date"`                // ISO 8601 format
+	Platform              string `json:"platform"`                    // ios or android
+	Timestamp             string `json:"timestamp"`                   // ISO 8601 format
+	ExpirationIntent      int    `json:"expiration_intent,omitempty"` // Apple expiration intent: 1=cancelled by user, 2=billing error, ...
+	Subtype               string `json:"subtype,omitempty"`           // Subtype of the last Apple notification, e.g. AUTO_RENEW_DISABLED, VOLUNTARY, BILLING_RETRY
+
+	// fraud.suspected only
+	SubscriptionCount int64 `json:"subscription_count,omitempty"` // Distinct subscriptions of the user
+}
+
+// Webhook events
+const (
+	WebhookEventSubscriptionUpdated = "subscription.updated"
+	WebhookEventFraudSuspected      = "fraud.suspected"
+)
+
+// formValues returns the payload as form fields (same names as the JSON keys)
+func (p WebhookPayload) formValues() url.Values {
+	values := url.Values{}
+	values.Set("event_id", p.EventID)
+	values.Set("event", p.Event)
+	values.Set("transaction_id", p.TransactionID)
+	values.Set("original_transaction_id", p.OriginalTransactionID)
+	values.Set("app_account_token", p.AppAccountToken)
+	values.Set("status", p.Status)
+	values.Set("product_id", p.ProductID)
+	values.Set("expires_date", p.ExpiresDate)
+	values.Set("platform", p.Platform)
+	values.Set("timestamp", p.Timestamp)
+	if p.ExpirationIntent > 0 {
+		values.Set("expiration_intent", fmt.Sprintf("%d", p.ExpirationIntent))
+	}
+	if p.Subtype != "" {
+		values.Set("subtype", p.Subtype)
+	}
+	if p.SubscriptionCount > 0 {
+		values.Set("subscription_count", fmt.Sprintf("%d", p.SubscriptionCount))
+	}
+	return values
+}
+
+// encodeWebhookPayload encodes the payload according to the content type
+// Returns the body and the Content-Type header value
+func encodeWebhookPayload(payload WebhookPayload, contentType string) ([]byte, string, error) {
+	if contentType == WebhookContentTypeForm {
+		return []byte(payload.formValues().Encode()), "application/x-www-form-urlencoded", nil
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, "", err
+	}
+	return jsonData, "application/json", nil
+}
+
+// NotifyAppBackendAsync sends webhook notification to App Backend in a new goroutine
+// A panic during delivery is recovered and logged so it cannot crash the process
+func (wn *WebhookNotifier) NotifyAppBackendAsync(endpoint WebhookEndpoint, subscription *models.Subscription) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				transactionID := ""
+				if subscription != nil {
+					transactionID = subscription.TransactionID
+				}
+				logging.Errorf("Webhook notifier panic recovered - url: %s, transaction: %s, panic: %v\n%s",
+					endpoint.URL, transactionID, r, debug.Stack())
+				metrics.IncCounter("webhook_notifier_panics_total", nil)
+			}
+		}()
+
+		wn.NotifyAppBackend(endpoint, subscription)
+	}()
 }
 
 // NotifyAppBackend sends webhook notification to App Backend
-// This function is called asynchronously (in goroutine) to avoid blocking
-func (wn *WebhookNotifier) NotifyAppBackend(callbackURL string, secret string, subscription *models.Subscription) {
-	if callbackURL == "" {
+// This function blocks until delivery finishes, use NotifyAppBackendAsync to avoid blocking
+func (wn *WebhookNotifier) NotifyAppBackend(endpoint WebhookEndpoint, subscription *models.Subscription) {
+	endpoint = endpoint.ForEnvironment(subscription.Environment)
+	if endpoint.URL == "" {
 		// No webhook configured, skip
 		return
 	}
 
-	// Create payload
-	payload := WebhookPayload{
-		Event:                 "subscription.updated",
+	// Send with retry mechanism
+	wn.sendWithRetry(endpoint, newSubscriptionPayload(WebhookEventSubscriptionUpdated, subscription))
+}
+
+// NotifyFraudSuspected sends a fraud.suspected event for the user owning the subscription
+// subscriptionCount is the number of distinct subscriptions that exceeded the threshold; blocks like NotifyAppBackend
+func (wn *WebhookNotifier) NotifyFraudSuspected(endpoint WebhookEndpoint, subscription *models.Subscription, subscriptionCount int64) {
+	endpoint = endpoint.ForEnvironment(subscription.Environment)
+	if endpoint.URL == "" {
+		return
+	}
+
+	payload := newSubscriptionPayload(WebhookEventFraudSuspected, subscription)
+	payload.SubscriptionCount = subscriptionCount
+	wn.sendWithRetry(endpoint, payload)
+}
+
+// newSubscriptionPayload builds the webhook payload of an event about a subscription
+func newSubscriptionPayload(event string, subscription *models.Subscription) WebhookPayload {
+	return WebhookPayload{
+		EventID:               newWebhookEventID(),
+		Event:                 event,
 		TransactionID:         subscription.TransactionID,
 		OriginalTransactionID: subscription.OriginalTransactionID,
 		AppAccountToken:       subscription.AppAccountToken,
@@ -59,81 +239,231 @@ func (wn *WebhookNotifier) NotifyAppBackend(callbackURL string, secret string, s
 		ExpiresDate:           subscription.ExpiresDate.Format(time.RFC3339),
 		Platform:              subscription.Platform,
 		Timestamp:             time.Now().Format(time.RFC3339),
+		ExpirationIntent:      subscription.ExpirationIntent,
+		Subtype:               subscription.LastSubtype,
 	}
+}
 
-	// Send with retry mechanism
-	wn.sendWithRetry(callbackURL, secret, payload)
+// newWebhookEventID generates the ID of a webhook event (a lowercase UUID)
+// Generated once per event so App Backends can drop repeated deliveries of the same event
+func newWebhookEventID() string {
+	eventID, err := newUUIDv4()
+	if err != nil {
+		logging.Errorf("Failed to generate webhook event ID: %v", err)
+		return fmt.Sprintf("evt-%d", time.Now().UnixNano())
+	}
+	return eventID
 }
 
 // sendWithRetry sends webhook with retry mechanism
-// Retry schedule: 1s, 5s, 30s (3 attempts total)
-func (wn *WebhookNotifier) sendWithRetry(callbackURL string, secret string, payload WebhookPayload) {
-	retryDelays := []time.Duration{1 * time.Second, 5 * time.Second, 30 * time.Second}
-	maxRetries := len(retryDelays)
+// Default retry schedule: 1s, 5s (3 attempts total); projects can configure exponential backoff
+// The final outcome is stored as a WebhookDelivery (see recordWebhookDelivery)
+func (wn *WebhookNotifier) sendWithRetry(endpoint WebhookEndpoint, payload WebhookPayload) {
+	// The policy is fixed for the whole delivery, even if the config is reloaded between retries
+	policy := newWebhookRetryPolicy(endpoint.MaxRetries, endpoint.BackoffBaseMs)
+	maxRetries := policy.attempts
 
+	var statusCode int
+	var err error
 	for attempt := 0; attempt < maxRetries; attempt++ {
-		err := wn.sendWebhook(callbackURL, secret, payload)
+		if attempt > 0 && config.AppConfig.WebhookRetryReloadConfig {
+			// Pick up URL / secret changes made while the delivery was being retried
+			current, ok := currentWebhookEndpoint(endpoint)
+			if !ok {
+				logging.Warnf("Webhook no longer configured, dropping retries - project: %s, transaction: %s",
+					endpoint.ProjectID, payload.TransactionID)
+				recordWebhookDelivery(endpoint, payload, statusCode, attempt, fmt.Errorf("webhook no longer configured: %w", err))
+				return
+			}
+			if current.URL != endpoint.URL {
+				logging.Infof("Webhook URL changed during retries - project: %s, url: %s -> %s",
+					endpoint.ProjectID, endpoint.URL, current.URL)
+			}
+			endpoint = current
+		}
+
+		statusCode, err = wn.deliver(endpoint, payload)
 		if err == nil {
 			logging.Infof("Webhook notification sent successfully - url: %s, transaction: %s, attempt: %d",
-				callbackURL, payload.TransactionID, attempt+1)
+				endpoint.URL, payload.TransactionID, attempt+1)
+			recordWebhookDelivery(endpoint, payload, statusCode, attempt+1, nil)
 			return
 		}
 
 		logging.Errorf("Webhook notification failed - url: %s, transaction: %s, attempt: %d, error: %v",
-			callbackURL, payload.TransactionID, attempt+1, err)
+			endpoint.URL, payload.TransactionID, attempt+1, err)
 
 		// If not the last attempt, wait before retry
 		if attempt < maxRetries-1 {
-			time.Sleep(retryDelays[attempt])
+			time.Sleep(policy.delay(attempt))
 		}
 	}
 
 	logging.Errorf("Webhook notification failed after %d attempts - url: %s, transaction: %s",
-		maxRetries, callbackURL, payload.TransactionID)
+		maxRetries, endpoint.URL, payload.TransactionID)
+	recordWebhookDelivery(endpoint, payload, statusCode, maxRetries, err)
 }
 
-// sendWebhook sends a single webhook request
-func (wn *WebhookNotifier) sendWebhook(callbackURL string, secret string, payload WebhookPayload) error {
-	// Marshal payload to JSON
-	jsonData, err := json.Marshal(payload)
+// currentWebhookEndpoint re-reads the webhook config of the endpoint's project
+// Returns the endpoint unchanged when it has no project or the project can't be loaded,
+// and false when the project no longer has a webhook for the environment
+func currentWebhookEndpoint(endpoint WebhookEndpoint) (WebhookEndpoint, bool) {
+	if endpoint.ProjectID == "" {
+		return endpoint, true
+	}
+	project, err := NewProjectService().GetProjectForAdmin(endpoint.ProjectID)
+	if err != nil {
+		logging.Warnf("Failed to reload webhook config, retrying with the previous one - project: %s, error: %v", endpoint.ProjectID, err)
+		return endpoint, true
+	}
+	current := WebhookEndpointFromProject(project).ForEnvironment(endpoint.Environment)
+	return current, current.URL != ""
+}
+
+// WebhookTestResult represents the result of a test webhook delivery
+type WebhookTestResult struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code,omitempty"` // HTTP status returned by App Backend (0 if no response)
+	LatencyMS  int64  `json:"latency_ms"`
+	Signed     bool   `json:"signed"` // Whether X-UnionHub-Signature header was sent
+	Error      string `json:"error,omitempty"`
+}
+
+// SendTestWebhook sends a synthetic subscription.updated event synchronously (no retry)
+// Used by integrators to debug their endpoint and signature verification
+func (wn *WebhookNotifier) SendTestWebhook(endpoint WebhookEndpoint) *WebhookTestResult {
+	now := time.Now()
+	payload := WebhookPayload{
+		EventID:               newWebhookEventID(),
+		Event:                 "subscription.updated",
+		TransactionID:         "test_transaction_id",
+		OriginalTransactionID: "test_original_transaction_id",
+		AppAccountToken:       "00000000-0000-0000-0000-000000000000",
+		Status:                "active",
+		ProductID:             "test_product_id",
+		ExpiresDate:           now.AddDate(0, 1, 0).Format(time.RFC3339),
+		Platform:              "ios",
+		Timestamp:             now.Format(time.RFC3339),
+	}
+
+	result := &WebhookTestResult{
+		URL:    endpoint.URL,
+		Signed: endpoint.Secret != "",
+	}
+
+	statusCode, err := wn.deliver(endpoint, payload)
+	result.LatencyMS = time.Since(now).Milliseconds()
+	result.StatusCode = statusCode
 	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// deliver sends a single webhook request and returns the response status code
+// The signature is computed over the encoded body bytes (JSON or form)
+func (wn *WebhookNotifier) deliver(endpoint WebhookEndpoint, payload WebhookPayload) (int, error) {
+	// Encode payload (JSON by default)
+	body, contentType, err := encodeWebhookPayload(payload, endpoint.ContentType)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	return wn.post(endpoint, body, contentType, payload.EventID)
+}
+
+// post sends an encoded body to the endpoint, signing it if a secret is configured
+// eventID is sent as X-UnionHub-Event-Id when set
+func (wn *WebhookNotifier) post(endpoint WebhookEndpoint, body []byte, contentType, eventID string) (int, error) {
+	// Re-validate URL at delivery time (DNS may have changed since configuration)
+	if err := ValidateWebhookURL(endpoint.URL); err != nil {
+		return 0, fmt.Errorf("webhook URL rejected: %w", err)
 	}
 
 	// Create HTTP request
-	req, err := http.NewRequest("POST", callbackURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", endpoint.URL, bytes.NewBuffer(body))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return 0, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set headers
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("User-Agent", "UnionHub-Webhook/1.0")
+	if eventID != "" {
+		req.Header.Set("X-UnionHub-Event-Id", eventID)
+	}
 
 	// Add signature if secret is provided
-	if secret != "" {
-		signature := wn.generateSignature(jsonData, secret)
+	if endpoint.Secret != "" {
+		signature := generateSignature(body, endpoint)
 		req.Header.Set("X-UnionHub-Signature", signature)
 	}
 
 	// Send request
 	resp, err := wn.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return 0, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Check response status
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return resp.StatusCode, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	return nil
+	return resp.StatusCode, nil
+}
+
+// generateSignature generates the HMAC signature for webhook payload using the endpoint's algorithm and format
+func generateSignature(payload []byte, endpoint WebhookEndpoint) string {
+	algorithm := endpoint.SignatureAlgorithm
+	newHash := sha256.New
+	if algorithm == WebhookSignatureSHA512 {
+		newHash = sha512.New
+	} else {
+		algorithm = WebhookSignatureSHA256
+	}
+
+	signature := hex.EncodeToString(hmacDigest(newHash, payload, endpoint.Secret))
+	if endpoint.SignatureFormat == WebhookSignaturePrefixed {
+		return algorithm + "=" + signature
+	}
+	return signature
+}
+
+// VerifySignature reports whether provided is a valid X-UnionHub-Signature of payload for secret
+// Accepts both header formats: raw hex (sha256 or sha512, told apart by length) and prefixed "<algorithm>=<hex>"
+// The digests are compared with hmac.Equal (constant time); never compare signatures with ==
+func (wn *WebhookNotifier) VerifySignature(payload []byte, secret, provided string) bool {
+	if secret == "" || provided == "" {
+		return false
+	}
+
+	algorithm, signature, prefixed := strings.Cut(strings.TrimSpace(provided), "=")
+	if !prefixed {
+		signature = algorithm
+		algorithm = ""
+	}
+	digest, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	newHash := sha256.New
+	switch {
+	case algorithm == WebhookSignatureSHA512, algorithm == "" && len(digest) == sha512.Size:
+		newHash = sha512.New
+	case algorithm == WebhookSignatureSHA256, algorithm == "" && len(digest) == sha256.Size:
+	default:
+		return false
+	}
+	return hmac.Equal(digest, hmacDigest(newHash, payload, secret))
 }
 
-// generateSignature generates HMAC-SHA256 signature for webhook payload
-func (wn *WebhookNotifier) generateSignature(payload []byte, secret string) string {
-	h := hmac.New(sha256.New, []byte(secret))
+// hmacDigest computes the HMAC of payload with the given hash function
+func hmacDigest(newHash func() hash.Hash, payload []byte, secret string) []byte {
+	h := hmac.New(newHash, []byte(secret))
 	h.Write(payload)
-	return hex.EncodeToString(h.Sum(nil))
+	return h.Sum(nil)
 }
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"verification-api/internal/config"
+	"verification-api/internal/database"
+	"verification-api/internal/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupWebhookTestDB points the database package at a fresh in-memory SQLite database
+// and allows plain-HTTP loopback webhooks so httptest servers can be used as App Backends
+func setupWebhookTestDB(t *testing.T, reloadConfig bool) {
+	t.Helper()
+	config.AppConfig = &config.Config{
+		WebhookAllowHTTP:         true,
+		WebhookAllowPrivateIPs:   true,
+		WebhookRetryReloadConfig: reloadConfig,
+	}
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:services_%s?mode=memory&cache=shared", name)), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Project{}, &models.WebhookDelivery{}); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	database.DB = db
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+// webhookTestServer counts requests and answers them with status
+func webhookTestServer(t *testing.T, status int, onRequest func()) (*httptest.Server, *int32) {
+	t.Helper()
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if onRequest != nil {
+			onRequest()
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+func TestSendWithRetryPicksUpConfigChangedMidFlight(t *testing.T) {
+	tests := []struct {
+		name         string
+		reloadConfig bool
+		newURL       func(newServer string) string // Webhook URL stored while the first attempt is in flight
+		oldHits      int32
+		newHits      int32
+		wantAttempts int
+		wantSuccess  bool
+		wantURL      func(oldServer, newServer string) string
+	}{
+		{
+			name:         "retry goes to the new URL",
+			reloadConfig: true,
+			newURL:       func(newServer string) string { return newServer },
+			oldHits:      1,
+			newHits:      1,
+			wantAttempts: 2,
+			wantSuccess:  true,
+			wantURL:      func(_, newServer string) string { return newServer },
+		},
+		{
+			name:         "retries are dropped when the webhook is removed",
+			reloadConfig: true,
+			newURL:       func(string) string { return "" },
+			oldHits:      1,
+			newHits:      0,
+			wantAttempts: 1,
+			wantSuccess:  false,
+			wantURL:      func(oldServer, _ string) string { return oldServer },
+		},
+		{
+			name:         "reload disabled keeps the original URL",
+			reloadConfig: false,
+			newURL:       func(newServer string) string { return newServer },
+			oldHits:      2,
+			newHits:      0,
+			wantAttempts: 2,
+			wantSuccess:  false,
+			wantURL:      func(oldServer, _ string) string { return oldServer },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupWebhookTestDB(t, tt.reloadConfig)
+
+			newServer, newHits := webhookTestServer(t, http.StatusOK, nil)
+			var changed int32
+			oldServer, oldHits := webhookTestServer(t, http.StatusInternalServerError, func() {
+				// Change the project's webhook after the first attempt has reached the App Backend
+				if atomic.CompareAndSwapInt32(&changed, 0, 1) {
+					database.DB.Model(&models.Project{}).Where("project_id = ?", "proj-a").
+						Update("webhook_callback_url", tt.newURL(newServer.URL))
+				}
+			})
+
+			project := models.Project{
+				ProjectID:            "proj-a",
+				ProjectName:          "Project A",
+				APIKey:               "key-proj-a",
+				BundleID:             "com.example.ios.proj-a",
+				IsActive:             true,
+				WebhookCallbackURL:   oldServer.URL,
+				WebhookMaxRetries:    1,
+				WebhookBackoffBaseMs: 1,
+			}
+			if err := database.DB.Create(&project).Error; err != nil {
+				t.Fatalf("create project: %v", err)
+			}
+
+			payload := WebhookPayload{EventID: "evt-1", Event: "subscription.updated", TransactionID: "tx-1"}
+			NewWebhookNotifier().sendWithRetry(WebhookEndpointFromProject(&project).ForEnvironment("Production"), payload)
+
+			if got := atomic.LoadInt32(oldHits); got != tt.oldHits {
+				t.Errorf("old URL received %d requests, want %d", got, tt.oldHits)
+			}
+			if got := atomic.LoadInt32(newHits); got != tt.newHits {
+				t.Errorf("new URL received %d requests, want %d", got, tt.newHits)
+			}
+
+			var delivery models.WebhookDelivery
+			if err := database.DB.Where("event_id = ?", "evt-1").First(&delivery).Error; err != nil {
+				t.Fatalf("load delivery: %v", err)
+			}
+			if delivery.Attempts != tt.wantAttempts {
+				t.Errorf("Attempts = %d, want %d", delivery.Attempts, tt.wantAttempts)
+			}
+			if delivery.Succeeded != tt.wantSuccess {
+				t.Errorf("Succeeded = %v, want %v", delivery.Succeeded, tt.wantSuccess)
+			}
+			if want := tt.wantURL(oldServer.URL, newServer.URL); delivery.URL != want {
+				t.Errorf("URL = %q, want %q", delivery.URL, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"encoding/json"
+	"runtime/debug"
+	"strconv"
+	"verification-api/internal/models"
+	"verification-api/pkg/logging"
+	"verification-api/pkg/metrics"
+)
+
+// DedupeReplayDeliveries keeps one delivery per webhook event (event_id), the first one
+// Retries and redeliveries of an event store the same payload, so it is replayed once
+// deliveries must be ordered by created_at ascending; the result keeps that order
+func DedupeReplayDeliveries(deliveries []models.WebhookDelivery) []models.WebhookDelivery {
+	seen := make(map[string]bool, len(deliveries))
+	deduped := make([]models.WebhookDelivery, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		key := delivery.EventID
+		if key == "" {
+			key = "delivery:" + strconv.FormatUint(uint64(delivery.ID), 10)
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		deduped = append(deduped, delivery)
+	}
+	return deduped
+}
+
+// ReplayWebhooksAsync re-sends the stored payloads of failed deliveries in a new goroutine
+// Each event keeps its event_id, and the URL is chosen from endpoint by the stored environment
+// Deliveries are sequential (each with the usual retry schedule) so a recovering App Backend is not flooded
+func (wn *WebhookNotifier) ReplayWebhooksAsync(endpoint WebhookEndpoint, deliveries []models.WebhookDelivery) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logging.Errorf("Webhook replay panic recovered - url: %s, panic: %v\n%s", endpoint.URL, r, debug.Stack())
+				metrics.IncCounter("webhook_notifier_panics_total", nil)
+			}
+		}()
+
+		replayed := 0
+		for _, delivery := range deliveries {
+			var payload WebhookPayload
+			if err := json.Unmarshal([]byte(delivery.Payload), &payload); err != nil {
+				logging.Errorf("Skipping webhook replay, stored payload is invalid - delivery: %d, error: %v", delivery.ID, err)
+				continue
+			}
+			target := endpoint.ForEnvironment(delivery.Environment)
+			if target.URL == "" {
+				continue
+			}
+			wn.sendWithRetry(target, payload)
+			metrics.IncCounter("webhook_replay_total", nil)
+			replayed++
+		}
+		logging.Infof("Webhook replay finished - url: %s, events: %d", endpoint.URL, replayed)
+	}()
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Per-project webhook retry policy limits
+const (
+	MaxWebhookRetries       = 10               // Upper bound of webhook_max_retries
+	MaxWebhookBackoffBaseMs = 60000            // Upper bound of webhook_backoff_base_ms
+	webhookBackoffCap       = 10 * time.Minute // Longest wait between two attempts
+)
+
+// defaultWebhookRetryDelays is the schedule used when a project doesn't configure a retry policy
+// (3 attempts total: the first retry after 1s, the second after 5s)
+var defaultWebhookRetryDelays = []time.Duration{1 * time.Second, 5 * time.Second, 30 * time.Second}
+
+// webhookRetryPolicy describes how many times a webhook is attempted and how long to wait in between
+type webhookRetryPolicy struct {
+	attempts int           // Total attempts, including the first one
+	base     time.Duration // Exponential backoff base; 0 uses defaultWebhookRetryDelays
+}
+
+// newWebhookRetryPolicy builds the retry policy of a project
+// maxRetries: retries after the first attempt (0 = default of 2, -1 = no retries)
+// backoffBaseMs: delay before retry n is base * 2^n with jitter, capped at webhookBackoffCap (0 = default schedule,
+// or 1000ms when only maxRetries is set)
+func newWebhookRetryPolicy(maxRetries, backoffBaseMs int) webhookRetryPolicy {
+	if maxRetries == 0 && backoffBaseMs == 0 {
+		return webhookRetryPolicy{attempts: len(defaultWebhookRetryDelays)}
+	}
+
+	policy := webhookRetryPolicy{attempts: len(defaultWebhookRetryDelays), base: time.Second}
+	switch {
+	case maxRetries < 0:
+		policy.attempts = 1
+	case maxRetries > 0:
+		policy.attempts = 1 + min(maxRetries, MaxWebhookRetries)
+	}
+	if backoffBaseMs > 0 {
+		policy.base = time.Duration(min(backoffBaseMs, MaxWebhookBackoffBaseMs)) * time.Millisecond
+	}
+	return policy
+}
+
+// delay returns how long to wait after the failed attempt (0-based) before the next one
+// Exponential delays get "equal jitter" (half fixed, half random) so retries of many deliveries
+// don't all hit a recovering backend at the same moment
+func (p webhookRetryPolicy) delay(attempt int) time.Duration {
+	if p.base == 0 {
+		return defaultWebhookRetryDelays[min(attempt, len(defaultWebhookRetryDelays)-1)]
+	}
+
+	delay := webhookBackoffCap
+	if attempt < 30 {
+		delay = min(p.base<<attempt, webhookBackoffCap)
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// ValidateWebhookRetryPolicy validates webhook_max_retries and webhook_backoff_base_ms (0 means default)
+func ValidateWebhookRetryPolicy(maxRetries, backoffBaseMs int) error {
+	if maxRetries < -1 || maxRetries > MaxWebhookRetries {
+		return fmt.Errorf("webhook_max_retries must be between -1 (no retries) and %d (0 = default)", MaxWebhookRetries)
+	}
+	if backoffBaseMs < 0 || backoffBaseMs > MaxWebhookBackoffBaseMs {
+		return fmt.Errorf("webhook_backoff_base_ms must be between 0 (default) and %d", MaxWebhookBackoffBaseMs)
+	}
+	return nil
+}
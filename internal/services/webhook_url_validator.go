@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+	"verification-api/internal/config"
+)
+
+// cgnatNetwork Carrier-grade NAT 地址段 (100.64.0.0/10)
+var cgnatNetwork = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// ValidateWebhookURL 校验 webhook 回调地址
+// 要求 https（可配置允许 http），且解析后的 IP 不能是内网/回环/链路本地地址（可配置允许）
+func ValidateWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if !config.AppConfig.WebhookAllowHTTP {
+			return fmt.Errorf("webhook URL must use https")
+		}
+	default:
+		return fmt.Errorf("unsupported webhook URL scheme: %s", u.Scheme)
+	}
+
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("webhook URL host is empty")
+	}
+
+	if config.AppConfig.WebhookAllowPrivateIPs {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve webhook host %s: %w", host, err)
+	}
+	for _, ip := range ips {
+		if isDisallowedIP(ip.IP) {
+			return fmt.Errorf("webhook host %s resolves to disallowed address %s", host, ip.IP)
+		}
+	}
+
+	return nil
+}
+
+// isDisallowedIP 检查 IP 是否为内网/回环/链路本地等不允许访问的地址
+func isDisallowedIP(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() ||
+		cgnatNetwork.Contains(ip)
+}
+
+// NewWebhookHTTPClient 创建访问 App Backend 的 HTTP 客户端
+// 在建立连接时再次校验目标 IP，防止 DNS 变更（DNS rebinding）绕过 URL 校验
+func NewWebhookHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if config.AppConfig.WebhookAllowPrivateIPs {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip != nil && isDisallowedIP(ip) {
+				return fmt.Errorf("connection to disallowed address %s blocked", ip)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil // 禁用代理，确保校验的是实际连接地址
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 3 {
+				return fmt.Errorf("stopped after %d redirects", len(via))
+			}
+			if req.URL.Scheme != "https" && !config.AppConfig.WebhookAllowHTTP {
+				return fmt.Errorf("redirect to non-https URL blocked")
+			}
+			return nil
+		},
+	}
+}
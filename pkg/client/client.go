@@ -0,0 +1,282 @@
+// Package client is a small Go client for the UnionHub subscription API
+// The request / response types are defined here and aliased by the server's handlers,
+// so Go integrators can import them instead of copying them
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client calls the UnionHub API with project authentication
+type Client struct {
+	BaseURL   string // e.g. https://unionhub.example.com (including BASE_PATH if configured)
+	ProjectID string // sent as X-Project-ID
+	APIKey    string // sent as X-API-Key
+
+	HTTPClient   *http.Client
+	MaxRetries   int           // retries after the first attempt for network errors, 429 and 5xx
+	RetryBackoff time.Duration // initial backoff, doubled after each retry
+}
+
+// APIError is returned when the API responds with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("unionhub: status %d: %s", e.StatusCode, e.Message)
+}
+
+// New creates a client with default timeout and retry settings
+func New(baseURL, projectID, apiKey string) *Client {
+	return &Client{
+		BaseURL:      strings.TrimRight(baseURL, "/"),
+		ProjectID:    projectID,
+		APIKey:       apiKey,
+		HTTPClient:   &http.Client{Timeout: 30 * time.Second},
+		MaxRetries:   2,
+		RetryBackoff: 500 * time.Millisecond,
+	}
+}
+
+// VerifySubscription verifies a receipt / transaction
+// POST /api/subscription/verify
+func (c *Client) VerifySubscription(ctx context.Context, req *VerifySubscriptionRequest) (*VerifySubscriptionResponse, error) {
+	var resp VerifySubscriptionResponse
+	if err := c.do(ctx, http.MethodPost, "/api/subscription/verify", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetSubscriptionStatus gets the subscription status and owned one-time products of a user
+// GET /api/subscription/status
+func (c *Client) GetSubscriptionStatus(ctx context.Context, userID, appID, platform string) (*GetSubscriptionStatusResponse, error) {
+	query := url.Values{"user_id": {userID}, "app_id": {appID}}
+	if platform != "" {
+		query.Set("platform", platform)
+	}
+
+	var resp GetSubscriptionStatusResponse
+	if err := c.do(ctx, http.MethodGet, "/api/subscription/status", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RestoreSubscription restores purchases for a user
+// POST /api/subscription/restore
+func (c *Client) RestoreSubscription(ctx context.Context, req *RestoreSubscriptionRequest) (*RestoreSubscriptionResponse, error) {
+	var resp RestoreSubscriptionResponse
+	if err := c.do(ctx, http.MethodPost, "/api/subscription/restore", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SyncSubscriptions refreshes a user's subscriptions from Apple / Google
+// POST /api/subscription/sync
+func (c *Client) SyncSubscriptions(ctx context.Context, req *SyncSubscriptionRequest) (*SyncSubscriptionResponse, error) {
+	var resp SyncSubscriptionResponse
+	if err := c.do(ctx, http.MethodPost, "/api/subscription/sync", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GenerateOfferSignature signs an App Store promotional offer
+// POST /api/subscription/offer-signature
+func (c *Client) GenerateOfferSignature(ctx context.Context, req *OfferSignatureRequest) (*OfferSignatureResponse, error) {
+	var resp OfferSignatureResponse
+	if err := c.do(ctx, http.MethodPost, "/api/subscription/offer-signature", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// BindAccount binds a user_id to a subscription
+// POST /api/subscription/bind_account
+func (c *Client) BindAccount(ctx context.Context, req *BindAccountRequest) (*BindAccountResponse, error) {
+	var resp BindAccountResponse
+	if err := c.do(ctx, http.MethodPost, "/api/subscription/bind_account", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetSubscriptionHistory gets the subscription history of a user
+// GET /api/subscription/history
+func (c *Client) GetSubscriptionHistory(ctx context.Context, userID, appID, platform string) (*SubscriptionHistoryResponse, error) {
+	query := url.Values{"user_id": {userID}}
+	if appID != "" {
+		query.Set("app_id", appID)
+	}
+	if platform != "" {
+		query.Set("platform", platform)
+	}
+
+	var resp SubscriptionHistoryResponse
+	if err := c.do(ctx, http.MethodGet, "/api/subscription/history", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CheckEntitlement reports whether a user is entitled right now, optionally to a specific product
+// GET /api/subscription/entitled
+func (c *Client) CheckEntitlement(ctx context.Context, userID, appID, productID, platform string) (*EntitlementCheckResponse, error) {
+	query := url.Values{"user_id": {userID}, "app_id": {appID}}
+	if productID != "" {
+		query.Set("product_id", productID)
+	}
+	if platform != "" {
+		query.Set("platform", platform)
+	}
+
+	var resp EntitlementCheckResponse
+	if err := c.do(ctx, http.MethodGet, "/api/subscription/entitled", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetSubscriptionByTransaction looks up a subscription by transaction_id
+// GET /api/subscription/by-transaction
+func (c *Client) GetSubscriptionByTransaction(ctx context.Context, transactionID, appID, platform string) (*SubscriptionByTransactionResponse, error) {
+	query := url.Values{"transaction_id": {transactionID}, "app_id": {appID}}
+	if platform != "" {
+		query.Set("platform", platform)
+	}
+
+	var resp SubscriptionByTransactionResponse
+	if err := c.do(ctx, http.MethodGet, "/api/subscription/by-transaction", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// do sends the request with retries and decodes the JSON response into out
+// POST requests carry an Idempotency-Key that stays the same across retries, so the server
+// returns the stored response instead of processing a request twice
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{}, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("unionhub: failed to encode request: %w", err)
+		}
+	}
+
+	endpoint := c.BaseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	idempotencyKey := ""
+	if method == http.MethodPost {
+		idempotencyKey = newIdempotencyKey()
+	}
+
+	backoff := c.RetryBackoff
+	var lastErr error
+	for attempt := 0; attempt <= c.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		retry, err := c.attempt(ctx, method, endpoint, payload, idempotencyKey, out)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry {
+			return err
+		}
+	}
+	return lastErr
+}
+
+// attempt sends a single request, reporting whether a failure is retryable
+func (c *Client) attempt(ctx context.Context, method, endpoint string, payload []byte, idempotencyKey string, out interface{}) (bool, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return false, fmt.Errorf("unionhub: failed to create request: %w", err)
+	}
+	req.Header.Set("X-Project-ID", c.ProjectID)
+	req.Header.Set("X-API-Key", c.APIKey)
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		// Network errors are retryable unless the context is done
+		return ctx.Err() == nil, fmt.Errorf("unionhub: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return true, fmt.Errorf("unionhub: failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := &APIError{StatusCode: resp.StatusCode, Message: errorMessage(data)}
+		// 409: the first attempt with this Idempotency-Key is still being processed
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 ||
+			(resp.StatusCode == http.StatusConflict && idempotencyKey != "")
+		return retry, apiErr
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return false, fmt.Errorf("unionhub: failed to decode response: %w", err)
+		}
+	}
+	return false, nil
+}
+
+// errorMessage extracts the "message" field from an error response
+func errorMessage(data []byte) string {
+	var body struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(data, &body) == nil && body.Message != "" {
+		return body.Message
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// newIdempotencyKey generates a random idempotency key
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,206 @@
+package client
+
+import "time"
+
+// VerifySubscriptionRequest represents verify subscription request
+// Supports platform-specific fields as per industry standards
+type VerifySubscriptionRequest struct {
+	Platform  string `json:"platform" binding:"required,oneof=ios android"` // ios or android
+	UserID    string `json:"user_id" binding:"required"`                    // User ID from the app
+	ProductID string `json:"product_id" binding:"required"`                 // Product ID (required for both platforms)
+
+	// iOS specific fields
+	SignedTransaction string `json:"signed_transaction,omitempty"` // JWT signed transaction (iOS)
+	TransactionID     string `json:"transaction_id,omitempty"`     // Transaction ID (iOS)
+
+	// Optional: force App Store environment (sandbox or production), auto-detected when empty
+	// Useful for TestFlight testers whose transactions need sandbox verification
+	Environment string `json:"environment,omitempty" binding:"omitempty,oneof=sandbox production"`
+
+	// Android specific fields
+	PurchaseToken string `json:"purchase_token,omitempty"` // Purchase token (Android)
+
+	// Legacy support (deprecated, use platform-specific fields)
+	ReceiptData string `json:"receipt_data,omitempty"` // Legacy: Base64 receipt (iOS) or purchase token (Android)
+	AppID       string `json:"app_id,omitempty"`       // Legacy: Bundle ID (iOS) or Package Name (Android)
+}
+
+// VerifySubscriptionResponse represents verify subscription response
+type VerifySubscriptionResponse struct {
+	Success       bool   `json:"success"`
+	Message       string `json:"message"`
+	Code          string `json:"code,omitempty"` // Error code, e.g. transaction_too_old, PROJECT_INACTIVE
+	IsActive      bool   `json:"is_active"`
+	Platform      string `json:"platform,omitempty"`     // Platform: ios or android
+	ExpiresDate   string `json:"expires_date,omitempty"` // ISO 8601 format
+	ProductID     string `json:"product_id,omitempty"`
+	AutoRenew     bool   `json:"auto_renew,omitempty"`
+	Plan          string `json:"plan,omitempty"`           // Plan resolved from product_id (project plan strategy)
+	BillingPeriod string `json:"billing_period,omitempty"` // ISO 8601 billing period, e.g. P1W, P1M, P3M, P1Y
+
+	// Legacy support (deprecated)
+	ExpiresAt string `json:"expires_at,omitempty"` // Deprecated: use expires_date
+}
+
+// GetSubscriptionStatusResponse represents subscription status response
+type GetSubscriptionStatusResponse struct {
+	Success       bool   `json:"success"`
+	Message       string `json:"message,omitempty"`
+	Code          string `json:"code,omitempty"` // Error code, e.g. PROJECT_INACTIVE
+	IsActive      bool   `json:"is_active"`
+	Platform      string `json:"platform,omitempty"`     // Platform: ios or android
+	Status        string `json:"status,omitempty"`       // Subscription status
+	ExpiresDate   string `json:"expires_date,omitempty"` // ISO 8601 format
+	ProductID     string `json:"product_id,omitempty"`
+	AutoRenew     bool   `json:"auto_renew,omitempty"`
+	Plan          string `json:"plan,omitempty"`           // Plan resolved from product_id (project plan strategy)
+	BillingPeriod string `json:"billing_period,omitempty"` // ISO 8601 billing period, e.g. P1W, P1M, P3M, P1Y
+	RenewalCount  int    `json:"renewal_count,omitempty"`  // Successful renewals of the subscription
+
+	// One-time products (non-consumable) owned by the user
+	NonConsumables []string `json:"non_consumables,omitempty"`
+
+	// Entitlements granted by the active subscription and owned one-time products (project entitlement_mapping)
+	Entitlements []string `json:"entitlements,omitempty"`
+
+	// Legacy support (deprecated)
+	ExpiresAt string `json:"expires_at,omitempty"` // Deprecated: use expires_date
+}
+
+// RestoreTransaction represents a transaction to restore
+type RestoreTransaction struct {
+	SignedTransaction string `json:"signed_transaction,omitempty"` // JWT signed transaction (iOS)
+	TransactionID     string `json:"transaction_id,omitempty"`     // Transaction ID (iOS)
+	ProductID         string `json:"product_id,omitempty"`         // Product ID
+}
+
+// RestoreSubscriptionRequest represents restore subscription request
+// Supports two modes:
+// 1. Active restore: Client provides transaction list, UnionHub verifies each one
+// 2. Passive restore: Client only provides user_id, UnionHub looks up from database
+type RestoreSubscriptionRequest struct {
+	UserID       string               `json:"user_id" binding:"required"`                    // User ID from the app
+	AppID        string               `json:"app_id,omitempty"`                              // Bundle ID (iOS) or Package Name (Android) - optional if transactions provided
+	Platform     string               `json:"platform" binding:"required,oneof=ios android"` // ios or android
+	Transactions []RestoreTransaction `json:"transactions,omitempty"`                        // List of transactions to verify (for active restore)
+}
+
+// SubscriptionInfo represents a subscription in restore response
+type SubscriptionInfo struct {
+	IsActive      bool   `json:"is_active"`
+	Status        string `json:"status"`
+	ExpiresDate   string `json:"expires_date,omitempty"`
+	ProductID     string `json:"product_id,omitempty"`
+	AutoRenew     bool   `json:"auto_renew,omitempty"`
+	Plan          string `json:"plan,omitempty"`
+	BillingPeriod string `json:"billing_period,omitempty"`
+}
+
+// RestoreSubscriptionResponse represents restore subscription response
+type RestoreSubscriptionResponse struct {
+	Success       bool               `json:"success"`
+	Message       string             `json:"message"`
+	Code          string             `json:"code,omitempty"`          // Error code, e.g. PROJECT_INACTIVE
+	Subscriptions []SubscriptionInfo `json:"subscriptions,omitempty"` // List of all active subscriptions
+	// Legacy fields (for backward compatibility)
+	IsActive  bool   `json:"is_active,omitempty"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+	ProductID string `json:"product_id,omitempty"`
+}
+
+// SyncSubscriptionRequest represents sync subscription request
+type SyncSubscriptionRequest struct {
+	UserID   string `json:"user_id" binding:"required"`                               // User ID (appAccountToken)
+	AppID    string `json:"app_id" binding:"required"`                                // Bundle ID (iOS) or Package Name (Android)
+	Platform string `json:"platform,omitempty" binding:"omitempty,oneof=ios android"` // ios (default) or android
+}
+
+// SyncSubscriptionResponse represents sync subscription response
+type SyncSubscriptionResponse struct {
+	Success       bool               `json:"success"`
+	Message       string             `json:"message"`
+	Code          string             `json:"code,omitempty"`          // Error code, e.g. PROJECT_INACTIVE
+	Subscriptions []SubscriptionInfo `json:"subscriptions,omitempty"` // Refreshed subscriptions
+	Failed        int                `json:"failed,omitempty"`        // Number of subscriptions that could not be refreshed
+}
+
+// BindAccountRequest represents bind account request
+type BindAccountRequest struct {
+	UserID string `json:"user_id" binding:"required"` // User ID to bind
+
+	// iOS specific
+	OriginalTransactionID string `json:"original_transaction_id,omitempty"` // iOS original transaction ID
+
+	// Android specific
+	PurchaseToken string `json:"purchase_token,omitempty"` // Android purchase token
+}
+
+// BindAccountResponse represents bind account response
+type BindAccountResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// SubscriptionHistoryItem represents a subscription history item
+type SubscriptionHistoryItem struct {
+	ID                    uint      `json:"id"`
+	AppAccountToken       string    `json:"app_account_token"`
+	Platform              string    `json:"platform"`
+	Status                string    `json:"status"`
+	Plan                  string    `json:"plan,omitempty"`
+	BillingPeriod         string    `json:"billing_period,omitempty"`
+	ProductID             string    `json:"product_id"`
+	SubscriptionGroupID   string    `json:"subscription_group_id,omitempty"` // App Store subscription group; status "superseded" when another tier of the group took over
+	TransactionID         string    `json:"transaction_id"`
+	OriginalTransactionID string    `json:"original_transaction_id"`
+	PurchaseDate          time.Time `json:"purchase_date"`
+	ExpiresDate           time.Time `json:"expires_date"`
+	AutoRenew             bool      `json:"auto_renew"`
+	RenewalCount          int       `json:"renewal_count"` // Successful renewals of the subscription
+	CreatedAt             time.Time `json:"created_at"`
+	UpdatedAt             time.Time `json:"updated_at"`
+}
+
+// SubscriptionHistoryResponse represents subscription history response
+type SubscriptionHistoryResponse struct {
+	Success       bool                      `json:"success"`
+	Message       string                    `json:"message,omitempty"`
+	Code          string                    `json:"code,omitempty"` // Error code, e.g. PROJECT_INACTIVE
+	Subscriptions []SubscriptionHistoryItem `json:"subscriptions,omitempty"`
+}
+
+// EntitlementCheckResponse represents the lightweight entitlement check response
+type EntitlementCheckResponse struct {
+	Success     bool   `json:"success"`
+	Message     string `json:"message,omitempty"`
+	Code        string `json:"code,omitempty"`         // Error code, e.g. PROJECT_INACTIVE
+	Entitled    bool   `json:"entitled"`               // The user has an active, unexpired subscription (to product_id when given)
+	ExpiresDate string `json:"expires_date,omitempty"` // Latest expiry of the matching active subscriptions (entitled only)
+}
+
+// SubscriptionByTransactionResponse represents subscription lookup by transaction_id response
+type SubscriptionByTransactionResponse struct {
+	Success      bool                     `json:"success"`
+	Message      string                   `json:"message,omitempty"`
+	Code         string                   `json:"code,omitempty"` // Error code, e.g. PROJECT_INACTIVE
+	IsActive     bool                     `json:"is_active"`      // Status is active and not yet expired
+	Subscription *SubscriptionHistoryItem `json:"subscription,omitempty"`
+}
+
+// OfferSignatureRequest represents promotional offer signature request
+type OfferSignatureRequest struct {
+	ProductID       string `json:"product_id" binding:"required"`        // Subscription product ID
+	OfferID         string `json:"offer_id" binding:"required"`          // Promotional offer ID configured in App Store Connect
+	AppAccountToken string `json:"app_account_token" binding:"required"` // appAccountToken / applicationUsername used for the purchase
+}
+
+// OfferSignatureResponse represents promotional offer signature response
+// Pass the fields to SKPaymentDiscount / Product.PurchaseOption.promotionalOffer
+type OfferSignatureResponse struct {
+	Success   bool   `json:"success"`
+	Message   string `json:"message,omitempty"`
+	KeyID     string `json:"key_id,omitempty"`
+	Nonce     string `json:"nonce,omitempty"`
+	Timestamp int64  `json:"timestamp,omitempty"` // Milliseconds since epoch
+	Signature string `json:"signature,omitempty"` // Base64 encoded ECDSA signature
+}
@@ -3,26 +3,76 @@ package logging
 import (
 	"log"
 	"os"
+	"strings"
+)
+
+// Log levels
+const (
+	LevelDebug = iota
+	LevelInfo
+	LevelWarn
+	LevelError
 )
 
 var (
+	DebugLogger *log.Logger
 	InfoLogger  *log.Logger
+	WarnLogger  *log.Logger
 	ErrorLogger *log.Logger
+
+	// level is the minimum level that will be logged
+	level = LevelInfo
 )
 
 // InitLogging initializes logging
 func InitLogging() {
+	DebugLogger = log.New(os.Stdout, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile)
 	InfoLogger = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
+	WarnLogger = log.New(os.Stdout, "WARN: ", log.Ldate|log.Ltime|log.Lshortfile)
 	ErrorLogger = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
 }
 
+// SetLevel sets the minimum log level (debug, info, warn, error)
+// Unknown values fall back to info
+func SetLevel(name string) {
+	switch strings.ToLower(name) {
+	case "debug":
+		level = LevelDebug
+	case "warn", "warning":
+		level = LevelWarn
+	case "error":
+		level = LevelError
+	default:
+		level = LevelInfo
+	}
+}
+
+// IsDebugEnabled reports whether debug level messages are logged
+func IsDebugEnabled() bool {
+	return level <= LevelDebug
+}
+
+// Debugf logs debug level messages
+func Debugf(format string, v ...interface{}) {
+	if DebugLogger != nil && level <= LevelDebug {
+		DebugLogger.Printf(format, v...)
+	}
+}
+
 // Infof logs info level messages
 func Infof(format string, v ...interface{}) {
-	if InfoLogger != nil {
+	if InfoLogger != nil && level <= LevelInfo {
 		InfoLogger.Printf(format, v...)
 	}
 }
 
+// Warnf logs warning level messages
+func Warnf(format string, v ...interface{}) {
+	if WarnLogger != nil && level <= LevelWarn {
+		WarnLogger.Printf(format, v...)
+	}
+}
+
 // Errorf logs error level messages
 func Errorf(format string, v ...interface{}) {
 	if ErrorLogger != nil {
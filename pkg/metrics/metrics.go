@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// counter represents a labeled counter
+type counter struct {
+	name   string
+	labels string // Formatted as {k="v",...}
+	value  uint64
+}
+
+// gauge represents a labeled gauge
+type gauge struct {
+	name   string
+	labels string // Formatted as {k="v",...}
+	value  float64
+}
+
+var (
+	mutex    sync.Mutex
+	counters = make(map[string]*counter)
+	gauges   = make(map[string]*gauge)
+)
+
+// IncCounter increments a counter identified by name and labels
+func IncCounter(name string, labels map[string]string) {
+	AddCounter(name, labels, 1)
+}
+
+// AddCounter adds delta to a counter identified by name and labels
+func AddCounter(name string, labels map[string]string, delta uint64) {
+	formatted := formatLabels(labels)
+	key := name + formatted
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	c, exists := counters[key]
+	if !exists {
+		c = &counter{name: name, labels: formatted}
+		counters[key] = c
+	}
+	c.value += delta
+}
+
+// GetCounter returns the current value of a counter
+func GetCounter(name string, labels map[string]string) uint64 {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if c, exists := counters[name+formatLabels(labels)]; exists {
+		return c.value
+	}
+	return 0
+}
+
+// SetGauge sets a gauge identified by name and labels
+func SetGauge(name string, labels map[string]string, value float64) {
+	formatted := formatLabels(labels)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	gauges[name+formatted] = &gauge{name: name, labels: formatted, value: value}
+}
+
+// WritePrometheus writes all counters and gauges in Prometheus text exposition format
+func WritePrometheus(w io.Writer) {
+	mutex.Lock()
+	snapshot := make([]counter, 0, len(counters))
+	for _, c := range counters {
+		snapshot = append(snapshot, *c)
+	}
+	gaugeSnapshot := make([]gauge, 0, len(gauges))
+	for _, g := range gauges {
+		gaugeSnapshot = append(gaugeSnapshot, *g)
+	}
+	mutex.Unlock()
+
+	sort.Slice(snapshot, func(i, j int) bool {
+		if snapshot[i].name != snapshot[j].name {
+			return snapshot[i].name < snapshot[j].name
+		}
+		return snapshot[i].labels < snapshot[j].labels
+	})
+
+	lastName := ""
+	for _, c := range snapshot {
+		if c.name != lastName {
+			fmt.Fprintf(w, "# TYPE %s counter\n", c.name)
+			lastName = c.name
+		}
+		fmt.Fprintf(w, "%s%s %d\n", c.name, c.labels, c.value)
+	}
+
+	sort.Slice(gaugeSnapshot, func(i, j int) bool {
+		if gaugeSnapshot[i].name != gaugeSnapshot[j].name {
+			return gaugeSnapshot[i].name < gaugeSnapshot[j].name
+		}
+		return gaugeSnapshot[i].labels < gaugeSnapshot[j].labels
+	})
+
+	lastName = ""
+	for _, g := range gaugeSnapshot {
+		if g.name != lastName {
+			fmt.Fprintf(w, "# TYPE %s gauge\n", g.name)
+			lastName = g.name
+		}
+		fmt.Fprintf(w, "%s%s %g\n", g.name, g.labels, g.value)
+	}
+}
+
+// formatLabels formats labels in a stable order
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[k])
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, k, value))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
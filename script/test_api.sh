@@ -7,6 +7,7 @@ TEST_EMAIL="test@example.com"
 TEST_CODE="123456"
 PROJECT_ID="default"
 API_KEY="default-api-key"
+ADMIN_KEY="${ADMIN_KEY:-admin-key}" # key part of an ADMIN_API_KEYS entry
 
 echo "📧 Test Email: $TEST_EMAIL"
 echo "🔢 Test Code: $TEST_CODE"
@@ -21,12 +22,12 @@ echo ""
 
 # 2. Get project list
 echo "2️⃣ Get Project List..."
-curl -s -X GET "$API_BASE_URL/api/admin/projects" | jq .
+curl -s -X GET "$API_BASE_URL/api/admin/projects" -H "X-Admin-Key: $ADMIN_KEY" | jq .
 echo ""
 
 # 2.1. Get project stats (admin)
 echo "2.1️⃣ Get Project Stats (Admin)..."
-curl -s -X GET "$API_BASE_URL/api/admin/projects/$PROJECT_ID/stats" | jq .
+curl -s -X GET "$API_BASE_URL/api/admin/projects/$PROJECT_ID/stats" -H "X-Admin-Key: $ADMIN_KEY" | jq .
 echo ""
 
 # 3. Send verification code